@@ -0,0 +1,183 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vburojevic/instapaper-cli/internal/aggregate"
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+	"github.com/vburojevic/instapaper-cli/internal/output"
+)
+
+// aggregateFlags holds --sort, --group-by, --count and --stats, shared by
+// list and export.
+type aggregateFlags struct {
+	sortSpec string
+	groupBy  string
+	count    bool
+	stats    bool
+
+	sort aggregate.Sort
+}
+
+func (f *aggregateFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.sortSpec, "sort", "", "Sort by "+strings.Join(aggregate.SortFields, "|")+"[:desc] (comma-separated keys)")
+	fs.StringVar(&f.groupBy, "group-by", "", "Group by "+strings.Join(aggregate.GroupFields, "|"))
+	fs.BoolVar(&f.count, "count", false, "Print counts instead of bookmarks (per group with --group-by)")
+	fs.BoolVar(&f.stats, "stats", false, "Print summary statistics instead of bookmarks (per group with --group-by)")
+}
+
+// validate parses --sort and rejects combinations that cannot be printed.
+func (f *aggregateFlags) validate(opts *GlobalOptions, fields string) error {
+	s, err := aggregate.ParseSort(f.sortSpec)
+	if err != nil {
+		return err
+	}
+	f.sort = s
+	f.groupBy = strings.ToLower(strings.TrimSpace(f.groupBy))
+	if f.groupBy != "" && !aggregate.ValidGroupBy(f.groupBy) {
+		return fmt.Errorf("invalid --group-by %q (expected %s)", f.groupBy, strings.Join(aggregate.GroupFields, ", "))
+	}
+	if f.count && f.stats {
+		return fmt.Errorf("use only one of --count or --stats")
+	}
+	if f.active() && fields != "" {
+		return fmt.Errorf("--fields cannot be used with --group-by, --count or --stats")
+	}
+	if f.active() && opts.tmpl != nil {
+		return fmt.Errorf("--template cannot be used with --group-by, --count or --stats")
+	}
+	return nil
+}
+
+// active reports whether output is grouped or aggregated rather than a
+// plain bookmark listing.
+func (f *aggregateFlags) active() bool {
+	return f.groupBy != "" || f.count || f.stats
+}
+
+// apply regroups by --group-by, then sorts. Without --group-by (or with
+// folder) each folder is sorted on its own and keeps its place; otherwise the
+// regrouped bookmarks are sorted across folders and the groups follow their
+// first bookmark.
+func (f *aggregateFlags) apply(groups []output.BookmarkGroup) []output.BookmarkGroup {
+	if f.groupBy == "" || f.groupBy == "folder" {
+		for _, g := range groups {
+			f.sort.Apply(g.Bookmarks)
+		}
+		return groups
+	}
+	groups = aggregate.Regroup(f.groupBy, groups)
+	f.sort.ApplyGroups(groups)
+	return groups
+}
+
+// write prints groups as counts, stats or grouped bookmarks. Without
+// --group-by, counts and stats cover all bookmarks together.
+func (f *aggregateFlags) write(w io.Writer, format string, groups []output.BookmarkGroup) error {
+	groups = f.apply(groups)
+	if !f.count && !f.stats {
+		return output.PrintBookmarkGroups(w, format, groups)
+	}
+	if f.groupBy == "" {
+		var all []instapaper.Bookmark
+		for _, g := range groups {
+			all = append(all, g.Bookmarks...)
+		}
+		groups = []output.BookmarkGroup{{Bookmarks: all}}
+	}
+	stats := make([]aggregate.Stats, 0, len(groups))
+	for _, g := range groups {
+		stats = append(stats, aggregate.Summarize(g.Folder, g.Bookmarks))
+	}
+	if f.count {
+		return printCounts(w, format, f.groupBy != "", stats)
+	}
+	return printStats(w, format, f.groupBy != "", stats)
+}
+
+type groupCount struct {
+	Group string `json:"group,omitempty"`
+	Count int    `json:"count"`
+}
+
+func printCounts(w io.Writer, format string, grouped bool, stats []aggregate.Stats) error {
+	counts := make([]groupCount, 0, len(stats))
+	for _, s := range stats {
+		counts = append(counts, groupCount{Group: s.Group, Count: s.Count})
+	}
+	switch {
+	case strings.EqualFold(format, "json") && !grouped:
+		return writeJSONByFormat(w, format, counts[0])
+	case strings.EqualFold(format, "json"):
+		return writeJSONByFormat(w, format, counts)
+	case isNDJSONFormat(format):
+		for _, c := range counts {
+			if err := writeJSONByFormat(w, format, c); err != nil {
+				return err
+			}
+		}
+		return nil
+	case !grouped:
+		_, err := fmt.Fprintln(w, counts[0].Count)
+		return err
+	case strings.EqualFold(format, "plain"):
+		for _, c := range counts {
+			fmt.Fprintf(w, "%s\t%d\n", c.Group, c.Count)
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "GROUP\tCOUNT")
+	for _, c := range counts {
+		fmt.Fprintf(tw, "%s\t%d\n", c.Group, c.Count)
+	}
+	return tw.Flush()
+}
+
+func printStats(w io.Writer, format string, grouped bool, stats []aggregate.Stats) error {
+	switch {
+	case strings.EqualFold(format, "json") && !grouped:
+		return writeJSONByFormat(w, format, stats[0])
+	case strings.EqualFold(format, "json"):
+		return writeJSONByFormat(w, format, stats)
+	case isNDJSONFormat(format):
+		for _, s := range stats {
+			if err := writeJSONByFormat(w, format, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	case strings.EqualFold(format, "plain"):
+		for _, s := range stats {
+			if grouped {
+				fmt.Fprintf(w, "%s\t", s.Group)
+			}
+			fmt.Fprintf(w, "%d\t%d\t%d\t%.4f\t%d\t%d\t%d\t%d\n", s.Count, s.Starred, s.Started, s.AvgProgress, s.Oldest, s.Newest, s.Domains, s.Tags)
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	if grouped {
+		fmt.Fprint(tw, "GROUP\t")
+	}
+	fmt.Fprintln(tw, "COUNT\tSTARRED\tSTARTED\tAVG PROG\tOLDEST\tNEWEST\tDOMAINS\tTAGS")
+	for _, s := range stats {
+		if grouped {
+			fmt.Fprintf(tw, "%s\t", s.Group)
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%.2f\t%s\t%s\t%d\t%d\n", s.Count, s.Starred, s.Started, s.AvgProgress, statsDate(s.Oldest), statsDate(s.Newest), s.Domains, s.Tags)
+	}
+	return tw.Flush()
+}
+
+func statsDate(unix int64) string {
+	if unix == 0 {
+		return "-"
+	}
+	return time.Unix(unix, 0).UTC().Format("2006-01-02")
+}
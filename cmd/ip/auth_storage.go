@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/vburojevic/instapaper-cli/internal/config"
+)
+
+// runAuthStorage shows or changes where secrets are kept, moving the
+// secrets of every profile to the new store.
+func runAuthStorage(args []string, opts *GlobalOptions, cfg *config.Config, cfgPath string, stdout, stderr io.Writer) int {
+	args = reorderFlags(args)
+	fs := flag.NewFlagSet("auth storage", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var help bool
+	var helper string
+	fs.BoolVar(&help, "help", false, "Show help")
+	fs.BoolVar(&help, "h", false, "Show help")
+	fs.StringVar(&helper, "helper", "", "Credential helper command for the helper store (e.g. \"git credential-osxkeychain\")")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if help {
+		printFlagUsage(stdout, usageAuthStorage(), fs)
+		return 0
+	}
+	if fs.NArg() > 1 {
+		return printUsageError(stderr, "usage: ip auth storage [file|encrypted|helper --helper <cmd>]")
+	}
+	if fs.NArg() == 0 {
+		kind := cfg.CredentialStore
+		if cfg.StoresSecretsInFile() {
+			kind = config.CredentialStoreFile
+		}
+		payload := map[string]any{"credential_store": kind}
+		if cfg.CredentialHelper != "" {
+			payload["credential_helper"] = cfg.CredentialHelper
+		}
+		if strings.EqualFold(opts.Format, "json") || isNDJSONFormat(opts.Format) {
+			if err := writeJSONByFormat(stdout, opts.Format, payload); err != nil {
+				return printError(stderr, err)
+			}
+			return 0
+		}
+		if cfg.CredentialHelper != "" {
+			fmt.Fprintf(stdout, "%s (%s)\n", kind, cfg.CredentialHelper)
+		} else {
+			fmt.Fprintln(stdout, kind)
+		}
+		return 0
+	}
+	kind := strings.ToLower(fs.Arg(0))
+	if err := config.ValidateCredentialStore(kind, helper); err != nil {
+		return printUsageError(stderr, err.Error())
+	}
+	if helper != "" && kind != config.CredentialStoreHelper {
+		return printUsageError(stderr, "--helper is only used with the helper store")
+	}
+	if opts.DryRun {
+		fmt.Fprintf(stdout, "Would move credentials to the %s store\n", kind)
+		return 0
+	}
+	if err := cfg.MigrateCredentials(cfgPath, kind, helper); err != nil {
+		return printError(stderr, err)
+	}
+	if !opts.Quiet {
+		fmt.Fprintf(stdout, "Credentials stored in the %s store\n", kind)
+	}
+	return 0
+}
+
+func usageAuthStorage() string {
+	return "Usage:\n  ip auth storage\n  ip auth storage file|encrypted\n  ip auth storage helper --helper <cmd>\n"
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/vburojevic/instapaper-cli/internal/bulk"
+)
+
+// exitInterrupted is the exit code of a bulk command stopped with Ctrl-C.
+const exitInterrupted = 130
+
+// addConcurrencyFlag registers --concurrency on a bulk command.
+func addConcurrencyFlag(fs *flag.FlagSet, v *int) {
+	fs.IntVar(v, "concurrency", 1, "Number of items to process in parallel (see --rate to stay under API limits)")
+}
+
+// bulkOptions maps the bulk flags to executor options. --batch keeps its
+// meaning: pause for --retry-backoff after every N items.
+func bulkOptions(opts *GlobalOptions, concurrency, batch int) bulk.Options {
+	o := bulk.Options{Concurrency: concurrency, BatchSize: batch}
+	if batch > 0 {
+		o.BatchPause = opts.RetryBackoff
+	}
+	return o
+}
+
+// interruptible returns a context that is cancelled on SIGINT, so a bulk
+// command stops starting new items and reports what completed.
+func interruptible(ctx context.Context) (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(ctx, os.Interrupt)
+}
+
+// bulkExit reports an interrupted run on stderr and picks the exit code.
+func bulkExit(stderr io.Writer, action string, sum bulk.Summary, exit int) int {
+	if !sum.Cancelled {
+		return exit
+	}
+	writeErrorLine(stderr, fmt.Errorf("%s interrupted: %d of %d completed (%d failed, %d not started)",
+		action, sum.Succeeded+sum.Failed, sum.Total, sum.Failed, sum.NotStarted))
+	return exitInterrupted
+}
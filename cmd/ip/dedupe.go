@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/vburojevic/instapaper-cli/internal/config"
+	"github.com/vburojevic/instapaper-cli/internal/dedupe"
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+)
+
+// dedupeEntry is one bookmark of a duplicate group. With --apply, Action is
+// keep for the bookmark the strategy keeps and archive or delete for the
+// others.
+type dedupeEntry struct {
+	BookmarkID int64   `json:"bookmark_id"`
+	Folder     string  `json:"folder"`
+	URL        string  `json:"url"`
+	Title      string  `json:"title,omitempty"`
+	Time       int64   `json:"time,omitempty"`
+	Progress   float64 `json:"progress"`
+	Action     string  `json:"action,omitempty"`
+	Status     string  `json:"status,omitempty"`
+	Error      string  `json:"error,omitempty"`
+
+	folderID string
+}
+
+type dedupeGroup struct {
+	Key       string        `json:"key"`
+	Bookmarks []dedupeEntry `json:"bookmarks"`
+}
+
+type dedupeReport struct {
+	DryRun     bool          `json:"dry_run"`
+	Strategy   string        `json:"strategy,omitempty"`
+	Action     string        `json:"action,omitempty"`
+	Scanned    int           `json:"scanned"`
+	Duplicates int           `json:"duplicates"`
+	Applied    int           `json:"applied"`
+	Failed     int           `json:"failed"`
+	Skipped    int           `json:"skipped"`
+	Groups     []dedupeGroup `json:"groups"`
+}
+
+// dedupeSource is a list folder id and its display title.
+type dedupeSource struct {
+	id    string
+	title string
+}
+
+func runDedupe(ctx context.Context, args []string, opts *GlobalOptions, cfg *config.Config, stdout, stderr io.Writer) int {
+	args = reorderFlags(args)
+	fs := flag.NewFlagSet("dedupe", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var help bool
+	var folder string
+	var strategy string
+	var action string
+	var allowDelete bool
+	var maxDeletes int
+	var maxPages int
+	var progressJSON bool
+	fs.BoolVar(&help, "help", false, "Show help")
+	fs.BoolVar(&help, "h", false, "Show help")
+	fs.StringVar(&folder, "folder", "all", "Folder to scan: all|unread|starred|archive|<id>|\"Title\"")
+	fs.StringVar(&strategy, "apply", "", "Resolve each group, keeping one bookmark: keep-oldest|keep-most-progress")
+	fs.StringVar(&action, "action", "archive", "With --apply, what to do with the other bookmarks: archive|delete")
+	fs.BoolVar(&allowDelete, "yes-really-delete", false, "Allow --action delete (permanent)")
+	fs.IntVar(&maxDeletes, "max-deletes", 25, "Refuse to run when more than N deletes are planned (0 = no limit)")
+	fs.IntVar(&maxPages, "max-pages", 200, "Max pages per folder")
+	fs.BoolVar(&progressJSON, "progress-json", false, "Emit progress as NDJSON on stderr")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if help {
+		printFlagUsage(stdout, usageDedupe(), fs)
+		return 0
+	}
+	if fs.NArg() > 0 {
+		return printUsageError(stderr, "dedupe does not take positional arguments")
+	}
+	if maxDeletes < 0 || maxPages < 0 {
+		return printUsageError(stderr, "--max-deletes and --max-pages must be >= 0")
+	}
+	action = strings.ToLower(strings.TrimSpace(action))
+	if action != config.ActionArchive && action != config.ActionDelete {
+		return printUsageError(stderr, fmt.Sprintf("invalid --action %q (expected archive or delete)", action))
+	}
+	if strategy != "" {
+		var err error
+		if strategy, err = dedupe.ParseStrategy(strategy); err != nil {
+			return printUsageError(stderr, err.Error())
+		}
+		if opts.Offline && !opts.DryRun {
+			return printUsageError(stderr, "dedupe --apply needs the API; use --dry-run to preview against the local store")
+		}
+	}
+
+	var client *instapaper.Client
+	if !opts.Offline {
+		var err error
+		client, _, _, err = requireClient(opts, cfg, true, stderr)
+		if err != nil {
+			return printError(stderr, err)
+		}
+	}
+	bookmarks, sources, err := listDedupeBookmarks(ctx, opts, client, folder, maxPages)
+	if err != nil {
+		return printError(stderr, err)
+	}
+	report := planDedupe(bookmarks, sources, strategy, action)
+	report.DryRun = opts.DryRun
+	verbosef(opts, stderr, "dedupe: scanned=%d groups=%d duplicates=%d", report.Scanned, len(report.Groups), report.Duplicates)
+
+	exit := 0
+	if strategy != "" {
+		pending := 0
+		for _, g := range report.Groups {
+			for _, e := range g.Bookmarks {
+				if e.Status == "planned" {
+					pending++
+				}
+			}
+		}
+		if !opts.DryRun && action == config.ActionDelete && pending > 0 {
+			if !allowDelete {
+				return printUsageError(stderr, fmt.Sprintf("refusing: dedupe would delete %d bookmark(s); rerun with --yes-really-delete (preview with --dry-run)", pending))
+			}
+			if maxDeletes > 0 && pending > maxDeletes {
+				return printError(stderr, fmt.Errorf("refusing: dedupe would delete %d bookmarks, more than --max-deletes %d", pending, maxDeletes))
+			}
+		}
+		if !opts.DryRun {
+			exit = applyDedupe(ctx, opts, client, &report, pending, progressJSON, stderr)
+		}
+	}
+	if err := writeDedupeReport(stdout, opts, report); err != nil {
+		return printError(stderr, err)
+	}
+	return exit
+}
+
+// listDedupeBookmarks lists folder, or with "all" Unread, Archive and every
+// user folder, returning each bookmark with the folder it was found in.
+// Starred is a view over the other folders and only scanned when asked for.
+func listDedupeBookmarks(ctx context.Context, opts *GlobalOptions, client *instapaper.Client, folder string, maxPages int) ([]instapaper.Bookmark, []dedupeSource, error) {
+	var sources []dedupeSource
+	if strings.EqualFold(folder, "all") {
+		sources = []dedupeSource{{"unread", "Unread"}, {"archive", "Archive"}}
+		if opts.Offline {
+			st, err := openSyncedStore(opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, f := range st.Folders {
+				id := strconv.FormatInt(int64(f.FolderID), 10)
+				sources = append(sources, dedupeSource{id, st.FolderTitle(id)})
+			}
+		} else {
+			folders, err := client.ListFolders(ctx)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, f := range folders {
+				sources = append(sources, dedupeSource{strconv.FormatInt(int64(f.FolderID), 10), f.Title})
+			}
+		}
+	} else {
+		var id string
+		if opts.Offline {
+			var err error
+			if id, err = resolveOfflineFolderID(opts, folder); err != nil {
+				return nil, nil, err
+			}
+		} else {
+			var err error
+			if id, err = resolveListFolderID(ctx, client, folder); err != nil {
+				return nil, nil, err
+			}
+		}
+		title, err := exportFolderTitle(ctx, opts, client, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		sources = []dedupeSource{{id, title}}
+	}
+
+	var bookmarks []instapaper.Bookmark
+	var from []dedupeSource
+	for _, src := range sources {
+		var page []instapaper.Bookmark
+		if opts.Offline {
+			var err error
+			if page, err = offlineBookmarks(opts, src.id, "", 0); err != nil {
+				return nil, nil, err
+			}
+		} else {
+			resp, err := listBookmarks(ctx, client, listBookmarksParams{Limit: 0, FolderID: src.id, MaxPages: maxPages})
+			if err != nil {
+				return nil, nil, fmt.Errorf("list %s: %w", src.title, err)
+			}
+			page = resp.Bookmarks
+		}
+		for _, b := range page {
+			bookmarks = append(bookmarks, b)
+			from = append(from, src)
+		}
+	}
+	return bookmarks, from, nil
+}
+
+// planDedupe groups the bookmarks and, with a strategy, marks the bookmark
+// to keep first in each group and the others as planned. Archiving a
+// duplicate that is already in Archive is skipped.
+func planDedupe(bookmarks []instapaper.Bookmark, sources []dedupeSource, strategy, action string) dedupeReport {
+	report := dedupeReport{Scanned: len(bookmarks), Groups: []dedupeGroup{}}
+	if strategy != "" {
+		report.Strategy, report.Action = strategy, action
+	}
+	for _, idx := range dedupe.Group(bookmarks) {
+		keep := idx[0]
+		if strategy != "" {
+			keep = dedupe.Keep(strategy, bookmarks, idx)
+		}
+		g := dedupeGroup{Key: dedupe.Canonical(bookmarks[keep].URL)}
+		order := append([]int{keep}, idx...)
+		for n, i := range order {
+			if n > 0 && i == keep {
+				continue
+			}
+			b := bookmarks[i]
+			e := dedupeEntry{
+				BookmarkID: int64(b.BookmarkID),
+				Folder:     sources[i].title,
+				URL:        b.URL,
+				Title:      b.Title,
+				Time:       int64(b.Time),
+				Progress:   float64(b.Progress),
+				folderID:   sources[i].id,
+			}
+			switch {
+			case strategy == "":
+			case i == keep:
+				e.Action = "keep"
+			case action == config.ActionArchive && e.folderID == "archive":
+				e.Action, e.Status = action, "skipped"
+			default:
+				e.Action, e.Status = action, "planned"
+			}
+			g.Bookmarks = append(g.Bookmarks, e)
+		}
+		report.Duplicates += len(idx) - 1
+		report.Groups = append(report.Groups, g)
+	}
+	for _, g := range report.Groups {
+		for _, e := range g.Bookmarks {
+			if e.Status == "skipped" {
+				report.Skipped++
+			}
+		}
+	}
+	return report
+}
+
+// applyDedupe archives or deletes the planned duplicates. Archives are
+// recorded in the undo log.
+func applyDedupe(ctx context.Context, opts *GlobalOptions, client *instapaper.Client, report *dedupeReport, total int, progressJSON bool, stderr io.Writer) int {
+	ctx, stop := interruptible(ctx)
+	defer stop()
+	emitter := newProgressEmitter(progressJSON, stderr, "dedupe", total)
+	emitter.Start()
+	undoRec := newUndoRecorder(opts, "archive")
+	exit := 0
+	for gi := range report.Groups {
+		for i := range report.Groups[gi].Bookmarks {
+			e := &report.Groups[gi].Bookmarks[i]
+			if e.Status != "planned" {
+				continue
+			}
+			meta := map[string]any{"action": e.Action, "bookmark_id": e.BookmarkID}
+			var err error
+			var bm instapaper.Bookmark
+			if e.Action == config.ActionDelete {
+				err = client.DeleteBookmark(ctx, e.BookmarkID)
+			} else {
+				undoRec.Known(e.BookmarkID, instapaper.Bookmark{BookmarkID: instapaper.Int64(e.BookmarkID)}, e.folderID)
+				bm, err = client.Archive(ctx, e.BookmarkID)
+				if err == nil {
+					undoRec.Add(e.BookmarkID, bm, "")
+				}
+			}
+			if err != nil && opts.Idempotent && isAlreadyStateError(err) {
+				err = nil
+			}
+			if err != nil {
+				e.Status, e.Error = "error", err.Error()
+				report.Failed++
+				if code := exitCodeForError(err); code > exit {
+					exit = code
+				}
+				emitter.ItemError(meta, err)
+				writeErrorLine(stderr, fmt.Errorf("dedupe: %s %d: %v", e.Action, e.BookmarkID, err))
+				continue
+			}
+			e.Status = "ok"
+			report.Applied++
+			emitter.ItemSuccess(meta)
+		}
+	}
+	emitter.Done()
+	undoRec.Save(stderr)
+	return exit
+}
+
+func writeDedupeReport(w io.Writer, opts *GlobalOptions, report dedupeReport) error {
+	switch {
+	case strings.EqualFold(opts.Format, "json"):
+		return writeJSONByFormat(w, opts.Format, report)
+	case isNDJSONFormat(opts.Format):
+		for _, g := range report.Groups {
+			if err := writeJSONByFormat(w, opts.Format, g); err != nil {
+				return err
+			}
+		}
+		return nil
+	case opts.Quiet:
+		return nil
+	case strings.EqualFold(opts.Format, "plain"):
+		for n, g := range report.Groups {
+			for _, e := range g.Bookmarks {
+				fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\t%s\n", n+1, e.BookmarkID, dashIfEmpty(e.Action), dashIfEmpty(e.Status), e.Folder, e.URL)
+			}
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "GROUP\tID\tFOLDER\tACTION\tSTATUS\tPROGRESS\tTITLE")
+	for n, g := range report.Groups {
+		for _, e := range g.Bookmarks {
+			fmt.Fprintf(tw, "%d\t%d\t%s\t%s\t%s\t%.2f\t%s\n", n+1, e.BookmarkID, e.Folder, dashIfEmpty(e.Action), dashIfEmpty(e.Status), e.Progress, ruleTitle(e.Title))
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "scanned=%d groups=%d duplicates=%d applied=%d failed=%d skipped=%d\n", report.Scanned, len(report.Groups), report.Duplicates, report.Applied, report.Failed, report.Skipped)
+	return err
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// savedSet holds the canonical URLs of the account for --skip-existing.
+// URLs added during the run join it only after the add succeeded, so a
+// failed add does not hide later repeats. It is safe for concurrent use.
+type savedSet struct {
+	mu    sync.Mutex
+	ids   map[string]int64
+	added map[string]bool
+	locks map[string]*sync.Mutex
+}
+
+// loadSavedSet lists every bookmark in Unread, Archive and the user folders.
+func loadSavedSet(ctx context.Context, opts *GlobalOptions, client *instapaper.Client) (*savedSet, error) {
+	bookmarks, _, err := listDedupeBookmarks(ctx, opts, client, "all", 200)
+	if err != nil {
+		return nil, err
+	}
+	s := &savedSet{ids: make(map[string]int64, len(bookmarks)), added: map[string]bool{}, locks: map[string]*sync.Mutex{}}
+	for _, b := range bookmarks {
+		s.ids[dedupe.Canonical(b.URL)] = int64(b.BookmarkID)
+	}
+	return s, nil
+}
+
+// Check reports whether u is saved by canonical URL and why.
+func (s *savedSet) Check(u string) (string, bool) {
+	key := dedupe.Canonical(u)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.ids[key]
+	switch {
+	case !ok:
+		return "", false
+	case s.added[key] && id > 0:
+		return fmt.Sprintf("duplicate in input, added as %d", id), true
+	case s.added[key]:
+		return "duplicate in input", true
+	default:
+		return fmt.Sprintf("already saved as %d", id), true
+	}
+}
+
+// Added records that u was saved in this run; id is 0 for a dry run.
+func (s *savedSet) Added(u string, id int64) {
+	key := dedupe.Canonical(u)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids[key] = id
+	s.added[key] = true
+}
+
+// Lock serialises adds of one canonical URL, so concurrent repeats wait
+// for the first to finish. It returns the unlock function.
+func (s *savedSet) Lock(u string) func() {
+	key := dedupe.Canonical(u)
+	s.mu.Lock()
+	l, ok := s.locks[key]
+	if !ok {
+		l = &sync.Mutex{}
+		s.locks[key] = l
+	}
+	s.mu.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+// skipSaved reports whether u is in saved and writes the reason to stderr
+// unless --quiet. A nil set skips nothing.
+func skipSaved(opts *GlobalOptions, stderr io.Writer, command string, saved *savedSet, u string) bool {
+	if saved == nil {
+		return false
+	}
+	reason, ok := saved.Check(u)
+	if ok && !opts.Quiet {
+		fmt.Fprintf(stderr, "%s: skipped %s (%s)\n", command, u, reason)
+	}
+	return ok
+}
+
+func usageDedupe() string {
+	return "Usage:\n  ip dedupe [--folder all|unread|archive|<id>|\"Title\"] [--max-pages N]\n  ip dedupe --apply keep-oldest|keep-most-progress [--action archive|delete] [--yes-really-delete] [--max-deletes N] [--progress-json]\n  ip --dry-run dedupe --apply keep-oldest\n\nGroups bookmarks by canonical URL (tracking parameters, http/https, www. and AMP variants folded together) and by hash.\n"
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vburojevic/instapaper-cli/internal/fakeapi"
+)
+
+// stringListFlag collects every value of a repeatable flag.
+type stringListFlag []string
+
+func (f *stringListFlag) String() string { return strings.Join(*f, ",") }
+
+func (f *stringListFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+func runDev(ctx context.Context, args []string, opts *GlobalOptions, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprintln(stdout, usageDev())
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+	switch args[0] {
+	case "server":
+		return runDevServer(ctx, args[1:], opts, stdout, stderr)
+	default:
+		return printUsageError(stderr, fmt.Sprintf("unknown dev subcommand: %s", args[0]))
+	}
+}
+
+// devServerInfo tells clients how to reach and authenticate against the
+// fake API.
+type devServerInfo struct {
+	BaseURL        string `json:"base_url"`
+	ConsumerKey    string `json:"consumer_key"`
+	ConsumerSecret string `json:"consumer_secret"`
+	Username       string `json:"username"`
+	Password       string `json:"password"`
+	Token          string `json:"oauth_token"`
+	TokenSecret    string `json:"oauth_token_secret"`
+	Bookmarks      int    `json:"bookmarks"`
+}
+
+func runDevServer(ctx context.Context, args []string, opts *GlobalOptions, stdout, stderr io.Writer) int {
+	args = reorderFlags(args)
+	fs := flag.NewFlagSet("dev server", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var help bool
+	var host string
+	var port int
+	var seed int
+	var faults stringListFlag
+	var fo fakeapi.Options
+	fs.BoolVar(&help, "help", false, "Show help")
+	fs.BoolVar(&help, "h", false, "Show help")
+	fs.StringVar(&host, "host", "127.0.0.1", "Address to listen on")
+	fs.IntVar(&port, "port", 8089, "Port to listen on (0 picks a free port)")
+	fs.IntVar(&seed, "seed", 0, "Start with N sample bookmarks")
+	fs.Var(&faults, "fail", "Inject an API error: code[:path-prefix[:times]] (repeatable)")
+	fs.StringVar(&fo.ConsumerKey, "consumer-key", fakeapi.DefaultConsumerKey, "Consumer key clients must sign with")
+	fs.StringVar(&fo.ConsumerSecret, "consumer-secret", fakeapi.DefaultConsumerSecret, "Consumer secret clients must sign with")
+	fs.StringVar(&fo.Username, "username", fakeapi.DefaultUsername, "Username accepted by auth login")
+	fs.StringVar(&fo.Password, "password", fakeapi.DefaultPassword, "Password accepted by auth login")
+	fs.StringVar(&fo.Token, "token", fakeapi.DefaultToken, "Access token accepted without logging in")
+	fs.StringVar(&fo.TokenSecret, "token-secret", fakeapi.DefaultTokenSecret, "Secret of --token")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if help {
+		printFlagUsage(stdout, usageDev(), fs)
+		return 0
+	}
+	if len(fs.Args()) != 0 {
+		return printUsageError(stderr, "usage: ip dev server [--port N] [--seed N] [--fail code[:path[:times]]]")
+	}
+	if port < 0 || port > 65535 {
+		return printUsageError(stderr, "--port must be between 0 and 65535")
+	}
+	if seed < 0 {
+		return printUsageError(stderr, "--seed must be >= 0")
+	}
+	var parsed []fakeapi.Fault
+	for _, v := range faults {
+		f, err := fakeapi.ParseFault(v)
+		if err != nil {
+			return printUsageError(stderr, err.Error())
+		}
+		parsed = append(parsed, f)
+	}
+	if !opts.Quiet {
+		var mu sync.Mutex
+		fo.Logf = func(format string, args ...any) {
+			mu.Lock()
+			defer mu.Unlock()
+			fmt.Fprintf(stderr, "dev: "+format+"\n", args...)
+		}
+	}
+
+	fake := fakeapi.New(fo)
+	fake.Seed(seed)
+	for _, f := range parsed {
+		fake.InjectFault(f)
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return printError(stderr, err)
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	srv := &http.Server{Handler: fake, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	eff := fake.Options()
+	info := devServerInfo{
+		BaseURL:        "http://" + ln.Addr().String(),
+		ConsumerKey:    eff.ConsumerKey,
+		ConsumerSecret: eff.ConsumerSecret,
+		Username:       eff.Username,
+		Password:       eff.Password,
+		Token:          eff.Token,
+		TokenSecret:    eff.TokenSecret,
+		Bookmarks:      seed,
+	}
+	if err := printDevServerInfo(stdout, opts.Format, info); err != nil {
+		return printError(stderr, err)
+	}
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return printError(stderr, err)
+	}
+	return 0
+}
+
+func printDevServerInfo(w io.Writer, format string, info devServerInfo) error {
+	if strings.EqualFold(format, "json") || isNDJSONFormat(format) {
+		return writeJSONByFormat(w, format, info)
+	}
+	fmt.Fprintf(w, "Fake Instapaper API on %s (Ctrl-C to stop)\n", info.BaseURL)
+	fmt.Fprintf(w, "Point ip at it:\n")
+	fmt.Fprintf(w, "  export INSTAPAPER_API_BASE=%s INSTAPAPER_CONSUMER_KEY=%s INSTAPAPER_CONSUMER_SECRET=%s\n", info.BaseURL, info.ConsumerKey, info.ConsumerSecret)
+	fmt.Fprintf(w, "  printf '%%s' %q | ip --config /tmp/ip-dev.json auth login --username %q --password-stdin\n", info.Password, info.Username)
+	fmt.Fprintf(w, "Inspect or script it: GET %s/_fake/state, POST /_fake/fault (code, path, times), POST /_fake/reset\n", info.BaseURL)
+	return nil
+}
+
+func usageDev() string {
+	return "Usage:\n  ip dev server [--host 127.0.0.1] [--port 8089] [--seed N] [--fail code[:path[:times]]]... [--consumer-key ...] [--consumer-secret ...] [--username ...] [--password ...]\n"
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vburojevic/instapaper-cli/internal/config"
+	"github.com/vburojevic/instapaper-cli/internal/convert"
+	"github.com/vburojevic/instapaper-cli/internal/epub"
+)
+
+type epubReport struct {
+	Out      string `json:"out"`
+	Title    string `json:"title"`
+	Chapters int    `json:"chapters"`
+	Failed   int    `json:"failed"`
+}
+
+func runEpub(ctx context.Context, args []string, opts *GlobalOptions, cfg *config.Config, stdout, stderr io.Writer) int {
+	args = reorderFlags(args)
+	fs := flag.NewFlagSet("epub", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var help bool
+	var sel bookmarkSelection
+	var outPath string
+	var title string
+	var language string
+	var progressJSON bool
+	fs.BoolVar(&help, "help", false, "Show help")
+	fs.BoolVar(&help, "h", false, "Show help")
+	sel.addFlags(fs, "unread", 20)
+	fs.StringVar(&outPath, "out", "", "Output .epub file (required)")
+	fs.StringVar(&title, "title", "", "Book title (default: Instapaper <folder> <date>)")
+	fs.StringVar(&language, "language", "en", "Book language (BCP 47)")
+	fs.BoolVar(&progressJSON, "progress-json", false, "Emit NDJSON progress events to stderr")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if help {
+		printFlagUsage(stdout, usageEpub(), fs)
+		return 0
+	}
+	if fs.NArg() > 0 {
+		return printUsageError(stderr, "epub does not take positional arguments")
+	}
+	if outPath == "" {
+		return printUsageError(stderr, "--out is required")
+	}
+	if err := sel.validate(); err != nil {
+		return printUsageError(stderr, err.Error())
+	}
+
+	bookmarks, err := sel.fetch(ctx, opts, cfg, stderr)
+	if err != nil {
+		return printError(stderr, err)
+	}
+	if len(bookmarks) == 0 {
+		return printError(stderr, fmt.Errorf("no bookmarks selected"))
+	}
+	fetch, err := textFetcher(ctx, opts, cfg, stderr)
+	if err != nil {
+		return printError(stderr, err)
+	}
+
+	now := time.Now()
+	if title == "" {
+		scope := sel.Folder
+		if sel.Tag != "" {
+			scope = "#" + sel.Tag
+		}
+		title = fmt.Sprintf("Instapaper %s %s", scope, now.Format("2006-01-02"))
+	}
+	book := &epub.Book{Title: title, Language: language, Modified: now}
+	report := epubReport{Out: outPath, Title: title}
+	exit := 0
+	emitter := newProgressEmitter(progressJSON, stderr, "epub", len(bookmarks))
+	emitter.Start()
+	for _, b := range bookmarks {
+		id := int64(b.BookmarkID)
+		html, err := fetch(id)
+		if err != nil {
+			if code := exitCodeForError(err); code > exit {
+				exit = code
+			}
+			report.Failed++
+			emitter.ItemError(map[string]any{"bookmark_id": id}, err)
+			writeErrorLine(stderr, fmt.Errorf("text %d: %v", id, err))
+			continue
+		}
+		book.Chapters = append(book.Chapters, epub.Chapter{
+			Title: b.Title,
+			URL:   b.URL,
+			Body:  convert.ToXHTML(string(html)),
+		})
+		emitter.ItemSuccess(map[string]any{"bookmark_id": id})
+	}
+	emitter.Done()
+	if len(book.Chapters) == 0 {
+		return printError(stderr, fmt.Errorf("no article text could be fetched"))
+	}
+	if err := writeEpubFile(outPath, book); err != nil {
+		return printError(stderr, err)
+	}
+	report.Chapters = len(book.Chapters)
+	verbosef(opts, stderr, "epub: chapters=%d failed=%d", report.Chapters, report.Failed)
+
+	switch {
+	case strings.EqualFold(opts.Format, "json") || isNDJSONFormat(opts.Format):
+		if err := writeJSONByFormat(stdout, opts.Format, report); err != nil {
+			return printError(stderr, err)
+		}
+	case !opts.Quiet:
+		fmt.Fprintln(stdout, outPath)
+	}
+	return exit
+}
+
+// writeEpubFile writes the book next to path and renames it into place so a
+// failed run never leaves a truncated file behind.
+func writeEpubFile(path string, book *epub.Book) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := book.Write(f); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(path)
+		if err2 := os.Rename(tmp, path); err2 != nil {
+			_ = os.Remove(tmp)
+			return err2
+		}
+	}
+	return nil
+}
+
+func usageEpub() string {
+	return "Usage:\n  ip epub --out <file.epub> [--folder ...] [--tag ...] [--limit N] [--since <bound>] [--until <bound>] [--updated-since <time>] [--select <expr>] [--title ...] [--language en] [--progress-json]\n"
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vburojevic/instapaper-cli/internal/config"
+	"github.com/vburojevic/instapaper-cli/internal/convert"
+	"github.com/vburojevic/instapaper-cli/internal/feed"
+	"github.com/vburojevic/instapaper-cli/internal/gateway"
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+)
+
+// feedOptions are the rendering flags of ip feed.
+type feedOptions struct {
+	Title   string
+	Author  string
+	Link    string
+	SelfURL string
+	Content bool
+}
+
+func runFeed(ctx context.Context, args []string, opts *GlobalOptions, cfg *config.Config, stdout, stderr io.Writer) int {
+	args = reorderFlags(args)
+	fs := flag.NewFlagSet("feed", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var help bool
+	var sel bookmarkSelection
+	var fo feedOptions
+	var format string
+	var outPath string
+	var serveAddr string
+	var token string
+	var cacheTTL time.Duration
+	fs.BoolVar(&help, "help", false, "Show help")
+	fs.BoolVar(&help, "h", false, "Show help")
+	sel.addFlags(fs, "starred", 50)
+	fs.StringVar(&format, "format", "atom", "Feed format: atom|jsonfeed")
+	fs.StringVar(&fo.Title, "title", "", "Feed title (default: Instapaper <folder>)")
+	fs.StringVar(&fo.Author, "author", "", "Feed author name (default: Instapaper)")
+	fs.StringVar(&fo.Link, "link", "", "Home page URL of the feed")
+	fs.StringVar(&fo.SelfURL, "self-url", "", "Public URL the feed is published at (Atom self link, JSON Feed feed_url)")
+	fs.BoolVar(&fo.Content, "content", false, "Include the article text (get_text) as HTML content")
+	fs.StringVar(&outPath, "out", "", "Write the feed to a file instead of stdout")
+	fs.StringVar(&serveAddr, "serve", "", "Serve the feed over HTTP on this address (e.g. 127.0.0.1:8080)")
+	fs.DurationVar(&cacheTTL, "cache", 5*time.Minute, "With --serve, rebuild the feed at most this often")
+	fs.StringVar(&token, "token", "", "With --serve, require the token as \"Authorization: Bearer <token>\" or ?token= (default: INSTAPAPER_FEED_TOKEN)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if help {
+		printFlagUsage(stdout, usageFeed(), fs)
+		return 0
+	}
+	if fs.NArg() > 0 {
+		return printUsageError(stderr, "feed does not take positional arguments")
+	}
+	format, err := feed.ParseFormat(format)
+	if err != nil {
+		return printUsageError(stderr, err.Error())
+	}
+	if err := sel.validate(); err != nil {
+		return printUsageError(stderr, err.Error())
+	}
+	if serveAddr != "" && outPath != "" {
+		return printUsageError(stderr, "use only one of --out or --serve")
+	}
+	if cacheTTL < 0 {
+		return printUsageError(stderr, "--cache must be >= 0")
+	}
+	if serveAddr != "" {
+		if token == "" {
+			token = os.Getenv("INSTAPAPER_FEED_TOKEN")
+		}
+		if token == "" && !isLoopbackAddr(serveAddr) {
+			return printUsageError(stderr, "refusing to serve the feed on a non-loopback address without --token")
+		}
+	} else if token != "" {
+		return printUsageError(stderr, "--token requires --serve")
+	}
+
+	build := func(ctx context.Context) (*feed.Feed, error) {
+		return buildFeed(ctx, opts, cfg, stderr, &sel, fo)
+	}
+	if serveAddr != "" {
+		return serveFeed(ctx, opts, stderr, serveAddr, token, format, cacheTTL, build)
+	}
+	f, err := build(ctx)
+	if err != nil {
+		return printError(stderr, err)
+	}
+	w := stdout
+	if outPath != "" {
+		file, err := os.OpenFile(outPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+		if err != nil {
+			return printError(stderr, err)
+		}
+		defer file.Close()
+		w = file
+	}
+	if err := f.Write(w, format); err != nil {
+		return printError(stderr, err)
+	}
+	if outPath != "" && !opts.Quiet {
+		fmt.Fprintln(stdout, outPath)
+	}
+	return 0
+}
+
+// buildFeed selects bookmarks and maps them to feed items. With --content,
+// article text that cannot be fetched is skipped with a warning rather than
+// failing the whole feed.
+func buildFeed(ctx context.Context, opts *GlobalOptions, cfg *config.Config, stderr io.Writer, sel *bookmarkSelection, fo feedOptions) (*feed.Feed, error) {
+	bookmarks, err := sel.fetch(ctx, opts, cfg, stderr)
+	if err != nil {
+		return nil, err
+	}
+	var fetch func(int64) ([]byte, error)
+	if fo.Content {
+		if fetch, err = textFetcher(ctx, opts, cfg, stderr); err != nil {
+			return nil, err
+		}
+	}
+	scope := sel.Folder
+	if sel.Tag != "" {
+		scope = "tag:" + sel.Tag
+	}
+	f := &feed.Feed{
+		ID:      "urn:instapaper-cli:feed:" + strings.ToLower(strings.ReplaceAll(scope, " ", "-")),
+		Title:   fo.Title,
+		Author:  fo.Author,
+		HomeURL: fo.Link,
+		FeedURL: fo.SelfURL,
+	}
+	if f.Title == "" {
+		f.Title = "Instapaper " + scope
+	}
+	for _, b := range bookmarks {
+		id := int64(b.BookmarkID)
+		item := feed.Item{
+			ID:      "urn:instapaper:bookmark:" + strconv.FormatInt(id, 10),
+			URL:     b.URL,
+			Title:   b.Title,
+			Summary: strings.TrimSpace(b.Description),
+			Tags:    instapaper.TagNames(b.Tags),
+		}
+		if b.Time > 0 {
+			item.Published = time.Unix(int64(b.Time), 0)
+		}
+		if fetch != nil {
+			html, err := fetch(id)
+			if err != nil {
+				writeErrorLine(stderr, fmt.Errorf("text %d: %v", id, err))
+			} else {
+				item.ContentHTML = convert.ToXHTML(string(html))
+			}
+		}
+		f.Items = append(f.Items, item)
+	}
+	verbosef(opts, stderr, "feed: items=%d content=%t", len(f.Items), fo.Content)
+	return f, nil
+}
+
+// feedHandler serves the rendered feed, rebuilding it at most once per ttl.
+// A failed rebuild keeps serving the last good document. Like ip serve, it
+// only answers Host headers naming addr or a loopback host, and with a token
+// set every request must carry it; feed readers that cannot send headers may
+// pass it as ?token=.
+type feedHandler struct {
+	addr   string
+	token  string
+	format string
+	ttl    time.Duration
+	build  func(context.Context) (*feed.Feed, error)
+	stderr io.Writer
+
+	mu      sync.Mutex
+	body    []byte
+	builtAt time.Time
+}
+
+func (h *feedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !gateway.AllowedHost(h.addr, r.Host) {
+		http.Error(w, "host not allowed", http.StatusMisdirectedRequest)
+		return
+	}
+	if h.token != "" && !gateway.BearerAuthorized(r, h.token) &&
+		subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(h.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="instapaper-cli"`)
+		http.Error(w, "missing or invalid token", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := h.render(r.Context())
+	if err != nil {
+		http.Error(w, "feed unavailable", http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", feed.ContentType(h.format))
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = w.Write(body)
+}
+
+func (h *feedHandler) render(ctx context.Context) ([]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.body != nil && time.Since(h.builtAt) < h.ttl {
+		return h.body, nil
+	}
+	f, err := h.build(ctx)
+	if err == nil {
+		var buf bytes.Buffer
+		if err = f.Write(&buf, h.format); err == nil {
+			h.body = buf.Bytes()
+			h.builtAt = time.Now()
+			return h.body, nil
+		}
+	}
+	writeErrorLine(h.stderr, fmt.Errorf("feed: %v", err))
+	if h.body != nil {
+		return h.body, nil
+	}
+	return nil, err
+}
+
+func serveFeed(ctx context.Context, opts *GlobalOptions, stderr io.Writer, addr, token, format string, ttl time.Duration, build func(context.Context) (*feed.Feed, error)) int {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return printError(stderr, err)
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	srv := &http.Server{
+		Handler:           &feedHandler{addr: addr, token: token, format: format, ttl: ttl, build: build, stderr: stderr},
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	if !opts.Quiet {
+		fmt.Fprintf(stderr, "Serving %s feed on http://%s/ (Ctrl-C to stop)\n", format, ln.Addr())
+	}
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return printError(stderr, err)
+	}
+	return 0
+}
+
+func usageFeed() string {
+	return "Usage:\n  ip feed [--format atom|jsonfeed] [--folder starred] [--tag ...] [--limit N] [--select <expr>] [--content] [--title ...] [--link <url>] [--self-url <url>] [--out <file>]\n  ip feed --serve 127.0.0.1:8080 [--cache 5m] [--token <token>] [...]\n"
+}
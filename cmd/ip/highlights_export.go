@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/vburojevic/instapaper-cli/internal/config"
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+	"github.com/vburojevic/instapaper-cli/internal/notes"
+)
+
+func runHighlightsExport(ctx context.Context, args []string, opts *GlobalOptions, cfg *config.Config, stdout, stderr io.Writer) int {
+	args = reorderFlags(args)
+	fs := flag.NewFlagSet("highlights export", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var help bool
+	var to string
+	var folder string
+	var selectExpr string
+	var outPath string
+	var outDir string
+	var maxPages int
+	fs.BoolVar(&help, "help", false, "Show help")
+	fs.BoolVar(&help, "h", false, "Show help")
+	fs.StringVar(&to, "to", "markdown", "Export format: markdown|readwise|obsidian")
+	fs.StringVar(&folder, "folder", "", "Only this folder: unread|starred|archive|<id>|\"Title\" (default: unread, archive and all user folders)")
+	fs.StringVar(&selectExpr, "select", "", "Filter bookmarks client-side (e.g. tag~research)")
+	fs.StringVar(&outPath, "out", "", "Write a single file (markdown digest or readwise CSV) instead of stdout")
+	fs.StringVar(&outDir, "out-dir", "", "Write one file per article (markdown, obsidian)")
+	fs.IntVar(&maxPages, "max-pages", 200, "Max pages per folder")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if help {
+		printFlagUsage(stdout, usageHighlightsExport(), fs)
+		return 0
+	}
+	if fs.NArg() > 0 {
+		return printUsageError(stderr, "highlights export does not take positional arguments")
+	}
+	to = strings.ToLower(strings.TrimSpace(to))
+	switch to {
+	case "markdown", "md":
+		to = "markdown"
+	case "readwise", "csv":
+		to = "readwise"
+		if outDir != "" {
+			return printUsageError(stderr, "--out-dir is not supported with --to readwise; use --out")
+		}
+	case "obsidian":
+		if outDir == "" {
+			return printUsageError(stderr, "--to obsidian requires --out-dir <vault folder>")
+		}
+	default:
+		return printUsageError(stderr, fmt.Sprintf("invalid --to %q (expected markdown|readwise|obsidian)", to))
+	}
+	if outPath != "" && outDir != "" {
+		return printUsageError(stderr, "use only one of --out or --out-dir")
+	}
+	if maxPages < 0 {
+		return printUsageError(stderr, "--max-pages must be >= 0")
+	}
+	sel, err := parseSelectExpr(selectExpr)
+	if err != nil {
+		return printUsageError(stderr, err.Error())
+	}
+
+	var articles []notes.Article
+	if opts.Offline {
+		articles, err = offlineHighlightArticles(opts, folder)
+	} else {
+		articles, err = fetchHighlightArticles(ctx, opts, cfg, stderr, folder, maxPages)
+	}
+	if err != nil {
+		return printError(stderr, err)
+	}
+	if sel != nil {
+		kept := articles[:0]
+		for _, a := range articles {
+			if sel.Match(a.Bookmark) {
+				kept = append(kept, a)
+			}
+		}
+		articles = kept
+	}
+	highlightCount := 0
+	for _, a := range articles {
+		highlightCount += len(a.Highlights)
+	}
+	verbosef(opts, stderr, "highlights export: articles=%d highlights=%d", len(articles), highlightCount)
+
+	if outDir != "" {
+		if err := os.MkdirAll(outDir, 0o700); err != nil {
+			return printError(stderr, err)
+		}
+		exit := 0
+		for _, a := range articles {
+			body := notes.Markdown(a)
+			if to == "obsidian" {
+				body = notes.Obsidian(a)
+			}
+			path := filepath.Join(outDir, notes.Filename(a, ".md"))
+			if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+				writeErrorLine(stderr, err)
+				exit = 1
+				continue
+			}
+			if !opts.Quiet {
+				fmt.Fprintln(stdout, path)
+			}
+		}
+		return exit
+	}
+
+	w := stdout
+	if outPath != "" {
+		f, err := os.OpenFile(outPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+		if err != nil {
+			return printError(stderr, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if to == "readwise" {
+		err = notes.WriteReadwiseCSV(w, articles)
+	} else {
+		_, err = io.WriteString(w, notes.MarkdownDigest(articles))
+	}
+	if err != nil {
+		return printError(stderr, err)
+	}
+	if outPath != "" && !opts.Quiet {
+		fmt.Fprintln(stdout, outPath)
+	}
+	return 0
+}
+
+// fetchHighlightArticles walks folders via the list endpoint and returns the
+// bookmarks that have highlights, newest first within each folder.
+func fetchHighlightArticles(ctx context.Context, opts *GlobalOptions, cfg *config.Config, stderr io.Writer, folder string, maxPages int) ([]notes.Article, error) {
+	client, _, _, err := requireClient(opts, cfg, true, stderr)
+	if err != nil {
+		return nil, err
+	}
+	var targets []string
+	if folder != "" {
+		id, err := resolveListFolderID(ctx, client, folder)
+		if err != nil {
+			return nil, err
+		}
+		targets = []string{id}
+	} else {
+		folders, err := client.ListFolders(ctx)
+		if err != nil {
+			return nil, err
+		}
+		targets = []string{"unread", "archive"}
+		for _, f := range folders {
+			targets = append(targets, strconv.FormatInt(int64(f.FolderID), 10))
+		}
+	}
+	var articles []notes.Article
+	seen := map[int64]bool{}
+	for _, target := range targets {
+		resp, err := listBookmarks(ctx, client, listBookmarksParams{FolderID: target, MaxPages: maxPages})
+		if err != nil {
+			return nil, fmt.Errorf("list %s: %w", target, err)
+		}
+		highlights, err := fetchFolderHighlights(ctx, client, target, resp.Bookmarks)
+		if err != nil {
+			return nil, fmt.Errorf("highlights %s: %w", target, err)
+		}
+		byBookmark := map[int64][]instapaper.Highlight{}
+		for _, h := range highlights {
+			byBookmark[int64(h.BookmarkID)] = append(byBookmark[int64(h.BookmarkID)], h)
+		}
+		for _, b := range resp.Bookmarks {
+			id := int64(b.BookmarkID)
+			if seen[id] || len(byBookmark[id]) == 0 {
+				continue
+			}
+			seen[id] = true
+			articles = append(articles, notes.NewArticle(b, byBookmark[id]))
+		}
+		verbosef(opts, stderr, "highlights export: folder=%s bookmarks=%d highlights=%d", target, len(resp.Bookmarks), len(highlights))
+	}
+	return articles, nil
+}
+
+func offlineHighlightArticles(opts *GlobalOptions, folder string) ([]notes.Article, error) {
+	st, err := openSyncedStore(opts)
+	if err != nil {
+		return nil, err
+	}
+	var bookmarks []instapaper.Bookmark
+	if folder != "" {
+		id, err := st.ResolveFolder(folder)
+		if err != nil {
+			return nil, err
+		}
+		bookmarks = st.BookmarksInFolder(id)
+	} else {
+		for _, e := range st.Entries() {
+			if e.Folder != "" {
+				bookmarks = append(bookmarks, e.Bookmark)
+			}
+		}
+	}
+	var articles []notes.Article
+	for _, b := range bookmarks {
+		if hls := st.HighlightsFor(int64(b.BookmarkID)); len(hls) > 0 {
+			articles = append(articles, notes.NewArticle(b, hls))
+		}
+	}
+	return articles, nil
+}
+
+func usageHighlightsExport() string {
+	return "Usage:\n  ip highlights export [--to markdown|readwise|obsidian] [--folder ...] [--select <expr>] [--out <file>|--out-dir <dir>] [--max-pages N]\n"
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vburojevic/instapaper-cli/internal/bulk"
+	"github.com/vburojevic/instapaper-cli/internal/config"
+	"github.com/vburojevic/instapaper-cli/internal/journal"
+)
+
+const jobsDirName = "jobs"
+
+// addJournalFlag registers --journal on a bulk command.
+func addJournalFlag(fs *flag.FlagSet, v *string) {
+	fs.StringVar(v, "journal", "", "Record each item's outcome in this file (default: a job under the config dir when there is more than one item)")
+}
+
+// resumeOr returns the items a resumed job still has to process, or collects
+// the items of a fresh run.
+func resumeOr[T any](opts *GlobalOptions, collect func() ([]T, error)) ([]T, error) {
+	if opts.resume == nil {
+		return collect()
+	}
+	var items []T
+	err := opts.resume.RemainingItems(&items)
+	return items, err
+}
+
+// startJob opens the journal of a bulk run: the resumed job's file, the
+// --journal path, or a new job under opts.JobsDir for runs of more than one
+// item. It returns nil when nothing is journalled. key names the progress
+// data field identifying an item.
+func startJob(opts *GlobalOptions, command string, args []string, key, path string, items any, count int, stderr io.Writer) (*journal.Journal, error) {
+	if opts.resume != nil {
+		return journal.Append(opts.resume.Path)
+	}
+	if path == "" && count < 2 {
+		return nil, nil
+	}
+	id := journal.NewID()
+	if path == "" {
+		path = filepath.Join(opts.JobsDir, id+journal.Ext)
+	}
+	j, err := journal.Create(path, journal.Header{ID: id, Command: command, Args: args, Profile: opts.Profile, Key: key}, items)
+	if err != nil {
+		return nil, fmt.Errorf("journal: %w", err)
+	}
+	verbosef(opts, stderr, "%s: journal %s", command, path)
+	return j, nil
+}
+
+// finishJob closes the journal. Jobs under opts.JobsDir are removed once
+// every item has succeeded; otherwise the user is told how to resume.
+func finishJob(opts *GlobalOptions, j *journal.Journal, sum bulk.Summary, stderr io.Writer) {
+	if j == nil {
+		return
+	}
+	if err := j.Done(sum.Succeeded, sum.Failed, sum.Cancelled); err != nil {
+		writeErrorLine(stderr, fmt.Errorf("journal: %v", err))
+		return
+	}
+	job, err := journal.Load(j.Path)
+	if err != nil {
+		writeErrorLine(stderr, fmt.Errorf("journal: %v", err))
+		return
+	}
+	if job.Complete() {
+		if filepath.Dir(j.Path) == filepath.Clean(opts.JobsDir) {
+			_ = os.Remove(j.Path)
+		}
+		return
+	}
+	if !opts.Quiet && !opts.StderrJSON {
+		ref := job.ID
+		if filepath.Dir(j.Path) != filepath.Clean(opts.JobsDir) {
+			ref = j.Path
+		}
+		fmt.Fprintf(stderr, "%d of %d items remaining; resume with: ip jobs resume %s\n", job.Remaining, len(job.Items), ref)
+	}
+}
+
+type jobInfo struct {
+	ID        string            `json:"id"`
+	Command   string            `json:"command"`
+	Args      []string          `json:"args,omitempty"`
+	Profile   string            `json:"profile,omitempty"`
+	Path      string            `json:"path"`
+	Status    string            `json:"status"`
+	Total     int               `json:"total"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Remaining int               `json:"remaining"`
+	Runs      int               `json:"runs"`
+	Created   int64             `json:"created"`
+	Updated   int64             `json:"updated"`
+	Errors    map[string]string `json:"errors,omitempty"`
+}
+
+func newJobInfo(job *journal.Job, withErrors bool) jobInfo {
+	info := jobInfo{
+		ID:        job.ID,
+		Command:   job.Command,
+		Args:      job.Args,
+		Profile:   job.Profile,
+		Path:      job.Path,
+		Status:    jobStatus(job),
+		Total:     len(job.Items),
+		Succeeded: job.Succeeded,
+		Failed:    job.Failed,
+		Remaining: job.Remaining,
+		Runs:      job.Runs,
+		Created:   job.Created,
+		Updated:   job.Updated,
+	}
+	if withErrors && len(job.LastErrors) > 0 {
+		info.Errors = job.LastErrors
+	}
+	return info
+}
+
+// jobStatus is complete, interrupted (Ctrl-C), failed (finished with item
+// errors) or unfinished (still running, or the process died).
+func jobStatus(job *journal.Job) string {
+	switch {
+	case job.Complete():
+		return "complete"
+	case !job.Finished:
+		return "unfinished"
+	case job.Interrupted:
+		return "interrupted"
+	default:
+		return "failed"
+	}
+}
+
+func runJobs(ctx context.Context, args []string, opts *GlobalOptions, cfg *config.Config, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprintln(stdout, usageJobs())
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			return printUsageError(stderr, "usage: ip jobs list")
+		}
+		jobs, err := journal.List(opts.JobsDir)
+		if err != nil {
+			return printError(stderr, err)
+		}
+		return printJobs(stdout, stderr, opts.Format, jobs)
+	case "show":
+		if len(args) != 2 {
+			return printUsageError(stderr, "usage: ip jobs show <id>")
+		}
+		job, err := journal.Find(opts.JobsDir, args[1])
+		if err != nil {
+			return printError(stderr, err)
+		}
+		return printJob(stdout, stderr, opts.Format, job)
+	case "resume":
+		if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+			return printUsageError(stderr, "usage: ip jobs resume <id> [command flags...]")
+		}
+		job, err := journal.Find(opts.JobsDir, args[1])
+		if err != nil {
+			return printError(stderr, err)
+		}
+		return resumeJob(ctx, job, args[2:], opts, cfg, stdout, stderr)
+	default:
+		return printUsageError(stderr, fmt.Sprintf("unknown jobs subcommand: %s", args[0]))
+	}
+}
+
+// resumeJob re-runs the job's command with its recorded flags plus extra
+// (later flags win), over the items that have not succeeded yet.
+func resumeJob(ctx context.Context, job *journal.Job, extra []string, opts *GlobalOptions, cfg *config.Config, stdout, stderr io.Writer) int {
+	profile := job.Profile
+	if profile == "" {
+		profile = config.DefaultProfile
+	}
+	if profile != opts.Profile {
+		return printUsageError(stderr, fmt.Sprintf("job %s was started with profile %s; run: ip --profile %s jobs resume %s", job.ID, profile, profile, job.ID))
+	}
+	if job.Complete() {
+		if !opts.Quiet {
+			fmt.Fprintf(stdout, "Job %s is already complete\n", job.ID)
+		}
+		return 0
+	}
+	verbosef(opts, stderr, "jobs: resuming %s (%d of %d items remaining)", job.ID, job.Remaining, len(job.Items))
+	opts.resume = job
+	defer func() { opts.resume = nil }()
+	args := append(append([]string{}, job.Args...), extra...)
+	switch job.Command {
+	case "import":
+		return runImport(ctx, args, opts, cfg, stdout, stderr)
+	case "delete":
+		return runDelete(ctx, args, opts, cfg, stdout, stderr)
+	case "archive", "unarchive", "star", "unstar":
+		return runBookmarkMutation(ctx, job.Command, args, opts, cfg, stdout, stderr)
+	default:
+		return printError(stderr, fmt.Errorf("job %s: cannot resume command %q", job.ID, job.Command))
+	}
+}
+
+func printJobs(w, stderr io.Writer, format string, jobs []*journal.Job) int {
+	infos := make([]jobInfo, 0, len(jobs))
+	for _, job := range jobs {
+		infos = append(infos, newJobInfo(job, false))
+	}
+	if strings.EqualFold(format, "json") {
+		if err := writeJSONByFormat(w, format, infos); err != nil {
+			return printError(stderr, err)
+		}
+		return 0
+	}
+	if isNDJSONFormat(format) {
+		for _, info := range infos {
+			if err := writeJSONByFormat(w, format, info); err != nil {
+				return printError(stderr, err)
+			}
+		}
+		return 0
+	}
+	if strings.EqualFold(format, "plain") {
+		for _, info := range infos {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\n", info.ID, info.Command, info.Status, info.Succeeded, info.Failed, info.Total)
+		}
+		return 0
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tCOMMAND\tSTATUS\tDONE\tFAILED\tUPDATED")
+	for _, info := range infos {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d/%d\t%d\t%s\n", info.ID, info.Command, info.Status, info.Succeeded, info.Total, info.Failed,
+			time.Unix(info.Updated, 0).Format("2006-01-02 15:04"))
+	}
+	if err := tw.Flush(); err != nil {
+		return printError(stderr, err)
+	}
+	return 0
+}
+
+func printJob(w, stderr io.Writer, format string, job *journal.Job) int {
+	info := newJobInfo(job, true)
+	if strings.EqualFold(format, "json") || isNDJSONFormat(format) {
+		if err := writeJSONByFormat(w, format, info); err != nil {
+			return printError(stderr, err)
+		}
+		return 0
+	}
+	fmt.Fprintf(w, "id=%s\ncommand=%s\nargs=%s\nprofile=%s\npath=%s\nstatus=%s\ntotal=%d\nsucceeded=%d\nfailed=%d\nremaining=%d\nruns=%d\n",
+		info.ID, info.Command, strings.Join(info.Args, " "), info.Profile, info.Path, info.Status,
+		info.Total, info.Succeeded, info.Failed, info.Remaining, info.Runs)
+	keys := make([]string, 0, len(info.Errors))
+	for key := range info.Errors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "error %s: %s\n", key, info.Errors[key])
+	}
+	return 0
+}
+
+func usageJobs() string {
+	return "Usage:\n  ip jobs list\n  ip jobs show <id>\n  ip jobs resume <id> [command flags...]\n"
+}
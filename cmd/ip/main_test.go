@@ -1,16 +1,30 @@
 package main
 
 import (
+	"archive/zip"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/vburojevic/instapaper-cli/internal/config"
+	"github.com/vburojevic/instapaper-cli/internal/fakeapi"
+	"github.com/vburojevic/instapaper-cli/internal/feed"
 	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+	"github.com/vburojevic/instapaper-cli/internal/journal"
+	"github.com/vburojevic/instapaper-cli/internal/oauth1"
+	"github.com/vburojevic/instapaper-cli/internal/webhook"
 )
 
 func runCmd(t *testing.T, args ...string) (int, string, string) {
@@ -306,6 +320,30 @@ func TestFilterBookmarksBySelect(t *testing.T) {
 	if len(filtered) != 1 || int64(filtered[0].BookmarkID) != 1 {
 		t.Fatalf("unexpected select result: %+v", filtered)
 	}
+
+	now := time.Now().Unix()
+	bookmarks[0].Progress, bookmarks[0].Time = 0.95, instapaper.Int64(now-40*86400)
+	bookmarks[1].Progress, bookmarks[1].Time = 0.2, instapaper.Int64(now-3600)
+	for expr, want := range map[string]int64{
+		"progress>=0.9":           1,
+		"progress<0.5":            2,
+		"age>30d":                 1,
+		"age<=1w,starred=0":       2,
+		"title~o W,bookmark_id<2": 1,
+	} {
+		filtered, err := filterBookmarksBySelect(bookmarks, expr)
+		if err != nil {
+			t.Fatalf("select %q: %v", expr, err)
+		}
+		if len(filtered) != 1 || int64(filtered[0].BookmarkID) != want {
+			t.Fatalf("select %q: got %+v, want id %d", expr, filtered, want)
+		}
+	}
+	for _, expr := range []string{"age>soon", "title>3", "progress~1"} {
+		if _, err := parseSelectExpr(expr); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
 }
 
 func TestMoveAcceptsFlagsAfterPositional(t *testing.T) {
@@ -353,3 +391,1780 @@ func TestFoldersDeleteAcceptsFlagsAfterPositional(t *testing.T) {
 		t.Fatalf("folders delete with trailing flag exit=%d err=%s", code, errOut)
 	}
 }
+
+func TestSyncThenOfflineList(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("ParseForm: %v", err)
+		}
+		var payload []map[string]any
+		switch r.URL.Path {
+		case "/api/1/folders/list":
+			payload = []map[string]any{{"type": "folder", "folder_id": 5, "title": "Work"}}
+		case "/api/1/bookmarks/list":
+			payload = []map[string]any{{"type": "user", "user_id": 1, "username": "tester"}}
+			if r.Form.Get("have") == "" {
+				switch r.Form.Get("folder_id") {
+				case "unread":
+					payload = append(payload,
+						map[string]any{"type": "bookmark", "bookmark_id": 1, "url": "https://a.example", "title": "A", "time": 100, "hash": "ha"},
+						map[string]any{"type": "bookmark", "bookmark_id": 2, "url": "https://b.example", "title": "B", "time": 200, "hash": "hb", "starred": 1},
+					)
+				case "5":
+					payload = append(payload,
+						map[string]any{"type": "bookmark", "bookmark_id": 3, "url": "https://c.example", "title": "C", "time": 300, "hash": "hc"},
+					)
+				}
+			}
+		case "/api/1/bookmarks/get_text":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<p>text " + r.Form.Get("bookmark_id") + "</p>"))
+			return
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		b, _ := json.Marshal(payload)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(b)
+	}))
+	defer server.Close()
+
+	cfgDir := t.TempDir()
+	cfgPath := filepath.Join(cfgDir, "config.json")
+	writeAuthConfig(t, cfgPath)
+	base := []string{"ip", "--config", cfgPath, "--api-base", server.URL}
+
+	code, out, errOut := runCmd(t, append(base, "--json", "sync", "--text")...)
+	if code != 0 {
+		t.Fatalf("sync exit=%d err=%s", code, errOut)
+	}
+	var report syncReport
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("decode report: %v (%s)", err, out)
+	}
+	if report.Bookmarks != 3 || report.TextFetched != 3 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	offline := []string{"ip", "--config", cfgPath, "--api-base", "http://127.0.0.1:1", "--offline", "--ndjson"}
+	code, out, errOut = runCmd(t, append(offline, "list", "--folder", "unread", "--select", "starred=1")...)
+	if code != 0 {
+		t.Fatalf("offline list exit=%d err=%s", code, errOut)
+	}
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 1 || !strings.Contains(lines[0], "\"bookmark_id\":2") {
+		t.Fatalf("unexpected offline list: %q", out)
+	}
+
+	code, out, errOut = runCmd(t, append(offline, "export", "--folder", "Work")...)
+	if code != 0 || !strings.Contains(out, "\"bookmark_id\":3") {
+		t.Fatalf("offline export exit=%d out=%q err=%s", code, out, errOut)
+	}
+
+	code, out, errOut = runCmd(t, append(offline, "export", "--folder", "all", "--format", "netscape")...)
+	if code != 0 || !strings.Contains(out, "<DT><H3>Work</H3>") || !strings.Contains(out, `<A HREF="https://c.example" ADD_DATE="300">C</A>`) {
+		t.Fatalf("offline netscape export exit=%d out=%q err=%s", code, out, errOut)
+	}
+
+	code, out, errOut = runCmd(t, append(offline, "feed", "--folder", "starred", "--format", "jsonfeed", "--content")...)
+	if code != 0 || !strings.Contains(out, `"content_html": "<p>text 2</p>"`) || strings.Contains(out, "https://a.example") {
+		t.Fatalf("offline feed exit=%d out=%q err=%s", code, out, errOut)
+	}
+
+	code, out, errOut = runCmd(t, append(offline, "export", "--format", "csv", "--fields", "bookmark_id,url,folder")...)
+	if code != 0 || out != "bookmark_id,url,folder\n2,https://b.example,Unread\n1,https://a.example,Unread\n" {
+		t.Fatalf("offline csv export exit=%d out=%q err=%s", code, out, errOut)
+	}
+
+	code, out, errOut = runCmd(t, append(offline, "text", "3")...)
+	if code != 0 || out != "<p>text 3</p>" {
+		t.Fatalf("offline text exit=%d out=%q err=%s", code, out, errOut)
+	}
+
+	code, out, errOut = runCmd(t, append(offline, "text", "3", "--to", "markdown")...)
+	want := "---\nid: 3\ntitle: \"C\"\nurl: \"https://c.example\"\ntags: []\nprogress: 0\nstarred: false\nsaved: 1970-01-01T00:05:00Z\n---\n\ntext 3\n"
+	if code != 0 || out != want {
+		t.Fatalf("offline text markdown exit=%d out=%q err=%s", code, out, errOut)
+	}
+
+	epubPath := filepath.Join(cfgDir, "week.epub")
+	code, out, errOut = runCmd(t, append(offline, "epub", "--folder", "unread", "--out", epubPath)...)
+	if code != 0 || !strings.Contains(out, "\"chapters\":2") {
+		t.Fatalf("offline epub exit=%d out=%q err=%s", code, out, errOut)
+	}
+	zr, err := zip.OpenReader(epubPath)
+	if err != nil {
+		t.Fatalf("open epub: %v", err)
+	}
+	defer zr.Close()
+	chapters := 0
+	for _, f := range zr.File {
+		if strings.HasPrefix(f.Name, "OEBPS/chapter-") {
+			chapters++
+		}
+	}
+	if zr.File[0].Name != "mimetype" || chapters != 2 {
+		t.Fatalf("unexpected epub layout: first=%s chapters=%d", zr.File[0].Name, chapters)
+	}
+}
+
+func TestSearchLocalStore(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("ParseForm: %v", err)
+		}
+		var payload []map[string]any
+		switch r.URL.Path {
+		case "/api/1/folders/list":
+			payload = []map[string]any{}
+		case "/api/1/bookmarks/list":
+			payload = []map[string]any{{"type": "user", "user_id": 1, "username": "tester"}}
+			if r.Form.Get("have") == "" && r.Form.Get("folder_id") == "unread" {
+				payload = append(payload,
+					map[string]any{"type": "bookmark", "bookmark_id": 1, "url": "https://go.dev/blog/generics", "title": "An intro", "time": 100, "hash": "ha"},
+					map[string]any{"type": "bookmark", "bookmark_id": 2, "url": "https://example.com/pasta", "title": "Pasta", "time": 200, "hash": "hb"},
+				)
+			}
+		case "/api/1/bookmarks/get_text":
+			w.Header().Set("Content-Type", "text/html")
+			body := "<p>Boil the <b>water</b>.</p>"
+			if r.Form.Get("bookmark_id") == "1" {
+				body = "<h1>Intro</h1><p>Type parameters bring generics to Go.</p>"
+			}
+			_, _ = w.Write([]byte(body))
+			return
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		b, _ := json.Marshal(payload)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(b)
+	}))
+	defer server.Close()
+
+	cfgPath := filepath.Join(t.TempDir(), "config.json")
+	writeAuthConfig(t, cfgPath)
+	code, _, errOut := runCmd(t, "ip", "--config", cfgPath, "--api-base", server.URL, "--json", "sync", "--text")
+	if code != 0 {
+		t.Fatalf("sync exit=%d err=%s", code, errOut)
+	}
+
+	base := []string{"ip", "--config", cfgPath, "--api-base", "http://127.0.0.1:1", "--ndjson", "search"}
+	code, out, errOut := runCmd(t, append(base, `"type parameters" OR water`)...)
+	if code != 0 {
+		t.Fatalf("search exit=%d err=%s", code, errOut)
+	}
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 2 {
+		t.Fatalf("unexpected search output: %q", out)
+	}
+
+	code, out, errOut = runCmd(t, append(base, "generics NOT url:example.com")...)
+	if code != 0 {
+		t.Fatalf("search exit=%d err=%s", code, errOut)
+	}
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 1 || !strings.Contains(lines[0], "\"bookmark_id\":1") {
+		t.Fatalf("unexpected search output: %q", out)
+	}
+
+	code, _, errOut = runCmd(t, append(base, "(broken")...)
+	if code != 2 || !strings.Contains(errOut, "missing )") {
+		t.Fatalf("expected usage error, got exit=%d err=%s", code, errOut)
+	}
+}
+
+func TestHighlightsExportReadwise(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("ParseForm: %v", err)
+		}
+		var payload []map[string]any
+		switch r.URL.Path {
+		case "/api/1/folders/list":
+			payload = []map[string]any{}
+		case "/api/1/bookmarks/list":
+			payload = []map[string]any{{"type": "user", "user_id": 1, "username": "tester"}}
+			if r.Form.Get("folder_id") != "unread" {
+				break
+			}
+			if r.Form.Get("have") == "" {
+				payload = append(payload,
+					map[string]any{"type": "bookmark", "bookmark_id": 1, "url": "https://a.example", "title": "A", "time": 100},
+					map[string]any{"type": "bookmark", "bookmark_id": 2, "url": "https://b.example", "title": "B", "time": 200},
+				)
+			}
+			if r.Form.Get("highlights") != "" {
+				payload = append(payload, map[string]any{"type": "highlight", "highlight_id": 9, "bookmark_id": 1, "text": "quoted", "note": "mine", "position": 3, "time": 1700000000})
+			}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		b, _ := json.Marshal(payload)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(b)
+	}))
+	defer server.Close()
+
+	cfgPath := filepath.Join(t.TempDir(), "config.json")
+	writeAuthConfig(t, cfgPath)
+	code, out, errOut := runCmd(t, "ip", "--config", cfgPath, "--api-base", server.URL, "highlights", "export", "--to", "readwise")
+	if code != 0 {
+		t.Fatalf("highlights export exit=%d err=%s", code, errOut)
+	}
+	want := "Highlight,Title,Author,URL,Note,Location,Date\nquoted,A,,https://a.example,mine,3,2023-11-14 22:13:20\n"
+	if out != want {
+		t.Fatalf("unexpected csv: %q", out)
+	}
+
+	dir := t.TempDir()
+	code, out, errOut = runCmd(t, "ip", "--config", cfgPath, "--api-base", server.URL, "highlights", "export", "--to", "obsidian", "--out-dir", dir)
+	if code != 0 || strings.TrimSpace(out) != filepath.Join(dir, "1.md") {
+		t.Fatalf("obsidian export exit=%d out=%q err=%s", code, out, errOut)
+	}
+}
+
+func TestImportNetscapeDryRun(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "bookmarks.html")
+	html := `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<DL><p>
+  <DT><H3>Bookmarks bar</H3>
+  <DL><p>
+    <DT><H3>Reading</H3>
+    <DL><p>
+      <DT><A HREF="https://example.com/a" ADD_DATE="1700000000" TAGS="go,cli">A</A>
+    </DL><p>
+  </DL><p>
+</DL><p>
+`
+	if err := os.WriteFile(input, []byte(html), 0o600); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	args := append([]string{"ip"}, tempConfigArg(t)...)
+	code, out, errOut := runCmd(t, append(args, "--json", "--dry-run", "import", "--input-format", "netscape", "--input", input, "--tags", "imported")...)
+	if code != 0 {
+		t.Fatalf("import exit=%d err=%s", code, errOut)
+	}
+	for _, want := range []string{`"url": "https://example.com/a"`, `"folder": "Reading"`, `"go"`, `"imported"`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("dry-run output missing %s:\n%s", want, out)
+		}
+	}
+}
+
+func TestFeedHandlerCachesAndFallsBack(t *testing.T) {
+	builds := 0
+	fail := false
+	h := &feedHandler{
+		format: feed.FormatAtom,
+		ttl:    time.Hour,
+		stderr: io.Discard,
+		build: func(context.Context) (*feed.Feed, error) {
+			builds++
+			if fail {
+				return nil, errors.New("boom")
+			}
+			return &feed.Feed{ID: "urn:test", Title: "T"}, nil
+		},
+	}
+	get := func(method, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Host = "localhost:8080"
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	for i := 0; i < 2; i++ {
+		rec := get(http.MethodGet, "/")
+		if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/atom+xml") {
+			t.Fatalf("status=%d headers=%v", rec.Code, rec.Header())
+		}
+	}
+	if builds != 1 {
+		t.Fatalf("builds=%d, want 1 (cached)", builds)
+	}
+	h.ttl = 0
+	fail = true
+	rec := get(http.MethodGet, "/")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "urn:test") {
+		t.Fatalf("expected stale feed on failure, status=%d", rec.Code)
+	}
+	if rec := get(http.MethodPost, "/"); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST status=%d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://rebind.example/", nil))
+	if rec.Code != http.StatusMisdirectedRequest {
+		t.Fatalf("foreign Host status=%d", rec.Code)
+	}
+	h.token = "s3cret"
+	if rec := get(http.MethodGet, "/"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("missing token status=%d", rec.Code)
+	}
+	if rec := get(http.MethodGet, "/?token=s3cret"); rec.Code != http.StatusOK {
+		t.Fatalf("query token status=%d", rec.Code)
+	}
+
+	cfgPath := filepath.Join(t.TempDir(), "config.json")
+	writeAuthConfig(t, cfgPath)
+	code, _, errOut := runCmd(t, "ip", "--config", cfgPath, "feed", "--serve", "0.0.0.0:0")
+	if code != 2 || !strings.Contains(errOut, "--token") {
+		t.Fatalf("public feed without a token: exit=%d err=%s", code, errOut)
+	}
+}
+
+func TestRulesRun(t *testing.T) {
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("ParseForm: %v", err)
+		}
+		var payload []map[string]any
+		switch r.URL.Path {
+		case "/api/1/bookmarks/list":
+			payload = []map[string]any{{"type": "user", "user_id": 1, "username": "tester"}}
+			if r.Form.Get("have") == "" && r.Form.Get("folder_id") == "unread" {
+				payload = append(payload,
+					map[string]any{"type": "bookmark", "bookmark_id": 1, "url": "https://go.dev/blog", "title": "Go", "progress": 0.95, "time": 100},
+					map[string]any{"type": "bookmark", "bookmark_id": 2, "url": "https://go.dev/doc", "title": "Doc", "progress": 0.1, "time": 200},
+					map[string]any{"type": "bookmark", "bookmark_id": 3, "url": "https://spam.example", "title": "Buy now", "time": 300},
+				)
+			}
+		case "/api/1/bookmarks/archive", "/api/1/bookmarks/star", "/api/1/bookmarks/delete":
+			calls = append(calls, strings.TrimPrefix(r.URL.Path, "/api/1/bookmarks/")+":"+r.Form.Get("bookmark_id"))
+			id, _ := strconv.Atoi(r.Form.Get("bookmark_id"))
+			payload = []map[string]any{{"type": "bookmark", "bookmark_id": id}}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		b, _ := json.Marshal(payload)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(b)
+	}))
+	defer server.Close()
+
+	cfgDir := t.TempDir()
+	cfgPath := filepath.Join(cfgDir, "config.json")
+	writeAuthConfig(t, cfgPath)
+	rules := `{"rules": [
+  {"name": "finished", "when": "progress>=0.9", "actions": [{"type": "archive"}]},
+  {"name": "go", "when": "url~go.dev", "actions": [{"type": "star"}]},
+  {"name": "spam", "when": "url~spam.example", "actions": [{"type": "delete"}]}
+]}`
+	if err := os.WriteFile(filepath.Join(cfgDir, "rules.json"), []byte(rules), 0o600); err != nil {
+		t.Fatalf("write rules: %v", err)
+	}
+	base := []string{"ip", "--config", cfgPath, "--api-base", server.URL}
+
+	code, out, errOut := runCmd(t, append(base, "--json", "--dry-run", "rules", "run")...)
+	if code != 0 {
+		t.Fatalf("dry-run exit=%d err=%s", code, errOut)
+	}
+	var report rulesReport
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("decode report: %v (%s)", err, out)
+	}
+	// Bookmark 1 is archived by "finished" and therefore not starred by "go".
+	if len(report.Steps) != 3 || report.Steps[0].Action != "archive" || report.Steps[1].BookmarkID != 2 || report.Steps[2].Action != "delete" {
+		t.Fatalf("unexpected plan: %+v", report.Steps)
+	}
+	if len(calls) != 0 {
+		t.Fatalf("dry-run made calls: %v", calls)
+	}
+
+	code, _, errOut = runCmd(t, append(base, "rules", "run")...)
+	if code != 2 || !strings.Contains(errOut, "--yes-really-delete") || len(calls) != 0 {
+		t.Fatalf("expected delete safeguard, exit=%d err=%s calls=%v", code, errOut, calls)
+	}
+
+	code, _, errOut = runCmd(t, append(base, "rules", "run", "--yes-really-delete")...)
+	if code != 0 {
+		t.Fatalf("run exit=%d err=%s", code, errOut)
+	}
+	if got := strings.Join(calls, " "); got != "archive:1 star:2 delete:3" {
+		t.Fatalf("unexpected calls: %s", got)
+	}
+}
+
+func TestRulesTagKeepsFolderChanges(t *testing.T) {
+	fake := fakeapi.New(fakeapi.Options{})
+	fake.Seed(3)
+	goFolder := fake.AddFolder("Go")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	cfgDir := t.TempDir()
+	cfgPath := filepath.Join(cfgDir, "config.json")
+	cfg := config.DefaultConfig()
+	cfg.ConsumerKey = fakeapi.DefaultConsumerKey
+	cfg.ConsumerSecret = fakeapi.DefaultConsumerSecret
+	cfg.OAuthToken = fakeapi.DefaultToken
+	cfg.OAuthTokenSecret = fakeapi.DefaultTokenSecret
+	writeConfig(t, cfgPath, cfg)
+	rulesPath := filepath.Join(cfgDir, "rules.json")
+	rules := `{"rules": [
+  {"name": "done", "when": "title~\"article 1\"", "actions": [{"type": "archive"}, {"type": "tag", "tags": ["read"]}]},
+  {"name": "go", "when": "title~\"article 2\"", "actions": [{"type": "move", "folder": "Go"}, {"type": "tag", "tags": ["go"]}, {"type": "tag", "tags": ["later"]}]}
+]}`
+	if err := os.WriteFile(rulesPath, []byte(rules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	base := []string{"ip", "--config", cfgPath, "--api-base", server.URL}
+	code, out, errOut := runCmd(t, append(base, "--json", "rules", "run")...)
+	if code != 0 {
+		t.Fatalf("rules run exit=%d err=%s", code, errOut)
+	}
+	var report rulesReport
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("decode report: %v (%s)", err, out)
+	}
+	var actions []string
+	for _, s := range report.Steps {
+		actions = append(actions, s.Rule+":"+s.Action)
+	}
+	if got := strings.Join(actions, " "); got != "done:tag done:archive go:tag go:move" {
+		t.Fatalf("tag steps should come first, once per bookmark: %s", got)
+	}
+	for _, b := range fake.State().Bookmarks {
+		var tags []string
+		for _, tag := range b.Tags {
+			tags = append(tags, tag.Name)
+		}
+		switch b.Title {
+		case "Example article 1":
+			if b.Folder != "archive" || !strings.Contains(strings.Join(tags, ","), "read") {
+				t.Errorf("archive+tag: folder=%s tags=%v", b.Folder, tags)
+			}
+		case "Example article 2":
+			if b.Folder != strconv.FormatInt(int64(goFolder.FolderID), 10) || !strings.Contains(strings.Join(tags, ","), "go,later") {
+				t.Errorf("move+tag: folder=%s tags=%v", b.Folder, tags)
+			}
+		}
+	}
+
+	if code, _, errOut := runCmd(t, append(base, "undo")...); code != 0 {
+		t.Fatalf("undo rules run exit=%d err=%s", code, errOut)
+	}
+	for _, b := range fake.State().Bookmarks {
+		if (b.Title == "Example article 1" || b.Title == "Example article 2") && b.Folder != "unread" {
+			t.Errorf("undo should restore %s to unread, folder=%s", b.Title, b.Folder)
+		}
+	}
+
+	starred := `{"rules": [{"name": "fav", "folder": "starred", "when": "starred", "actions": [{"type": "tag", "tags": ["fav"]}]}]}`
+	if err := os.WriteFile(rulesPath, []byte(starred), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	code, _, errOut = runCmd(t, append(base, "--dry-run", "rules", "run")...)
+	if code == 0 || !strings.Contains(errOut, "starred") {
+		t.Fatalf("tag in the starred folder should be rejected: exit=%d err=%s", code, errOut)
+	}
+
+	// Offline, the rule folder is resolved against the local store, so an
+	// archive rule on "ARCHIVE" does not plan archiving again.
+	for _, b := range fake.State().Bookmarks {
+		if b.Title == "Example article 3" {
+			if code, _, errOut := runCmd(t, append(base, "archive", strconv.FormatInt(int64(b.BookmarkID), 10))...); code != 0 {
+				t.Fatalf("archive exit=%d err=%s", code, errOut)
+			}
+		}
+	}
+	archived := `{"rules": [{"name": "old", "folder": "ARCHIVE", "when": "title~\"article 3\"", "actions": [{"type": "archive"}, {"type": "unstar"}]}]}`
+	if err := os.WriteFile(rulesPath, []byte(archived), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, errOut := runCmd(t, append(base, "sync")...); code != 0 {
+		t.Fatalf("sync exit=%d err=%s", code, errOut)
+	}
+	code, out, errOut = runCmd(t, append(base, "--offline", "--dry-run", "--json", "rules", "run")...)
+	if code != 0 {
+		t.Fatalf("offline rules run exit=%d err=%s", code, errOut)
+	}
+	report = rulesReport{}
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("decode report: %v (%s)", err, out)
+	}
+	if len(report.Steps) != 1 || report.Steps[0].Action != "unstar" {
+		t.Fatalf("offline rule folder not resolved: %+v", report.Steps)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.json")
+	cfg := writeAuthConfig(t, cfgPath)
+	cfg.User = config.User{UserID: 1, Username: "me"}
+	cfg.Profiles = map[string]*config.Profile{
+		"work": {APIBase: "http://127.0.0.1:1", OAuthToken: "wtok", OAuthTokenSecret: "wsecret", User: config.User{UserID: 2, Username: "team"}},
+	}
+	writeConfig(t, cfgPath, cfg)
+
+	authUser := func(args ...string) map[string]any {
+		t.Helper()
+		code, out, errOut := runCmd(t, append(append([]string{"ip", "--config", cfgPath, "--json"}, args...), "auth", "status")...)
+		if code != 0 {
+			t.Fatalf("auth status exit=%d stderr=%s", code, errOut)
+		}
+		var payload map[string]any
+		if err := json.Unmarshal([]byte(out), &payload); err != nil {
+			t.Fatalf("decode: %v\n%s", err, out)
+		}
+		return payload
+	}
+	if p := authUser("--profile", "work"); p["profile"] != "work" || p["user"].(map[string]any)["username"] != "team" {
+		t.Fatalf("unexpected work status: %v", p)
+	}
+	if p := authUser(); p["profile"] != "default" || p["user"].(map[string]any)["username"] != "me" {
+		t.Fatalf("unexpected default status: %v", p)
+	}
+	t.Setenv("INSTAPAPER_PROFILE", "work")
+	if p := authUser(); p["profile"] != "work" {
+		t.Fatalf("INSTAPAPER_PROFILE ignored: %v", p)
+	}
+	t.Setenv("INSTAPAPER_PROFILE", "")
+
+	if code, _, errOut := runCmd(t, "ip", "--config", cfgPath, "--profile", "work", "config", "set", "defaults.list_limit", "7"); code != 0 {
+		t.Fatalf("config set exit=%d stderr=%s", code, errOut)
+	}
+	stored, err := config.Load(cfgPath)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	work := stored.Profiles["work"]
+	if stored.Defaults.ListLimit != 0 || stored.OAuthToken != "tok" || work.Defaults.ListLimit != 7 || work.OAuthToken != "wtok" || work.APIBase != "http://127.0.0.1:1" || work.ConsumerKey != "" {
+		t.Fatalf("profile settings leaked: top=%+v work=%+v", stored, work)
+	}
+
+	if code, _, errOut := runCmd(t, "ip", "--config", cfgPath, "profiles", "use", "work"); code != 0 {
+		t.Fatalf("profiles use exit=%d stderr=%s", code, errOut)
+	}
+	if p := authUser(); p["profile"] != "work" {
+		t.Fatalf("current profile not used: %v", p)
+	}
+	code, out, _ := runCmd(t, "ip", "--config", cfgPath, "--json", "profiles", "list")
+	var infos []profileInfo
+	if code != 0 || json.Unmarshal([]byte(out), &infos) != nil || len(infos) != 2 {
+		t.Fatalf("profiles list exit=%d out=%s", code, out)
+	}
+	if infos[0].Name != "default" || infos[0].Active || infos[1].Name != "work" || !infos[1].Active || !infos[1].Current || infos[1].Username != "team" {
+		t.Fatalf("unexpected profiles: %+v", infos)
+	}
+
+	if code, _, errOut := runCmd(t, "ip", "--config", cfgPath, "profiles", "remove", "work"); code != 0 {
+		t.Fatalf("profiles remove exit=%d stderr=%s", code, errOut)
+	}
+	if stored, _ = config.Load(cfgPath); stored.CurrentProfile != "" || len(stored.Profiles) != 0 {
+		t.Fatalf("profile not removed: %+v", stored)
+	}
+	if code, _, _ := runCmd(t, "ip", "--config", cfgPath, "--profile", "work", "list"); code != 2 {
+		t.Fatalf("missing profile exit=%d, want 2", code)
+	}
+}
+
+func TestCredentialStores(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("credential helper test uses sh")
+	}
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.json")
+	cfg := writeAuthConfig(t, cfgPath)
+	cfg.Profiles = map[string]*config.Profile{"work": {OAuthToken: "wtok", OAuthTokenSecret: "wsecret", User: config.User{UserID: 2}}}
+	writeConfig(t, cfgPath, cfg)
+	t.Setenv("INSTAPAPER_PASSPHRASE", "correct horse")
+
+	ip := func(args ...string) (int, string, string) {
+		return runCmd(t, append([]string{"ip", "--config", cfgPath}, args...)...)
+	}
+	fileContains := func(path string, secrets ...string) bool {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read %s: %v", path, err)
+		}
+		for _, s := range secrets {
+			if strings.Contains(string(b), s) {
+				return true
+			}
+		}
+		return false
+	}
+	loggedIn := func(profile string) bool {
+		t.Helper()
+		code, out, errOut := ip("--profile", profile, "--json", "auth", "status")
+		if code != 0 {
+			t.Fatalf("auth status exit=%d stderr=%s", code, errOut)
+		}
+		return strings.Contains(out, `"logged_in": true`)
+	}
+
+	if code, _, errOut := ip("auth", "storage", "encrypted"); code != 0 {
+		t.Fatalf("storage encrypted exit=%d stderr=%s", code, errOut)
+	}
+	encPath := filepath.Join(dir, "credentials.enc")
+	if fileContains(cfgPath, "toksecret", `"cs"`, "wsecret") || fileContains(encPath, "toksecret", "wsecret") {
+		t.Fatalf("secrets left in plaintext")
+	}
+	if !loggedIn("default") || !loggedIn("work") {
+		t.Fatalf("expected both profiles to be logged in from the encrypted store")
+	}
+	t.Setenv("INSTAPAPER_PASSPHRASE", "wrong")
+	if code, _, _ := ip("auth", "status"); code == 0 {
+		t.Fatalf("expected wrong passphrase to fail")
+	}
+	t.Setenv("INSTAPAPER_PASSPHRASE", "correct horse")
+
+	// Scrypt parameters from the file are bounded before deriving the key.
+	enc, err := os.ReadFile(encPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var header map[string]any
+	if err := json.Unmarshal(enc, &header); err != nil {
+		t.Fatal(err)
+	}
+	header["p"] = 64
+	costly, _ := json.Marshal(header)
+	if err := os.WriteFile(encPath, costly, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, errOut := ip("auth", "status"); code == 0 || !strings.Contains(errOut, "scrypt parameters too large") {
+		t.Fatalf("expected oversized scrypt parameters to be rejected, exit=%d err=%s", code, errOut)
+	}
+	if err := os.WriteFile(encPath, enc, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	vault := filepath.Join(dir, "vault")
+	if err := os.Mkdir(vault, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(dir, "helper.sh")
+	helper := `user=""; pass=""
+while IFS= read -r line; do
+  [ -z "$line" ] && break
+  case "$line" in username=*) user=${line#username=};; password=*) pass=${line#password=};; esac
+done
+case "$1" in
+  get) [ -f "` + vault + `/$user" ] && printf 'password=%s\n' "$(cat "` + vault + `/$user")";;
+  store) printf '%s' "$pass" > "` + vault + `/$user";;
+  erase) rm -f "` + vault + `/$user";;
+esac
+exit 0
+`
+	if err := os.WriteFile(script, []byte(helper), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, errOut := ip("auth", "storage", "helper", "--helper", "!sh "+script); code != 0 {
+		t.Fatalf("storage helper exit=%d stderr=%s", code, errOut)
+	}
+	if !fileContains(filepath.Join(vault, "work"), "wsecret") || fileContains(encPath, "toksecret") {
+		t.Fatalf("secrets not moved to the helper")
+	}
+	if !loggedIn("work") {
+		t.Fatalf("expected work to be logged in via the helper")
+	}
+	if code, _, errOut := ip("auth", "logout"); code != 0 {
+		t.Fatalf("logout exit=%d stderr=%s", code, errOut)
+	}
+	if loggedIn("default") || fileContains(filepath.Join(vault, "default"), "toksecret") || !fileContains(filepath.Join(vault, "default"), `"cs"`) {
+		t.Fatalf("logout did not clear the stored token")
+	}
+
+	if code, out, _ := ip("auth", "storage"); code != 0 || !strings.Contains(out, "helper") {
+		t.Fatalf("storage show exit=%d out=%s", code, out)
+	}
+	// Another command for the same backend must not erase what it just stored.
+	if code, _, errOut := ip("auth", "storage", "helper", "--helper", "!/bin/sh "+script); code != 0 {
+		t.Fatalf("storage helper switch exit=%d stderr=%s", code, errOut)
+	}
+	if !fileContains(filepath.Join(vault, "work"), "wsecret") || !loggedIn("work") {
+		t.Fatalf("helper switch lost the stored secrets")
+	}
+	if code, _, errOut := ip("auth", "storage", "file"); code != 0 {
+		t.Fatalf("storage file exit=%d stderr=%s", code, errOut)
+	}
+	if !fileContains(cfgPath, "wsecret") {
+		t.Fatalf("secrets not moved back to config.json")
+	}
+	if _, err := os.Stat(filepath.Join(vault, "work")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("helper entry not erased: %v", err)
+	}
+}
+
+func TestBulkConcurrencyKeepsOrder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/1/bookmarks/archive" {
+			http.NotFound(w, r)
+			return
+		}
+		id, _ := strconv.Atoi(r.FormValue("bookmark_id"))
+		// Earlier ids finish last.
+		time.Sleep(time.Duration(5-id) * 10 * time.Millisecond)
+		b, _ := json.Marshal([]map[string]any{{"type": "bookmark", "bookmark_id": id}})
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(b)
+	}))
+	defer server.Close()
+
+	cfgPath := filepath.Join(t.TempDir(), "config.json")
+	writeAuthConfig(t, cfgPath)
+	code, out, errOut := runCmd(t, "ip", "--config", cfgPath, "--api-base", server.URL, "--rate", "100/s",
+		"archive", "--ids", "1,2,3,4", "--concurrency", "3")
+	if code != 0 {
+		t.Fatalf("exit=%d err=%s", code, errOut)
+	}
+	if want := "OK archive 1\nOK archive 2\nOK archive 3\nOK archive 4\n"; out != want {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+
+	code, _, errOut = runCmd(t, "ip", "--config", cfgPath, "--rate", "fast", "archive", "1")
+	if code != 2 || !strings.Contains(errOut, "invalid rate") {
+		t.Fatalf("expected usage error, exit=%d err=%s", code, errOut)
+	}
+}
+
+func TestJobsResume(t *testing.T) {
+	var calls []string
+	failing := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.FormValue("bookmark_id")
+		calls = append(calls, id)
+		w.Header().Set("Content-Type", "application/json")
+		if failing && id == "2" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`[{"type":"error","error_code":1500,"message":"Unexpected service error"}]`))
+			return
+		}
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	cfgDir := t.TempDir()
+	cfgPath := filepath.Join(cfgDir, "config.json")
+	writeAuthConfig(t, cfgPath)
+	base := []string{"ip", "--config", cfgPath, "--api-base", server.URL}
+
+	code, _, errOut := runCmd(t, append(base, "delete", "--ids", "1,2,3", "--yes-really-delete")...)
+	if code == 0 || !strings.Contains(errOut, "1 of 3 items remaining; resume with: ip jobs resume ") {
+		t.Fatalf("expected failure with resume hint, exit=%d err=%s", code, errOut)
+	}
+
+	code, out, errOut := runCmd(t, append(base, "--json", "jobs", "list")...)
+	if code != 0 {
+		t.Fatalf("jobs list exit=%d err=%s", code, errOut)
+	}
+	var jobs []jobInfo
+	if err := json.Unmarshal([]byte(out), &jobs); err != nil {
+		t.Fatalf("decode jobs: %v (%s)", err, out)
+	}
+	if len(jobs) != 1 || jobs[0].Command != "delete" || jobs[0].Status != "failed" || jobs[0].Succeeded != 2 || jobs[0].Remaining != 1 {
+		t.Fatalf("unexpected jobs: %+v", jobs)
+	}
+
+	failing = false
+	calls = nil
+	code, out, errOut = runCmd(t, append(base, "jobs", "resume", jobs[0].ID)...)
+	if code != 0 {
+		t.Fatalf("resume exit=%d err=%s", code, errOut)
+	}
+	if strings.Join(calls, ",") != "2" || out != "Deleted 2\n" {
+		t.Fatalf("resume should only retry item 2: calls=%v out=%q", calls, out)
+	}
+	if _, err := os.Stat(jobs[0].Path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("completed job not removed: %v", err)
+	}
+}
+
+func TestOfflineRejectsMutations(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	cfgPath := filepath.Join(t.TempDir(), "config.json")
+	writeAuthConfig(t, cfgPath)
+	base := []string{"ip", "--config", cfgPath, "--api-base", server.URL, "--offline"}
+	for _, args := range [][]string{
+		{"add", "https://example.com/a"},
+		{"import", "--input", "-"},
+		{"archive", "1"},
+		{"unarchive", "1"},
+		{"star", "1"},
+		{"unstar", "1"},
+		{"move", "1", "--folder", "2"},
+		{"delete", "1", "--yes-really-delete"},
+		{"progress", "1", "--progress", "0.5", "--timestamp", "1"},
+		{"undo"},
+	} {
+		code, _, errOut := runCmd(t, append(base, args...)...)
+		if code != 2 || !strings.Contains(errOut, "--offline") {
+			t.Fatalf("%v: exit=%d err=%s", args, code, errOut)
+		}
+	}
+	if calls != 0 {
+		t.Fatalf("offline mutations reached the API %d time(s)", calls)
+	}
+}
+
+func TestUndo(t *testing.T) {
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/1/folders/list":
+			_, _ = w.Write([]byte(`[]`))
+			return
+		case "/api/1/bookmarks/list":
+			if r.FormValue("folder_id") == "unread" && r.FormValue("have") == "" {
+				_, _ = w.Write([]byte(`{"bookmarks": [{"type": "bookmark", "bookmark_id": 1}, {"type": "bookmark", "bookmark_id": 2}, {"type": "bookmark", "bookmark_id": 3}]}`))
+			} else {
+				_, _ = w.Write([]byte(`{"bookmarks": []}`))
+			}
+			return
+		}
+		id, _ := strconv.Atoi(r.FormValue("bookmark_id"))
+		calls = append(calls, strings.TrimPrefix(r.URL.Path, "/api/1/bookmarks/")+":"+r.FormValue("bookmark_id"))
+		b, _ := json.Marshal([]map[string]any{{"type": "bookmark", "bookmark_id": id}})
+		_, _ = w.Write(b)
+	}))
+	defer server.Close()
+
+	cfgPath := filepath.Join(t.TempDir(), "config.json")
+	writeAuthConfig(t, cfgPath)
+	base := []string{"ip", "--config", cfgPath, "--api-base", server.URL}
+
+	if code, _, errOut := runCmd(t, append(base, "archive", "--ids", "1,2")...); code != 0 {
+		t.Fatalf("archive exit=%d err=%s", code, errOut)
+	}
+	if code, _, errOut := runCmd(t, append(base, "star", "3")...); code != 0 {
+		t.Fatalf("star exit=%d err=%s", code, errOut)
+	}
+	code, out, errOut := runCmd(t, append(base, "--json", "undo", "--list")...)
+	if code != 0 {
+		t.Fatalf("undo --list exit=%d err=%s", code, errOut)
+	}
+	var ops []undoOpInfo
+	if err := json.Unmarshal([]byte(out), &ops); err != nil {
+		t.Fatalf("decode ops: %v (%s)", err, out)
+	}
+	if len(ops) != 2 || ops[0].Command != "star" || ops[1].Command != "archive" || ops[1].Items != 2 {
+		t.Fatalf("unexpected ops: %+v", ops)
+	}
+
+	calls = nil
+	code, out, errOut = runCmd(t, append(base, "undo", "--op", ops[1].ID)...)
+	if code != 0 {
+		t.Fatalf("undo exit=%d err=%s", code, errOut)
+	}
+	if got := strings.Join(calls, " "); got != "unarchive:2 unarchive:1" || out != "OK unarchive 2\nOK unarchive 1\n" {
+		t.Fatalf("unexpected undo: calls=%s out=%q", got, out)
+	}
+
+	calls = nil
+	if code, _, errOut := runCmd(t, append(base, "undo", "--last", "5")...); code != 0 {
+		t.Fatalf("undo --last exit=%d err=%s", code, errOut)
+	}
+	if got := strings.Join(calls, " "); got != "unstar:3" {
+		t.Fatalf("unexpected calls: %s", got)
+	}
+	code, _, errOut = runCmd(t, append(base, "undo")...)
+	if code != 1 || !strings.Contains(errOut, "nothing to undo") {
+		t.Fatalf("expected nothing to undo, exit=%d err=%s", code, errOut)
+	}
+}
+
+func TestUndoLookupIsBounded(t *testing.T) {
+	var lists int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/1/folders/list":
+			_, _ = w.Write([]byte(`[]`))
+		case "/api/1/bookmarks/list":
+			// An endless account that never contains the bookmark.
+			lists++
+			_, _ = w.Write([]byte(`{"bookmarks": [{"type": "bookmark", "bookmark_id": ` + strconv.Itoa(1000+lists) + `}]}`))
+		default:
+			_, _ = w.Write([]byte(`[{"type": "bookmark", "bookmark_id": 1}]`))
+		}
+	}))
+	defer server.Close()
+
+	cfgPath := filepath.Join(t.TempDir(), "config.json")
+	writeAuthConfig(t, cfgPath)
+	if code, _, errOut := runCmd(t, "ip", "--config", cfgPath, "--api-base", server.URL, "archive", "1"); code != 0 {
+		t.Fatalf("archive exit=%d err=%s", code, errOut)
+	}
+	if lists != undoLookupPages {
+		t.Fatalf("undo lookup listed %d pages, want %d", lists, undoLookupPages)
+	}
+}
+
+func TestUndoTracksState(t *testing.T) {
+	fake := fakeapi.New(fakeapi.Options{})
+	fake.Seed(5)
+	goFolder := fake.AddFolder("Go")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	ids := map[string]int64{}
+	for _, b := range fake.State().Bookmarks {
+		ids[b.Title] = int64(b.BookmarkID)
+	}
+	folderOf := func(id int64) string {
+		for _, b := range fake.State().Bookmarks {
+			if int64(b.BookmarkID) == id {
+				return b.Folder
+			}
+		}
+		return ""
+	}
+	setup := func() []string {
+		cfgPath := filepath.Join(t.TempDir(), "config.json")
+		cfg := config.DefaultConfig()
+		cfg.ConsumerKey = fakeapi.DefaultConsumerKey
+		cfg.ConsumerSecret = fakeapi.DefaultConsumerSecret
+		cfg.OAuthToken = fakeapi.DefaultToken
+		cfg.OAuthTokenSecret = fakeapi.DefaultTokenSecret
+		writeConfig(t, cfgPath, cfg)
+		return []string{"ip", "--config", cfgPath, "--api-base", server.URL}
+	}
+	run := func(args ...string) {
+		t.Helper()
+		if code, _, errOut := runCmd(t, args...); code != 0 {
+			t.Fatalf("%v exit=%d err=%s", args[len(args)-2:], code, errOut)
+		}
+	}
+
+	// The second command must see the state the first one left, not the
+	// synced snapshot.
+	base := setup()
+	first := strconv.FormatInt(ids["Example article 1"], 10)
+	run(append(base, "sync")...)
+	run(append(base, "archive", first)...)
+	run(append(base, "unarchive", first)...)
+	run(append(base, "undo")...)
+	if got := folderOf(ids["Example article 1"]); got != "archive" {
+		t.Fatalf("undo of unarchive should archive again, folder=%q", got)
+	}
+	run(append(base, "undo")...)
+	if got := folderOf(ids["Example article 1"]); got != "unread" {
+		t.Fatalf("undo of archive should unarchive, folder=%q", got)
+	}
+
+	// Without a local store the prior state is looked up, not guessed.
+	base = setup()
+	fifth := strconv.FormatInt(ids["Example article 5"], 10)
+	run(append(base, "move", fifth, "--folder", "Go")...)
+	if got := folderOf(ids["Example article 5"]); got != strconv.FormatInt(int64(goFolder.FolderID), 10) {
+		t.Fatalf("move failed, folder=%q", got)
+	}
+	run(append(base, "undo")...)
+	if got := folderOf(ids["Example article 5"]); got != "archive" {
+		t.Fatalf("undo of move should restore Archive, folder=%q", got)
+	}
+	second := strconv.FormatInt(ids["Example article 2"], 10)
+	run(append(base, "progress", second, "--progress", "0.5", "--timestamp", "100")...)
+	run(append(base, "undo")...)
+	for _, b := range fake.State().Bookmarks {
+		if int64(b.BookmarkID) == ids["Example article 2"] && b.Progress != 0 {
+			t.Fatalf("undo of progress should restore 0, got %v", b.Progress)
+		}
+	}
+}
+
+func TestRetryPolicyConfigAndDebugEvents(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/api/1/bookmarks/star" {
+			_, _ = w.Write([]byte(`[]`))
+			return
+		}
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"type":"bookmark","bookmark_id":1}]`))
+	}))
+	defer server.Close()
+
+	cfgPath := filepath.Join(t.TempDir(), "config.json")
+	writeAuthConfig(t, cfgPath)
+	base := []string{"ip", "--config", cfgPath, "--api-base", server.URL}
+	if code, _, errOut := runCmd(t, append(base, "config", "set", "retry.count", "2")...); code != 0 {
+		t.Fatalf("config set exit=%d err=%s", code, errOut)
+	}
+	if code, _, errOut := runCmd(t, append(base, "config", "set", "retry.on", "bogus")...); code == 0 {
+		t.Fatalf("expected invalid retry.on to fail: %s", errOut)
+	}
+	code, out, _ := runCmd(t, append(base, "config", "get", "retry.count")...)
+	if code != 0 || !strings.Contains(out, `"value":2`) {
+		t.Fatalf("config get exit=%d out=%q", code, out)
+	}
+
+	code, _, errOut := runCmd(t, append(base, "--debug-json", "star", "1")...)
+	if code != 0 {
+		t.Fatalf("star exit=%d err=%s", code, errOut)
+	}
+	if calls != 2 || !strings.Contains(errOut, `"type":"retry"`) || !strings.Contains(errOut, `"class":"rate_limit"`) {
+		t.Fatalf("expected one retry event, calls=%d err=%s", calls, errOut)
+	}
+
+	calls = 0
+	code, _, _ = runCmd(t, append(base, "--retry-on", "server", "star", "1")...)
+	if code == 0 || calls != 1 {
+		t.Fatalf("--retry-on server retried a 429: exit=%d calls=%d", code, calls)
+	}
+	if code, _, _ := runCmd(t, append(base, "--retry-jitter", "2", "star", "1")...); code != 2 {
+		t.Fatalf("expected usage error for --retry-jitter 2, exit=%d", code)
+	}
+}
+
+func TestFakeAPIEndToEnd(t *testing.T) {
+	fake := fakeapi.New(fakeapi.Options{})
+	fake.Seed(3)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	cfgPath := filepath.Join(t.TempDir(), "config.json")
+	cfg := config.DefaultConfig()
+	cfg.ConsumerKey = fakeapi.DefaultConsumerKey
+	cfg.ConsumerSecret = fakeapi.DefaultConsumerSecret
+	cfg.OAuthToken = fakeapi.DefaultToken
+	cfg.OAuthTokenSecret = fakeapi.DefaultTokenSecret
+	writeConfig(t, cfgPath, cfg)
+	base := []string{"ip", "--config", cfgPath, "--api-base", server.URL}
+
+	code, out, errOut := runCmd(t, append(base, "--quiet", "add", "https://example.com/new")...)
+	if code != 0 {
+		t.Fatalf("add exit=%d err=%s", code, errOut)
+	}
+	id := strings.TrimSpace(out)
+	if code, _, errOut := runCmd(t, append(base, "archive", id)...); code != 0 {
+		t.Fatalf("archive exit=%d err=%s", code, errOut)
+	}
+	code, out, errOut = runCmd(t, append(base, "--plain", "list", "--folder", "archive")...)
+	if code != 0 || !strings.HasPrefix(out, id+"\t") {
+		t.Fatalf("list archive exit=%d out=%q err=%s", code, out, errOut)
+	}
+
+	fake.InjectFault(fakeapi.Fault{Code: 1041, Path: "/api/1/folders/list", Times: 1})
+	if code, _, _ := runCmd(t, append(base, "folders", "list")...); code != 11 {
+		t.Fatalf("expected exit 11 for injected 1041, got %d", code)
+	}
+	if code, _, errOut := runCmd(t, append(base, "sync")...); code != 0 {
+		t.Fatalf("sync exit=%d err=%s", code, errOut)
+	}
+	code, out, _ = runCmd(t, append(base, "--offline", "--plain", "list", "--folder", "unread")...)
+	if code != 0 || strings.Count(out, "\n") != 3 {
+		t.Fatalf("offline list exit=%d out=%q", code, out)
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	fake := fakeapi.New(fakeapi.Options{})
+	fake.Seed(4)
+	server := httptest.NewServer(fake)
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.json")
+	cfg := config.DefaultConfig()
+	cfg.ConsumerKey = fakeapi.DefaultConsumerKey
+	cfg.ConsumerSecret = fakeapi.DefaultConsumerSecret
+	cfg.OAuthToken = fakeapi.DefaultToken
+	cfg.OAuthTokenSecret = fakeapi.DefaultTokenSecret
+	writeConfig(t, cfgPath, cfg)
+	cassette := filepath.Join(dir, "bug.cassette")
+
+	code, recorded, errOut := runCmd(t, "ip", "--config", cfgPath, "--api-base", server.URL, "--record", cassette, "--plain", "list", "--limit", "3")
+	if code != 0 {
+		t.Fatalf("record exit=%d err=%s", code, errOut)
+	}
+	server.Close()
+	raw, _ := os.ReadFile(cassette)
+	if strings.Contains(string(raw), fakeapi.DefaultTokenSecret) || strings.Contains(string(raw), fakeapi.DefaultToken+`"`) {
+		t.Fatalf("cassette leaks the token: %s", raw)
+	}
+
+	// Replay needs neither the server nor a login.
+	emptyCfg := filepath.Join(dir, "empty.json")
+	code, replayed, errOut := runCmd(t, "ip", "--config", emptyCfg, "--replay", cassette, "--plain", "list", "--limit", "3")
+	if code != 0 || replayed != recorded {
+		t.Fatalf("replay exit=%d err=%s\nrecorded=%q\nreplayed=%q", code, errOut, recorded, replayed)
+	}
+	code, _, errOut = runCmd(t, "ip", "--config", emptyCfg, "--replay", cassette, "list", "--limit", "5")
+	if code == 0 || !strings.Contains(errOut, "no recorded response") {
+		t.Fatalf("expected a cassette miss, exit=%d err=%s", code, errOut)
+	}
+	if code, _, _ := runCmd(t, "ip", "--record", cassette, "--replay", cassette, "list"); code != 2 {
+		t.Fatalf("expected usage error for --record with --replay, got %d", code)
+	}
+}
+
+func TestTemplateOutput(t *testing.T) {
+	fake := fakeapi.New(fakeapi.Options{})
+	fake.Seed(5) // 4 unread, 1 archived
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.json")
+	cfg := config.DefaultConfig()
+	cfg.ConsumerKey = fakeapi.DefaultConsumerKey
+	cfg.ConsumerSecret = fakeapi.DefaultConsumerSecret
+	cfg.OAuthToken = fakeapi.DefaultToken
+	cfg.OAuthTokenSecret = fakeapi.DefaultTokenSecret
+	writeConfig(t, cfgPath, cfg)
+	base := []string{"ip", "--config", cfgPath, "--api-base", server.URL}
+
+	code, out, errOut := runCmd(t, append(base, "--template", `- [{{mdescape .Title}}]({{.URL}}) {{domain .URL}}`, "list", "--limit", "2")...)
+	if code != 0 || out != "- [Example article 4](https://example.com/articles/4) example.com\n- [Example article 3](https://example.com/articles/3) example.com\n" {
+		t.Fatalf("list template exit=%d out=%q err=%s", code, out, errOut)
+	}
+
+	tmplPath := filepath.Join(dir, "export.tmpl")
+	if err := os.WriteFile(tmplPath, []byte("{{.Folder}}: {{.Title}}\n"), 0o600); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+	code, out, errOut = runCmd(t, append(base, "--template-file", tmplPath, "export", "--folder", "all")...)
+	if code != 0 || strings.Count(out, "\n") != 5 || !strings.Contains(out, "Archive: Example article 5\n") {
+		t.Fatalf("export template exit=%d out=%q err=%s", code, out, errOut)
+	}
+
+	// Items that render nothing produce no line.
+	code, out, errOut = runCmd(t, append(base, "--template", `{{if eq .Title "Example article 1"}}{{.BookmarkID}}{{end}}`, "list")...)
+	if code != 0 || strings.Count(out, "\n") != 1 {
+		t.Fatalf("list filter template exit=%d out=%q err=%s", code, out, errOut)
+	}
+	code, out, errOut = runCmd(t, append(base, "--template", "{{.HighlightID}} {{.Text}}", "highlights", "list", strings.TrimSpace(out))...)
+	if code != 0 || !strings.HasSuffix(out, " A highlighted passage from article 1.\n") {
+		t.Fatalf("highlights template exit=%d out=%q err=%s", code, out, errOut)
+	}
+
+	if code, _, _ := runCmd(t, append(base, "--template", "{{.Title", "list")...); code != 2 {
+		t.Fatalf("expected usage error for a bad template, got %d", code)
+	}
+	if code, _, _ := runCmd(t, append(base, "--template", "x", "--template-file", tmplPath, "list")...); code != 2 {
+		t.Fatalf("expected usage error for --template with --template-file, got %d", code)
+	}
+	if code, _, _ := runCmd(t, append(base, "--template", "x", "export", "--format", "csv")...); code != 2 {
+		t.Fatalf("expected usage error for --template with a file format, got %d", code)
+	}
+}
+
+func TestListSortGroupAndStats(t *testing.T) {
+	fake := fakeapi.New(fakeapi.Options{})
+	for i, u := range []string{"https://b.example/1", "https://a.example/2", "https://b.example/3", "https://a.example/4"} {
+		bm := instapaper.Bookmark{URL: u, Title: "T" + strconv.Itoa(i), Time: instapaper.Int64(1700000000 - i*86400*40)}
+		if i == 1 {
+			bm.Starred = true
+			bm.Progress = 0.5
+		}
+		fake.AddBookmark(fakeapi.Bookmark{Bookmark: bm})
+	}
+	fake.AddBookmark(fakeapi.Bookmark{Bookmark: instapaper.Bookmark{URL: "https://c.example/5", Title: "T4", Time: 1700000000}, Folder: "archive"})
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	cfgPath := filepath.Join(t.TempDir(), "config.json")
+	cfg := config.DefaultConfig()
+	cfg.ConsumerKey = fakeapi.DefaultConsumerKey
+	cfg.ConsumerSecret = fakeapi.DefaultConsumerSecret
+	cfg.OAuthToken = fakeapi.DefaultToken
+	cfg.OAuthTokenSecret = fakeapi.DefaultTokenSecret
+	writeConfig(t, cfgPath, cfg)
+	base := []string{"ip", "--config", cfgPath, "--api-base", server.URL}
+
+	// Unread grouped by domain, oldest first.
+	code, out, errOut := runCmd(t, append(base, "--template", "{{.Title}}", "list", "--sort", "time")...)
+	if code != 0 || out != "T3\nT2\nT1\nT0\n" {
+		t.Fatalf("sorted list exit=%d out=%q err=%s", code, out, errOut)
+	}
+	code, out, errOut = runCmd(t, append(base, "--plain", "list", "--sort", "time", "--group-by", "domain")...)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if code != 0 || len(lines) != 4 || !strings.HasPrefix(lines[0], "a.example\t") || !strings.HasSuffix(lines[0], "\tT3\thttps://a.example/4") || !strings.HasPrefix(lines[2], "b.example\t") {
+		t.Fatalf("grouped list exit=%d out=%q err=%s", code, out, errOut)
+	}
+
+	code, out, errOut = runCmd(t, append(base, "--json", "list", "--count")...)
+	if code != 0 || strings.TrimSpace(out) != `{
+  "count": 4
+}` {
+		t.Fatalf("count exit=%d out=%q err=%s", code, out, errOut)
+	}
+	code, out, errOut = runCmd(t, append(base, "list", "--group-by", "month", "--sort", "time:desc", "--count")...)
+	if code != 0 || out != "{\"group\":\"2023-11\",\"count\":1}\n{\"group\":\"2023-10\",\"count\":1}\n{\"group\":\"2023-08\",\"count\":1}\n{\"group\":\"2023-07\",\"count\":1}\n" {
+		t.Fatalf("month counts exit=%d out=%q err=%s", code, out, errOut)
+	}
+
+	code, out, errOut = runCmd(t, append(base, "--json", "export", "--folder", "all", "--group-by", "folder", "--stats")...)
+	if code != 0 {
+		t.Fatalf("export stats exit=%d err=%s", code, errOut)
+	}
+	var stats []map[string]any
+	if err := json.Unmarshal([]byte(out), &stats); err != nil {
+		t.Fatalf("stats json: %v\n%s", err, out)
+	}
+	if len(stats) != 2 || stats[0]["group"] != "Unread" || stats[0]["count"] != float64(4) || stats[0]["starred"] != float64(1) || stats[0]["avg_progress"] != 0.125 || stats[0]["domains"] != float64(2) || stats[1]["group"] != "Archive" {
+		t.Fatalf("unexpected stats: %s", out)
+	}
+
+	for _, args := range [][]string{
+		{"list", "--count", "--stats"},
+		{"list", "--group-by", "size"},
+		{"list", "--sort", "size"},
+		{"--json", "list", "--count", "--fields", "url"},
+		{"export", "--format", "csv", "--count"},
+	} {
+		if code, _, _ := runCmd(t, append(base, args...)...); code != 2 {
+			t.Fatalf("%v: expected usage error, got %d", args, code)
+		}
+	}
+}
+
+func TestMCPServe(t *testing.T) {
+	fake := fakeapi.New(fakeapi.Options{})
+	fake.Seed(3)
+	fake.AddFolder("Later")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.json")
+	cfg := config.DefaultConfig()
+	cfg.ConsumerKey = fakeapi.DefaultConsumerKey
+	cfg.ConsumerSecret = fakeapi.DefaultConsumerSecret
+	cfg.OAuthToken = fakeapi.DefaultToken
+	cfg.OAuthTokenSecret = fakeapi.DefaultTokenSecret
+	writeConfig(t, cfgPath, cfg)
+	var bookmarkID int64
+	for _, b := range fake.State().Bookmarks {
+		if b.Title == "Example article 1" {
+			bookmarkID = int64(b.BookmarkID)
+		}
+	}
+	id := strconv.FormatInt(bookmarkID, 10)
+
+	serve := func(args []string, lines ...string) []map[string]any {
+		t.Helper()
+		in := filepath.Join(dir, "requests.ndjson")
+		if err := os.WriteFile(in, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+			t.Fatalf("write requests: %v", err)
+		}
+		f, err := os.Open(in)
+		if err != nil {
+			t.Fatalf("open requests: %v", err)
+		}
+		defer f.Close()
+		saved := os.Stdin
+		os.Stdin = f
+		defer func() { os.Stdin = saved }()
+		code, out, errOut := runCmd(t, append([]string{"ip", "--config", cfgPath, "--api-base", server.URL}, args...)...)
+		if code != 0 {
+			t.Fatalf("mcp serve exit=%d err=%s", code, errOut)
+		}
+		var resps []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+			var m map[string]any
+			if err := json.Unmarshal([]byte(line), &m); err != nil {
+				t.Fatalf("response %q: %v", line, err)
+			}
+			resps = append(resps, m)
+		}
+		return resps
+	}
+	result := func(resp map[string]any) map[string]any {
+		t.Helper()
+		r, ok := resp["result"].(map[string]any)
+		if !ok {
+			t.Fatalf("no result: %v", resp)
+		}
+		return r
+	}
+
+	resps := serve([]string{"mcp", "serve"},
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test","version":"0"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"list_bookmarks","arguments":{"limit":2}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"move","arguments":{"bookmark_id":`+id+`,"folder":"Later"}}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"archive","arguments":{"bookmark_id":`+id+`,"dry_run":true}}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"tools/call","params":{"name":"add_highlight","arguments":{"bookmark_id":`+id+`,"text":"A highlighted passage from article 1."}}}`,
+		`{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"get_text","arguments":{"bookmark_id":`+id+`,"format":"text"}}}`,
+		`{"jsonrpc":"2.0","id":8,"method":"tools/call","params":{"name":"archive","arguments":{"id":1}}}`,
+	)
+	if len(resps) != 8 {
+		t.Fatalf("expected 8 responses, got %d", len(resps))
+	}
+	if v := result(resps[0])["protocolVersion"]; v != "2025-06-18" {
+		t.Fatalf("protocolVersion=%v", v)
+	}
+	tools := result(resps[1])["tools"].([]any)
+	var names []string
+	for _, tool := range tools {
+		tm := tool.(map[string]any)
+		names = append(names, tm["name"].(string))
+		if tm["name"] == "archive" {
+			idProp := tm["inputSchema"].(map[string]any)["properties"].(map[string]any)["bookmark_id"].(map[string]any)
+			if idProp["type"] != "integer" {
+				t.Fatalf("bookmark_id schema: %v", idProp)
+			}
+		}
+	}
+	if strings.Join(names, ",") != "list_bookmarks,add_bookmark,archive,move,get_text,list_highlights,add_highlight" {
+		t.Fatalf("tools: %v", names)
+	}
+	listed := result(resps[2])["structuredContent"].(map[string]any)["bookmarks"].([]any)
+	if len(listed) != 2 {
+		t.Fatalf("list_bookmarks returned %d bookmarks", len(listed))
+	}
+	if r := result(resps[3]); r["isError"] != false {
+		t.Fatalf("move: %v", r)
+	}
+	if got, _ := fake.Bookmark(bookmarkID); got.Folder == "archive" || got.Folder == "" {
+		t.Fatalf("bookmark not moved (dry-run archive must not apply): %+v", got)
+	}
+	if dry := result(resps[4])["structuredContent"].(map[string]any); dry["dry_run"] != true || dry["action"] != "archive" {
+		t.Fatalf("dry-run archive: %v", dry)
+	}
+	// The seeded bookmark already has this highlight.
+	if r := result(resps[5]); r["isError"] != true {
+		t.Fatalf("duplicate highlight should fail without --idempotent: %v", r)
+	}
+	if text := result(resps[6])["structuredContent"].(map[string]any)["text"].(string); !strings.Contains(text, "Example article") {
+		t.Fatalf("get_text: %q", text)
+	}
+	if r := result(resps[7]); r["isError"] != true || !strings.Contains(r["content"].([]any)[0].(map[string]any)["text"].(string), "unknown field") {
+		t.Fatalf("unknown argument should be rejected: %v", r)
+	}
+
+	resps = serve([]string{"--idempotent", "mcp", "serve"},
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"add_highlight","arguments":{"bookmark_id":`+id+`,"text":"A highlighted passage from article 1."}}}`,
+	)
+	if sc := result(resps[0])["structuredContent"].(map[string]any); sc["idempotent"] != true {
+		t.Fatalf("--idempotent add_highlight: %v", sc)
+	}
+	resps = serve([]string{"--dry-run", "mcp", "serve"},
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"add_bookmark","arguments":{"url":"https://example.com/new"}}}`,
+	)
+	if sc := result(resps[0])["structuredContent"].(map[string]any); sc["dry_run"] != true || len(fake.State().Bookmarks) != 3 {
+		t.Fatalf("--dry-run add_bookmark: %v", sc)
+	}
+
+	resps = serve([]string{"mcp", "serve", "--read-only"}, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	if n := len(result(resps[0])["tools"].([]any)); n != 3 {
+		t.Fatalf("tools=%d", n)
+	}
+}
+
+func TestWatchEmitsChangeEvents(t *testing.T) {
+	fake := fakeapi.New(fakeapi.Options{})
+	fake.Seed(4)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.json")
+	cfg := config.DefaultConfig()
+	cfg.ConsumerKey = fakeapi.DefaultConsumerKey
+	cfg.ConsumerSecret = fakeapi.DefaultConsumerSecret
+	cfg.OAuthToken = fakeapi.DefaultToken
+	cfg.OAuthTokenSecret = fakeapi.DefaultTokenSecret
+	writeConfig(t, cfgPath, cfg)
+	ids := map[string]string{}
+	for _, b := range fake.State().Bookmarks {
+		ids[b.Title] = strconv.FormatInt(int64(b.BookmarkID), 10)
+	}
+	ip := func(args ...string) string {
+		t.Helper()
+		code, out, errOut := runCmd(t, append([]string{"ip", "--config", cfgPath, "--api-base", server.URL}, args...)...)
+		if code != 0 {
+			t.Fatalf("%v exit=%d err=%s", args, code, errOut)
+		}
+		return out
+	}
+	watchArgs := []string{"watch", "--once", "--folder", "unread,archive"}
+
+	if out := ip(watchArgs...); out != "" {
+		t.Fatalf("first poll should only record the cursor, got %q", out)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "watch", "folder_unread.json")); err != nil {
+		t.Fatalf("cursor not written next to config: %v", err)
+	}
+
+	ip("archive", ids["Example article 1"])
+	ip("star", ids["Example article 2"])
+	ip("progress", ids["Example article 3"], "--progress", "0.5", "--timestamp", strconv.FormatInt(time.Now().Unix()+10, 10))
+	ip("delete", ids["Example article 4"], "--yes-really-delete")
+	ip("add", "https://example.com/new", "--title", "New one")
+
+	got := map[string]map[string]any{}
+	for _, line := range strings.Split(strings.TrimSpace(ip(watchArgs...)), "\n") {
+		var ev map[string]any
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("event %q: %v", line, err)
+		}
+		got[ev["event"].(string)] = ev
+	}
+	if len(got) != 5 {
+		t.Fatalf("expected one event of each kind, got %v", got)
+	}
+	if ev := got["moved"]; ev["from"] != "unread" || ev["to"] != "archive" || ev["folder"] != "archive" {
+		t.Fatalf("moved: %v", ev)
+	}
+	if ev := got["starred_changed"]; ev["from"] != false || ev["to"] != true {
+		t.Fatalf("starred_changed: %v", ev)
+	}
+	if ev := got["progress_changed"]; ev["to"] != 0.5 {
+		t.Fatalf("progress_changed: %v", ev)
+	}
+	if ev := got["deleted"]; ev["folder"] != "unread" || strconv.FormatFloat(ev["bookmark_id"].(float64), 'f', -1, 64) != ids["Example article 4"] {
+		t.Fatalf("deleted: %v", ev)
+	}
+	if ev := got["added"]; ev["bookmark"].(map[string]any)["title"] != "New one" {
+		t.Fatalf("added: %v", ev)
+	}
+
+	if out := ip(watchArgs...); out != "" {
+		t.Fatalf("no changes should emit nothing, got %q", out)
+	}
+}
+
+func TestWebhooksRunAndRedeliver(t *testing.T) {
+	fake := fakeapi.New(fakeapi.Options{})
+	fake.Seed(2)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	type received struct {
+		event, delivery string
+		body            map[string]any
+	}
+	var chat, tracker []received
+	trackerUp := false
+	hooks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var m map[string]any
+		_ = json.Unmarshal(body, &m)
+		rec := received{event: r.Header.Get(webhook.EventHeader), delivery: r.Header.Get(webhook.DeliveryHeader), body: m}
+		switch r.URL.Path {
+		case "/chat":
+			if !webhook.Verify("chat-secret", body, r.Header.Get(webhook.SignatureHeader)) {
+				t.Errorf("chat: bad signature")
+			}
+			chat = append(chat, rec)
+		case "/tracker":
+			if !trackerUp {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			tracker = append(tracker, rec)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer hooks.Close()
+
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.json")
+	cfg := config.DefaultConfig()
+	cfg.ConsumerKey = fakeapi.DefaultConsumerKey
+	cfg.ConsumerSecret = fakeapi.DefaultConsumerSecret
+	cfg.OAuthToken = fakeapi.DefaultToken
+	cfg.OAuthTokenSecret = fakeapi.DefaultTokenSecret
+	noRetries := 0
+	cfg.Webhooks = &config.Webhooks{
+		Retry: &config.Retry{Count: &noRetries},
+		Hooks: []config.Webhook{
+			{Name: "chat", URL: hooks.URL + "/chat", Events: []string{"starred_changed"}, Select: "starred", Secret: "chat-secret"},
+			{Name: "tracker", URL: hooks.URL + "/tracker", Events: []string{"*"}},
+		},
+	}
+	writeConfig(t, cfgPath, cfg)
+	ids := map[string]string{}
+	for _, b := range fake.State().Bookmarks {
+		ids[b.Title] = strconv.FormatInt(int64(b.BookmarkID), 10)
+	}
+	ip := func(want int, args ...string) string {
+		t.Helper()
+		code, out, errOut := runCmd(t, append([]string{"ip", "--config", cfgPath, "--api-base", server.URL}, args...)...)
+		if code != want {
+			t.Fatalf("%v exit=%d want %d err=%s", args, code, want, errOut)
+		}
+		return out
+	}
+
+	ip(0, "webhooks", "run")
+	if len(chat)+len(tracker) != 0 {
+		t.Fatalf("first run should only record cursors")
+	}
+	ip(0, "star", ids["Example article 1"])
+	ip(0, "add", "https://example.com/new", "--title", "New one")
+
+	out := ip(1, "webhooks", "run")
+	if n := strings.Count(out, `"status":"failed"`); n != 2 || strings.Count(out, `"status":"delivered"`) != 1 {
+		t.Fatalf("deliveries: %s", out)
+	}
+	if len(chat) != 1 || chat[0].event != "starred_changed" || chat[0].body["to"] != true {
+		t.Fatalf("chat got %+v", chat)
+	}
+	deadPath := filepath.Join(dir, "webhooks-dead.jsonl")
+	b, err := os.ReadFile(deadPath)
+	if err != nil || strings.Count(string(b), "\n") != 2 {
+		t.Fatalf("dead letters: %q err=%v", b, err)
+	}
+
+	trackerUp = true
+	ip(0, "webhooks", "redeliver")
+	if len(tracker) != 2 {
+		t.Fatalf("tracker got %+v", tracker)
+	}
+	if !strings.Contains(string(b), tracker[0].delivery) {
+		t.Fatalf("redelivery should keep the delivery id %s", tracker[0].delivery)
+	}
+	if _, err := os.Stat(deadPath); !os.IsNotExist(err) {
+		t.Fatalf("dead-letter file should be removed once empty: %v", err)
+	}
+	if out := ip(0, "--plain", "webhooks", "list"); strings.Join(strings.Fields(strings.Split(out, "\n")[0])[:3], " ") != "chat starred_changed true" {
+		t.Fatalf("list: %q", out)
+	}
+}
+
+func TestServeAPI(t *testing.T) {
+	fake := fakeapi.New(fakeapi.Options{})
+	fake.Seed(3)
+	upstream := httptest.NewServer(fake)
+	defer upstream.Close()
+	client, err := instapaper.NewClient(upstream.URL, fakeapi.DefaultConsumerKey, fakeapi.DefaultConsumerSecret, &oauth1.Token{Key: fakeapi.DefaultToken, Secret: fakeapi.DefaultTokenSecret}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id int64
+	for _, b := range fake.State().Bookmarks {
+		if b.Title == "Example article 2" {
+			id = int64(b.BookmarkID)
+		}
+	}
+	if _, err := client.Star(context.Background(), id); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(newServeHandler(client, "tok", time.Minute))
+	defer srv.Close()
+
+	get := func(path string, v any) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer tok")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if v != nil {
+			if err := json.Unmarshal(body, v); err != nil {
+				t.Fatalf("%s: %v: %s", path, err, body)
+			}
+		}
+		return resp
+	}
+
+	var bookmarks []instapaper.Bookmark
+	if resp := get("/bookmarks?select=starred=1", &bookmarks); resp.StatusCode != 200 || len(bookmarks) == 0 {
+		t.Fatalf("bookmarks: %d %+v", resp.StatusCode, bookmarks)
+	}
+	found := false
+	for _, b := range bookmarks {
+		if !bool(b.Starred) {
+			t.Fatalf("select=starred=1 returned %+v", b)
+		}
+		found = found || int64(b.BookmarkID) == id
+	}
+	if !found {
+		t.Fatalf("starred bookmark %d missing from %+v", id, bookmarks)
+	}
+	var highlights []instapaper.Highlight
+	if resp := get("/highlights?folder=unread", &highlights); resp.StatusCode != 200 || len(highlights) != 3 {
+		t.Fatalf("folder highlights: %d %+v", resp.StatusCode, highlights)
+	}
+	if resp := get("/highlights?bookmark_id="+strconv.FormatInt(id, 10), &highlights); resp.StatusCode != 200 || len(highlights) != 1 || int64(highlights[0].BookmarkID) != id {
+		t.Fatalf("bookmark highlights: %d %+v", resp.StatusCode, highlights)
+	}
+	var folders []instapaper.Folder
+	if resp := get("/folders", &folders); resp.StatusCode != 200 {
+		t.Fatalf("folders: %d", resp.StatusCode)
+	}
+	var apiErr struct {
+		Error struct{ Code string } `json:"error"`
+	}
+	if resp := get("/bookmarks?folder=No+such+folder", &apiErr); resp.StatusCode != 400 || apiErr.Error.Code != "invalid_request" {
+		t.Fatalf("unknown folder: %d %+v", resp.StatusCode, apiErr)
+	}
+	resp := get("/bookmarks/"+strconv.FormatInt(id, 10)+"/text?format=text", nil)
+	if resp.StatusCode != 200 || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Fatalf("text: %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	t.Setenv("INSTAPAPER_SERVE_TOKEN", "")
+	code, _, errOut := runCmd(t, append(append([]string{"ip"}, tempConfigArg(t)...), "serve", "--listen", "0.0.0.0:0")...)
+	if code != 2 || !strings.Contains(errOut, "non-loopback") {
+		t.Fatalf("serve without token on all interfaces: exit=%d err=%s", code, errOut)
+	}
+}
+
+func TestDedupeAndSkipExisting(t *testing.T) {
+	fake := fakeapi.New(fakeapi.Options{})
+	fake.Seed(2)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.json")
+	cfg := config.DefaultConfig()
+	cfg.ConsumerKey = fakeapi.DefaultConsumerKey
+	cfg.ConsumerSecret = fakeapi.DefaultConsumerSecret
+	cfg.OAuthToken = fakeapi.DefaultToken
+	cfg.OAuthTokenSecret = fakeapi.DefaultTokenSecret
+	writeConfig(t, cfgPath, cfg)
+	ip := func(want int, args ...string) (string, string) {
+		t.Helper()
+		code, out, errOut := runCmd(t, append([]string{"ip", "--config", cfgPath, "--api-base", server.URL}, args...)...)
+		if code != want {
+			t.Fatalf("%v exit=%d want %d err=%s", args, code, want, errOut)
+		}
+		return out, errOut
+	}
+	var original int64
+	for _, b := range fake.State().Bookmarks {
+		if b.URL == "https://example.com/articles/1" {
+			original = int64(b.BookmarkID)
+		}
+	}
+	ip(0, "add", "https://example.com/articles/1?utm_source=newsletter")
+	ip(0, "add", "http://www.example.com/articles/1/")
+
+	var report dedupeReport
+	out, _ := ip(0, "--json", "dedupe")
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("dedupe json: %v\n%s", err, out)
+	}
+	if len(report.Groups) != 1 || report.Duplicates != 2 || report.Groups[0].Key != "https://example.com/articles/1" {
+		t.Fatalf("dedupe report: %+v", report)
+	}
+
+	if _, errOut := ip(2, "dedupe", "--apply", "keep-oldest", "--action", "delete"); !strings.Contains(errOut, "--yes-really-delete") {
+		t.Fatalf("delete without confirmation: %s", errOut)
+	}
+	out, _ = ip(0, "--json", "dedupe", "--apply", "keep-oldest")
+	report = dedupeReport{}
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Applied != 2 || report.Groups[0].Bookmarks[0].BookmarkID != original || report.Groups[0].Bookmarks[0].Action != "keep" {
+		t.Fatalf("apply keep-oldest: %+v", report)
+	}
+	out, _ = ip(0, "--json", "dedupe", "--folder", "unread")
+	report = dedupeReport{}
+	if err := json.Unmarshal([]byte(out), &report); err != nil || len(report.Groups) != 0 {
+		t.Fatalf("unread still has duplicates: %s", out)
+	}
+	out, _ = ip(0, "--json", "dedupe", "--apply", "keep-oldest")
+	report = dedupeReport{}
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Applied != 0 || report.Skipped != 2 {
+		t.Fatalf("archived duplicates should be skipped: %+v", report)
+	}
+
+	// Offline, --folder is resolved against the local store like online.
+	ip(0, "sync")
+	out, _ = ip(0, "--offline", "--dry-run", "--json", "dedupe", "--folder", "ARCHIVE", "--apply", "keep-oldest")
+	report = dedupeReport{}
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Skipped != 1 || report.Groups[0].Bookmarks[1].Folder != "Archive" {
+		t.Fatalf("offline --folder ARCHIVE not resolved: %+v", report)
+	}
+
+	before := len(fake.State().Bookmarks)
+	out, errOut := ip(0, "add", "--skip-existing", "https://www.example.com/articles/2?fbclid=abc")
+	if out != "" || !strings.Contains(errOut, "already saved") {
+		t.Fatalf("add --skip-existing: out=%q err=%q", out, errOut)
+	}
+	input := filepath.Join(dir, "urls.txt")
+	if err := os.WriteFile(input, []byte("https://example.com/articles/2/\nhttps://example.com/new\nhttps://example.com/new?utm_campaign=z\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, errOut = ip(0, "--plain", "import", "--skip-existing", "--input", input)
+	if got := len(fake.State().Bookmarks); got != before+1 || !strings.Contains(errOut, "duplicate in input") {
+		t.Fatalf("import --skip-existing added %d bookmark(s), err=%s", got-before, errOut)
+	}
+
+	// A failed add must not turn its repeat into a "duplicate in input".
+	before = len(fake.State().Bookmarks)
+	if err := os.WriteFile(input, []byte("https://example.com/flaky\nhttps://example.com/flaky?utm_source=x\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fake.InjectFault(fakeapi.Fault{Code: 1500, Path: "/api/1/bookmarks/add", Times: 1})
+	code, _, errOut := runCmd(t, "ip", "--config", cfgPath, "--api-base", server.URL, "--plain", "import", "--skip-existing", "--input", input)
+	if code == 0 || strings.Contains(errOut, "duplicate in input") || len(fake.State().Bookmarks) != before+1 {
+		t.Fatalf("repeat of a failed add was skipped: exit=%d err=%s", code, errOut)
+	}
+}
+
+func TestIdempotentBulkCountsAsSuccess(t *testing.T) {
+	fake := fakeapi.New(fakeapi.Options{})
+	fake.Seed(2)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	cfgDir := t.TempDir()
+	cfgPath := filepath.Join(cfgDir, "config.json")
+	cfg := config.DefaultConfig()
+	cfg.ConsumerKey = fakeapi.DefaultConsumerKey
+	cfg.ConsumerSecret = fakeapi.DefaultConsumerSecret
+	cfg.OAuthToken = fakeapi.DefaultToken
+	cfg.OAuthTokenSecret = fakeapi.DefaultTokenSecret
+	writeConfig(t, cfgPath, cfg)
+	var ids []string
+	for _, b := range fake.State().Bookmarks {
+		ids = append(ids, strconv.FormatInt(int64(b.BookmarkID), 10))
+	}
+	fake.InjectFault(fakeapi.Fault{Code: 1601, Path: "/api/1/bookmarks/archive", Times: 1})
+	journalPath := filepath.Join(cfgDir, "archive.jsonl")
+	code, _, errOut := runCmd(t, "ip", "--config", cfgPath, "--api-base", server.URL, "--idempotent", "archive", "--concurrency", "1", "--journal", journalPath, "--ids", strings.Join(ids, ","))
+	if code != 0 {
+		t.Fatalf("archive --idempotent exit=%d err=%s", code, errOut)
+	}
+	raw, err := os.ReadFile(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	var done journal.Event
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &done); err != nil {
+		t.Fatal(err)
+	}
+	if done.Event != "done" || done.Succeeded != 2 || done.Failed != 0 {
+		t.Fatalf("already-in-state item should count as succeeded: %+v", done)
+	}
+}
+
+func TestRuleTitleTruncatesRunes(t *testing.T) {
+	title := strings.Repeat("ž", 70)
+	got := ruleTitle(title)
+	if !utf8.ValidString(got) || got != strings.Repeat("ž", 59)+"..." {
+		t.Fatalf("ruleTitle = %q", got)
+	}
+	if got := ruleTitle("short"); got != "short" {
+		t.Fatalf("ruleTitle(short) = %q", got)
+	}
+}
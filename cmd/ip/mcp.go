@@ -0,0 +1,537 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/vburojevic/instapaper-cli/internal/config"
+	"github.com/vburojevic/instapaper-cli/internal/convert"
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+	"github.com/vburojevic/instapaper-cli/internal/mcp"
+	"github.com/vburojevic/instapaper-cli/internal/version"
+)
+
+const mcpInstructions = "Tools for an Instapaper account. Bookmark ids come from list_bookmarks. " +
+	"Mutating tools accept dry_run to preview the change; archive and move are recorded in the ip undo log."
+
+func runMCP(ctx context.Context, args []string, opts *GlobalOptions, cfg *config.Config, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprintln(stdout, usageMCP())
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+	switch args[0] {
+	case "serve":
+		return runMCPServe(ctx, args[1:], opts, cfg, stdout, stderr)
+	default:
+		return printUsageError(stderr, fmt.Sprintf("unknown mcp subcommand: %s", args[0]))
+	}
+}
+
+func runMCPServe(ctx context.Context, args []string, opts *GlobalOptions, cfg *config.Config, stdout, stderr io.Writer) int {
+	args = reorderFlags(args)
+	fs := flag.NewFlagSet("mcp serve", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var help bool
+	var readOnly bool
+	fs.BoolVar(&help, "help", false, "Show help")
+	fs.BoolVar(&help, "h", false, "Show help")
+	fs.BoolVar(&readOnly, "read-only", false, "Expose only the tools that do not change the account")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if help {
+		printFlagUsage(stdout, usageMCP(), fs)
+		return 0
+	}
+	if len(fs.Args()) != 0 {
+		return printUsageError(stderr, "usage: ip mcp serve [--read-only]")
+	}
+
+	srv := &mcp.Server{Name: "instapaper-cli", Version: version.Version, Instructions: mcpInstructions}
+	if opts.Verbose || opts.Debug {
+		srv.Logf = func(format string, args ...any) {
+			fmt.Fprintf(stderr, "mcp: "+format+"\n", args...)
+		}
+	}
+	tools := &mcpTools{opts: opts, cfg: cfg, stderr: stderr}
+	for _, t := range tools.all() {
+		if readOnly && (t.Annotations == nil || !t.Annotations.ReadOnly) {
+			continue
+		}
+		srv.AddTool(t)
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	if err := srv.Serve(ctx, os.Stdin, stdout); err != nil && !errors.Is(err, context.Canceled) {
+		return printError(stderr, err)
+	}
+	return 0
+}
+
+// mcpTools implements the tools of ip mcp serve on top of the same client,
+// dry-run, idempotent, offline and undo handling as the CLI commands.
+type mcpTools struct {
+	opts   *GlobalOptions
+	cfg    *config.Config
+	stderr io.Writer
+	client *instapaper.Client
+}
+
+func (m *mcpTools) requireClient() (*instapaper.Client, error) {
+	if m.opts.Offline {
+		return nil, errors.New("not available with --offline")
+	}
+	if m.client == nil {
+		client, _, _, err := requireClient(m.opts, m.cfg, true, m.stderr)
+		if err != nil {
+			return nil, err
+		}
+		m.client = client
+	}
+	return m.client, nil
+}
+
+// toolProperty copies a property of a record schema and documents it.
+func toolProperty(target, name, description string) map[string]any {
+	props, _ := schemaProperties(target)
+	p := map[string]any{}
+	if src, ok := props[name].(map[string]any); ok {
+		for k, v := range src {
+			p[k] = v
+		}
+	}
+	p["description"] = description
+	return p
+}
+
+func objectSchema(props map[string]any, required ...string) map[string]any {
+	s := map[string]any{"type": "object", "properties": props, "additionalProperties": false}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// listSchema is the output schema of a tool returning a list of records.
+func listSchema(key, target string) map[string]any {
+	props, _ := schemaProperties(target)
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			key: map[string]any{"type": "array", "items": map[string]any{"type": "object", "properties": props}},
+		},
+		"required": []string{key},
+	}
+}
+
+func dryRunProperty() map[string]any {
+	return map[string]any{"type": "boolean", "description": "Preview the change without making it (always on when ip runs with --dry-run)"}
+}
+
+func bookmarkIDProperty() map[string]any {
+	return toolProperty("bookmarks", "bookmark_id", "Bookmark id")
+}
+
+func (m *mcpTools) all() []mcp.Tool {
+	return []mcp.Tool{
+		{
+			Name:        "list_bookmarks",
+			Title:       "List bookmarks",
+			Description: "List bookmarks in a folder or with a tag, newest first.",
+			InputSchema: objectSchema(map[string]any{
+				"folder": map[string]any{"type": "string", "description": "unread (default), starred, archive, a folder id or a folder title"},
+				"tag":    map[string]any{"type": "string", "description": "Tag name; when set, folder is ignored"},
+				"limit":  map[string]any{"type": "integer", "minimum": 0, "maximum": 500, "default": 25, "description": "Maximum bookmarks (0 = all)"},
+				"select": map[string]any{"type": "string", "description": "ip --select filter, e.g. \"starred=1 && age>30d\""},
+			}),
+			OutputSchema: listSchema("bookmarks", "bookmarks"),
+			Annotations:  &mcp.Annotations{ReadOnly: true, Idempotent: true, OpenWorld: true},
+			Handler:      m.listBookmarks,
+		},
+		{
+			Name:        "add_bookmark",
+			Title:       "Add bookmark",
+			Description: "Save a URL to Instapaper.",
+			InputSchema: objectSchema(map[string]any{
+				"url":         toolProperty("bookmarks", "url", "URL to save"),
+				"title":       toolProperty("bookmarks", "title", "Title (default: from the page)"),
+				"description": toolProperty("bookmarks", "description", "Description"),
+				"tags":        map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Tag names"},
+				"folder":      map[string]any{"type": "string", "description": "User folder id or title (default: unread)"},
+				"archive":     map[string]any{"type": "boolean", "description": "Add straight to the archive"},
+				"dry_run":     dryRunProperty(),
+			}, "url"),
+			Annotations: &mcp.Annotations{OpenWorld: true},
+			Handler:     m.addBookmark,
+		},
+		{
+			Name:        "archive",
+			Title:       "Archive bookmark",
+			Description: "Move a bookmark to the archive.",
+			InputSchema: objectSchema(map[string]any{
+				"bookmark_id": bookmarkIDProperty(),
+				"dry_run":     dryRunProperty(),
+			}, "bookmark_id"),
+			Annotations: &mcp.Annotations{Idempotent: true, OpenWorld: true},
+			Handler:     m.archive,
+		},
+		{
+			Name:        "move",
+			Title:       "Move bookmark",
+			Description: "Move a bookmark to a user folder.",
+			InputSchema: objectSchema(map[string]any{
+				"bookmark_id": bookmarkIDProperty(),
+				"folder":      map[string]any{"type": "string", "description": "User folder id or title"},
+				"dry_run":     dryRunProperty(),
+			}, "bookmark_id", "folder"),
+			Annotations: &mcp.Annotations{Idempotent: true, OpenWorld: true},
+			Handler:     m.move,
+		},
+		{
+			Name:        "get_text",
+			Title:       "Get article text",
+			Description: "Fetch the processed article text of a bookmark.",
+			InputSchema: objectSchema(map[string]any{
+				"bookmark_id": bookmarkIDProperty(),
+				"format":      map[string]any{"type": "string", "enum": []string{"markdown", "text", "html"}, "default": "markdown", "description": "Output format"},
+			}, "bookmark_id"),
+			OutputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"bookmark_id": map[string]any{"type": "integer"},
+					"format":      map[string]any{"type": "string"},
+					"text":        map[string]any{"type": "string"},
+				},
+				"required": []string{"bookmark_id", "format", "text"},
+			},
+			Annotations: &mcp.Annotations{ReadOnly: true, Idempotent: true, OpenWorld: true},
+			Handler:     m.getText,
+		},
+		{
+			Name:        "list_highlights",
+			Title:       "List highlights",
+			Description: "List the highlights of a bookmark.",
+			InputSchema: objectSchema(map[string]any{
+				"bookmark_id": toolProperty("highlights", "bookmark_id", "Bookmark id"),
+			}, "bookmark_id"),
+			OutputSchema: listSchema("highlights", "highlights"),
+			Annotations:  &mcp.Annotations{ReadOnly: true, Idempotent: true, OpenWorld: true},
+			Handler:      m.listHighlights,
+		},
+		{
+			Name:        "add_highlight",
+			Title:       "Add highlight",
+			Description: "Highlight a passage of a bookmark's text.",
+			InputSchema: objectSchema(map[string]any{
+				"bookmark_id": toolProperty("highlights", "bookmark_id", "Bookmark id"),
+				"text":        toolProperty("highlights", "text", "Highlighted passage"),
+				"position":    toolProperty("highlights", "position", "0-indexed position of the passage (optional)"),
+				"dry_run":     dryRunProperty(),
+			}, "bookmark_id", "text"),
+			Annotations: &mcp.Annotations{OpenWorld: true},
+			Handler:     m.addHighlight,
+		},
+	}
+}
+
+// decodeArgs strictly decodes tool arguments into v.
+func decodeArgs(raw json.RawMessage, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+// dryRun returns the record ip --dry-run prints for action.
+func dryRun(action string, data map[string]any) map[string]any {
+	return map[string]any{"dry_run": true, "action": action, "data": data}
+}
+
+// idempotentResult is returned instead of an already-in-state error when ip
+// runs with --idempotent.
+func (m *mcpTools) idempotentResult(err error, id int64) (any, error) {
+	if m.opts.Idempotent && isAlreadyStateError(err) {
+		return map[string]any{"bookmark_id": id, "idempotent": true}, nil
+	}
+	return nil, err
+}
+
+func (m *mcpTools) listBookmarks(ctx context.Context, raw json.RawMessage) (any, error) {
+	args := struct {
+		Folder string `json:"folder"`
+		Tag    string `json:"tag"`
+		Limit  *int   `json:"limit"`
+		Select string `json:"select"`
+	}{Folder: "unread"}
+	if err := decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	limit := 25
+	if args.Limit != nil {
+		limit = *args.Limit
+	}
+	if limit < 0 || limit > 500 {
+		return nil, fmt.Errorf("invalid limit %d (expected 0..500)", limit)
+	}
+	var bookmarks []instapaper.Bookmark
+	if m.opts.Offline {
+		var err error
+		if bookmarks, err = offlineBookmarks(m.opts, args.Folder, args.Tag, limit); err != nil {
+			return nil, err
+		}
+	} else {
+		client, err := m.requireClient()
+		if err != nil {
+			return nil, err
+		}
+		folderID := ""
+		if args.Tag == "" {
+			if folderID, err = resolveListFolderID(ctx, client, args.Folder); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := listBookmarks(ctx, client, listBookmarksParams{Limit: limit, FolderID: folderID, Tag: args.Tag, MaxPages: 200})
+		if err != nil {
+			return nil, err
+		}
+		bookmarks = resp.Bookmarks
+	}
+	if args.Select != "" {
+		var err error
+		if bookmarks, err = filterBookmarksBySelect(bookmarks, args.Select); err != nil {
+			return nil, err
+		}
+	}
+	if bookmarks == nil {
+		bookmarks = []instapaper.Bookmark{}
+	}
+	return map[string]any{"bookmarks": bookmarks}, nil
+}
+
+func (m *mcpTools) addBookmark(ctx context.Context, raw json.RawMessage) (any, error) {
+	var args struct {
+		URL         string   `json:"url"`
+		Title       string   `json:"title"`
+		Description string   `json:"description"`
+		Tags        []string `json:"tags"`
+		Folder      string   `json:"folder"`
+		Archive     bool     `json:"archive"`
+		DryRun      bool     `json:"dry_run"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(args.URL) == "" {
+		return nil, errors.New("url is required")
+	}
+	if m.opts.DryRun || args.DryRun {
+		return dryRun("add", map[string]any{
+			"url":         args.URL,
+			"title":       args.Title,
+			"description": args.Description,
+			"folder":      args.Folder,
+			"archive":     args.Archive,
+			"tags":        args.Tags,
+		}), nil
+	}
+	client, err := m.requireClient()
+	if err != nil {
+		return nil, err
+	}
+	folderID, err := resolveUserFolderID(ctx, client, args.Folder)
+	if err != nil {
+		return nil, err
+	}
+	return client.AddBookmark(ctx, instapaper.AddBookmarkRequest{
+		URL:             args.URL,
+		Title:           args.Title,
+		Description:     args.Description,
+		FolderID:        folderID,
+		ResolveFinalURL: m.cfg.Defaults.ResolveFinalURLValue(),
+		Archived:        args.Archive,
+		Tags:            args.Tags,
+	})
+}
+
+func (m *mcpTools) archive(ctx context.Context, raw json.RawMessage) (any, error) {
+	var args struct {
+		BookmarkID int64 `json:"bookmark_id"`
+		DryRun     bool  `json:"dry_run"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	if args.BookmarkID <= 0 {
+		return nil, errors.New("bookmark_id is required")
+	}
+	if m.opts.DryRun || args.DryRun {
+		return dryRun("archive", map[string]any{"bookmark_id": args.BookmarkID}), nil
+	}
+	client, err := m.requireClient()
+	if err != nil {
+		return nil, err
+	}
+	undoRec := newUndoRecorder(m.opts, "archive")
+	undoRec.Lookup(ctx, client, []int64{args.BookmarkID}, m.stderr)
+	bm, err := client.Archive(ctx, args.BookmarkID)
+	if err != nil {
+		return m.idempotentResult(err, args.BookmarkID)
+	}
+	undoRec.Add(args.BookmarkID, bm, "")
+	undoRec.Save(m.stderr)
+	return bm, nil
+}
+
+func (m *mcpTools) move(ctx context.Context, raw json.RawMessage) (any, error) {
+	var args struct {
+		BookmarkID int64  `json:"bookmark_id"`
+		Folder     string `json:"folder"`
+		DryRun     bool   `json:"dry_run"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	if args.BookmarkID <= 0 || strings.TrimSpace(args.Folder) == "" {
+		return nil, errors.New("bookmark_id and folder are required")
+	}
+	if m.opts.DryRun || args.DryRun {
+		return dryRun("move", map[string]any{"bookmark_id": args.BookmarkID, "folder": args.Folder}), nil
+	}
+	client, err := m.requireClient()
+	if err != nil {
+		return nil, err
+	}
+	folderID, err := resolveUserFolderID(ctx, client, args.Folder)
+	if err != nil {
+		return nil, err
+	}
+	if folderID == "" {
+		return nil, errors.New("folder must be a user folder")
+	}
+	undoRec := newUndoRecorder(m.opts, "move")
+	undoRec.Lookup(ctx, client, []int64{args.BookmarkID}, m.stderr)
+	bm, err := client.Move(ctx, args.BookmarkID, folderID)
+	if err != nil {
+		return m.idempotentResult(err, args.BookmarkID)
+	}
+	undoRec.Add(args.BookmarkID, bm, folderID)
+	undoRec.Save(m.stderr)
+	return bm, nil
+}
+
+func (m *mcpTools) getText(ctx context.Context, raw json.RawMessage) (any, error) {
+	args := struct {
+		BookmarkID int64  `json:"bookmark_id"`
+		Format     string `json:"format"`
+	}{Format: "markdown"}
+	if err := decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	if args.BookmarkID <= 0 {
+		return nil, errors.New("bookmark_id is required")
+	}
+	to, err := convert.ParseFormat(args.Format)
+	if err != nil {
+		return nil, err
+	}
+	var html []byte
+	if m.opts.Offline {
+		st, err := openSyncedStore(m.opts)
+		if err != nil {
+			return nil, err
+		}
+		html, err = st.ReadText(args.BookmarkID)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		client, err := m.requireClient()
+		if err != nil {
+			return nil, err
+		}
+		if html, err = client.GetTextHTML(ctx, args.BookmarkID); err != nil {
+			return nil, err
+		}
+	}
+	text := html
+	if to != convert.FormatHTML {
+		text = convert.Convert(html, to)
+	}
+	return map[string]any{"bookmark_id": args.BookmarkID, "format": to, "text": string(text)}, nil
+}
+
+func (m *mcpTools) listHighlights(ctx context.Context, raw json.RawMessage) (any, error) {
+	var args struct {
+		BookmarkID int64 `json:"bookmark_id"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	if args.BookmarkID <= 0 {
+		return nil, errors.New("bookmark_id is required")
+	}
+	var highlights []instapaper.Highlight
+	if m.opts.Offline {
+		st, err := openSyncedStore(m.opts)
+		if err != nil {
+			return nil, err
+		}
+		highlights = st.HighlightsFor(args.BookmarkID)
+	} else {
+		client, err := m.requireClient()
+		if err != nil {
+			return nil, err
+		}
+		if highlights, err = client.ListHighlights(ctx, args.BookmarkID); err != nil {
+			return nil, err
+		}
+	}
+	if highlights == nil {
+		highlights = []instapaper.Highlight{}
+	}
+	return map[string]any{"highlights": highlights}, nil
+}
+
+func (m *mcpTools) addHighlight(ctx context.Context, raw json.RawMessage) (any, error) {
+	var args struct {
+		BookmarkID int64  `json:"bookmark_id"`
+		Text       string `json:"text"`
+		Position   int    `json:"position"`
+		DryRun     bool   `json:"dry_run"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	if args.BookmarkID <= 0 || strings.TrimSpace(args.Text) == "" {
+		return nil, errors.New("bookmark_id and text are required")
+	}
+	if m.opts.DryRun || args.DryRun {
+		return dryRun("highlights.add", map[string]any{"bookmark_id": args.BookmarkID, "text": args.Text, "position": args.Position}), nil
+	}
+	client, err := m.requireClient()
+	if err != nil {
+		return nil, err
+	}
+	h, err := client.CreateHighlight(ctx, args.BookmarkID, args.Text, args.Position)
+	if err != nil {
+		return m.idempotentResult(err, args.BookmarkID)
+	}
+	return h, nil
+}
+
+func usageMCP() string {
+	return "Usage:\n  ip mcp serve [--read-only]\n\nSpeaks the Model Context Protocol (JSON-RPC over stdio). Tools: list_bookmarks, add_bookmark, archive, move, get_text, list_highlights, add_highlight.\n"
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/vburojevic/instapaper-cli/internal/config"
+)
+
+type profileInfo struct {
+	Name     string `json:"name"`
+	Active   bool   `json:"active"`
+	Current  bool   `json:"current"`
+	LoggedIn bool   `json:"logged_in"`
+	UserID   int64  `json:"user_id,omitempty"`
+	Username string `json:"username,omitempty"`
+	APIBase  string `json:"api_base"`
+}
+
+// runProfiles manages named profiles. It works on the config file as stored,
+// not on the profile selected for this invocation.
+func runProfiles(args []string, opts *GlobalOptions, cfgPath string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprintln(stdout, usageProfiles())
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		return printError(stderr, err)
+	}
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			return printUsageError(stderr, "usage: ip profiles list")
+		}
+		return runProfilesList(opts, cfg, stdout, stderr)
+	case "use":
+		if len(args) != 2 {
+			return printUsageError(stderr, "usage: ip profiles use <name>")
+		}
+		name := args[1]
+		if !cfg.HasProfile(name) {
+			return printError(stderr, fmt.Errorf("profile not found: %s (create it with: ip auth login --profile %s)", name, name))
+		}
+		if name == config.DefaultProfile {
+			name = ""
+		}
+		cfg.CurrentProfile = name
+		if err := cfg.Save(cfgPath); err != nil {
+			return printError(stderr, err)
+		}
+		if !opts.Quiet {
+			fmt.Fprintf(stdout, "Using profile %s\n", args[1])
+		}
+		return 0
+	case "remove":
+		if len(args) != 2 {
+			return printUsageError(stderr, "usage: ip profiles remove <name>")
+		}
+		if err := cfg.RemoveProfile(args[1]); err != nil {
+			return printError(stderr, err)
+		}
+		if err := cfg.Save(cfgPath); err != nil {
+			return printError(stderr, err)
+		}
+		if !opts.Quiet {
+			fmt.Fprintf(stdout, "Removed profile %s\n", args[1])
+		}
+		return 0
+	default:
+		return printUsageError(stderr, fmt.Sprintf("unknown profiles subcommand: %s", args[0]))
+	}
+}
+
+func runProfilesList(opts *GlobalOptions, cfg *config.Config, stdout, stderr io.Writer) int {
+	current := cfg.CurrentProfile
+	if current == "" {
+		current = config.DefaultProfile
+	}
+	var infos []profileInfo
+	for _, name := range cfg.ProfileNames() {
+		p, err := cfg.ResolvedProfile(name)
+		if err != nil {
+			return printError(stderr, err)
+		}
+		infos = append(infos, profileInfo{
+			Name:     name,
+			Active:   name == opts.Profile,
+			Current:  name == current,
+			LoggedIn: (p.OAuthToken != "" && p.OAuthTokenSecret != "") || p.User.UserID != 0, // secrets may be in a credential store
+			UserID:   p.User.UserID,
+			Username: p.User.Username,
+			APIBase:  p.APIBase,
+		})
+	}
+	if strings.EqualFold(opts.Format, "json") || isNDJSONFormat(opts.Format) {
+		if isNDJSONFormat(opts.Format) {
+			for _, info := range infos {
+				if err := writeJSONByFormat(stdout, opts.Format, info); err != nil {
+					return printError(stderr, err)
+				}
+			}
+			return 0
+		}
+		if err := writeJSONByFormat(stdout, opts.Format, infos); err != nil {
+			return printError(stderr, err)
+		}
+		return 0
+	}
+	if strings.EqualFold(opts.Format, "plain") {
+		for _, info := range infos {
+			fmt.Fprintf(stdout, "%s\t%t\t%s\t%s\n", info.Name, info.Active, info.Username, info.APIBase)
+		}
+		return 0
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tPROFILE\tUSER\tAPI BASE")
+	for _, info := range infos {
+		marker := ""
+		if info.Active {
+			marker = "*"
+		}
+		user := info.Username
+		if !info.LoggedIn {
+			user = "(not logged in)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", marker, info.Name, user, info.APIBase)
+	}
+	if err := tw.Flush(); err != nil {
+		return printError(stderr, err)
+	}
+	return 0
+}
+
+func usageProfiles() string {
+	return "Usage:\n  ip profiles list\n  ip profiles use <name>\n  ip profiles remove <name>\n  ip auth login --profile <name>\n  ip --profile <name> <command> ...   (or INSTAPAPER_PROFILE=<name>)\n"
+}
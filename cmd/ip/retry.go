@@ -0,0 +1,227 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vburojevic/instapaper-cli/internal/config"
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+)
+
+// retryFlags holds the retry flags beyond --retry and --retry-backoff, which
+// live on GlobalOptions.
+type retryFlags struct {
+	maxBackoff time.Duration
+	maxElapsed time.Duration
+	jitter     float64
+	on         string
+}
+
+func (f *retryFlags) register(fs *flag.FlagSet) {
+	def := instapaper.DefaultRetryPolicy()
+	fs.DurationVar(&f.maxBackoff, "retry-max-backoff", def.MaxDelay, "Upper bound for a single retry delay")
+	fs.DurationVar(&f.maxElapsed, "retry-max-elapsed", 0, "Stop retrying after this long (0 = no limit)")
+	fs.Float64Var(&f.jitter, "retry-jitter", def.Jitter, "Randomly shorten retry delays by up to this fraction (0..1)")
+	fs.StringVar(&f.on, "retry-on", "all", "Failure classes to retry: rate_limit,server,network (or all, none)")
+}
+
+// resolveRetryPolicy layers the defaults, the config "retry" section and
+// the flags that were set explicitly. It updates opts.RetryCount and
+// opts.RetryBackoff to the effective values.
+func resolveRetryPolicy(opts *GlobalOptions, cfg *config.Config, f *retryFlags, set map[string]bool) (instapaper.RetryPolicy, error) {
+	p := instapaper.DefaultRetryPolicy()
+	if err := applyRetryConfig(&p, cfg.Retry, "retry"); err != nil {
+		return p, err
+	}
+	if set["retry"] {
+		p.MaxAttempts = opts.RetryCount + 1
+	}
+	if set["retry-backoff"] {
+		p.BaseDelay = opts.RetryBackoff
+	}
+	if set["retry-max-backoff"] {
+		p.MaxDelay = f.maxBackoff
+	}
+	if set["retry-max-elapsed"] {
+		p.MaxElapsed = f.maxElapsed
+	}
+	if set["retry-jitter"] {
+		p.Jitter = f.jitter
+	}
+	if set["retry-on"] {
+		on, err := instapaper.ParseRetryClasses(f.on)
+		if err != nil {
+			return p, err
+		}
+		p.On = on
+	}
+	if p.MaxAttempts < 1 {
+		return p, fmt.Errorf("retry count must be >= 0")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return p, fmt.Errorf("retry jitter must be between 0 and 1")
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = instapaper.DefaultRetryPolicy().BaseDelay
+	}
+	opts.RetryCount = p.MaxAttempts - 1
+	opts.RetryBackoff = p.BaseDelay
+	return p, nil
+}
+
+// applyRetryConfig applies a retry config section (the top-level "retry" or
+// "webhooks.retry", named by key) on top of p.
+func applyRetryConfig(p *instapaper.RetryPolicy, r *config.Retry, key string) error {
+	if r == nil {
+		return nil
+	}
+	if r.Count != nil {
+		p.MaxAttempts = *r.Count + 1
+	}
+	for _, d := range []struct {
+		key string
+		val string
+		dst *time.Duration
+	}{
+		{key + ".backoff", r.Backoff, &p.BaseDelay},
+		{key + ".max_backoff", r.MaxBackoff, &p.MaxDelay},
+		{key + ".max_elapsed", r.MaxElapsed, &p.MaxElapsed},
+	} {
+		if d.val == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.val)
+		if err != nil {
+			return fmt.Errorf("config %s: %w", d.key, err)
+		}
+		*d.dst = v
+	}
+	if r.Jitter != nil {
+		p.Jitter = *r.Jitter
+	}
+	if r.On != nil {
+		on, err := instapaper.ParseRetryClasses(strings.Join(r.On, ","))
+		if err != nil {
+			return fmt.Errorf("config %s.on: %w", key, err)
+		}
+		p.On = on
+	}
+	return nil
+}
+
+func retryConfigGet(cfg *config.Config, key string) (any, bool) {
+	r := cfg.Retry
+	if r == nil {
+		r = &config.Retry{}
+	}
+	switch key {
+	case "retry.count":
+		if r.Count == nil {
+			return nil, true
+		}
+		return *r.Count, true
+	case "retry.backoff":
+		return r.Backoff, true
+	case "retry.max_backoff":
+		return r.MaxBackoff, true
+	case "retry.max_elapsed":
+		return r.MaxElapsed, true
+	case "retry.jitter":
+		if r.Jitter == nil {
+			return nil, true
+		}
+		return *r.Jitter, true
+	case "retry.on":
+		return strings.Join(r.On, ","), true
+	}
+	return nil, false
+}
+
+func retryConfigSet(cfg *config.Config, key, value string) error {
+	r := cfg.Retry
+	if r == nil {
+		r = &config.Retry{}
+	}
+	switch key {
+	case "retry.count":
+		v, err := strconv.Atoi(value)
+		if err != nil || v < 0 {
+			return fmt.Errorf("invalid retry.count %q (expected an integer >= 0)", value)
+		}
+		r.Count = &v
+	case "retry.backoff", "retry.max_backoff", "retry.max_elapsed":
+		if _, err := time.ParseDuration(value); err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+		switch key {
+		case "retry.backoff":
+			r.Backoff = value
+		case "retry.max_backoff":
+			r.MaxBackoff = value
+		default:
+			r.MaxElapsed = value
+		}
+	case "retry.jitter":
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || v < 0 || v > 1 {
+			return fmt.Errorf("invalid retry.jitter %q (expected 0..1)", value)
+		}
+		r.Jitter = &v
+	case "retry.on":
+		on, err := instapaper.ParseRetryClasses(value)
+		if err != nil {
+			return err
+		}
+		r.On = on
+	default:
+		return fmt.Errorf("unknown config key: %s", key)
+	}
+	cfg.Retry = r
+	return nil
+}
+
+func retryConfigUnset(cfg *config.Config, key string) error {
+	r := cfg.Retry
+	if r == nil {
+		if _, ok := retryConfigGet(cfg, key); !ok {
+			return fmt.Errorf("unknown config key: %s", key)
+		}
+		return nil
+	}
+	switch key {
+	case "retry.count":
+		r.Count = nil
+	case "retry.backoff":
+		r.Backoff = ""
+	case "retry.max_backoff":
+		r.MaxBackoff = ""
+	case "retry.max_elapsed":
+		r.MaxElapsed = ""
+	case "retry.jitter":
+		r.Jitter = nil
+	case "retry.on":
+		r.On = nil
+	default:
+		return fmt.Errorf("unknown config key: %s", key)
+	}
+	if r.Count == nil && r.Backoff == "" && r.MaxBackoff == "" && r.MaxElapsed == "" && r.Jitter == nil && r.On == nil {
+		cfg.Retry = nil
+	}
+	return nil
+}
+
+// retryConfigLines renders the retry section for config show.
+func retryConfigLines(cfg *config.Config) [][2]string {
+	var lines [][2]string
+	for _, key := range []string{"retry.count", "retry.backoff", "retry.max_backoff", "retry.max_elapsed", "retry.jitter", "retry.on"} {
+		v, _ := retryConfigGet(cfg, key)
+		if v == nil || v == "" {
+			continue
+		}
+		lines = append(lines, [2]string{key, fmt.Sprint(v)})
+	}
+	return lines
+}
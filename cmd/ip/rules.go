@@ -0,0 +1,556 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/vburojevic/instapaper-cli/internal/config"
+	"github.com/vburojevic/instapaper-cli/internal/filter"
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+)
+
+// ruleStep is one action planned (and possibly applied) for one bookmark.
+type ruleStep struct {
+	Rule       string `json:"rule"`
+	Action     string `json:"action"`
+	BookmarkID int64  `json:"bookmark_id"`
+	URL        string `json:"url"`
+	Title      string `json:"title,omitempty"`
+	Target     string `json:"target,omitempty"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+
+	bookmark instapaper.Bookmark
+	folder   string // list folder id the bookmark was found in
+	action   config.RuleAction
+}
+
+type rulesReport struct {
+	DryRun  bool       `json:"dry_run"`
+	Rules   int        `json:"rules"`
+	Matched int        `json:"matched"`
+	Applied int        `json:"applied"`
+	Failed  int        `json:"failed"`
+	Skipped int        `json:"skipped"`
+	Steps   []ruleStep `json:"actions"`
+}
+
+func runRules(ctx context.Context, args []string, opts *GlobalOptions, cfg *config.Config, cfgPath string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprintln(stdout, usageRules())
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+	switch args[0] {
+	case "list":
+		return runRulesList(args[1:], opts, cfgPath, stdout, stderr)
+	case "run":
+		return runRulesRun(ctx, args[1:], opts, cfg, cfgPath, stdout, stderr)
+	default:
+		return printUsageError(stderr, fmt.Sprintf("unknown rules subcommand: %s", args[0]))
+	}
+}
+
+// loadRules reads the rules file and checks every condition.
+func loadRules(path string) (*config.Rules, map[string]*filter.Expr, error) {
+	rules, err := config.LoadRules(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("no rules file at %s (create it or pass --rules <file>)", path)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	filters := map[string]*filter.Expr{}
+	for _, r := range rules.Rules {
+		f, err := parseSelectExpr(r.When)
+		if err != nil {
+			return nil, nil, fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+		filters[r.Name] = f
+	}
+	return rules, filters, nil
+}
+
+func runRulesList(args []string, opts *GlobalOptions, cfgPath string, stdout, stderr io.Writer) int {
+	args = reorderFlags(args)
+	fs := flag.NewFlagSet("rules list", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var help bool
+	var rulesPath string
+	fs.BoolVar(&help, "help", false, "Show help")
+	fs.BoolVar(&help, "h", false, "Show help")
+	fs.StringVar(&rulesPath, "rules", "", "Rules file (default: rules.json next to the config file)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if help {
+		printFlagUsage(stdout, usageRules(), fs)
+		return 0
+	}
+	if rulesPath == "" {
+		rulesPath = config.RulesPath(cfgPath)
+	}
+	rules, _, err := loadRules(rulesPath)
+	if err != nil {
+		return printError(stderr, err)
+	}
+	if strings.EqualFold(opts.Format, "json") || isNDJSONFormat(opts.Format) {
+		if isNDJSONFormat(opts.Format) {
+			for _, r := range rules.Rules {
+				if err := writeJSONByFormat(stdout, opts.Format, r); err != nil {
+					return printError(stderr, err)
+				}
+			}
+			return 0
+		}
+		if err := writeJSONByFormat(stdout, opts.Format, rules); err != nil {
+			return printError(stderr, err)
+		}
+		return 0
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	if !strings.EqualFold(opts.Format, "plain") {
+		fmt.Fprintln(tw, "NAME\tFOLDER\tWHEN\tACTIONS")
+	}
+	for _, r := range rules.Rules {
+		name := r.Name
+		if r.Disabled {
+			name += " (disabled)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", name, ruleFolder(r), r.When, describeActions(r.Actions))
+	}
+	if err := tw.Flush(); err != nil {
+		return printError(stderr, err)
+	}
+	return 0
+}
+
+func runRulesRun(ctx context.Context, args []string, opts *GlobalOptions, cfg *config.Config, cfgPath string, stdout, stderr io.Writer) int {
+	args = reorderFlags(args)
+	fs := flag.NewFlagSet("rules run", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var help bool
+	var rulesPath string
+	var only string
+	var allowDelete bool
+	var maxDeletes int
+	var maxPages int
+	var progressJSON bool
+	fs.BoolVar(&help, "help", false, "Show help")
+	fs.BoolVar(&help, "h", false, "Show help")
+	fs.StringVar(&rulesPath, "rules", "", "Rules file (default: rules.json next to the config file)")
+	fs.StringVar(&only, "rule", "", "Only run these rules (comma-separated names)")
+	fs.BoolVar(&allowDelete, "yes-really-delete", false, "Allow delete actions (permanent)")
+	fs.IntVar(&maxDeletes, "max-deletes", 25, "Refuse to run when more than N deletes are planned (0 = no limit)")
+	fs.IntVar(&maxPages, "max-pages", 200, "Max pages per folder")
+	fs.BoolVar(&progressJSON, "progress-json", false, "Emit progress as NDJSON on stderr")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if help {
+		printFlagUsage(stdout, usageRules(), fs)
+		return 0
+	}
+	if fs.NArg() > 0 {
+		return printUsageError(stderr, "rules run does not take positional arguments")
+	}
+	if maxDeletes < 0 || maxPages < 0 {
+		return printUsageError(stderr, "--max-deletes and --max-pages must be >= 0")
+	}
+	if opts.Offline && !opts.DryRun {
+		return printUsageError(stderr, "rules run needs the API; use --dry-run to preview against the local store")
+	}
+	if rulesPath == "" {
+		rulesPath = config.RulesPath(cfgPath)
+	}
+	rules, filters, err := loadRules(rulesPath)
+	if err != nil {
+		return printError(stderr, err)
+	}
+	selected := rules.Rules[:0:0]
+	wanted := map[string]bool{}
+	for _, name := range splitTags(only) {
+		wanted[strings.ToLower(name)] = true
+	}
+	for _, r := range rules.Rules {
+		if len(wanted) > 0 {
+			if !wanted[strings.ToLower(r.Name)] {
+				continue
+			}
+			delete(wanted, strings.ToLower(r.Name))
+		} else if r.Disabled {
+			continue
+		}
+		selected = append(selected, r)
+	}
+	if len(wanted) > 0 {
+		unknown := make([]string, 0, len(wanted))
+		for name := range wanted {
+			unknown = append(unknown, name)
+		}
+		sort.Strings(unknown)
+		return printUsageError(stderr, fmt.Sprintf("unknown rule(s): %s", strings.Join(unknown, ", ")))
+	}
+
+	var client *instapaper.Client
+	if !opts.Offline {
+		client, _, _, err = requireClient(opts, cfg, true, stderr)
+		if err != nil {
+			return printError(stderr, err)
+		}
+	}
+	steps, err := planRules(ctx, opts, client, selected, filters, maxPages)
+	if err != nil {
+		return printError(stderr, err)
+	}
+	report := rulesReport{DryRun: opts.DryRun, Rules: len(selected), Steps: steps}
+	matched := map[int64]bool{}
+	deletes := 0
+	for _, s := range steps {
+		matched[s.BookmarkID] = true
+		if s.Action == config.ActionDelete {
+			deletes++
+		}
+	}
+	report.Matched = len(matched)
+	verbosef(opts, stderr, "rules: rules=%d matched=%d actions=%d deletes=%d", report.Rules, report.Matched, len(steps), deletes)
+
+	if !opts.DryRun && deletes > 0 {
+		if !allowDelete {
+			return printUsageError(stderr, fmt.Sprintf("refusing: rules would delete %d bookmark(s); rerun with --yes-really-delete (preview with --dry-run)", deletes))
+		}
+		if maxDeletes > 0 && deletes > maxDeletes {
+			return printError(stderr, fmt.Errorf("refusing: rules would delete %d bookmarks, more than --max-deletes %d", deletes, maxDeletes))
+		}
+	}
+
+	exit := 0
+	if opts.DryRun {
+		for i := range report.Steps {
+			report.Steps[i].Status = "planned"
+		}
+	} else {
+		exit = applyRuleSteps(ctx, opts, client, report.Steps, progressJSON, stderr)
+	}
+	for _, s := range report.Steps {
+		switch s.Status {
+		case "ok":
+			report.Applied++
+		case "error":
+			report.Failed++
+		case "skipped":
+			report.Skipped++
+		}
+	}
+	if err := writeRulesReport(stdout, opts, report); err != nil {
+		return printError(stderr, err)
+	}
+	return exit
+}
+
+// planRules evaluates rules in file order. A bookmark that an earlier rule
+// archives, moves or deletes is not considered by later rules, and actions
+// that would not change anything (starring a starred bookmark) are left out.
+// A bookmark gets at most one tag step, planned before its other actions.
+func planRules(ctx context.Context, opts *GlobalOptions, client *instapaper.Client, rules []config.Rule, filters map[string]*filter.Expr, maxPages int) ([]ruleStep, error) {
+	folders := map[string][]instapaper.Bookmark{}
+	folderIDs := map[string]string{}
+	handled := map[int64]bool{}
+	tagSteps := map[int64]int{}
+	var steps []ruleStep
+	for _, r := range rules {
+		name := ruleFolder(r)
+		folderID, ok := folderIDs[strings.ToLower(name)]
+		if !ok {
+			var err error
+			if opts.Offline {
+				folderID, err = resolveOfflineFolderID(opts, name)
+			} else {
+				folderID, err = resolveListFolderID(ctx, client, name)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %w", r.Name, err)
+			}
+			folderIDs[strings.ToLower(name)] = folderID
+		}
+		bookmarks, ok := folders[folderID]
+		if !ok {
+			var err error
+			if opts.Offline {
+				bookmarks, err = offlineBookmarks(opts, folderID, "", 0)
+			} else {
+				var resp instapaper.BookmarksListResponse
+				resp, err = listBookmarks(ctx, client, listBookmarksParams{FolderID: folderID, MaxPages: maxPages})
+				bookmarks = resp.Bookmarks
+			}
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: list %s: %w", r.Name, name, err)
+			}
+			folders[folderID] = bookmarks
+		}
+		for _, b := range filters[r.Name].Filter(bookmarks) {
+			id := int64(b.BookmarkID)
+			if handled[id] {
+				continue
+			}
+			newStep := func(a config.RuleAction) ruleStep {
+				return ruleStep{
+					Rule:       r.Name,
+					Action:     a.Type,
+					BookmarkID: id,
+					URL:        b.URL,
+					Title:      b.Title,
+					bookmark:   b,
+					folder:     folderID,
+					action:     a,
+				}
+			}
+			// Tagging re-saves the URL into the folder it was listed in, so it
+			// runs before anything that changes the folder, and all tags for a
+			// bookmark go into one re-save.
+			var tags []string
+			for _, a := range r.Actions {
+				if a.Type == config.ActionTag {
+					tags = mergeTags(tags, a.Tags)
+				}
+			}
+			if i, ok := tagSteps[id]; ok {
+				tags = mergeTags(steps[i].action.Tags, tags)
+			}
+			if tagging := (config.RuleAction{Type: config.ActionTag, Tags: tags}); len(tags) > 0 && ruleActionChanges(tagging, b, folderID) {
+				if i, ok := tagSteps[id]; ok {
+					steps[i].action.Tags = tags
+					steps[i].Target = strings.Join(tags, ",")
+				} else {
+					step := newStep(tagging)
+					step.Target = strings.Join(tags, ",")
+					tagSteps[id] = len(steps)
+					steps = append(steps, step)
+				}
+			}
+			for _, a := range r.Actions {
+				if a.Type == config.ActionTag || !ruleActionChanges(a, b, folderID) {
+					continue
+				}
+				step := newStep(a)
+				if a.Type == config.ActionMove {
+					step.Target = a.Folder
+				}
+				steps = append(steps, step)
+				switch a.Type {
+				case config.ActionArchive, config.ActionUnarchive, config.ActionMove, config.ActionDelete:
+					handled[id] = true
+				}
+			}
+		}
+	}
+	return steps, nil
+}
+
+func ruleActionChanges(a config.RuleAction, b instapaper.Bookmark, folderID string) bool {
+	switch a.Type {
+	case config.ActionArchive:
+		return folderID != "archive"
+	case config.ActionUnarchive:
+		return folderID == "archive"
+	case config.ActionStar:
+		return !bool(b.Starred)
+	case config.ActionUnstar:
+		return bool(b.Starred)
+	case config.ActionTag:
+		have := map[string]bool{}
+		for _, t := range b.Tags {
+			have[strings.ToLower(t.Name)] = true
+		}
+		for _, t := range a.Tags {
+			if !have[strings.ToLower(strings.TrimSpace(t))] {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// applyRuleSteps runs the planned steps. Once an action fails for a
+// bookmark, its remaining actions are skipped. Folder and starred changes
+// are recorded in the undo log as one operation.
+func applyRuleSteps(ctx context.Context, opts *GlobalOptions, client *instapaper.Client, steps []ruleStep, progressJSON bool, stderr io.Writer) int {
+	emitter := newProgressEmitter(progressJSON, stderr, "rules", len(steps))
+	emitter.Start()
+	undoRec := newUndoRecorder(opts, "rules")
+	failed := map[int64]bool{}
+	moveTargets := map[string]string{}
+	exit := 0
+	for i := range steps {
+		s := &steps[i]
+		meta := map[string]any{"rule": s.Rule, "action": s.Action, "bookmark_id": s.BookmarkID}
+		if failed[s.BookmarkID] {
+			s.Status = "skipped"
+			continue
+		}
+		if s.folder != "starred" {
+			// Starred is a view, not the folder the bookmark lives in.
+			undoRec.Known(s.BookmarkID, s.bookmark, s.folder)
+		}
+		bm, target, err := applyRuleStep(ctx, client, s, moveTargets)
+		if err == nil {
+			switch s.Action {
+			case config.ActionArchive, config.ActionUnarchive, config.ActionMove, config.ActionStar, config.ActionUnstar:
+				undoRec.AddAction(s.Action, s.BookmarkID, bm, target)
+			}
+		}
+		if err != nil && opts.Idempotent && isAlreadyStateError(err) {
+			err = nil
+		}
+		if err != nil {
+			failed[s.BookmarkID] = true
+			s.Status = "error"
+			s.Error = err.Error()
+			if code := exitCodeForError(err); code > exit {
+				exit = code
+			}
+			emitter.ItemError(meta, err)
+			writeErrorLine(stderr, fmt.Errorf("rule %q: %s %d: %v", s.Rule, s.Action, s.BookmarkID, err))
+			continue
+		}
+		s.Status = "ok"
+		emitter.ItemSuccess(meta)
+	}
+	undoRec.Save(stderr)
+	emitter.Done()
+	return exit
+}
+
+// applyRuleStep runs one step and returns the bookmark the API returned and,
+// for a move, the destination folder id.
+func applyRuleStep(ctx context.Context, client *instapaper.Client, s *ruleStep, moveTargets map[string]string) (instapaper.Bookmark, string, error) {
+	var bm instapaper.Bookmark
+	var err error
+	switch s.Action {
+	case config.ActionArchive:
+		bm, err = client.Archive(ctx, s.BookmarkID)
+	case config.ActionUnarchive:
+		bm, err = client.Unarchive(ctx, s.BookmarkID)
+	case config.ActionStar:
+		bm, err = client.Star(ctx, s.BookmarkID)
+	case config.ActionUnstar:
+		bm, err = client.Unstar(ctx, s.BookmarkID)
+	case config.ActionDelete:
+		err = client.DeleteBookmark(ctx, s.BookmarkID)
+	case config.ActionMove:
+		target, ok := moveTargets[s.action.Folder]
+		if !ok {
+			if target, err = resolveUserFolderID(ctx, client, s.action.Folder); err != nil {
+				return bm, "", err
+			}
+			if target == "" {
+				return bm, "", fmt.Errorf("move target must be a user folder: %s", s.action.Folder)
+			}
+			moveTargets[s.action.Folder] = target
+		}
+		bm, err = client.Move(ctx, s.BookmarkID, target)
+		return bm, target, err
+	case config.ActionTag:
+		// The API has no tag endpoint; re-saving the URL with the full tag
+		// list updates the existing bookmark in place.
+		b := s.bookmark
+		req := instapaper.AddBookmarkRequest{
+			URL:         b.URL,
+			Title:       b.Title,
+			Description: b.Description,
+			Tags:        mergeTags(instapaper.TagNames(b.Tags), s.action.Tags),
+			Archived:    s.folder == "archive",
+		}
+		if _, convErr := strconv.ParseInt(s.folder, 10, 64); convErr == nil {
+			req.FolderID = s.folder
+		}
+		bm, err = client.AddBookmark(ctx, req)
+	default:
+		err = fmt.Errorf("unknown action: %s", s.Action)
+	}
+	return bm, "", err
+}
+
+func writeRulesReport(w io.Writer, opts *GlobalOptions, report rulesReport) error {
+	if report.Steps == nil {
+		report.Steps = []ruleStep{}
+	}
+	switch {
+	case strings.EqualFold(opts.Format, "json"):
+		return writeJSONByFormat(w, opts.Format, report)
+	case isNDJSONFormat(opts.Format):
+		for _, s := range report.Steps {
+			if err := writeJSONByFormat(w, opts.Format, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	case opts.Quiet:
+		return nil
+	case strings.EqualFold(opts.Format, "plain"):
+		for _, s := range report.Steps {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", s.Status, s.Action, s.BookmarkID, s.Rule, s.URL)
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tRULE\tACTION\tID\tTITLE")
+	for _, s := range report.Steps {
+		action := s.Action
+		if s.Target != "" {
+			action += " " + s.Target
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", s.Status, s.Rule, action, s.BookmarkID, ruleTitle(s.Title))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "rules=%d matched=%d applied=%d failed=%d skipped=%d\n", report.Rules, report.Matched, report.Applied, report.Failed, report.Skipped)
+	return err
+}
+
+func ruleTitle(title string) string {
+	title = strings.TrimSpace(strings.ReplaceAll(title, "\n", " "))
+	if r := []rune(title); len(r) > 60 {
+		title = string(r[:59]) + "..."
+	}
+	return title
+}
+
+func ruleFolder(r config.Rule) string {
+	if strings.TrimSpace(r.Folder) == "" {
+		return "unread"
+	}
+	return r.Folder
+}
+
+func describeActions(actions []config.RuleAction) string {
+	parts := make([]string, 0, len(actions))
+	for _, a := range actions {
+		switch a.Type {
+		case config.ActionMove:
+			parts = append(parts, "move:"+a.Folder)
+		case config.ActionTag:
+			parts = append(parts, "tag:"+strings.Join(a.Tags, "+"))
+		default:
+			parts = append(parts, a.Type)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func usageRules() string {
+	return "Usage:\n  ip rules list [--rules <file>]\n  ip rules run [--rules <file>] [--rule name,...] [--yes-really-delete] [--max-deletes N] [--max-pages N] [--progress-json]\n  ip --dry-run rules run\n"
+}
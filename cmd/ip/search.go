@@ -0,0 +1,170 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/vburojevic/instapaper-cli/internal/convert"
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+	"github.com/vburojevic/instapaper-cli/internal/output"
+	"github.com/vburojevic/instapaper-cli/internal/search"
+	"github.com/vburojevic/instapaper-cli/internal/store"
+)
+
+const searchIndexName = "search-index.gob"
+
+func runSearch(args []string, opts *GlobalOptions, stdout, stderr io.Writer) int {
+	args = reorderFlags(args)
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var help bool
+	var folder string
+	var limit int
+	var fields string
+	var selectExpr string
+	var reindex bool
+	fs.BoolVar(&help, "help", false, "Show help")
+	fs.BoolVar(&help, "h", false, "Show help")
+	fs.StringVar(&folder, "folder", "", "Restrict to a folder: unread|starred|archive|<id>|\"Title\" (default: all)")
+	fs.IntVar(&limit, "limit", 20, "Max results (0 = no limit)")
+	fs.StringVar(&fields, "fields", "", "Comma-separated fields (json/ndjson only)")
+	fs.StringVar(&selectExpr, "select", "", "Filter results client-side (e.g. starred=1,tag~news)")
+	fs.BoolVar(&reindex, "reindex", false, "Rebuild the search index from scratch")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if help {
+		printFlagUsage(stdout, usageSearch(), fs)
+		return 0
+	}
+	if fs.NArg() == 0 {
+		return printUsageError(stderr, "search requires a query")
+	}
+	if limit < 0 {
+		return printUsageError(stderr, "--limit must be >= 0")
+	}
+	if fields != "" && !strings.EqualFold(opts.Format, "json") && !isNDJSONFormat(opts.Format) {
+		return printUsageError(stderr, "--fields requires --json or --ndjson output")
+	}
+	if fields != "" && opts.tmpl != nil {
+		return printUsageError(stderr, "--fields cannot be used with --template")
+	}
+	query, err := search.Parse(strings.Join(fs.Args(), " "))
+	if err != nil {
+		return printUsageError(stderr, err.Error())
+	}
+
+	st, err := openSyncedStore(opts)
+	if err != nil {
+		return printError(stderr, err)
+	}
+	idx, err := loadSearchIndex(opts, st, reindex, stderr)
+	if err != nil {
+		return printError(stderr, err)
+	}
+
+	var allowed map[int64]bool
+	if folder != "" {
+		folderID, err := st.ResolveFolder(folder)
+		if err != nil {
+			return printError(stderr, err)
+		}
+		allowed = map[int64]bool{}
+		for _, b := range st.BookmarksInFolder(folderID) {
+			allowed[int64(b.BookmarkID)] = true
+		}
+	}
+
+	var bookmarks []instapaper.Bookmark
+	for _, res := range idx.Search(query) {
+		if allowed != nil && !allowed[res.ID] {
+			continue
+		}
+		e, ok := st.Entry(res.ID)
+		if !ok || e.Folder == "" {
+			continue
+		}
+		bookmarks = append(bookmarks, e.Bookmark)
+	}
+	if selectExpr != "" {
+		bookmarks, err = filterBookmarksBySelect(bookmarks, selectExpr)
+		if err != nil {
+			return printUsageError(stderr, err.Error())
+		}
+	}
+	if limit > 0 && len(bookmarks) > limit {
+		bookmarks = bookmarks[:limit]
+	}
+	verbosef(opts, stderr, "search: indexed=%d results=%d", idx.Len(), len(bookmarks))
+	if fields != "" {
+		if err := output.PrintBookmarksWithFields(stdout, opts.Format, bookmarks, fields); err != nil {
+			return printError(stderr, err)
+		}
+		return 0
+	}
+	if err := printBookmarks(stdout, opts, bookmarks); err != nil {
+		return printError(stderr, err)
+	}
+	return 0
+}
+
+// loadSearchIndex opens the index stored next to the local store and brings it
+// up to date with the store's bookmarks and cached text.
+func loadSearchIndex(opts *GlobalOptions, st *store.Store, reindex bool, stderr io.Writer) (*search.Index, error) {
+	path := filepath.Join(st.Dir(), searchIndexName)
+	idx := search.New()
+	if !reindex {
+		var err error
+		idx, err = search.Load(path)
+		if err != nil {
+			return nil, fmt.Errorf("%w (rebuild with: ip search --reindex)", err)
+		}
+	}
+	var sources []search.Source
+	for _, e := range st.Entries() {
+		if e.Folder == "" {
+			continue
+		}
+		b := e.Bookmark
+		id := int64(b.BookmarkID)
+		hasText := st.HasText(id)
+		sources = append(sources, search.Source{
+			ID:        id,
+			Signature: fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%s\x00%s\x00%t", b.Title, b.URL, b.Description, strings.Join(instapaper.TagNames(b.Tags), ","), b.Hash, e.TextHash, hasText),
+			Load: func() (search.Document, error) {
+				doc := search.Document{
+					Title:       b.Title,
+					URL:         b.URL,
+					Description: b.Description,
+					Tags:        instapaper.TagNames(b.Tags),
+				}
+				if hasText {
+					html, err := st.ReadText(id)
+					if err != nil {
+						return doc, err
+					}
+					doc.Body = convert.ToText(string(html))
+				}
+				return doc, nil
+			},
+		})
+	}
+	stats, err := idx.Update(sources)
+	if err != nil {
+		return nil, err
+	}
+	if reindex || stats.Added+stats.Updated+stats.Removed > 0 {
+		if err := idx.Save(path); err != nil {
+			return nil, err
+		}
+	}
+	verbosef(opts, stderr, "search: index added=%d updated=%d removed=%d", stats.Added, stats.Updated, stats.Removed)
+	return idx, nil
+}
+
+func usageSearch() string {
+	return "Usage:\n  ip search [--folder ...] [--limit N] [--fields ...] [--select <expr>] [--reindex] \"<query>\"\n\nQuery syntax:\n  go generics            all terms (AND is implicit)\n  \"type parameters\"      exact phrase\n  go OR rust             either term\n  go NOT rust | go -rust exclude a term\n  (go OR rust) tag:news  grouping\n  title:, url:, tag:, description:, body:  scope a term or phrase to a field\n  gener*                 prefix match\n\nSearches the local store; run ip sync --text first so article bodies are indexed.\n"
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/vburojevic/instapaper-cli/internal/config"
+	"github.com/vburojevic/instapaper-cli/internal/filter"
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+)
+
+// bookmarkSelection holds the list-style selection flags (--folder, --tag,
+// --limit, bounds, --select) for commands that operate on a set of bookmarks.
+type bookmarkSelection struct {
+	Folder       string
+	Tag          string
+	Limit        int
+	Since        string
+	Until        string
+	UpdatedSince string
+	MaxPages     int
+	Select       string
+
+	since  *boundSpec
+	until  *boundSpec
+	filter *filter.Expr
+}
+
+func (s *bookmarkSelection) addFlags(fs *flag.FlagSet, defaultFolder string, defaultLimit int) {
+	fs.StringVar(&s.Folder, "folder", defaultFolder, "Folder: unread|starred|archive|<id>|\"Title\"")
+	fs.StringVar(&s.Tag, "tag", "", "Tag name (when provided, folder is ignored)")
+	fs.IntVar(&s.Limit, "limit", defaultLimit, "Limit (0 = no limit, max 500)")
+	fs.StringVar(&s.Since, "since", "", "Filter bookmarks since a bound (bookmark_id:<id> or time:<rfc3339|unix>)")
+	fs.StringVar(&s.Until, "until", "", "Filter bookmarks up to a bound (bookmark_id:<id> or time:<rfc3339|unix>)")
+	fs.StringVar(&s.UpdatedSince, "updated-since", "", "Filter by updated time (progress_timestamp or time)")
+	fs.IntVar(&s.MaxPages, "max-pages", 200, "Max pages when --limit is 0")
+	fs.StringVar(&s.Select, "select", "", "Filter results client-side (e.g. starred=1,tag~news)")
+}
+
+// validate checks and parses the flags; errors are usage errors.
+func (s *bookmarkSelection) validate() error {
+	if s.Limit < 0 || s.Limit > 500 {
+		return fmt.Errorf("invalid --limit %d (expected 0..500)", s.Limit)
+	}
+	if s.MaxPages < 0 {
+		return fmt.Errorf("--max-pages must be >= 0")
+	}
+	if s.Since != "" && s.UpdatedSince != "" {
+		return fmt.Errorf("use only one of --since or --updated-since")
+	}
+	var err error
+	if s.since, err = parseBoundSpec(s.Since, "bookmark_id"); err != nil {
+		return err
+	}
+	if s.UpdatedSince != "" {
+		if s.since, err = parseUpdatedBound(s.UpdatedSince); err != nil {
+			return err
+		}
+	}
+	if s.until, err = parseBoundSpec(s.Until, "bookmark_id"); err != nil {
+		return err
+	}
+	if s.filter, err = parseSelectExpr(s.Select); err != nil {
+		return err
+	}
+	return nil
+}
+
+// fetch lists the selected bookmarks from the API, or from the local store
+// with --offline. validate must be called first.
+func (s *bookmarkSelection) fetch(ctx context.Context, opts *GlobalOptions, cfg *config.Config, stderr io.Writer) ([]instapaper.Bookmark, error) {
+	var bookmarks []instapaper.Bookmark
+	if opts.Offline {
+		var err error
+		bookmarks, err = offlineBookmarks(opts, s.Folder, s.Tag, s.Limit)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		client, _, _, err := requireClient(opts, cfg, true, stderr)
+		if err != nil {
+			return nil, err
+		}
+		folderID := ""
+		if s.Tag == "" {
+			folderID, err = resolveListFolderID(ctx, client, s.Folder)
+			if err != nil {
+				return nil, err
+			}
+		}
+		resp, err := listBookmarks(ctx, client, listBookmarksParams{
+			Limit:    s.Limit,
+			FolderID: folderID,
+			Tag:      s.Tag,
+			MaxPages: s.MaxPages,
+		})
+		if err != nil {
+			return nil, err
+		}
+		bookmarks = resp.Bookmarks
+	}
+	bookmarks = filterBookmarksByBounds(bookmarks, s.since, s.until)
+	return s.filter.Filter(bookmarks), nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/vburojevic/instapaper-cli/internal/config"
+	"github.com/vburojevic/instapaper-cli/internal/convert"
+	"github.com/vburojevic/instapaper-cli/internal/gateway"
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+)
+
+func runServe(ctx context.Context, args []string, opts *GlobalOptions, cfg *config.Config, stdout, stderr io.Writer) int {
+	args = reorderFlags(args)
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var help bool
+	var listen string
+	var cacheTTL time.Duration
+	var token string
+	fs.BoolVar(&help, "help", false, "Show help")
+	fs.BoolVar(&help, "h", false, "Show help")
+	fs.StringVar(&listen, "listen", "127.0.0.1:8080", "Address to listen on")
+	fs.DurationVar(&cacheTTL, "cache", time.Minute, "Cache successful responses this long (0 disables)")
+	fs.StringVar(&token, "token", "", "Require \"Authorization: Bearer <token>\" (default: INSTAPAPER_SERVE_TOKEN)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if help {
+		printFlagUsage(stdout, usageServe(), fs)
+		return 0
+	}
+	if fs.NArg() > 0 {
+		return printUsageError(stderr, "usage: ip serve [--listen 127.0.0.1:8080] [--cache 1m] [--token <token>]")
+	}
+	if cacheTTL < 0 {
+		return printUsageError(stderr, "--cache must be >= 0")
+	}
+	if opts.Offline {
+		return printUsageError(stderr, "serve cannot run with --offline")
+	}
+	if token == "" {
+		token = os.Getenv("INSTAPAPER_SERVE_TOKEN")
+	}
+	if token == "" && !isLoopbackAddr(listen) {
+		return printUsageError(stderr, "refusing to listen on a non-loopback address without --token")
+	}
+
+	client, _, _, err := requireClient(opts, cfg, true, stderr)
+	if err != nil {
+		return printError(stderr, err)
+	}
+	handler := newServeHandler(client, token, cacheTTL)
+	handler.Addr = listen
+	if opts.Verbose || opts.Debug {
+		handler.Logf = func(format string, args ...any) {
+			fmt.Fprintf(stderr, "serve: "+format+"\n", args...)
+		}
+	}
+
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return printError(stderr, err)
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	if !opts.Quiet {
+		fmt.Fprintf(stderr, "Serving read-only API on http://%s/ (Ctrl-C to stop)\n", ln.Addr())
+	}
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return printError(stderr, err)
+	}
+	return 0
+}
+
+func newServeHandler(client *instapaper.Client, token string, ttl time.Duration) *gateway.Server {
+	return &gateway.Server{
+		Backend:  &serveBackend{client: client},
+		Token:    token,
+		TTL:      ttl,
+		Classify: httpStatusForError,
+	}
+}
+
+// isLoopbackAddr reports whether addr only accepts local connections. An
+// empty host listens on every interface.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// httpStatusForError maps an upstream error to the status ip serve answers
+// with, keeping the error codes of --json errors.
+func httpStatusForError(err error) (int, string) {
+	code := errorCodeForError(err)
+	switch code {
+	case ErrCodeRateLimited:
+		return http.StatusTooManyRequests, code
+	case ErrCodeInvalidRequest:
+		return http.StatusBadRequest, code
+	case ErrCodeTimeout:
+		return http.StatusGatewayTimeout, code
+	case ErrCodeAuth, ErrCodeConfig:
+		return http.StatusInternalServerError, code
+	}
+	return http.StatusBadGateway, code
+}
+
+// serveBackend answers ip serve requests with the same folder resolution,
+// paging and --select filtering as the CLI commands.
+type serveBackend struct {
+	client *instapaper.Client
+}
+
+func (b *serveBackend) folderID(ctx context.Context, folder string) (string, error) {
+	id, err := resolveListFolderID(ctx, b.client, folder)
+	if errors.Is(err, errFolderNotFound) {
+		return "", gateway.BadRequest(err)
+	}
+	return id, err
+}
+
+func (b *serveBackend) Bookmarks(ctx context.Context, q gateway.BookmarkQuery) ([]instapaper.Bookmark, error) {
+	sel, err := parseSelectExpr(q.Select)
+	if err != nil {
+		return nil, gateway.BadRequest(err)
+	}
+	folderID := ""
+	if q.Tag == "" {
+		if folderID, err = b.folderID(ctx, q.Folder); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := listBookmarks(ctx, b.client, listBookmarksParams{Limit: q.Limit, FolderID: folderID, Tag: q.Tag, MaxPages: 200})
+	if err != nil {
+		return nil, err
+	}
+	return sel.Filter(resp.Bookmarks), nil
+}
+
+func (b *serveBackend) Text(ctx context.Context, bookmarkID int64, format string) ([]byte, error) {
+	to, err := convert.ParseFormat(format)
+	if err != nil {
+		return nil, gateway.BadRequest(err)
+	}
+	html, err := b.client.GetTextHTML(ctx, bookmarkID)
+	if err != nil {
+		return nil, err
+	}
+	if to == convert.FormatHTML {
+		return html, nil
+	}
+	return convert.Convert(html, to), nil
+}
+
+func (b *serveBackend) Folders(ctx context.Context) ([]instapaper.Folder, error) {
+	return b.client.ListFolders(ctx)
+}
+
+func (b *serveBackend) Highlights(ctx context.Context, q gateway.HighlightQuery) ([]instapaper.Highlight, error) {
+	if q.BookmarkID > 0 {
+		return b.client.ListHighlights(ctx, q.BookmarkID)
+	}
+	folderID, err := b.folderID(ctx, q.Folder)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := listBookmarks(ctx, b.client, listBookmarksParams{Limit: 0, FolderID: folderID, MaxPages: 200})
+	if err != nil {
+		return nil, err
+	}
+	return fetchFolderHighlights(ctx, b.client, folderID, resp.Bookmarks)
+}
+
+func usageServe() string {
+	return "Usage:\n  ip serve [--listen 127.0.0.1:8080] [--cache 1m] [--token <token>]\n\nServes a read-only JSON API: GET /bookmarks?folder=&tag=&select=&limit=, GET /bookmarks/{id}/text?format=html|markdown|text, GET /folders, GET /highlights?bookmark_id=|folder=.\n"
+}
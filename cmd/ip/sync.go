@@ -0,0 +1,458 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vburojevic/instapaper-cli/internal/config"
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+	"github.com/vburojevic/instapaper-cli/internal/store"
+)
+
+const storeDirName = "store"
+
+type syncFolderReport struct {
+	Folder string `json:"folder"`
+	Title  string `json:"title"`
+	store.ApplyResult
+}
+
+type syncReport struct {
+	StoreDir    string             `json:"store_dir"`
+	SyncedAt    int64              `json:"synced_at"`
+	Folders     []syncFolderReport `json:"folders"`
+	Bookmarks   int                `json:"bookmarks"`
+	Pruned      int                `json:"pruned"`
+	Highlights  int                `json:"highlights_added"`
+	TextFetched int                `json:"text_fetched"`
+	TextFailed  int                `json:"text_failed"`
+}
+
+type syncStatus struct {
+	StoreDir   string         `json:"store_dir"`
+	SyncedAt   int64          `json:"synced_at,omitempty"`
+	Bookmarks  int            `json:"bookmarks"`
+	Starred    int            `json:"starred"`
+	Folders    map[string]int `json:"folders"`
+	Highlights int            `json:"highlights"`
+	Texts      int            `json:"texts"`
+}
+
+// resolveStoreDir picks the local store location: flag, env, then a "store"
+// directory next to the config file (profiles/<name>/store for a named
+// profile, so accounts never share a store).
+func resolveStoreDir(override, cfgPath, profile string) string {
+	if override != "" {
+		return override
+	}
+	if env := os.Getenv("INSTAPAPER_STORE_DIR"); env != "" {
+		return env
+	}
+	if profile != "" && profile != config.DefaultProfile {
+		return filepath.Join(filepath.Dir(cfgPath), "profiles", profile, storeDirName)
+	}
+	return filepath.Join(filepath.Dir(cfgPath), storeDirName)
+}
+
+func openLocalStore(opts *GlobalOptions) (*store.Store, error) {
+	return store.Open(opts.StoreDir)
+}
+
+// openSyncedStore opens the local store and fails if it has never been synced.
+func openSyncedStore(opts *GlobalOptions) (*store.Store, error) {
+	st, err := openLocalStore(opts)
+	if err != nil {
+		return nil, err
+	}
+	if st.Empty() {
+		return nil, fmt.Errorf("local store %s is empty; run: ip sync", opts.StoreDir)
+	}
+	return st, nil
+}
+
+// resolveOfflineFolderID resolves a folder name or id against the local
+// store, the offline counterpart of resolveListFolderID.
+func resolveOfflineFolderID(opts *GlobalOptions, folder string) (string, error) {
+	st, err := openSyncedStore(opts)
+	if err != nil {
+		return "", err
+	}
+	return st.ResolveFolder(folder)
+}
+
+// offlineBookmarks answers a list/export selection from the local store.
+func offlineBookmarks(opts *GlobalOptions, folder, tag string, limit int) ([]instapaper.Bookmark, error) {
+	st, err := openSyncedStore(opts)
+	if err != nil {
+		return nil, err
+	}
+	var bookmarks []instapaper.Bookmark
+	if tag != "" {
+		bookmarks = st.BookmarksByTag(tag)
+	} else {
+		folderID, err := st.ResolveFolder(folder)
+		if err != nil {
+			return nil, err
+		}
+		bookmarks = st.BookmarksInFolder(folderID)
+	}
+	if limit > 0 && len(bookmarks) > limit {
+		bookmarks = bookmarks[:limit]
+	}
+	return bookmarks, nil
+}
+
+func runSync(ctx context.Context, args []string, opts *GlobalOptions, cfg *config.Config, stdout, stderr io.Writer) int {
+	if len(args) > 0 && args[0] == "status" {
+		return runSyncStatus(args[1:], opts, stdout, stderr)
+	}
+	args = reorderFlags(args)
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var help bool
+	var foldersCSV string
+	var highlights bool
+	var text bool
+	var full bool
+	var maxPages int
+	var progressJSON bool
+	fs.BoolVar(&help, "help", false, "Show help")
+	fs.BoolVar(&help, "h", false, "Show help")
+	fs.StringVar(&foldersCSV, "folders", "", "Comma-separated folders to sync (default: unread, archive and all user folders)")
+	fs.BoolVar(&highlights, "highlights", false, "Also sync highlights")
+	fs.BoolVar(&text, "text", false, "Also cache the text view of new or changed bookmarks")
+	fs.BoolVar(&full, "full", false, "Ignore local state and refetch every folder")
+	fs.IntVar(&maxPages, "max-pages", 200, "Max pages per folder")
+	fs.BoolVar(&progressJSON, "progress-json", false, "Emit text fetch progress as NDJSON on stderr")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if help {
+		printFlagUsage(stdout, usageSync(), fs)
+		return 0
+	}
+	if len(fs.Args()) > 0 {
+		return printUsageError(stderr, "usage: ip sync [--folders ...] [--highlights] [--text] [--full] | ip sync status")
+	}
+	if maxPages < 0 {
+		return printUsageError(stderr, "--max-pages must be >= 0")
+	}
+	if opts.Offline {
+		return printUsageError(stderr, "sync cannot run with --offline")
+	}
+	if opts.DryRun {
+		_ = emitDryRunAction(stdout, opts.Format, "sync", map[string]any{
+			"store_dir":  opts.StoreDir,
+			"folders":    foldersCSV,
+			"highlights": highlights,
+			"text":       text,
+			"full":       full,
+		})
+		return 0
+	}
+
+	client, _, _, err := requireClient(opts, cfg, true, stderr)
+	if err != nil {
+		return printError(stderr, err)
+	}
+	st, err := openLocalStore(opts)
+	if err != nil {
+		return printError(stderr, err)
+	}
+
+	folders, err := client.ListFolders(ctx)
+	if err != nil {
+		return printError(stderr, err)
+	}
+	st.Folders = folders
+
+	targets := []string{"unread", "archive"}
+	for _, f := range folders {
+		targets = append(targets, strconv.FormatInt(int64(f.FolderID), 10))
+	}
+	if foldersCSV != "" {
+		targets = targets[:0]
+		for _, name := range splitTags(foldersCSV) {
+			id, err := resolveListFolderID(ctx, client, name)
+			if err != nil {
+				return printError(stderr, err)
+			}
+			if id == "starred" {
+				return printUsageError(stderr, "starred is derived from the starred flag; sync the folders that hold the bookmarks instead")
+			}
+			targets = append(targets, id)
+		}
+	}
+
+	report := syncReport{StoreDir: st.Dir()}
+	for _, target := range targets {
+		if full {
+			if highlights {
+				st.ClearHighlights(target)
+			}
+			st.Detach(target)
+		}
+		resp, err := listBookmarks(ctx, client, listBookmarksParams{
+			FolderID: target,
+			Have:     haveStringForBookmarks(st.HaveEntries(target)),
+			MaxPages: maxPages,
+		})
+		if err != nil {
+			return printError(stderr, fmt.Errorf("sync folder %s: %w", target, err))
+		}
+		if resp.User.UserID != 0 {
+			st.User = resp.User
+		}
+		res := st.Apply(target, resp.Bookmarks, resp.DeleteIDs)
+		if highlights {
+			added, err := syncFolderHighlights(ctx, client, st, target)
+			if err != nil {
+				return printError(stderr, fmt.Errorf("sync highlights %s: %w", target, err))
+			}
+			report.Highlights += added
+		}
+		report.Folders = append(report.Folders, syncFolderReport{
+			Folder:      target,
+			Title:       st.FolderTitle(target),
+			ApplyResult: res,
+		})
+		verbosef(opts, stderr, "sync: folder=%s added=%d updated=%d removed=%d", target, res.Added, res.Updated, res.Removed)
+	}
+	// Entries detached from one folder are re-attached if they show up in
+	// another; only prune once every folder has been seen.
+	if foldersCSV == "" {
+		st.Retain(targets)
+		pruned, err := st.Prune()
+		if err != nil {
+			return printError(stderr, err)
+		}
+		report.Pruned = pruned
+	}
+	st.SyncedAt = time.Now().Unix()
+	if err := st.Save(); err != nil {
+		return printError(stderr, err)
+	}
+
+	exit := 0
+	if text {
+		var pending []int64
+		for _, e := range st.Entries() {
+			if e.Bookmark.PrivateSource == "" && st.NeedsText(int64(e.Bookmark.BookmarkID)) {
+				pending = append(pending, int64(e.Bookmark.BookmarkID))
+			}
+		}
+		emitter := newProgressEmitter(progressJSON, stderr, "sync.text", len(pending))
+		emitter.Start()
+		for _, id := range pending {
+			b, err := client.GetTextHTML(ctx, id)
+			if err == nil {
+				err = st.WriteText(id, b)
+			}
+			if err != nil {
+				code := exitCodeForError(err)
+				if code > exit {
+					exit = code
+				}
+				report.TextFailed++
+				emitter.ItemError(map[string]any{"bookmark_id": id}, err)
+				writeErrorLine(stderr, fmt.Errorf("text %d: %v", id, err))
+				continue
+			}
+			report.TextFetched++
+			emitter.ItemSuccess(map[string]any{"bookmark_id": id})
+		}
+		emitter.Done()
+		if err := st.Save(); err != nil {
+			return printError(stderr, err)
+		}
+	}
+
+	report.SyncedAt = st.SyncedAt
+	report.Bookmarks = len(st.Entries())
+	if err := printSyncReport(stdout, opts, report); err != nil {
+		return printError(stderr, err)
+	}
+	return exit
+}
+
+func runSyncStatus(args []string, opts *GlobalOptions, stdout, stderr io.Writer) int {
+	if hasHelpFlag(args) {
+		fmt.Fprintln(stdout, usageSync())
+		return 0
+	}
+	if len(args) > 0 {
+		return printUsageError(stderr, "usage: ip sync status")
+	}
+	st, err := openLocalStore(opts)
+	if err != nil {
+		return printError(stderr, err)
+	}
+	status := syncStatus{
+		StoreDir:   st.Dir(),
+		SyncedAt:   st.SyncedAt,
+		Folders:    map[string]int{},
+		Highlights: len(st.AllHighlights()),
+	}
+	for _, e := range st.Entries() {
+		status.Bookmarks++
+		status.Folders[e.Folder]++
+		if bool(e.Bookmark.Starred) {
+			status.Starred++
+		}
+		if st.HasText(int64(e.Bookmark.BookmarkID)) {
+			status.Texts++
+		}
+	}
+	if strings.EqualFold(opts.Format, "json") || isNDJSONFormat(opts.Format) {
+		if err := writeJSONByFormat(stdout, opts.Format, status); err != nil {
+			return printError(stderr, err)
+		}
+		return 0
+	}
+	synced := "never"
+	if status.SyncedAt > 0 {
+		synced = time.Unix(status.SyncedAt, 0).UTC().Format(time.RFC3339)
+	}
+	fmt.Fprintf(stdout, "store_dir=%s\nsynced_at=%s\nbookmarks=%d\nstarred=%d\nhighlights=%d\ntexts=%d\n",
+		status.StoreDir, synced, status.Bookmarks, status.Starred, status.Highlights, status.Texts)
+	for _, key := range sortedKeys(status.Folders) {
+		fmt.Fprintf(stdout, "folder.%s=%d\n", key, status.Folders[key])
+	}
+	return 0
+}
+
+func printSyncReport(w io.Writer, opts *GlobalOptions, report syncReport) error {
+	switch {
+	case strings.EqualFold(opts.Format, "json") || isNDJSONFormat(opts.Format):
+		return writeJSONByFormat(w, opts.Format, report)
+	case opts.Quiet:
+		return nil
+	case strings.EqualFold(opts.Format, "plain"):
+		for _, f := range report.Folders {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\n", f.Folder, f.Added, f.Updated, f.Removed, f.Title)
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "FOLDER\tADDED\tUPDATED\tREMOVED\tTITLE")
+	for _, f := range report.Folders {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\n", f.Folder, f.Added, f.Updated, f.Removed, f.Title)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Synced %d bookmarks to %s (pruned %d, text fetched %d, failed %d)\n",
+		report.Bookmarks, report.StoreDir, report.Pruned, report.TextFetched, report.TextFailed)
+	return nil
+}
+
+// syncFolderHighlights fetches the highlights of every stored bookmark in
+// folder and merges them into the store.
+func syncFolderHighlights(ctx context.Context, client *instapaper.Client, st *store.Store, folder string) (int, error) {
+	highlights, err := fetchFolderHighlights(ctx, client, folder, st.HaveEntries(folder))
+	if err != nil {
+		return 0, err
+	}
+	return st.MergeHighlights(highlights), nil
+}
+
+// highlightsChunk caps how many bookmark ids go into one highlights request.
+const highlightsChunk = 100
+
+// fetchFolderHighlights asks the list endpoint for the highlights of the given
+// bookmarks in folder. Passing the full have set keeps bookmarks out of the
+// response so only highlights come back.
+func fetchFolderHighlights(ctx context.Context, client *instapaper.Client, folder string, bookmarks []instapaper.Bookmark) ([]instapaper.Highlight, error) {
+	if len(bookmarks) == 0 {
+		return nil, nil
+	}
+	have := haveStringForBookmarks(bookmarks)
+	var highlights []instapaper.Highlight
+	for start := 0; start < len(bookmarks); start += highlightsChunk {
+		end := min(start+highlightsChunk, len(bookmarks))
+		resp, err := client.ListBookmarks(ctx, instapaper.ListBookmarksOptions{
+			Limit:      500,
+			FolderID:   folder,
+			Have:       have,
+			Highlights: bookmarkIDList(bookmarks[start:end]),
+		})
+		if err != nil {
+			return nil, err
+		}
+		highlights = append(highlights, resp.Highlights...)
+	}
+	return highlights, nil
+}
+
+func haveStringForBookmarks(bookmarks []instapaper.Bookmark) string {
+	cur := &listCursor{Have: map[string]cursorEntry{}}
+	updateCursor(cur, bookmarks, nil)
+	return haveStringFromCursor(cur)
+}
+
+func bookmarkIDList(bookmarks []instapaper.Bookmark) string {
+	ids := make([]string, 0, len(bookmarks))
+	for _, b := range bookmarks {
+		ids = append(ids, strconv.FormatInt(int64(b.BookmarkID), 10))
+	}
+	return strings.Join(ids, ",")
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// textFetcher returns a text view loader backed by the API, or by the local
+// store when --offline is set.
+func textFetcher(ctx context.Context, opts *GlobalOptions, cfg *config.Config, stderr io.Writer) (func(int64) ([]byte, error), error) {
+	if opts.Offline {
+		st, err := openSyncedStore(opts)
+		if err != nil {
+			return nil, err
+		}
+		return st.ReadText, nil
+	}
+	client, _, _, err := requireClient(opts, cfg, true, stderr)
+	if err != nil {
+		return nil, err
+	}
+	return func(id int64) ([]byte, error) {
+		return client.GetTextHTML(ctx, id)
+	}, nil
+}
+
+func usageSync() string {
+	return "Usage:\n  ip sync [--folders <list>] [--highlights] [--text] [--full] [--max-pages N] [--progress-json]\n  ip sync status\n"
+}
+
+// printOfflineFolders and printOfflineHighlights serve `folders list` and
+// `highlights list` from the local store.
+func printOfflineFolders(w io.Writer, opts *GlobalOptions) error {
+	st, err := openSyncedStore(opts)
+	if err != nil {
+		return err
+	}
+	return printFolders(w, opts, st.Folders)
+}
+
+func printOfflineHighlights(w io.Writer, opts *GlobalOptions, bookmarkID int64) error {
+	st, err := openSyncedStore(opts)
+	if err != nil {
+		return err
+	}
+	return printHighlights(w, opts, st.HighlightsFor(bookmarkID))
+}
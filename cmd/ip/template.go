@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+	"github.com/vburojevic/instapaper-cli/internal/output"
+)
+
+// loadTemplate parses --template or the contents of --template-file. It
+// returns nil when neither is set.
+func loadTemplate(text, path string) (*output.Template, error) {
+	if text != "" && path != "" {
+		return nil, fmt.Errorf("use only one of --template or --template-file")
+	}
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("--template-file: %w", err)
+		}
+		text = string(b)
+	}
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := output.ParseTemplate(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// printBookmarks, printFolders and printHighlights render listings through
+// the --template when one is set, and in the output format otherwise.
+func printBookmarks(w io.Writer, opts *GlobalOptions, bookmarks []instapaper.Bookmark) error {
+	if opts.tmpl != nil {
+		return opts.tmpl.Bookmarks(w, []output.BookmarkGroup{{Bookmarks: bookmarks}})
+	}
+	return output.PrintBookmarks(w, opts.Format, bookmarks)
+}
+
+func printFolders(w io.Writer, opts *GlobalOptions, folders []instapaper.Folder) error {
+	if opts.tmpl != nil {
+		return opts.tmpl.Folders(w, folders)
+	}
+	return output.PrintFolders(w, opts.Format, folders)
+}
+
+func printHighlights(w io.Writer, opts *GlobalOptions, highlights []instapaper.Highlight) error {
+	if opts.tmpl != nil {
+		return opts.tmpl.Highlights(w, highlights)
+	}
+	return output.PrintHighlights(w, opts.Format, highlights)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/vburojevic/instapaper-cli/internal/config"
+	"github.com/vburojevic/instapaper-cli/internal/convert"
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+	"github.com/vburojevic/instapaper-cli/internal/store"
+)
+
+// bookmarkLookup resolves bookmark metadata for front matter. It checks the
+// local store first and, unless --offline is set, lists folders from the API
+// on demand (unread, archive, then user folders) until the id turns up. It is
+// safe for concurrent use.
+type bookmarkLookup struct {
+	mu      sync.Mutex
+	ctx     context.Context
+	opts    *GlobalOptions
+	cfg     *config.Config
+	stderr  io.Writer
+	store   *store.Store
+	client  *instapaper.Client
+	found   map[int64]instapaper.Bookmark
+	pending []string
+	started bool
+}
+
+func newBookmarkLookup(ctx context.Context, opts *GlobalOptions, cfg *config.Config, stderr io.Writer) *bookmarkLookup {
+	l := &bookmarkLookup{ctx: ctx, opts: opts, cfg: cfg, stderr: stderr, found: map[int64]instapaper.Bookmark{}}
+	if st, err := openLocalStore(opts); err == nil && !st.Empty() {
+		l.store = st
+	}
+	return l
+}
+
+func (l *bookmarkLookup) Get(id int64) (instapaper.Bookmark, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.store != nil {
+		if e, ok := l.store.Entry(id); ok {
+			return e.Bookmark, true, nil
+		}
+	}
+	if b, ok := l.found[id]; ok {
+		return b, true, nil
+	}
+	if l.opts.Offline {
+		return instapaper.Bookmark{}, false, nil
+	}
+	if !l.started {
+		l.started = true
+		client, _, _, err := requireClient(l.opts, l.cfg, true, l.stderr)
+		if err != nil {
+			return instapaper.Bookmark{}, false, err
+		}
+		l.client = client
+		folders, err := client.ListFolders(l.ctx)
+		if err != nil {
+			return instapaper.Bookmark{}, false, err
+		}
+		l.pending = []string{"unread", "archive"}
+		for _, f := range folders {
+			l.pending = append(l.pending, strconv.FormatInt(int64(f.FolderID), 10))
+		}
+	}
+	for len(l.pending) > 0 {
+		folder := l.pending[0]
+		l.pending = l.pending[1:]
+		verbosef(l.opts, l.stderr, "text: looking up metadata in folder %s", folder)
+		resp, err := listBookmarks(l.ctx, l.client, listBookmarksParams{FolderID: folder, MaxPages: 200})
+		if err != nil {
+			return instapaper.Bookmark{}, false, err
+		}
+		for _, b := range resp.Bookmarks {
+			l.found[int64(b.BookmarkID)] = b
+		}
+		if b, ok := l.found[id]; ok {
+			return b, true, nil
+		}
+	}
+	return instapaper.Bookmark{}, false, nil
+}
+
+// textMetadata maps a bookmark onto front matter fields. Unknown bookmarks
+// carry only their id.
+func textMetadata(id int64, b instapaper.Bookmark, ok bool) convert.Metadata {
+	meta := convert.Metadata{ID: id}
+	if !ok {
+		return meta
+	}
+	meta.URL = b.URL
+	meta.Title = b.Title
+	meta.Description = b.Description
+	meta.Tags = instapaper.TagNames(b.Tags)
+	meta.Progress = float64(b.Progress)
+	meta.Starred = bool(b.Starred)
+	meta.Time = int64(b.Time)
+	return meta
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vburojevic/instapaper-cli/internal/config"
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+	"github.com/vburojevic/instapaper-cli/internal/store"
+	"github.com/vburojevic/instapaper-cli/internal/undo"
+)
+
+const undoLogName = "undo.jsonl"
+
+// undoRecorder collects the changes made by one mutating command and appends
+// them to the undo log as a single operation. Prior state comes from what the
+// caller read (Known), then from the local store, then from a bounded Lookup
+// against the API. Every recorded change is written back to the store, so
+// the store is only behind by changes made outside ip since the last sync;
+// when no source knows a bookmark its prior state is left unknown rather
+// than guessed.
+type undoRecorder struct {
+	opts  *GlobalOptions
+	op    undo.Op
+	store *store.Store
+	// known holds prior state for bookmarks the store does not have.
+	known map[int64]*store.Entry
+	dirty bool
+}
+
+func newUndoRecorder(opts *GlobalOptions, command string) *undoRecorder {
+	r := &undoRecorder{opts: opts, op: undo.Op{Command: command, Profile: opts.Profile}, known: map[int64]*store.Entry{}}
+	if st, err := openLocalStore(opts); err == nil && !st.Empty() {
+		r.store = st
+	}
+	return r
+}
+
+// undoLookupPages caps the pages (of up to 500 bookmarks) one Lookup lists,
+// so an unknown or deleted id does not scan the whole account.
+const undoLookupPages = 4
+
+var (
+	errLookupDone   = errors.New("lookup done")
+	errLookupBudget = errors.New("lookup page budget spent")
+)
+
+// Lookup fetches the current state of the ids neither the caller nor the
+// local store knows by listing Unread, Archive and the user folders until
+// all are found or undoLookupPages pages were read. It must run before the
+// mutation. Failures only leave prior state unknown.
+func (r *undoRecorder) Lookup(ctx context.Context, client *instapaper.Client, ids []int64, stderr io.Writer) {
+	missing := map[int64]bool{}
+	for _, id := range ids {
+		if r.entry(id) == nil {
+			missing[id] = true
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	folders := []string{"unread", "archive"}
+	pages := 0
+	if list, err := client.ListFolders(ctx); err == nil {
+		for _, f := range list {
+			folders = append(folders, strconv.FormatInt(int64(f.FolderID), 10))
+		}
+	}
+	for _, folder := range folders {
+		_, err := listBookmarks(ctx, client, listBookmarksParams{
+			FolderID:      folder,
+			DiscardOutput: true,
+			PageHandler: func(page []instapaper.Bookmark, _ int) error {
+				for _, b := range page {
+					id := int64(b.BookmarkID)
+					if missing[id] {
+						r.Known(id, b, folder)
+						delete(missing, id)
+					}
+				}
+				if len(missing) == 0 {
+					return errLookupDone
+				}
+				if pages++; pages >= undoLookupPages {
+					return errLookupBudget
+				}
+				return nil
+			},
+		})
+		if errors.Is(err, errLookupDone) {
+			return
+		}
+		if errors.Is(err, errLookupBudget) {
+			verbosef(r.opts, stderr, "%s: undo lookup stopped after %d pages; %d bookmark(s) recorded without prior state (run ip sync)", r.op.Command, pages, len(missing))
+			return
+		}
+		if err != nil {
+			verbosef(r.opts, stderr, "%s: undo lookup in %s: %v", r.op.Command, folder, err)
+			return
+		}
+	}
+}
+
+// Known records the state of a bookmark the caller read before changing it,
+// so it need not be looked up. The first call for a bookmark wins; later
+// changes are tracked by Add.
+func (r *undoRecorder) Known(id int64, bm instapaper.Bookmark, folder string) {
+	if _, ok := r.known[id]; ok {
+		return
+	}
+	r.known[id] = &store.Entry{Bookmark: bm, Folder: folder}
+}
+
+func (r *undoRecorder) entry(id int64) *store.Entry {
+	if e, ok := r.known[id]; ok {
+		return e
+	}
+	if r.store != nil {
+		if e, ok := r.store.Entry(id); ok {
+			return e
+		}
+	}
+	return nil
+}
+
+// Add records that command changed bookmark id; bm is the bookmark the API
+// returned and folder the destination of a move. The change is recorded even
+// when the prior state matches the new one, since that state may be stale.
+func (r *undoRecorder) Add(id int64, bm instapaper.Bookmark, folder string) {
+	r.AddAction(r.op.Command, id, bm, folder)
+}
+
+// AddAction is Add for commands such as rules run that mix actions: action
+// is archive, unarchive, move, star, unstar or progress.
+func (r *undoRecorder) AddAction(action string, id int64, bm instapaper.Bookmark, folder string) {
+	entry := r.entry(id)
+	c := undo.Change{BookmarkID: id}
+	switch action {
+	case "archive":
+		c.After.Folder = "archive"
+	case "unarchive":
+		c.After.Folder = "unread"
+	case "move":
+		c.After.Folder = folder
+	case "star", "unstar":
+		after := action == "star"
+		c.After.Starred = &after
+		if entry != nil {
+			before := bool(entry.Bookmark.Starred)
+			c.Before.Starred = &before
+		}
+	case "progress":
+		p, ts := float64(bm.Progress), int64(bm.ProgressTimestamp)
+		c.After.Progress, c.After.ProgressTimestamp = &p, &ts
+		if entry != nil {
+			bp, bts := float64(entry.Bookmark.Progress), int64(entry.Bookmark.ProgressTimestamp)
+			c.Before.Progress, c.Before.ProgressTimestamp = &bp, &bts
+		}
+	}
+	if entry != nil && c.After.Folder != "" {
+		c.Before.Folder = entry.Folder
+	}
+	r.op.Changes = append(r.op.Changes, c)
+	if entry != nil {
+		r.apply(entry, c.After)
+	}
+}
+
+// apply moves entry to state s after a successful mutation.
+func (r *undoRecorder) apply(entry *store.Entry, s undo.State) {
+	if s.Folder != "" {
+		entry.Folder = s.Folder
+	}
+	if s.Starred != nil {
+		entry.Bookmark.Starred = instapaper.BoolInt(*s.Starred)
+	}
+	if s.Progress != nil {
+		entry.Bookmark.Progress = instapaper.Float64(*s.Progress)
+		entry.Bookmark.ProgressTimestamp = instapaper.Int64(*s.ProgressTimestamp)
+	}
+	r.dirty = true
+}
+
+// Save appends the operation, if anything changed, and writes the updated
+// entries back to the local store. Failures are reported but do not fail the
+// command.
+func (r *undoRecorder) Save(stderr io.Writer) {
+	if len(r.op.Changes) == 0 {
+		return
+	}
+	if r.dirty && r.store != nil {
+		if err := r.store.Save(); err != nil {
+			writeErrorLine(stderr, fmt.Errorf("store: %v", err))
+		}
+	}
+	if err := undo.Open(r.opts.UndoLog).Append(&r.op); err != nil {
+		writeErrorLine(stderr, fmt.Errorf("undo log: %v", err))
+		return
+	}
+	verbosef(r.opts, stderr, "%s: recorded undo operation %s", r.op.Command, r.op.ID)
+}
+
+func runUndo(ctx context.Context, args []string, opts *GlobalOptions, cfg *config.Config, stdout, stderr io.Writer) int {
+	args = reorderFlags(args)
+	fs := flag.NewFlagSet("undo", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var help bool
+	var last int
+	var opID string
+	var list bool
+	fs.BoolVar(&help, "help", false, "Show help")
+	fs.BoolVar(&help, "h", false, "Show help")
+	fs.IntVar(&last, "last", 1, "Undo the N most recent operations")
+	fs.StringVar(&opID, "op", "", "Undo the operation with this id")
+	fs.BoolVar(&list, "list", false, "List recorded operations")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if help {
+		printFlagUsage(stdout, usageUndo(), fs)
+		return 0
+	}
+	if len(fs.Args()) != 0 {
+		return printUsageError(stderr, "usage: ip undo [--last N | --op <id>] [--list]")
+	}
+	if last < 1 {
+		return printUsageError(stderr, "--last must be >= 1")
+	}
+	if opts.Offline && !list {
+		return printUsageError(stderr, "undo cannot run with --offline (only --list)")
+	}
+	log := undo.Open(opts.UndoLog)
+	all, err := log.Ops()
+	if err != nil {
+		return printError(stderr, err)
+	}
+	var ops []undo.Op
+	for _, op := range all {
+		if op.Profile == opts.Profile || (op.Profile == "" && opts.Profile == config.DefaultProfile) {
+			ops = append(ops, op)
+		}
+	}
+	if list {
+		return printUndoOps(stdout, stderr, opts.Format, ops)
+	}
+
+	var targets []undo.Op
+	if opID != "" {
+		for _, op := range ops {
+			if op.ID == opID {
+				targets = append(targets, op)
+			}
+		}
+		if len(targets) == 0 {
+			return printError(stderr, fmt.Errorf("operation not found: %s", opID))
+		}
+		if targets[0].Undone() {
+			return printError(stderr, fmt.Errorf("operation %s was already undone", opID))
+		}
+	} else {
+		for i := len(ops) - 1; i >= 0 && len(targets) < last; i-- {
+			if !ops[i].Undone() {
+				targets = append(targets, ops[i])
+			}
+		}
+		if len(targets) == 0 {
+			return printError(stderr, errors.New("nothing to undo"))
+		}
+	}
+
+	if opts.DryRun {
+		var records []map[string]any
+		for _, op := range targets {
+			for i := len(op.Changes) - 1; i >= 0; i-- {
+				c := op.Changes[i]
+				records = append(records, map[string]any{"op": op.ID, "command": op.Command, "bookmark_id": c.BookmarkID, "restore": c.Before})
+			}
+		}
+		return emitDryRunRecords(stdout, opts.Format, "undo", records)
+	}
+	client, _, _, err := requireClient(opts, cfg, true, stderr)
+	if err != nil {
+		return printError(stderr, err)
+	}
+	exit := 0
+	for _, op := range targets {
+		failed := false
+		// Revert in reverse order so repeated changes to one bookmark unwind.
+		for i := len(op.Changes) - 1; i >= 0; i-- {
+			c := op.Changes[i]
+			action, err := restoreState(ctx, client, c.BookmarkID, c.Before)
+			if err != nil && !isAlreadyStateError(err) {
+				failed = true
+				if code := exitCodeForError(err); code > exit {
+					exit = code
+				}
+				writeErrorLine(stderr, fmt.Errorf("undo %s %d: %v", op.Command, c.BookmarkID, err))
+				continue
+			}
+			if opts.Quiet {
+				fmt.Fprintf(stdout, "%d\n", c.BookmarkID)
+			} else {
+				fmt.Fprintf(stdout, "OK %s %d\n", action, c.BookmarkID)
+			}
+		}
+		if failed {
+			continue
+		}
+		if err := log.MarkUndone(op.ID); err != nil {
+			writeErrorLine(stderr, fmt.Errorf("undo log: %v", err))
+		}
+		verbosef(opts, stderr, "undo: reverted %s (%s, %d bookmarks)", op.ID, op.Command, len(op.Changes))
+	}
+	return exit
+}
+
+// restoreState puts a bookmark back into state s through the regular client
+// calls and returns the action taken.
+func restoreState(ctx context.Context, client *instapaper.Client, id int64, s undo.State) (string, error) {
+	if s.Empty() {
+		return "", errors.New("previous state unknown (run ip sync before mutating to record it)")
+	}
+	var actions []string
+	switch s.Folder {
+	case "":
+	case "unread":
+		if _, err := client.Unarchive(ctx, id); err != nil {
+			return "", err
+		}
+		actions = append(actions, "unarchive")
+	case "archive":
+		if _, err := client.Archive(ctx, id); err != nil {
+			return "", err
+		}
+		actions = append(actions, "archive")
+	default:
+		if _, err := client.Move(ctx, id, s.Folder); err != nil {
+			return "", err
+		}
+		actions = append(actions, "move")
+	}
+	if s.Starred != nil {
+		var err error
+		if *s.Starred {
+			_, err = client.Star(ctx, id)
+			actions = append(actions, "star")
+		} else {
+			_, err = client.Unstar(ctx, id)
+			actions = append(actions, "unstar")
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	if s.Progress != nil {
+		ts := time.Now().Unix()
+		if s.ProgressTimestamp != nil && *s.ProgressTimestamp > 0 {
+			ts = *s.ProgressTimestamp
+		}
+		if _, err := client.UpdateReadProgress(ctx, id, *s.Progress, ts); err != nil {
+			return "", err
+		}
+		actions = append(actions, "progress")
+	}
+	return strings.Join(actions, "+"), nil
+}
+
+type undoOpInfo struct {
+	ID       string `json:"id"`
+	Time     int64  `json:"time"`
+	Command  string `json:"command"`
+	Items    int    `json:"items"`
+	Undone   bool   `json:"undone"`
+	UndoneAt int64  `json:"undone_at,omitempty"`
+}
+
+func printUndoOps(stdout, stderr io.Writer, format string, ops []undo.Op) int {
+	infos := make([]undoOpInfo, 0, len(ops))
+	// Newest first, like a history.
+	for i := len(ops) - 1; i >= 0; i-- {
+		op := ops[i]
+		info := undoOpInfo{ID: op.ID, Time: op.Time, Command: op.Command, Items: len(op.Changes), Undone: op.Undone(), UndoneAt: op.UndoneAt}
+		infos = append(infos, info)
+	}
+	if strings.EqualFold(format, "json") {
+		if err := writeJSONByFormat(stdout, format, infos); err != nil {
+			return printError(stderr, err)
+		}
+		return 0
+	}
+	if isNDJSONFormat(format) {
+		for _, info := range infos {
+			if err := writeJSONByFormat(stdout, format, info); err != nil {
+				return printError(stderr, err)
+			}
+		}
+		return 0
+	}
+	if strings.EqualFold(format, "plain") {
+		for _, info := range infos {
+			fmt.Fprintf(stdout, "%s\t%s\t%d\t%t\n", info.ID, info.Command, info.Items, info.Undone)
+		}
+		return 0
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTIME\tCOMMAND\tITEMS\tUNDONE")
+	for _, info := range infos {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%t\n", info.ID, time.Unix(info.Time, 0).Format("2006-01-02 15:04"), info.Command, info.Items, info.Undone)
+	}
+	if err := tw.Flush(); err != nil {
+		return printError(stderr, err)
+	}
+	return 0
+}
+
+func usageUndo() string {
+	return "Usage:\n  ip undo [--last N]\n  ip undo --op <id>\n  ip undo --list\n"
+}
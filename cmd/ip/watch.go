@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vburojevic/instapaper-cli/internal/config"
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+	"github.com/vburojevic/instapaper-cli/internal/watch"
+)
+
+const watchDirName = "watch"
+
+type watchFolder struct {
+	label      string
+	folderID   string
+	cursorPath string
+}
+
+// profileDir is a directory next to the config file that belongs to the
+// active profile, like the store: ip watch and ip webhooks run keep their
+// per-folder cursors there by default.
+func profileDir(cfgPath, profile, name string) string {
+	if profile != "" && profile != config.DefaultProfile {
+		return filepath.Join(filepath.Dir(cfgPath), "profiles", profile, name)
+	}
+	return filepath.Join(filepath.Dir(cfgPath), name)
+}
+
+func runWatch(ctx context.Context, args []string, opts *GlobalOptions, cfg *config.Config, cfgPath string, stdout, stderr io.Writer) int {
+	args = reorderFlags(args)
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var help bool
+	var foldersCSV string
+	var interval time.Duration
+	var cursorDir string
+	var maxPages int
+	var once bool
+	var initial bool
+	fs.BoolVar(&help, "help", false, "Show help")
+	fs.BoolVar(&help, "h", false, "Show help")
+	fs.StringVar(&foldersCSV, "folder", "unread", "Comma-separated folders to watch: unread|starred|archive|<id>|\"Title\"")
+	fs.DurationVar(&interval, "interval", 5*time.Minute, "Time between polls")
+	fs.StringVar(&cursorDir, "cursor-dir", "", "Directory for watch cursors (default: watch/ next to the config file)")
+	fs.IntVar(&maxPages, "max-pages", 200, "Max pages per folder and poll")
+	fs.BoolVar(&once, "once", false, "Poll once and exit")
+	fs.BoolVar(&initial, "initial", false, "Emit added events for every bookmark on a folder's first poll")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if help {
+		printFlagUsage(stdout, usageWatch(), fs)
+		return 0
+	}
+	if len(fs.Args()) > 0 {
+		return printUsageError(stderr, "usage: ip watch [--folder unread,...] [--interval 5m] [--once]")
+	}
+	if interval <= 0 {
+		return printUsageError(stderr, "--interval must be > 0")
+	}
+	if maxPages < 0 {
+		return printUsageError(stderr, "--max-pages must be >= 0")
+	}
+	if opts.Offline {
+		return printUsageError(stderr, "watch cannot run with --offline")
+	}
+	if cursorDir == "" {
+		cursorDir = profileDir(cfgPath, opts.Profile, watchDirName)
+	}
+
+	client, _, _, err := requireClient(opts, cfg, true, stderr)
+	if err != nil {
+		return printError(stderr, err)
+	}
+	folders, err := resolveWatchFolders(ctx, client, strings.Split(foldersCSV, ","), cursorDir)
+	if err != nil {
+		return printError(stderr, err)
+	}
+	if len(folders) == 0 {
+		return printUsageError(stderr, "--folder must name at least one folder")
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	for {
+		events, err := pollWatch(ctx, client, folders, maxPages, initial)
+		if err != nil {
+			if ctx.Err() != nil {
+				return 0
+			}
+			if once {
+				return printError(stderr, err)
+			}
+			// A long-running watch outlives transient API failures: the
+			// failed folder's cursor is not advanced, so the next poll
+			// catches up.
+			writeErrorLine(stderr, fmt.Errorf("watch: %v", err))
+		}
+		for _, ev := range events {
+			if err := writeJSONByFormat(stdout, "ndjson", ev); err != nil {
+				return printError(stderr, err)
+			}
+		}
+		verbosef(opts, stderr, "watch: folders=%d events=%d", len(folders), len(events))
+		if once {
+			return 0
+		}
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-time.After(interval):
+		}
+	}
+}
+
+// resolveWatchFolders resolves folder names to list folder ids, dropping
+// blanks and duplicates, each with its cursor file in cursorDir.
+func resolveWatchFolders(ctx context.Context, client *instapaper.Client, labels []string, cursorDir string) ([]watchFolder, error) {
+	var folders []watchFolder
+	seen := map[string]bool{}
+	for _, label := range labels {
+		label = strings.TrimSpace(label)
+		if label == "" {
+			continue
+		}
+		folderID, err := resolveListFolderID(ctx, client, label)
+		if err != nil {
+			return nil, err
+		}
+		if seen[folderID] {
+			continue
+		}
+		seen[folderID] = true
+		folders = append(folders, watchFolder{label: label, folderID: folderID, cursorPath: resolveCursorPath(cursorDir, folderID, "")})
+	}
+	return folders, nil
+}
+
+// pollWatch lists every folder against its cursor and diffs the results.
+// A folder without a cursor yet is only recorded on its first poll unless
+// initial is set, so starting a watch does not replay the whole folder. On
+// error the events of the folders already polled are still returned, since
+// their cursors have moved on.
+func pollWatch(ctx context.Context, client *instapaper.Client, folders []watchFolder, maxPages int, initial bool) ([]watch.Event, error) {
+	var polls []watch.Poll
+	for _, f := range folders {
+		_, statErr := os.Stat(f.cursorPath)
+		cursor, err := loadCursor(f.cursorPath)
+		if err != nil {
+			return watch.Diff(time.Now().Unix(), polls), err
+		}
+		resp, err := listBookmarks(ctx, client, listBookmarksParams{
+			FolderID:   f.folderID,
+			CursorPath: f.cursorPath,
+			MaxPages:   maxPages,
+		})
+		if err != nil {
+			return watch.Diff(time.Now().Unix(), polls), fmt.Errorf("%s: %w", f.label, err)
+		}
+		if statErr != nil && !initial {
+			continue
+		}
+		known := make(map[int64]watch.Entry, len(cursor.Have))
+		for key, entry := range cursor.Have {
+			id, err := strconv.ParseInt(key, 10, 64)
+			if err != nil {
+				continue
+			}
+			known[id] = watch.Entry{Progress: entry.Progress, ProgressTimestamp: entry.ProgressTimestamp, Starred: entry.Starred}
+		}
+		deleteIDs := make([]int64, 0, len(resp.DeleteIDs))
+		for _, id := range resp.DeleteIDs {
+			deleteIDs = append(deleteIDs, int64(id))
+		}
+		polls = append(polls, watch.Poll{Folder: f.label, Known: known, Bookmarks: resp.Bookmarks, DeleteIDs: deleteIDs})
+	}
+	return watch.Diff(time.Now().Unix(), polls), nil
+}
+
+func usageWatch() string {
+	return "Usage:\n  ip watch [--folder unread|starred|archive|<id>|\"Title\"[,...]] [--interval 5m] [--cursor-dir <dir>] [--max-pages N] [--initial] [--once]\n\nEmits one NDJSON event per change until interrupted: added, deleted, moved, progress_changed, starred_changed.\n"
+}
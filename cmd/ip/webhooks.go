@@ -0,0 +1,588 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vburojevic/instapaper-cli/internal/config"
+	"github.com/vburojevic/instapaper-cli/internal/filter"
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+	"github.com/vburojevic/instapaper-cli/internal/version"
+	"github.com/vburojevic/instapaper-cli/internal/watch"
+	"github.com/vburojevic/instapaper-cli/internal/webhook"
+)
+
+const webhooksDirName = "webhooks"
+
+// webhookDelivery is one event posted (or not) to one hook.
+type webhookDelivery struct {
+	Hook       string `json:"hook"`
+	Event      string `json:"event"`
+	BookmarkID int64  `json:"bookmark_id"`
+	DeliveryID string `json:"delivery_id"`
+	Status     string `json:"status"`
+	Attempts   int    `json:"attempts"`
+	HTTPStatus int    `json:"http_status,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type webhooksReport struct {
+	DryRun     bool              `json:"dry_run,omitempty"`
+	Events     int               `json:"events"`
+	Delivered  int               `json:"delivered"`
+	Failed     int               `json:"failed"`
+	DeadLetter string            `json:"dead_letter"`
+	Deliveries []webhookDelivery `json:"deliveries"`
+}
+
+// deadLetter is one line of the dead-letter file: a failed delivery with
+// its payload, so ip webhooks redeliver can send it again.
+type deadLetter struct {
+	Time       int64           `json:"time"`
+	Hook       string          `json:"hook"`
+	URL        string          `json:"url"`
+	Event      string          `json:"event"`
+	BookmarkID int64           `json:"bookmark_id"`
+	DeliveryID string          `json:"delivery_id"`
+	Attempts   int             `json:"attempts"`
+	HTTPStatus int             `json:"http_status,omitempty"`
+	Error      string          `json:"error"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// webhookHook is a configured hook with its select expression parsed and
+// its secret resolved.
+type webhookHook struct {
+	config.Webhook
+	events map[string]bool
+	sel    *filter.Expr
+	secret string
+}
+
+func (h *webhookHook) wants(ev watch.Event) bool {
+	if !h.events["*"] && !h.events[ev.Event] {
+		return false
+	}
+	if h.sel == nil {
+		return true
+	}
+	return ev.Bookmark != nil && h.sel.Match(*ev.Bookmark)
+}
+
+func (h *webhookHook) target() webhook.Target {
+	return webhook.Target{URL: h.URL, Secret: h.secret, Headers: h.Headers}
+}
+
+func runWebhooks(ctx context.Context, args []string, opts *GlobalOptions, cfg *config.Config, cfgPath string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprintln(stdout, usageWebhooks())
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+	switch args[0] {
+	case "list":
+		return runWebhooksList(args[1:], opts, cfg, stdout, stderr)
+	case "run":
+		return runWebhooksRun(ctx, args[1:], opts, cfg, cfgPath, stdout, stderr)
+	case "redeliver":
+		return runWebhooksRedeliver(ctx, args[1:], opts, cfg, cfgPath, stdout, stderr)
+	default:
+		return printUsageError(stderr, fmt.Sprintf("unknown webhooks subcommand: %s", args[0]))
+	}
+}
+
+// loadWebhooks validates the webhooks section and prepares its hooks. With
+// only set, just the named hooks are returned (even when disabled);
+// otherwise every enabled hook.
+func loadWebhooks(cfg *config.Config, only string) ([]*webhookHook, error) {
+	wh := cfg.Webhooks
+	if err := wh.Validate(); err != nil {
+		return nil, fmt.Errorf("config webhooks: %w", err)
+	}
+	wanted := map[string]bool{}
+	for _, name := range splitTags(only) {
+		wanted[strings.ToLower(name)] = true
+	}
+	var hooks []*webhookHook
+	for _, h := range wh.Hooks {
+		if len(wanted) > 0 {
+			if !wanted[strings.ToLower(h.Name)] {
+				continue
+			}
+			delete(wanted, strings.ToLower(h.Name))
+		} else if h.Disabled {
+			continue
+		}
+		hook, err := prepareWebhook(h)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	for name := range wanted {
+		return nil, fmt.Errorf("webhook not found: %s", name)
+	}
+	return hooks, nil
+}
+
+// prepareWebhook checks a hook's events and select expression and resolves
+// its secret.
+func prepareWebhook(h config.Webhook) (*webhookHook, error) {
+	hook := &webhookHook{Webhook: h, events: map[string]bool{}}
+	for _, e := range h.Events {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if e != "*" && !containsString(watch.Kinds, e) {
+			return nil, fmt.Errorf("webhook %q: unknown event %q (expected %s or *)", h.Name, e, strings.Join(watch.Kinds, ", "))
+		}
+		hook.events[e] = true
+	}
+	if strings.TrimSpace(h.Select) != "" {
+		sel, err := parseSelectExpr(h.Select)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %q: %w", h.Name, err)
+		}
+		hook.sel = sel
+	}
+	secret, err := h.SigningSecret()
+	if err != nil {
+		return nil, err
+	}
+	hook.secret = secret
+	return hook, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// newWebhookSender builds the delivery client: 10s per attempt and three
+// retries with backoff unless the webhooks section says otherwise.
+func newWebhookSender(wh *config.Webhooks) (*webhook.Sender, error) {
+	timeout := 10 * time.Second
+	if wh.Timeout != "" {
+		d, err := time.ParseDuration(wh.Timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("config webhooks.timeout: invalid duration %q", wh.Timeout)
+		}
+		timeout = d
+	}
+	policy := instapaper.DefaultRetryPolicy()
+	policy.MaxAttempts = 4
+	policy.BaseDelay = time.Second
+	if err := applyRetryConfig(&policy, wh.Retry, "webhooks.retry"); err != nil {
+		return nil, err
+	}
+	if policy.MaxAttempts < 1 {
+		return nil, fmt.Errorf("config webhooks.retry.count must be >= 0")
+	}
+	return &webhook.Sender{
+		Client:    &http.Client{Timeout: timeout},
+		Retry:     policy,
+		UserAgent: "instapaper-cli/" + version.Version,
+	}, nil
+}
+
+func runWebhooksList(args []string, opts *GlobalOptions, cfg *config.Config, stdout, stderr io.Writer) int {
+	if hasHelpFlag(args) {
+		fmt.Fprintln(stdout, usageWebhooks())
+		return 0
+	}
+	if len(args) > 0 {
+		return printUsageError(stderr, "usage: ip webhooks list")
+	}
+	if err := cfg.Webhooks.Validate(); err != nil {
+		return printError(stderr, fmt.Errorf("config webhooks: %w", err))
+	}
+	type hookView struct {
+		Name     string   `json:"name"`
+		URL      string   `json:"url"`
+		Events   []string `json:"events"`
+		Select   string   `json:"select,omitempty"`
+		Signed   bool     `json:"signed"`
+		Disabled bool     `json:"disabled,omitempty"`
+	}
+	views := make([]hookView, 0, len(cfg.Webhooks.Hooks))
+	for _, h := range cfg.Webhooks.Hooks {
+		views = append(views, hookView{Name: h.Name, URL: h.URL, Events: h.Events, Select: h.Select, Signed: h.Secret != "" || h.SecretEnv != "", Disabled: h.Disabled})
+	}
+	switch {
+	case strings.EqualFold(opts.Format, "json"):
+		if err := writeJSONByFormat(stdout, opts.Format, views); err != nil {
+			return printError(stderr, err)
+		}
+		return 0
+	case isNDJSONFormat(opts.Format):
+		for _, v := range views {
+			if err := writeJSONByFormat(stdout, opts.Format, v); err != nil {
+				return printError(stderr, err)
+			}
+		}
+		return 0
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	if !strings.EqualFold(opts.Format, "plain") {
+		fmt.Fprintln(tw, "NAME\tEVENTS\tSIGNED\tURL\tSELECT")
+	}
+	for _, v := range views {
+		name := v.Name
+		if v.Disabled {
+			name += " (disabled)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%s\t%s\n", name, strings.Join(v.Events, ","), v.Signed, v.URL, v.Select)
+	}
+	if err := tw.Flush(); err != nil {
+		return printError(stderr, err)
+	}
+	return 0
+}
+
+func runWebhooksRun(ctx context.Context, args []string, opts *GlobalOptions, cfg *config.Config, cfgPath string, stdout, stderr io.Writer) int {
+	args = reorderFlags(args)
+	fs := flag.NewFlagSet("webhooks run", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var help bool
+	var only string
+	var cursorDir string
+	var deadLetterPath string
+	var maxPages int
+	fs.BoolVar(&help, "help", false, "Show help")
+	fs.BoolVar(&help, "h", false, "Show help")
+	fs.StringVar(&only, "hook", "", "Only deliver to these hooks (comma-separated names)")
+	fs.StringVar(&cursorDir, "cursor-dir", "", "Directory for webhook cursors (default: webhooks/ next to the config file)")
+	fs.StringVar(&deadLetterPath, "dead-letter", "", "Append failed deliveries to this file (default: webhooks.dead_letter or webhooks-dead.jsonl next to the config file)")
+	fs.IntVar(&maxPages, "max-pages", 200, "Max pages per folder")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if help {
+		printFlagUsage(stdout, usageWebhooks(), fs)
+		return 0
+	}
+	if fs.NArg() > 0 {
+		return printUsageError(stderr, "webhooks run does not take positional arguments")
+	}
+	if maxPages < 0 {
+		return printUsageError(stderr, "--max-pages must be >= 0")
+	}
+	if opts.Offline {
+		return printUsageError(stderr, "webhooks run cannot run with --offline")
+	}
+	hooks, err := loadWebhooks(cfg, only)
+	if err != nil {
+		return printError(stderr, err)
+	}
+	wh := cfg.Webhooks
+	if deadLetterPath == "" {
+		deadLetterPath = wh.DeadLetterPath(cfgPath)
+	}
+	if cursorDir == "" {
+		cursorDir = profileDir(cfgPath, opts.Profile, webhooksDirName)
+	}
+	folderNames := wh.Folders
+	if len(folderNames) == 0 {
+		folderNames = []string{"unread"}
+	}
+	if opts.DryRun {
+		names := make([]string, 0, len(hooks))
+		for _, h := range hooks {
+			names = append(names, h.Name)
+		}
+		_ = emitDryRunAction(stdout, opts.Format, "webhooks.run", map[string]any{
+			"hooks":       names,
+			"folders":     folderNames,
+			"cursor_dir":  cursorDir,
+			"dead_letter": deadLetterPath,
+		})
+		return 0
+	}
+	sender, err := newWebhookSender(wh)
+	if err != nil {
+		return printError(stderr, err)
+	}
+	client, _, _, err := requireClient(opts, cfg, true, stderr)
+	if err != nil {
+		return printError(stderr, err)
+	}
+	folders, err := resolveWatchFolders(ctx, client, folderNames, cursorDir)
+	if err != nil {
+		return printError(stderr, err)
+	}
+	ctx, stop := interruptible(ctx)
+	defer stop()
+
+	// Events already taken from the cursors are delivered even when a later
+	// folder fails to poll, so none are lost.
+	events, pollErr := pollWatch(ctx, client, folders, maxPages, false)
+	report := webhooksReport{Events: len(events), DeadLetter: deadLetterPath, Deliveries: []webhookDelivery{}}
+	var dead []deadLetter
+	for _, ev := range events {
+		payload, err := json.Marshal(ev)
+		if err != nil {
+			return printError(stderr, err)
+		}
+		for _, h := range hooks {
+			if !h.wants(ev) {
+				continue
+			}
+			d, dl := deliverWebhook(ctx, sender, h, ev.Event, ev.BookmarkID, payload)
+			verbosef(opts, stderr, "webhooks: hook=%s event=%s bookmark=%d status=%s attempts=%d", d.Hook, d.Event, d.BookmarkID, d.Status, d.Attempts)
+			report.Deliveries = append(report.Deliveries, d)
+			if dl != nil {
+				dead = append(dead, *dl)
+				report.Failed++
+			} else {
+				report.Delivered++
+			}
+		}
+	}
+	if err := appendDeadLetters(deadLetterPath, dead); err != nil {
+		return printError(stderr, err)
+	}
+	if err := writeWebhooksReport(stdout, opts, report); err != nil {
+		return printError(stderr, err)
+	}
+	if pollErr != nil {
+		return printError(stderr, pollErr)
+	}
+	if report.Failed > 0 {
+		writeErrorLine(stderr, fmt.Errorf("%d webhook deliveries failed; see %s (retry with: ip webhooks redeliver)", report.Failed, deadLetterPath))
+		return 1
+	}
+	return 0
+}
+
+func runWebhooksRedeliver(ctx context.Context, args []string, opts *GlobalOptions, cfg *config.Config, cfgPath string, stdout, stderr io.Writer) int {
+	args = reorderFlags(args)
+	fs := flag.NewFlagSet("webhooks redeliver", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var help bool
+	var deadLetterPath string
+	fs.BoolVar(&help, "help", false, "Show help")
+	fs.BoolVar(&help, "h", false, "Show help")
+	fs.StringVar(&deadLetterPath, "dead-letter", "", "Dead-letter file to redeliver (default: webhooks.dead_letter or webhooks-dead.jsonl next to the config file)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if help {
+		printFlagUsage(stdout, usageWebhooks(), fs)
+		return 0
+	}
+	if fs.NArg() > 0 {
+		return printUsageError(stderr, "webhooks redeliver does not take positional arguments")
+	}
+	if err := cfg.Webhooks.Validate(); err != nil {
+		return printError(stderr, fmt.Errorf("config webhooks: %w", err))
+	}
+	if deadLetterPath == "" {
+		deadLetterPath = cfg.Webhooks.DeadLetterPath(cfgPath)
+	}
+	letters, err := readDeadLetters(deadLetterPath)
+	if err != nil {
+		return printError(stderr, err)
+	}
+	report := webhooksReport{DryRun: opts.DryRun, Events: len(letters), DeadLetter: deadLetterPath, Deliveries: []webhookDelivery{}}
+	if opts.DryRun {
+		for _, l := range letters {
+			report.Deliveries = append(report.Deliveries, webhookDelivery{Hook: l.Hook, Event: l.Event, BookmarkID: l.BookmarkID, DeliveryID: l.DeliveryID, Status: "planned", Attempts: l.Attempts, Error: l.Error})
+		}
+		if err := writeWebhooksReport(stdout, opts, report); err != nil {
+			return printError(stderr, err)
+		}
+		return 0
+	}
+	// Hooks are looked up by name, even disabled ones, so a fixed URL or
+	// secret in the config applies to the retries.
+	byName := map[string]*webhookHook{}
+	for _, h := range cfg.Webhooks.Hooks {
+		hook, err := prepareWebhook(h)
+		if err != nil {
+			return printError(stderr, err)
+		}
+		byName[strings.ToLower(h.Name)] = hook
+	}
+	sender, err := newWebhookSender(cfg.Webhooks)
+	if err != nil {
+		return printError(stderr, err)
+	}
+	ctx, stop := interruptible(ctx)
+	defer stop()
+	var remaining []deadLetter
+	for _, l := range letters {
+		h, ok := byName[strings.ToLower(l.Hook)]
+		if !ok || ctx.Err() != nil {
+			if !ok {
+				l.Error = "webhook not configured"
+			}
+			remaining = append(remaining, l)
+			report.Failed++
+			report.Deliveries = append(report.Deliveries, webhookDelivery{Hook: l.Hook, Event: l.Event, BookmarkID: l.BookmarkID, DeliveryID: l.DeliveryID, Status: "failed", Attempts: 0, Error: l.Error})
+			continue
+		}
+		d, dl := deliverWebhook(ctx, sender, h, l.Event, l.BookmarkID, l.Payload)
+		report.Deliveries = append(report.Deliveries, d)
+		if dl != nil {
+			dl.Attempts += l.Attempts
+			remaining = append(remaining, *dl)
+			report.Failed++
+		} else {
+			report.Delivered++
+		}
+	}
+	if err := writeDeadLetters(deadLetterPath, remaining); err != nil {
+		return printError(stderr, err)
+	}
+	if err := writeWebhooksReport(stdout, opts, report); err != nil {
+		return printError(stderr, err)
+	}
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// deliverWebhook posts payload to h. The delivery id is derived from the
+// hook and payload, so a redelivery carries the same id and receivers can
+// drop duplicates. On failure it also returns the dead letter to keep.
+func deliverWebhook(ctx context.Context, sender *webhook.Sender, h *webhookHook, event string, bookmarkID int64, payload []byte) (webhookDelivery, *deadLetter) {
+	sum := sha256.Sum256(append([]byte(h.Name+"\n"), payload...))
+	id := hex.EncodeToString(sum[:8])
+	res, err := sender.Send(ctx, h.target(), webhook.Delivery{ID: id, Event: event, Body: payload})
+	d := webhookDelivery{Hook: h.Name, Event: event, BookmarkID: bookmarkID, DeliveryID: id, Status: "delivered", Attempts: res.Attempts, HTTPStatus: res.Status}
+	if err == nil {
+		return d, nil
+	}
+	d.Status = "failed"
+	d.Error = err.Error()
+	return d, &deadLetter{
+		Time:       time.Now().Unix(),
+		Hook:       h.Name,
+		URL:        h.URL,
+		Event:      event,
+		BookmarkID: bookmarkID,
+		DeliveryID: id,
+		Attempts:   res.Attempts,
+		HTTPStatus: res.Status,
+		Error:      err.Error(),
+		Payload:    payload,
+	}
+}
+
+func appendDeadLetters(path string, letters []deadLetter) error {
+	if len(letters) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	for _, l := range letters {
+		if err := writeJSONByFormat(f, "ndjson", l); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// writeDeadLetters replaces the dead-letter file with letters, removing it
+// when none are left.
+func writeDeadLetters(path string, letters []deadLetter) error {
+	if len(letters) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	tmp := path + ".tmp"
+	if err := os.Remove(tmp); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := appendDeadLetters(tmp, letters); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readDeadLetters(path string) ([]deadLetter, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []deadLetter
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		var l deadLetter
+		if err := json.Unmarshal([]byte(line), &l); err != nil {
+			return nil, fmt.Errorf("parse %s line %d: %w", path, n, err)
+		}
+		out = append(out, l)
+	}
+	return out, sc.Err()
+}
+
+func writeWebhooksReport(w io.Writer, opts *GlobalOptions, report webhooksReport) error {
+	switch {
+	case strings.EqualFold(opts.Format, "json"):
+		return writeJSONByFormat(w, opts.Format, report)
+	case isNDJSONFormat(opts.Format):
+		for _, d := range report.Deliveries {
+			if err := writeJSONByFormat(w, opts.Format, d); err != nil {
+				return err
+			}
+		}
+		return nil
+	case opts.Quiet:
+		return nil
+	case strings.EqualFold(opts.Format, "plain"):
+		for _, d := range report.Deliveries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\n", d.Status, d.Hook, d.Event, d.BookmarkID, d.Attempts, d.Error)
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tHOOK\tEVENT\tID\tATTEMPTS\tERROR")
+	for _, d := range report.Deliveries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\n", d.Status, d.Hook, d.Event, d.BookmarkID, d.Attempts, d.Error)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "events=%d delivered=%d failed=%d\n", report.Events, report.Delivered, report.Failed)
+	return err
+}
+
+func usageWebhooks() string {
+	return "Usage:\n  ip webhooks list\n  ip webhooks run [--hook name,...] [--cursor-dir <dir>] [--dead-letter <file>] [--max-pages N]\n  ip webhooks redeliver [--dead-letter <file>]\n\nHooks are configured in the \"webhooks\" section of config.json. Events: added, deleted, moved, progress_changed, starred_changed.\n"
+}
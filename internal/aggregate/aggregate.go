@@ -0,0 +1,261 @@
+// Package aggregate sorts, groups and summarizes bookmark listings for
+// ip list and ip export (--sort, --group-by, --count, --stats).
+package aggregate
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vburojevic/instapaper-cli/internal/filter"
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+	"github.com/vburojevic/instapaper-cli/internal/output"
+)
+
+// SortFields and GroupFields are the accepted --sort and --group-by values.
+var (
+	SortFields  = []string{"time", "progress", "progress_timestamp", "title", "domain", "bookmark_id"}
+	GroupFields = []string{"folder", "tag", "domain", "month"}
+)
+
+// NoGroup is the key of bookmarks without a value for the grouping field
+// (untagged, no URL host, no save time).
+const NoGroup = "(none)"
+
+// SortKey is one field of a sort order.
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// Sort is a parsed --sort: keys are compared in order, later keys break
+// ties. A nil Sort keeps the API order.
+type Sort []SortKey
+
+// ParseSort parses "field[:asc|desc][,field[:asc|desc]...]".
+func ParseSort(spec string) (Sort, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	var s Sort
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+		field, dir, _ := strings.Cut(part, ":")
+		if !contains(SortFields, field) {
+			return nil, fmt.Errorf("unknown sort field %q (expected %s)", field, strings.Join(SortFields, ", "))
+		}
+		key := SortKey{Field: field}
+		switch dir {
+		case "", "asc":
+		case "desc":
+			key.Desc = true
+		default:
+			return nil, fmt.Errorf("invalid sort direction %q (expected asc or desc)", dir)
+		}
+		s = append(s, key)
+	}
+	return s, nil
+}
+
+// Apply sorts bookmarks in place. The sort is stable, so equal bookmarks
+// keep the API order.
+func (s Sort) Apply(bookmarks []instapaper.Bookmark) {
+	if len(s) == 0 {
+		return
+	}
+	sort.SliceStable(bookmarks, func(i, j int) bool {
+		return s.less(bookmarks[i], bookmarks[j])
+	})
+}
+
+// ApplyGroups sorts each group in place, then orders the groups by their
+// first bookmark. Empty groups go last.
+func (s Sort) ApplyGroups(groups []output.BookmarkGroup) {
+	if len(s) == 0 {
+		return
+	}
+	for _, g := range groups {
+		s.Apply(g.Bookmarks)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		a, b := groups[i].Bookmarks, groups[j].Bookmarks
+		if len(a) == 0 || len(b) == 0 {
+			return len(b) == 0 && len(a) != 0
+		}
+		return s.less(a[0], b[0])
+	})
+}
+
+func (s Sort) less(a, b instapaper.Bookmark) bool {
+	for _, k := range s {
+		c := compare(a, b, k.Field)
+		if c == 0 {
+			continue
+		}
+		if k.Desc {
+			return c > 0
+		}
+		return c < 0
+	}
+	return false
+}
+
+func compare(a, b instapaper.Bookmark, field string) int {
+	switch field {
+	case "time":
+		return cmpInt(int64(a.Time), int64(b.Time))
+	case "progress":
+		return cmpFloat(float64(a.Progress), float64(b.Progress))
+	case "progress_timestamp":
+		return cmpInt(int64(a.ProgressTimestamp), int64(b.ProgressTimestamp))
+	case "bookmark_id":
+		return cmpInt(int64(a.BookmarkID), int64(b.BookmarkID))
+	case "title":
+		return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+	case "domain":
+		return strings.Compare(filter.Host(a.URL), filter.Host(b.URL))
+	}
+	return 0
+}
+
+func cmpInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// ValidGroupBy reports whether by is a --group-by field.
+func ValidGroupBy(by string) bool {
+	return contains(GroupFields, by)
+}
+
+// Regroup regroups bookmarks by folder, tag, domain or month (YYYY-MM of the
+// save time, UTC). Groups appear in the order their first bookmark appears;
+// use Sort.ApplyGroups afterwards to sort across folders. A bookmark with several tags is in
+// each tag's group. Grouping by folder keeps the input groups.
+func Regroup(by string, groups []output.BookmarkGroup) []output.BookmarkGroup {
+	if by == "folder" {
+		return groups
+	}
+	var out []output.BookmarkGroup
+	index := map[string]int{}
+	add := func(key string, b instapaper.Bookmark) {
+		i, ok := index[key]
+		if !ok {
+			i = len(out)
+			index[key] = i
+			out = append(out, output.BookmarkGroup{Folder: key})
+		}
+		out[i].Bookmarks = append(out[i].Bookmarks, b)
+	}
+	for _, g := range groups {
+		for _, b := range g.Bookmarks {
+			for _, key := range groupKeys(by, b) {
+				add(key, b)
+			}
+		}
+	}
+	return out
+}
+
+func groupKeys(by string, b instapaper.Bookmark) []string {
+	switch by {
+	case "tag":
+		if len(b.Tags) == 0 {
+			return []string{NoGroup}
+		}
+		keys := make([]string, 0, len(b.Tags))
+		for _, t := range b.Tags {
+			keys = append(keys, t.Name)
+		}
+		return keys
+	case "domain":
+		if host := filter.Host(b.URL); host != "" {
+			return []string{host}
+		}
+	case "month":
+		if b.Time > 0 {
+			return []string{time.Unix(int64(b.Time), 0).UTC().Format("2006-01")}
+		}
+	}
+	return []string{NoGroup}
+}
+
+// Stats summarizes a set of bookmarks.
+type Stats struct {
+	Group       string  `json:"group,omitempty"`
+	Count       int     `json:"count"`
+	Starred     int     `json:"starred"`
+	Started     int     `json:"started"`
+	AvgProgress float64 `json:"avg_progress"`
+	Oldest      int64   `json:"oldest,omitempty"`
+	Newest      int64   `json:"newest,omitempty"`
+	Domains     int     `json:"domains"`
+	Tags        int     `json:"tags"`
+}
+
+// Summarize computes Stats for bookmarks. Started counts bookmarks with any
+// read progress; Oldest and Newest are unix save times.
+func Summarize(group string, bookmarks []instapaper.Bookmark) Stats {
+	st := Stats{Group: group, Count: len(bookmarks)}
+	domains := map[string]bool{}
+	tags := map[string]bool{}
+	var progress float64
+	for _, b := range bookmarks {
+		if bool(b.Starred) {
+			st.Starred++
+		}
+		if b.Progress > 0 {
+			st.Started++
+		}
+		progress += float64(b.Progress)
+		if t := int64(b.Time); t > 0 {
+			if st.Oldest == 0 || t < st.Oldest {
+				st.Oldest = t
+			}
+			if t > st.Newest {
+				st.Newest = t
+			}
+		}
+		if host := filter.Host(b.URL); host != "" {
+			domains[host] = true
+		}
+		for _, t := range b.Tags {
+			tags[strings.ToLower(t.Name)] = true
+		}
+	}
+	if len(bookmarks) > 0 {
+		st.AvgProgress = math.Round(progress/float64(len(bookmarks))*10000) / 10000
+	}
+	st.Domains = len(domains)
+	st.Tags = len(tags)
+	return st
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package aggregate
+
+import (
+	"testing"
+
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+	"github.com/vburojevic/instapaper-cli/internal/output"
+)
+
+func sample() []instapaper.Bookmark {
+	return []instapaper.Bookmark{
+		{BookmarkID: 1, Title: "b", URL: "https://www.go.dev/a", Time: 1700000000, Progress: 0.5, Tags: []instapaper.Tag{{Name: "go"}, {Name: "news"}}},
+		{BookmarkID: 2, Title: "A", URL: "https://example.com/x", Time: 1690000000, Starred: true},
+		{BookmarkID: 3, Title: "c", URL: "https://go.dev/b", Time: 1680000000, Tags: []instapaper.Tag{{Name: "go"}}},
+		{BookmarkID: 4, Title: "d", Time: 1700000000},
+	}
+}
+
+func ids(bookmarks []instapaper.Bookmark) []int64 {
+	out := make([]int64, 0, len(bookmarks))
+	for _, b := range bookmarks {
+		out = append(out, int64(b.BookmarkID))
+	}
+	return out
+}
+
+func equalIDs(a []int64, b ...int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSort(t *testing.T) {
+	cases := []struct {
+		spec string
+		want []int64
+	}{
+		{"time", []int64{3, 2, 1, 4}},
+		{"time:desc", []int64{1, 4, 2, 3}},
+		{"title", []int64{2, 1, 3, 4}},
+		{"domain,time", []int64{4, 2, 3, 1}},
+		{"progress:desc", []int64{1, 2, 3, 4}},
+	}
+	for _, tc := range cases {
+		s, err := ParseSort(tc.spec)
+		if err != nil {
+			t.Fatalf("ParseSort(%q): %v", tc.spec, err)
+		}
+		bookmarks := sample()
+		s.Apply(bookmarks)
+		if got := ids(bookmarks); !equalIDs(got, tc.want...) {
+			t.Fatalf("sort %q: got %v want %v", tc.spec, got, tc.want)
+		}
+	}
+	for _, bad := range []string{"size", "time:up"} {
+		if _, err := ParseSort(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestRegroupAndSummarize(t *testing.T) {
+	in := []output.BookmarkGroup{{Folder: "Unread", Bookmarks: sample()}}
+	byDomain := Regroup("domain", in)
+	if len(byDomain) != 3 || byDomain[0].Folder != "go.dev" || !equalIDs(ids(byDomain[0].Bookmarks), 1, 3) || byDomain[2].Folder != NoGroup {
+		t.Fatalf("domain groups: %+v", byDomain)
+	}
+	byTag := Regroup("tag", in)
+	if len(byTag) != 3 || byTag[0].Folder != "go" || len(byTag[0].Bookmarks) != 2 || byTag[1].Folder != "news" || byTag[2].Folder != NoGroup {
+		t.Fatalf("tag groups: %+v", byTag)
+	}
+	byMonth := Regroup("month", in)
+	if len(byMonth) != 3 || byMonth[0].Folder != "2023-11" || len(byMonth[0].Bookmarks) != 2 {
+		t.Fatalf("month groups: %+v", byMonth)
+	}
+	if got := Regroup("folder", in); len(got) != 1 || got[0].Folder != "Unread" {
+		t.Fatalf("folder groups: %+v", got)
+	}
+
+	st := Summarize("", sample())
+	want := Stats{Count: 4, Starred: 1, Started: 1, AvgProgress: 0.125, Oldest: 1680000000, Newest: 1700000000, Domains: 2, Tags: 2}
+	if st != want {
+		t.Fatalf("stats: got %+v want %+v", st, want)
+	}
+	if st := Summarize("empty", nil); st.Count != 0 || st.AvgProgress != 0 {
+		t.Fatalf("empty stats: %+v", st)
+	}
+}
+
+func TestRegroupThenSortAcrossFolders(t *testing.T) {
+	b := sample()
+	in := []output.BookmarkGroup{
+		{Folder: "Unread", Bookmarks: []instapaper.Bookmark{b[0], b[1]}},
+		{Folder: "Archive", Bookmarks: []instapaper.Bookmark{b[2], b[3]}},
+	}
+	s, err := ParseSort("time:asc,bookmark_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byTag := Regroup("tag", in)
+	s.ApplyGroups(byTag)
+	if len(byTag) != 3 || byTag[0].Folder != "go" || !equalIDs(ids(byTag[0].Bookmarks), 3, 1) {
+		t.Fatalf("go group: %+v", byTag)
+	}
+	if byTag[1].Folder != NoGroup || !equalIDs(ids(byTag[1].Bookmarks), 2, 4) || byTag[2].Folder != "news" {
+		t.Fatalf("tag group order: %+v", byTag)
+	}
+}
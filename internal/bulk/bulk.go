@@ -0,0 +1,142 @@
+// Package bulk runs an operation over many items with bounded concurrency and
+// reports the results in input order.
+package bulk
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Options control a Run.
+type Options struct {
+	// Concurrency is the number of workers (at least 1).
+	Concurrency int
+	// BatchSize and BatchPause pause dispatching for BatchPause after every
+	// BatchSize items.
+	BatchSize  int
+	BatchPause time.Duration
+}
+
+// Result is the outcome of one item.
+type Result[T, R any] struct {
+	Index int
+	Item  T
+	Value R
+	Err   error
+}
+
+// Summary counts what a Run did. NotStarted items were never attempted
+// because the context was cancelled.
+type Summary struct {
+	Total      int  `json:"total"`
+	Succeeded  int  `json:"succeeded"`
+	Failed     int  `json:"failed"`
+	NotStarted int  `json:"not_started"`
+	Cancelled  bool `json:"cancelled"`
+}
+
+// Run calls fn for every item using opts.Concurrency workers. emit is called
+// from the calling goroutine once per attempted item, in input order, so it
+// may write output without locking. When ctx is cancelled no new items are
+// started; items already running finish (their fn sees the cancelled ctx).
+func Run[T, R any](ctx context.Context, items []T, opts Options, fn func(context.Context, T) (R, error), emit func(Result[T, R])) Summary {
+	workers := opts.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(items) {
+		workers = len(items)
+	}
+	sum := Summary{Total: len(items)}
+
+	type job struct {
+		index int
+		item  T
+	}
+	jobs := make(chan job)
+	results := make(chan Result[T, R])
+
+	go func() {
+		defer close(jobs)
+		for i, it := range items {
+			if opts.BatchSize > 0 && opts.BatchPause > 0 && i > 0 && i%opts.BatchSize == 0 {
+				if !sleep(ctx, opts.BatchPause) {
+					return
+				}
+			}
+			select {
+			case jobs <- job{i, it}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if ctx.Err() != nil {
+					// Picked up after cancellation: report as not started.
+					results <- Result[T, R]{Index: j.index, Item: j.item, Err: errSkipped}
+					continue
+				}
+				v, err := fn(ctx, j.item)
+				results <- Result[T, R]{Index: j.index, Item: j.item, Value: v, Err: err}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Reorder: hold results until every earlier index has been emitted.
+	pending := map[int]Result[T, R]{}
+	next := 0
+	attempted := 0
+	for r := range results {
+		pending[r.Index] = r
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if r.Err == errSkipped {
+				continue
+			}
+			attempted++
+			if r.Err != nil {
+				sum.Failed++
+			} else {
+				sum.Succeeded++
+			}
+			emit(r)
+		}
+	}
+	sum.NotStarted = sum.Total - attempted
+	sum.Cancelled = ctx.Err() != nil && sum.NotStarted > 0
+	return sum
+}
+
+type skipError struct{}
+
+func (skipError) Error() string { return "not started" }
+
+var errSkipped error = skipError{}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
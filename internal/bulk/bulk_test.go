@@ -0,0 +1,71 @@
+package bulk
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunOrderedConcurrent(t *testing.T) {
+	items := []int{5, 1, 4, 2, 3, 0}
+	var running, peak int32
+	fn := func(ctx context.Context, n int) (int, error) {
+		cur := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if cur <= p || atomic.CompareAndSwapInt32(&peak, p, cur) {
+				break
+			}
+		}
+		time.Sleep(time.Duration(n) * 3 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		if n == 4 {
+			return 0, errors.New("boom")
+		}
+		return n * 10, nil
+	}
+	var got []int
+	sum := Run(context.Background(), items, Options{Concurrency: 3}, fn, func(r Result[int, int]) {
+		got = append(got, r.Index)
+	})
+	for i, idx := range got {
+		if idx != i {
+			t.Fatalf("results out of order: %v", got)
+		}
+	}
+	if sum.Total != 6 || sum.Succeeded != 5 || sum.Failed != 1 || sum.NotStarted != 0 || sum.Cancelled {
+		t.Fatalf("unexpected summary: %+v", sum)
+	}
+	if peak < 2 || peak > 3 {
+		t.Fatalf("expected 2-3 concurrent workers, got %d", peak)
+	}
+}
+
+func TestRunCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	items := make([]int, 20)
+	emitted := 0
+	sum := Run(ctx, items, Options{Concurrency: 2}, func(ctx context.Context, _ int) (int, error) {
+		time.Sleep(2 * time.Millisecond)
+		return 0, nil
+	}, func(r Result[int, int]) {
+		emitted++
+		if emitted == 4 {
+			cancel()
+		}
+	})
+	if !sum.Cancelled || sum.NotStarted == 0 || sum.Succeeded != emitted || sum.Succeeded+sum.NotStarted != 20 {
+		t.Fatalf("unexpected summary after cancel: %+v (emitted %d)", sum, emitted)
+	}
+}
+
+func TestRunBatchPause(t *testing.T) {
+	start := time.Now()
+	sum := Run(context.Background(), []int{1, 2, 3, 4}, Options{Concurrency: 4, BatchSize: 2, BatchPause: 20 * time.Millisecond},
+		func(context.Context, int) (int, error) { return 0, nil }, func(Result[int, int]) {})
+	if sum.Succeeded != 4 || time.Since(start) < 20*time.Millisecond {
+		t.Fatalf("batch pause not applied: %+v in %v", sum, time.Since(start))
+	}
+}
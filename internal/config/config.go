@@ -26,6 +26,18 @@ func (d Defaults) ResolveFinalURLValue() bool {
 	return *d.ResolveFinalURL
 }
 
+// Retry is the retry policy section. Durations use Go syntax ("500ms").
+type Retry struct {
+	// Count is the number of retries after the first attempt.
+	Count      *int     `json:"count,omitempty"`
+	Backoff    string   `json:"backoff,omitempty"`
+	MaxBackoff string   `json:"max_backoff,omitempty"`
+	MaxElapsed string   `json:"max_elapsed,omitempty"`
+	Jitter     *float64 `json:"jitter,omitempty"`
+	// On lists the failure classes to retry: rate_limit, server, network.
+	On []string `json:"on,omitempty"`
+}
+
 type Config struct {
 	APIBase          string   `json:"api_base,omitempty"`
 	ConsumerKey      string   `json:"consumer_key,omitempty"`
@@ -34,6 +46,31 @@ type Config struct {
 	OAuthTokenSecret string   `json:"oauth_token_secret,omitempty"`
 	User             User     `json:"user,omitempty"`
 	Defaults         Defaults `json:"defaults,omitempty"`
+
+	// CurrentProfile is the profile used when neither --profile nor
+	// INSTAPAPER_PROFILE is set; empty means the top-level settings.
+	CurrentProfile string              `json:"current_profile,omitempty"`
+	Profiles       map[string]*Profile `json:"profiles,omitempty"`
+
+	// CredentialStore is where secrets live: file (config.json, default),
+	// encrypted or helper. See credentials.go.
+	CredentialStore  string `json:"credential_store,omitempty"`
+	CredentialHelper string `json:"credential_helper,omitempty"`
+
+	// Retry configures retries of failed API requests; flags override it.
+	Retry *Retry `json:"retry,omitempty"`
+
+	// Webhooks configures ip webhooks run. See webhooks.go.
+	Webhooks *Webhooks `json:"webhooks,omitempty"`
+
+	// Passphrase unlocks the encrypted credential store.
+	Passphrase func() (string, error) `json:"-"`
+
+	profile  string   // profile applied by UseProfile
+	root     *Profile // top-level settings while a profile is applied
+	path     string   // file the config was loaded from
+	unlocked bool     // secrets were read from the credential store
+	store    CredentialStore
 }
 
 func DefaultConfig() *Config {
@@ -48,6 +85,7 @@ func DefaultConfig() *Config {
 
 func Load(path string) (*Config, error) {
 	c := DefaultConfig()
+	c.path = path
 	b, err := os.ReadFile(path)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
@@ -71,6 +109,11 @@ func Load(path string) (*Config, error) {
 	if c.Defaults.Format == "" {
 		c.Defaults.Format = "ndjson"
 	}
+	for name, p := range c.Profiles {
+		if p == nil {
+			c.Profiles[name] = &Profile{}
+		}
+	}
 	return c, nil
 }
 
@@ -82,12 +125,22 @@ func (c *Config) Save(path string) error {
 	if err := os.MkdirAll(dir, 0o700); err != nil {
 		return err
 	}
-	b, err := json.MarshalIndent(c, "", "  ")
+	if c.path == "" {
+		c.path = path
+	}
+	view := *c.fileView()
+	if err := c.saveCredentials(&view); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(&view, "", "  ")
 	if err != nil {
 		return err
 	}
 	b = append(b, '\n')
+	return writeFileAtomic(path, b)
+}
 
+func writeFileAtomic(path string, b []byte) error {
 	tmp := path + ".tmp"
 	if err := os.WriteFile(tmp, b, 0o600); err != nil {
 		return err
@@ -0,0 +1,495 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/vburojevic/instapaper-cli/internal/scrypt"
+)
+
+// Credential store backends.
+const (
+	CredentialStoreFile      = "file"      // secrets in config.json (default)
+	CredentialStoreEncrypted = "encrypted" // credentials.enc, AES-256-GCM with a passphrase
+	CredentialStoreHelper    = "helper"    // external git-style credential helper
+)
+
+const credentialsName = "credentials.enc"
+
+// helperHost is the host sent to credential helpers. It is fixed, so
+// entries do not move when api_base changes; profiles differ by username.
+const helperHost = "instapaper-cli"
+
+// Credentials are the secrets of one profile. They are kept out of
+// config.json unless the file store is used.
+type Credentials struct {
+	ConsumerSecret   string `json:"consumer_secret,omitempty"`
+	OAuthToken       string `json:"oauth_token,omitempty"`
+	OAuthTokenSecret string `json:"oauth_token_secret,omitempty"`
+}
+
+func (c Credentials) empty() bool {
+	return c == Credentials{}
+}
+
+// CredentialStore keeps Credentials by profile name.
+type CredentialStore interface {
+	// Get returns the stored credentials; missing ones are zero, not an error.
+	Get(profile string) (Credentials, error)
+	Store(profile string, creds Credentials) error
+	Erase(profile string) error
+}
+
+// ValidateCredentialStore checks a credential_store value.
+func ValidateCredentialStore(kind, helper string) error {
+	switch kind {
+	case "", CredentialStoreFile, CredentialStoreEncrypted:
+		return nil
+	case CredentialStoreHelper:
+		if strings.TrimSpace(helper) == "" {
+			return errors.New("credential_store helper requires credential_helper")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown credential_store %q (expected file|encrypted|helper)", kind)
+	}
+}
+
+// StoresSecretsInFile reports whether secrets are written to config.json.
+func (c *Config) StoresSecretsInFile() bool {
+	return c.CredentialStore == "" || c.CredentialStore == CredentialStoreFile
+}
+
+// OpenCredentialStore returns the backend configured for c. The file backend
+// has no separate store and returns nil.
+func (c *Config) OpenCredentialStore() (CredentialStore, error) {
+	if err := ValidateCredentialStore(c.CredentialStore, c.CredentialHelper); err != nil {
+		return nil, err
+	}
+	switch c.CredentialStore {
+	case CredentialStoreEncrypted:
+		if c.path == "" {
+			return nil, errors.New("encrypted credential store needs a config path")
+		}
+		return &encryptedStore{path: filepath.Join(filepath.Dir(c.path), credentialsName), passphrase: c.Passphrase}, nil
+	case CredentialStoreHelper:
+		return &helperStore{command: c.CredentialHelper}, nil
+	}
+	return nil, nil
+}
+
+// credentialStore returns the configured backend, opened once per Config so
+// an encrypted store asks for its passphrase only once.
+func (c *Config) credentialStore() (CredentialStore, error) {
+	if c.store == nil {
+		st, err := c.OpenCredentialStore()
+		if err != nil {
+			return nil, err
+		}
+		c.store = st
+	}
+	return c.store, nil
+}
+
+// UnlockCredentials reads the secrets of every profile from the credential
+// store, so the config behaves as if they were in the file. It is a no-op for
+// the file store and after the first call.
+func (c *Config) UnlockCredentials() error {
+	if c.StoresSecretsInFile() || c.unlocked {
+		return nil
+	}
+	st, err := c.credentialStore()
+	if err != nil {
+		return err
+	}
+	active := c.ActiveProfile()
+	if err := c.UseProfile(DefaultProfile, false); err != nil {
+		return err
+	}
+	for _, name := range c.ProfileNames() {
+		creds, err := st.Get(name)
+		if err != nil {
+			return fmt.Errorf("credential store: %w", err)
+		}
+		if name == DefaultProfile {
+			fillSecrets(&c.ConsumerSecret, &c.OAuthToken, &c.OAuthTokenSecret, creds)
+			continue
+		}
+		p := c.Profiles[name]
+		fillSecrets(&p.ConsumerSecret, &p.OAuthToken, &p.OAuthTokenSecret, creds)
+	}
+	c.unlocked = true
+	return c.UseProfile(active, false)
+}
+
+// MigrateCredentials moves every profile's secrets to another store, saves
+// the config at path and then erases the entries from the old store. Two
+// helpers may share a backend (the same keychain under another command), so
+// between helpers the old entries are erased first and put back if saving
+// fails.
+func (c *Config) MigrateCredentials(path, kind, helper string) error {
+	if err := ValidateCredentialStore(kind, helper); err != nil {
+		return err
+	}
+	if kind == CredentialStoreFile {
+		kind = ""
+	}
+	if kind != CredentialStoreHelper {
+		helper = ""
+	}
+	if kind == c.CredentialStore && helper == c.CredentialHelper {
+		return nil
+	}
+	if err := c.UnlockCredentials(); err != nil {
+		return err
+	}
+	old, err := c.credentialStore()
+	if err != nil {
+		return err
+	}
+	eraseOld := func() error {
+		for _, name := range c.ProfileNames() {
+			if err := old.Erase(name); err != nil {
+				return fmt.Errorf("erase old credentials: %w", err)
+			}
+		}
+		return nil
+	}
+	eraseFirst := kind == CredentialStoreHelper && c.CredentialStore == CredentialStoreHelper
+	if eraseFirst {
+		if err := eraseOld(); err != nil {
+			return err
+		}
+	}
+	c.CredentialStore, c.CredentialHelper = kind, helper
+	c.store = nil
+	c.unlocked = !c.StoresSecretsInFile()
+	if err := c.Save(path); err != nil {
+		if eraseFirst {
+			for _, name := range c.ProfileNames() {
+				if creds := c.profileCredentials(name); !creds.empty() {
+					_ = old.Store(name, creds)
+				}
+			}
+		}
+		return err
+	}
+	if old != nil && !eraseFirst {
+		return eraseOld()
+	}
+	return nil
+}
+
+// profileCredentials returns the secrets held in memory for a profile.
+func (c *Config) profileCredentials(name string) Credentials {
+	if name == DefaultProfile {
+		return Credentials{ConsumerSecret: c.ConsumerSecret, OAuthToken: c.OAuthToken, OAuthTokenSecret: c.OAuthTokenSecret}
+	}
+	p := c.Profiles[name]
+	if p == nil {
+		return Credentials{}
+	}
+	return Credentials{ConsumerSecret: p.ConsumerSecret, OAuthToken: p.OAuthToken, OAuthTokenSecret: p.OAuthTokenSecret}
+}
+
+// saveCredentials writes the secrets of view to the credential store and
+// clears them from view, which must be a copy owned by Save.
+func (c *Config) saveCredentials(view *Config) error {
+	if c.StoresSecretsInFile() {
+		return nil
+	}
+	if !c.unlocked {
+		// Secrets were never read, so whatever is in the file stays as is.
+		return nil
+	}
+	st, err := c.credentialStore()
+	if err != nil {
+		return err
+	}
+	put := func(name string, consumerSecret, token, tokenSecret *string) error {
+		creds := Credentials{ConsumerSecret: *consumerSecret, OAuthToken: *token, OAuthTokenSecret: *tokenSecret}
+		*consumerSecret, *token, *tokenSecret = "", "", ""
+		if creds.empty() {
+			return st.Erase(name)
+		}
+		return st.Store(name, creds)
+	}
+	if err := put(DefaultProfile, &view.ConsumerSecret, &view.OAuthToken, &view.OAuthTokenSecret); err != nil {
+		return fmt.Errorf("credential store: %w", err)
+	}
+	profiles := make(map[string]*Profile, len(view.Profiles))
+	for name, p := range view.Profiles {
+		cp := *p
+		if err := put(name, &cp.ConsumerSecret, &cp.OAuthToken, &cp.OAuthTokenSecret); err != nil {
+			return fmt.Errorf("credential store: %w", err)
+		}
+		profiles[name] = &cp
+	}
+	if len(profiles) > 0 {
+		view.Profiles = profiles
+	}
+	return nil
+}
+
+func fillSecrets(consumerSecret, token, tokenSecret *string, creds Credentials) {
+	if creds.ConsumerSecret != "" {
+		*consumerSecret = creds.ConsumerSecret
+	}
+	if creds.OAuthToken != "" {
+		*token = creds.OAuthToken
+	}
+	if creds.OAuthTokenSecret != "" {
+		*tokenSecret = creds.OAuthTokenSecret
+	}
+}
+
+// Scrypt parameters for new encrypted stores (N=2^15, r=8, p=1: 32 MiB).
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// Upper bounds for the parameters read from credentials.enc, so a tampered
+// header cannot make unlocking take gigabytes of memory or minutes of CPU.
+const (
+	maxScryptN = 1 << 18
+	maxScryptR = 16
+	maxScryptP = 4
+)
+
+// encryptedFile is the on-disk format of credentials.enc.
+type encryptedFile struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// encryptedStore keeps all profiles in one AES-256-GCM sealed JSON document.
+// The key is derived once per process and reused for every write.
+type encryptedStore struct {
+	path       string
+	passphrase func() (string, error)
+
+	loaded  bool
+	entries map[string]Credentials
+	header  encryptedFile
+	key     []byte
+}
+
+func (s *encryptedStore) Get(profile string) (Credentials, error) {
+	if err := s.load(); err != nil {
+		return Credentials{}, err
+	}
+	return s.entries[profile], nil
+}
+
+func (s *encryptedStore) Store(profile string, creds Credentials) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+	if s.entries[profile] == creds {
+		return nil
+	}
+	s.entries[profile] = creds
+	return s.write()
+}
+
+func (s *encryptedStore) Erase(profile string) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+	if _, ok := s.entries[profile]; !ok {
+		return nil
+	}
+	delete(s.entries, profile)
+	return s.write()
+}
+
+func (s *encryptedStore) load() error {
+	if s.loaded {
+		return nil
+	}
+	s.entries = map[string]Credentials{}
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.loaded = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, &s.header); err != nil {
+		return fmt.Errorf("parse %s: %w", s.path, err)
+	}
+	if s.header.Version != 1 || s.header.KDF != "scrypt" {
+		return fmt.Errorf("%s: unsupported format (version %d, kdf %q)", s.path, s.header.Version, s.header.KDF)
+	}
+	if s.header.N > maxScryptN || s.header.R > maxScryptR || s.header.P > maxScryptP {
+		return fmt.Errorf("%s: scrypt parameters too large (n=%d, r=%d, p=%d)", s.path, s.header.N, s.header.R, s.header.P)
+	}
+	if err := s.deriveKey(); err != nil {
+		return err
+	}
+	gcm, err := newGCM(s.key)
+	if err != nil {
+		return err
+	}
+	plain, err := gcm.Open(nil, s.header.Nonce, s.header.Data, nil)
+	if err != nil {
+		return fmt.Errorf("%s: wrong passphrase or corrupted file", s.path)
+	}
+	if err := json.Unmarshal(plain, &s.entries); err != nil {
+		return fmt.Errorf("parse %s: %w", s.path, err)
+	}
+	s.loaded = true
+	return nil
+}
+
+func (s *encryptedStore) deriveKey() error {
+	if s.passphrase == nil {
+		return errors.New("encrypted credential store is locked (set INSTAPAPER_PASSPHRASE)")
+	}
+	pass, err := s.passphrase()
+	if err != nil {
+		return err
+	}
+	if pass == "" {
+		return errors.New("empty passphrase")
+	}
+	s.key, err = scrypt.Key([]byte(pass), s.header.Salt, s.header.N, s.header.R, s.header.P, 32)
+	return err
+}
+
+func (s *encryptedStore) write() error {
+	if s.key == nil {
+		s.header = encryptedFile{Version: 1, KDF: "scrypt", N: scryptN, R: scryptR, P: scryptP, Salt: make([]byte, 16)}
+		if _, err := rand.Read(s.header.Salt); err != nil {
+			return err
+		}
+		if err := s.deriveKey(); err != nil {
+			return err
+		}
+	}
+	plain, err := json.Marshal(s.entries)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(s.key)
+	if err != nil {
+		return err
+	}
+	s.header.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(s.header.Nonce); err != nil {
+		return err
+	}
+	s.header.Data = gcm.Seal(nil, s.header.Nonce, plain, nil)
+	b, err := json.MarshalIndent(s.header, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, append(b, '\n'))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// helperStore talks to an external program with git's credential helper
+// protocol: "<helper> get|store|erase" with key=value lines on stdin.
+// Entries live under helperHost with the profile as the username and the
+// secrets as one JSON password, so git helpers such as
+// "git credential-osxkeychain" or "git credential-libsecret" can be used as
+// an OS keyring.
+type helperStore struct {
+	command string
+}
+
+func (s *helperStore) Get(profile string) (Credentials, error) {
+	out, err := s.run("get", profile, "")
+	if err != nil {
+		return Credentials{}, err
+	}
+	var creds Credentials
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		key, value, ok := strings.Cut(sc.Text(), "=")
+		if ok && key == "password" && value != "" {
+			if err := json.Unmarshal([]byte(value), &creds); err != nil {
+				return Credentials{}, fmt.Errorf("credential helper returned an invalid password for %s", profile)
+			}
+		}
+	}
+	return creds, sc.Err()
+}
+
+func (s *helperStore) Store(profile string, creds Credentials) error {
+	b, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+	_, err = s.run("store", profile, string(b))
+	return err
+}
+
+func (s *helperStore) Erase(profile string) error {
+	_, err := s.run("erase", profile, "")
+	return err
+}
+
+func (s *helperStore) run(action, profile, password string) ([]byte, error) {
+	var in bytes.Buffer
+	fmt.Fprintf(&in, "protocol=https\nhost=%s\nusername=%s\n", helperHost, profile)
+	if password != "" {
+		fmt.Fprintf(&in, "password=%s\n", password)
+	}
+	in.WriteString("\n")
+
+	// Like git: a command starting with "!" runs through the shell,
+	// anything else is split on spaces.
+	var cmd *exec.Cmd
+	if strings.HasPrefix(s.command, "!") {
+		if runtime.GOOS == "windows" {
+			cmd = exec.Command("cmd", "/C", s.command[1:]+" "+action)
+		} else {
+			cmd = exec.Command("sh", "-c", s.command[1:]+" "+action)
+		}
+	} else {
+		fields := strings.Fields(s.command)
+		cmd = exec.Command(fields[0], append(fields[1:], action)...)
+	}
+	cmd.Stdin = &in
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("credential helper %s: %v: %s", action, err, msg)
+		}
+		return nil, fmt.Errorf("credential helper %s: %w", action, err)
+	}
+	return out, nil
+}
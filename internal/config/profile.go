@@ -0,0 +1,219 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// DefaultProfile names the settings stored at the top level of config.json.
+const DefaultProfile = "default"
+
+var profileNameRE = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Profile holds per-account settings. Empty fields other than the token and
+// user fall back to the top-level (default) settings.
+type Profile struct {
+	APIBase          string   `json:"api_base,omitempty"`
+	ConsumerKey      string   `json:"consumer_key,omitempty"`
+	ConsumerSecret   string   `json:"consumer_secret,omitempty"`
+	OAuthToken       string   `json:"oauth_token,omitempty"`
+	OAuthTokenSecret string   `json:"oauth_token_secret,omitempty"`
+	User             User     `json:"user,omitempty"`
+	Defaults         Defaults `json:"defaults,omitempty"`
+}
+
+// ValidateProfileName rejects names that cannot be used as a profile (and as
+// a directory name for the profile's local store).
+func ValidateProfileName(name string) error {
+	if name == DefaultProfile {
+		return nil
+	}
+	if !profileNameRE.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q (letters, digits, '.', '_', '-')", name)
+	}
+	return nil
+}
+
+// ActiveProfile returns the profile applied by UseProfile, or DefaultProfile.
+func (c *Config) ActiveProfile() string {
+	if c.profile == "" {
+		return DefaultProfile
+	}
+	return c.profile
+}
+
+// HasProfile reports whether name is DefaultProfile or a stored profile.
+func (c *Config) HasProfile(name string) bool {
+	if name == "" || name == DefaultProfile {
+		return true
+	}
+	_, ok := c.Profiles[name]
+	return ok
+}
+
+// ProfileNames returns DefaultProfile followed by the stored profiles, sorted.
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{DefaultProfile}, names...)
+}
+
+// UseProfile makes the named profile the effective configuration: its values
+// replace the top-level fields, and Save writes changes back into the
+// profile. With create, a missing profile starts out empty.
+func (c *Config) UseProfile(name string, create bool) error {
+	if name == "" {
+		name = DefaultProfile
+	}
+	if err := ValidateProfileName(name); err != nil {
+		return err
+	}
+	if c.profile != "" {
+		c.setTop(*c.root)
+		c.profile, c.root = "", nil
+	}
+	if name == DefaultProfile {
+		return nil
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		if !create {
+			return fmt.Errorf("profile not found: %s", name)
+		}
+		p = &Profile{}
+		if c.Profiles == nil {
+			c.Profiles = map[string]*Profile{}
+		}
+		c.Profiles[name] = p
+	}
+	root := c.top()
+	c.root = &root
+	c.profile = name
+	c.setTop(mergeProfile(root, *p))
+	return nil
+}
+
+// RemoveProfile deletes a stored profile. The default profile cannot be
+// removed; removing the current profile makes default current again.
+func (c *Config) RemoveProfile(name string) error {
+	if name == DefaultProfile {
+		return errors.New("the default profile cannot be removed")
+	}
+	if _, ok := c.Profiles[name]; !ok {
+		return fmt.Errorf("profile not found: %s", name)
+	}
+	if c.profile == name {
+		return fmt.Errorf("profile %s is in use", name)
+	}
+	delete(c.Profiles, name)
+	if c.CurrentProfile == name {
+		c.CurrentProfile = ""
+	}
+	return nil
+}
+
+// ResolvedProfile returns the effective settings of a profile, including
+// values inherited from the default profile.
+func (c *Config) ResolvedProfile(name string) (Profile, error) {
+	root := c.top()
+	if c.root != nil {
+		root = *c.root
+	}
+	if name == "" || name == DefaultProfile {
+		return root, nil
+	}
+	if name == c.profile {
+		return c.top(), nil
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("profile not found: %s", name)
+	}
+	return mergeProfile(root, *p), nil
+}
+
+// fileView is the config as stored on disk: with a profile active, the
+// effective values go back into that profile and the top level is restored.
+func (c *Config) fileView() *Config {
+	if c.profile == "" {
+		return c
+	}
+	c.Profiles[c.profile] = diffProfile(*c.root, c.top())
+	out := *c
+	out.setTop(*c.root)
+	return &out
+}
+
+func (c *Config) top() Profile {
+	return Profile{
+		APIBase:          c.APIBase,
+		ConsumerKey:      c.ConsumerKey,
+		ConsumerSecret:   c.ConsumerSecret,
+		OAuthToken:       c.OAuthToken,
+		OAuthTokenSecret: c.OAuthTokenSecret,
+		User:             c.User,
+		Defaults:         c.Defaults,
+	}
+}
+
+func (c *Config) setTop(p Profile) {
+	c.APIBase = p.APIBase
+	c.ConsumerKey = p.ConsumerKey
+	c.ConsumerSecret = p.ConsumerSecret
+	c.OAuthToken = p.OAuthToken
+	c.OAuthTokenSecret = p.OAuthTokenSecret
+	c.User = p.User
+	c.Defaults = p.Defaults
+}
+
+func mergeProfile(root, p Profile) Profile {
+	out := p
+	if out.APIBase == "" {
+		out.APIBase = root.APIBase
+	}
+	if out.ConsumerKey == "" {
+		out.ConsumerKey = root.ConsumerKey
+	}
+	if out.ConsumerSecret == "" {
+		out.ConsumerSecret = root.ConsumerSecret
+	}
+	if out.Defaults.ListLimit == 0 {
+		out.Defaults.ListLimit = root.Defaults.ListLimit
+	}
+	if out.Defaults.Format == "" {
+		out.Defaults.Format = root.Defaults.Format
+	}
+	if out.Defaults.ResolveFinalURL == nil {
+		out.Defaults.ResolveFinalURL = root.Defaults.ResolveFinalURL
+	}
+	return out
+}
+
+// diffProfile keeps the values of p that are not simply inherited from root.
+func diffProfile(root, p Profile) *Profile {
+	out := &Profile{OAuthToken: p.OAuthToken, OAuthTokenSecret: p.OAuthTokenSecret, User: p.User}
+	if p.APIBase != root.APIBase {
+		out.APIBase = p.APIBase
+	}
+	if p.ConsumerKey != root.ConsumerKey {
+		out.ConsumerKey = p.ConsumerKey
+	}
+	if p.ConsumerSecret != root.ConsumerSecret {
+		out.ConsumerSecret = p.ConsumerSecret
+	}
+	if p.Defaults.ListLimit != root.Defaults.ListLimit {
+		out.Defaults.ListLimit = p.Defaults.ListLimit
+	}
+	if p.Defaults.Format != root.Defaults.Format {
+		out.Defaults.Format = p.Defaults.Format
+	}
+	if p.Defaults.ResolveFinalURL != nil && (root.Defaults.ResolveFinalURL == nil || *p.Defaults.ResolveFinalURL != *root.Defaults.ResolveFinalURL) {
+		out.Defaults.ResolveFinalURL = p.Defaults.ResolveFinalURL
+	}
+	return out
+}
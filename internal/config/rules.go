@@ -0,0 +1,114 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const rulesName = "rules.json"
+
+// Rule actions.
+const (
+	ActionArchive   = "archive"
+	ActionUnarchive = "unarchive"
+	ActionStar      = "star"
+	ActionUnstar    = "unstar"
+	ActionMove      = "move"
+	ActionTag       = "tag"
+	ActionDelete    = "delete"
+)
+
+// RuleAction is one thing to do with a bookmark that matched a rule.
+type RuleAction struct {
+	Type   string   `json:"type"`
+	Folder string   `json:"folder,omitempty"` // move target (id or title)
+	Tags   []string `json:"tags,omitempty"`   // tag: tags to add
+}
+
+// Rule selects bookmarks in Folder with When (a --select expression) and
+// applies Actions to each match, in order.
+type Rule struct {
+	Name     string       `json:"name"`
+	Folder   string       `json:"folder,omitempty"`
+	When     string       `json:"when"`
+	Actions  []RuleAction `json:"actions"`
+	Disabled bool         `json:"disabled,omitempty"`
+}
+
+// Rules is the rules file, stored as rules.json next to config.json.
+type Rules struct {
+	Rules []Rule `json:"rules"`
+}
+
+// RulesPath returns the rules file that belongs to the config at configPath.
+func RulesPath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), rulesName)
+}
+
+// LoadRules reads and validates a rules file. A missing file is an error
+// wrapping os.ErrNotExist so callers can point at the expected location.
+func LoadRules(path string) (*Rules, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Rules{}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, fmt.Errorf("parse rules %s: %w", path, err)
+	}
+	if err := r.Validate(); err != nil {
+		return nil, fmt.Errorf("rules %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// Validate checks rule names and actions. Conditions are checked by the
+// caller, which owns the select expression syntax.
+func (r *Rules) Validate() error {
+	seen := map[string]bool{}
+	for i := range r.Rules {
+		rule := &r.Rules[i]
+		rule.Name = strings.TrimSpace(rule.Name)
+		if rule.Name == "" {
+			return fmt.Errorf("rule %d: name is required", i+1)
+		}
+		if seen[strings.ToLower(rule.Name)] {
+			return fmt.Errorf("rule %q: duplicate name", rule.Name)
+		}
+		seen[strings.ToLower(rule.Name)] = true
+		if strings.TrimSpace(rule.When) == "" {
+			return fmt.Errorf("rule %q: when is required", rule.Name)
+		}
+		if len(rule.Actions) == 0 {
+			return fmt.Errorf("rule %q: at least one action is required", rule.Name)
+		}
+		for j := range rule.Actions {
+			a := &rule.Actions[j]
+			a.Type = strings.ToLower(strings.TrimSpace(a.Type))
+			switch a.Type {
+			case ActionArchive, ActionUnarchive, ActionStar, ActionUnstar, ActionDelete:
+			case ActionMove:
+				if strings.TrimSpace(a.Folder) == "" {
+					return fmt.Errorf("rule %q: move requires folder", rule.Name)
+				}
+			case ActionTag:
+				if len(a.Tags) == 0 {
+					return fmt.Errorf("rule %q: tag requires tags", rule.Name)
+				}
+				// Tags are added by re-saving the URL into the source folder,
+				// and Starred is not a folder a bookmark can be saved into.
+				if strings.EqualFold(strings.TrimSpace(rule.Folder), "starred") {
+					return fmt.Errorf("rule %q: tag is not supported in the starred folder", rule.Name)
+				}
+			case "":
+				return fmt.Errorf("rule %q: action type is required", rule.Name)
+			default:
+				return fmt.Errorf("rule %q: unknown action %q", rule.Name, a.Type)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const deadLetterName = "webhooks-dead.jsonl"
+
+// Webhooks is the "webhooks" section: the folders ip webhooks run polls for
+// changes and the hooks the resulting events are posted to.
+type Webhooks struct {
+	// Folders to watch (default: unread).
+	Folders []string `json:"folders,omitempty"`
+	// DeadLetter is the file failed deliveries are appended to (default:
+	// webhooks-dead.jsonl next to config.json).
+	DeadLetter string `json:"dead_letter,omitempty"`
+	// Timeout bounds one delivery attempt, in Go duration syntax.
+	Timeout string `json:"timeout,omitempty"`
+	// Retry overrides the delivery retry policy; same keys as "retry".
+	Retry *Retry    `json:"retry,omitempty"`
+	Hooks []Webhook `json:"hooks"`
+}
+
+// Webhook posts events of the listed types (or "*") to URL. With a secret
+// the body is signed with HMAC-SHA256.
+type Webhook struct {
+	Name   string   `json:"name"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Select narrows events to bookmarks matching a --select expression.
+	Select    string            `json:"select,omitempty"`
+	Secret    string            `json:"secret,omitempty"`
+	SecretEnv string            `json:"secret_env,omitempty"` // read the secret from this variable
+	Headers   map[string]string `json:"headers,omitempty"`
+	Disabled  bool              `json:"disabled,omitempty"`
+}
+
+// DeadLetterPath returns the dead-letter file for the config at configPath.
+func (w *Webhooks) DeadLetterPath(configPath string) string {
+	if w != nil && w.DeadLetter != "" {
+		return w.DeadLetter
+	}
+	return filepath.Join(filepath.Dir(configPath), deadLetterName)
+}
+
+// SigningSecret returns the hook's secret, from SecretEnv when set.
+func (h Webhook) SigningSecret() (string, error) {
+	if h.SecretEnv == "" {
+		return h.Secret, nil
+	}
+	v := os.Getenv(h.SecretEnv)
+	if v == "" {
+		return "", fmt.Errorf("webhook %q: %s is not set", h.Name, h.SecretEnv)
+	}
+	return v, nil
+}
+
+// Validate checks hook names and URLs. Event names and select expressions
+// are checked by the caller, which owns them.
+func (w *Webhooks) Validate() error {
+	if w == nil || len(w.Hooks) == 0 {
+		return fmt.Errorf("no webhooks configured")
+	}
+	seen := map[string]bool{}
+	for i := range w.Hooks {
+		h := &w.Hooks[i]
+		h.Name = strings.TrimSpace(h.Name)
+		if h.Name == "" {
+			return fmt.Errorf("webhook %d: name is required", i+1)
+		}
+		if seen[strings.ToLower(h.Name)] {
+			return fmt.Errorf("webhook %q: duplicate name", h.Name)
+		}
+		seen[strings.ToLower(h.Name)] = true
+		u, err := url.Parse(strings.TrimSpace(h.URL))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook %q: url must be an http or https URL", h.Name)
+		}
+		if len(h.Events) == 0 {
+			return fmt.Errorf("webhook %q: at least one event is required", h.Name)
+		}
+		if h.Secret != "" && h.SecretEnv != "" {
+			return fmt.Errorf("webhook %q: use only one of secret or secret_env", h.Name)
+		}
+	}
+	return nil
+}
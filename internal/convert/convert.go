@@ -0,0 +1,451 @@
+// Package convert turns the HTML returned by the text endpoint into Markdown,
+// plain text or sanitized XHTML, optionally prefixed with YAML front matter.
+package convert
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Formats accepted by Convert.
+const (
+	FormatHTML     = "html"
+	FormatMarkdown = "markdown"
+	FormatText     = "text"
+)
+
+// ParseFormat normalizes a --to value.
+func ParseFormat(s string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "html":
+		return FormatHTML, nil
+	case "markdown", "md":
+		return FormatMarkdown, nil
+	case "text", "txt", "plain":
+		return FormatText, nil
+	default:
+		return "", fmt.Errorf("invalid format %q (expected markdown|text|html)", s)
+	}
+}
+
+// Extension returns the file extension used for format.
+func Extension(format string) string {
+	switch format {
+	case FormatMarkdown:
+		return ".md"
+	case FormatText:
+		return ".txt"
+	default:
+		return ".html"
+	}
+}
+
+// Convert renders src in format. HTML is returned unchanged.
+func Convert(src []byte, format string) []byte {
+	switch format {
+	case FormatMarkdown:
+		return []byte(ToMarkdown(string(src)))
+	case FormatText:
+		return []byte(ToText(string(src)))
+	default:
+		return src
+	}
+}
+
+// ToMarkdown converts HTML to CommonMark. Images are emitted as reference
+// links collected at the end of the document.
+func ToMarkdown(src string) string {
+	r := &renderer{markdown: true}
+	out := r.children(parse(src))
+	if len(r.images) > 0 {
+		var b strings.Builder
+		b.WriteString(out)
+		b.WriteString("\n\n")
+		for i, img := range r.images {
+			fmt.Fprintf(&b, "[image%d]: %s\n", i+1, img)
+		}
+		out = b.String()
+	}
+	return normalize(out)
+}
+
+// ToText converts HTML to readable plain text.
+func ToText(src string) string {
+	r := &renderer{}
+	return normalize(r.children(parse(src)))
+}
+
+type renderer struct {
+	markdown bool
+	code     int
+	images   []string
+}
+
+var spaceRun = regexp.MustCompile(`[ \t\r\n\f]+`)
+
+func (r *renderer) children(n *node) string {
+	var b strings.Builder
+	for _, c := range n.children {
+		s := r.render(c)
+		if strings.HasSuffix(b.String(), "\n") {
+			s = strings.TrimLeft(s, " ")
+		}
+		b.WriteString(s)
+	}
+	return b.String()
+}
+
+func (r *renderer) render(n *node) string {
+	if n.tag == "" {
+		s := spaceRun.ReplaceAllString(n.text, " ")
+		if r.markdown && r.code == 0 {
+			s = EscapeMarkdown(s)
+		}
+		return s
+	}
+	if skipTags[n.tag] {
+		return ""
+	}
+	switch n.tag {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		text := strings.TrimSpace(spaceRun.ReplaceAllString(r.children(n), " "))
+		if text == "" {
+			return ""
+		}
+		if r.markdown {
+			level := int(n.tag[1] - '0')
+			return "\n\n" + strings.Repeat("#", level) + " " + text + "\n\n"
+		}
+		return "\n\n" + text + "\n\n"
+	case "p", "div", "section", "article", "header", "footer", "main", "aside", "nav",
+		"figure", "figcaption", "address", "details", "summary", "center", "dl":
+		return block(r.children(n))
+	case "dt":
+		text := strings.TrimSpace(r.children(n))
+		if r.markdown && text != "" {
+			text = "**" + text + "**"
+		}
+		return "\n" + text + "\n"
+	case "dd":
+		return "\n" + indent(strings.TrimSpace(r.children(n)), "  ") + "\n"
+	case "br":
+		return "\n"
+	case "hr":
+		if r.markdown {
+			return "\n\n---\n\n"
+		}
+		return "\n\n"
+	case "strong", "b":
+		return r.wrap(n, "**")
+	case "em", "i", "cite":
+		return r.wrap(n, "_")
+	case "del", "s", "strike":
+		return r.wrap(n, "~~")
+	case "code", "kbd", "samp", "tt":
+		r.code++
+		text := r.children(n)
+		r.code--
+		if !r.markdown || strings.TrimSpace(text) == "" {
+			return text
+		}
+		fence := "`"
+		if strings.Contains(text, "`") {
+			fence = "``"
+		}
+		return fence + text + fence
+	case "pre":
+		return r.preformatted(n)
+	case "a":
+		return r.link(n)
+	case "img":
+		return r.image(n)
+	case "blockquote":
+		inner := normalize(r.children(n))
+		if inner == "" {
+			return ""
+		}
+		if r.markdown {
+			return block(prefixLines(inner, "> ", ">"))
+		}
+		return "\n\n" + indent(inner, "    ") + "\n\n"
+	case "ul", "ol":
+		return r.list(n)
+	case "li":
+		// Stray list item outside ul/ol.
+		return block("- " + strings.TrimSpace(r.children(n)))
+	case "table":
+		return r.table(n)
+	}
+	return r.children(n)
+}
+
+func (r *renderer) wrap(n *node, marker string) string {
+	text := r.children(n)
+	trimmed := strings.TrimSpace(text)
+	if !r.markdown || trimmed == "" || r.code > 0 {
+		return text
+	}
+	// Keep surrounding spaces outside the markers so emphasis still parses.
+	lead := text[:len(text)-len(strings.TrimLeft(text, " "))]
+	trail := text[len(strings.TrimRight(text, " ")):]
+	return lead + marker + trimmed + marker + trail
+}
+
+func (r *renderer) preformatted(n *node) string {
+	text := strings.Trim(textContent(n), "\n")
+	if strings.TrimSpace(text) == "" {
+		return ""
+	}
+	if !r.markdown {
+		return "\n\n" + indent(text, "    ") + "\n\n"
+	}
+	lang := codeLanguage(n)
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	return "\n\n" + fence + lang + "\n" + text + "\n" + fence + "\n\n"
+}
+
+// codeLanguage reads a language-xxx or lang-xxx class from pre or its code child.
+func codeLanguage(n *node) string {
+	classes := n.attrs["class"]
+	for _, c := range n.children {
+		if c.tag == "code" {
+			classes += " " + c.attrs["class"]
+		}
+	}
+	for _, class := range strings.Fields(classes) {
+		for _, prefix := range []string{"language-", "lang-"} {
+			if strings.HasPrefix(class, prefix) {
+				return strings.TrimPrefix(class, prefix)
+			}
+		}
+	}
+	return ""
+}
+
+func (r *renderer) link(n *node) string {
+	text := r.children(n)
+	href := strings.TrimSpace(n.attrs["href"])
+	if !r.markdown || href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		return text
+	}
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		if strings.Contains(text, "![") {
+			return text
+		}
+		return "<" + href + ">"
+	}
+	return "[" + trimmed + "](" + escapeURL(href) + ")"
+}
+
+func (r *renderer) image(n *node) string {
+	src := strings.TrimSpace(n.attrs["src"])
+	alt := strings.TrimSpace(n.attrs["alt"])
+	if !r.markdown {
+		if alt == "" {
+			return ""
+		}
+		return "[" + alt + "]"
+	}
+	if src == "" || strings.HasPrefix(src, "data:") {
+		return ""
+	}
+	r.images = append(r.images, escapeURL(src))
+	return fmt.Sprintf("![%s][image%d]", EscapeMarkdown(alt), len(r.images))
+}
+
+func (r *renderer) list(n *node) string {
+	ordered := n.tag == "ol"
+	num := 1
+	if v, err := strconv.Atoi(n.attrs["start"]); ordered && err == nil {
+		num = v
+	}
+	var items []string
+	for _, c := range n.children {
+		if c.tag == "" {
+			continue
+		}
+		var content string
+		if c.tag == "li" {
+			content = normalize(r.children(c))
+		} else {
+			content = normalize(r.render(c))
+		}
+		if content == "" {
+			continue
+		}
+		marker := "- "
+		if ordered {
+			marker = strconv.Itoa(num) + ". "
+			num++
+		}
+		lines := strings.Split(content, "\n")
+		pad := strings.Repeat(" ", len(marker))
+		for i := range lines {
+			switch {
+			case i == 0:
+				lines[i] = marker + lines[i]
+			case lines[i] != "":
+				lines[i] = pad + lines[i]
+			}
+		}
+		items = append(items, strings.Join(lines, "\n"))
+	}
+	if len(items) == 0 {
+		return ""
+	}
+	return block(strings.Join(items, "\n"))
+}
+
+func (r *renderer) table(n *node) string {
+	var rows [][]string
+	var collect func(*node)
+	collect = func(n *node) {
+		for _, c := range n.children {
+			switch c.tag {
+			case "tr":
+				var cells []string
+				for _, cell := range c.children {
+					if cell.tag == "td" || cell.tag == "th" {
+						text := strings.TrimSpace(spaceRun.ReplaceAllString(r.children(cell), " "))
+						if r.markdown {
+							text = escapeCellPipes(text)
+						}
+						cells = append(cells, text)
+					}
+				}
+				if len(cells) > 0 {
+					rows = append(rows, cells)
+				}
+			case "thead", "tbody", "tfoot":
+				collect(c)
+			}
+		}
+	}
+	collect(n)
+	if len(rows) == 0 {
+		return ""
+	}
+	width := 0
+	for _, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	var b strings.Builder
+	for i, row := range rows {
+		for len(row) < width {
+			row = append(row, "")
+		}
+		if !r.markdown {
+			b.WriteString(strings.Join(row, "\t"))
+			b.WriteByte('\n')
+			continue
+		}
+		b.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		if i == 0 {
+			b.WriteString("|" + strings.Repeat(" --- |", width) + "\n")
+		}
+	}
+	return block(b.String())
+}
+
+func block(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return ""
+	}
+	return "\n\n" + s + "\n\n"
+}
+
+func indent(s, prefix string) string {
+	return prefixLines(s, prefix, "")
+}
+
+func prefixLines(s, prefix, blank string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = blank
+			continue
+		}
+		lines[i] = prefix + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// normalize trims trailing spaces, collapses runs of blank lines and trims the
+// document. Fenced code blocks are left alone.
+func normalize(s string) string {
+	lines := strings.Split(s, "\n")
+	out := make([]string, 0, len(lines))
+	blank := false
+	fence := ""
+	for _, line := range lines {
+		if fence != "" {
+			out = append(out, line)
+			if strings.TrimSpace(line) == fence {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "```") {
+			fence = strings.TrimRight(line, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789+-_#.")
+		}
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			if !blank && len(out) > 0 {
+				out = append(out, "")
+			}
+			blank = true
+			continue
+		}
+		blank = false
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`,
+	`(`, `\(`, `)`, `\)`, `#`, `\#`, `|`, `\|`, `<`, `\<`, `>`, `\>`, `!`, `\!`, `~`, `\~`,
+)
+
+// Block markers that only count at the start of a line: "- " and "+ "
+// bullets, "1." and "1)" ordered items. "#" and ">" are always escaped.
+var (
+	bulletStart  = regexp.MustCompile(`(?m)^([ \t]*)([-+])`)
+	orderedStart = regexp.MustCompile(`(?m)^([ \t]*[0-9]+)([.)])`)
+)
+
+// EscapeMarkdown backslash-escapes the characters that change Markdown
+// rendering, so text is safe in paragraphs, links, lists and tables. The
+// start of s and of every line counts as a line start, so text cannot turn
+// into a heading, quote or list item.
+func EscapeMarkdown(s string) string {
+	s = markdownEscaper.Replace(s)
+	s = bulletStart.ReplaceAllString(s, `$1\$2`)
+	return orderedStart.ReplaceAllString(s, `$1\$2`)
+}
+
+// escapeCellPipes escapes the pipes EscapeMarkdown left alone (those in
+// code spans), which would otherwise end a table cell.
+func escapeCellPipes(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '|' && (i == 0 || s[i-1] != '\\') {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func escapeURL(s string) string {
+	return strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29").Replace(s)
+}
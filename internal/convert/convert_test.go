@@ -0,0 +1,100 @@
+package convert
+
+import (
+	"strings"
+	"testing"
+)
+
+const sampleHTML = `<html><head><title>T</title><style>p{color:red}</style></head><body>
+<h1>Go   generics</h1>
+<p>Type <b>parameters</b> arrive in <a href="https://go.dev/doc">Go 1.18</a>.<br>Second line</p>
+<ul><li>one<li>two <em>items</em></ul>
+<ol start="3"><li>three</li><li>four<ul><li>nested</li></ul></li></ol>
+<blockquote><p>Quoted</p><p>Twice</p></blockquote>
+<pre><code class="language-go">func F[T any](v T) {}
+
+// done</code></pre>
+<p>Use <code>x*y</code> and a_b.</p>
+<img src="https://img.example/a.png" alt="Chart">
+<table><tr><th>k</th><th>v</th></tr><tr><td>a</td><td>1|2</td></tr></table>
+<script>alert(1)</script>
+</body></html>`
+
+func TestToMarkdown(t *testing.T) {
+	got := ToMarkdown(sampleHTML)
+	want := "# Go generics\n\n" +
+		"Type **parameters** arrive in [Go 1.18](https://go.dev/doc).\nSecond line\n\n" +
+		"- one\n- two _items_\n\n" +
+		"3. three\n4. four\n\n   - nested\n\n" +
+		"> Quoted\n>\n> Twice\n\n" +
+		"```go\nfunc F[T any](v T) {}\n\n// done\n```\n\n" +
+		"Use `x*y` and a\\_b.\n\n" +
+		"![Chart][image1]\n\n" +
+		"| k | v |\n| --- | --- |\n| a | 1\\|2 |\n\n" +
+		"[image1]: https://img.example/a.png"
+	if got != want {
+		t.Fatalf("markdown mismatch:\n--- got ---\n%s\n--- want ---\n%s", got, want)
+	}
+}
+
+func TestEscapeMarkdown(t *testing.T) {
+	for in, want := range map[string]string{
+		"# Title":             `\# Title`,
+		"> quote":             `\> quote`,
+		"- item\n+ more":      "\\- item\n\\+ more",
+		"1. first\n  12) two": "1\\. first\n  12\\) two",
+		"e-mail 1.5 a+b":      "e-mail 1.5 a+b",
+		"a|b [x](y)":          `a\|b \[x\]\(y\)`,
+	} {
+		if got := EscapeMarkdown(in); got != want {
+			t.Errorf("EscapeMarkdown(%q) = %q, want %q", in, got, want)
+		}
+	}
+	got := ToMarkdown("<p>1. Not a list</p><p>- nor this<br>+ or this</p>")
+	if want := "1\\. Not a list\n\n\\- nor this\n\\+ or this"; got != want {
+		t.Fatalf("ToMarkdown = %q, want %q", got, want)
+	}
+}
+
+func TestToText(t *testing.T) {
+	got := ToText(sampleHTML)
+	for _, want := range []string{"Go generics\n\nType parameters arrive in Go 1.18.\nSecond line", "- one\n- two items", "    Quoted", "[Chart]", "a\t1|2"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("text missing %q:\n%s", want, got)
+		}
+	}
+	for _, bad := range []string{"alert", "color:red", "<", "**"} {
+		if strings.Contains(got, bad) {
+			t.Fatalf("text kept %q:\n%s", bad, got)
+		}
+	}
+}
+
+func TestFrontMatter(t *testing.T) {
+	got := FrontMatter(Metadata{ID: 7, Title: `A "quoted": title`, URL: "https://a.example", Tags: []string{"go", "read later"}, Progress: 0.5, Time: 1700000000})
+	want := "---\nid: 7\ntitle: \"A \\\"quoted\\\": title\"\nurl: \"https://a.example\"\ntags:\n  - \"go\"\n  - \"read later\"\nprogress: 0.5\nstarred: false\nsaved: 2023-11-14T22:13:20Z\n---\n\n"
+	if got != want {
+		t.Fatalf("front matter mismatch:\n%s", got)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for in, want := range map[string]string{"md": FormatMarkdown, "TEXT": FormatText, "": FormatHTML} {
+		got, err := ParseFormat(in)
+		if err != nil || got != want {
+			t.Fatalf("ParseFormat(%q)=%q,%v want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseFormat("pdf"); err == nil {
+		t.Fatalf("expected error for pdf")
+	}
+}
+
+func TestToXHTML(t *testing.T) {
+	in := `<div onclick="x()"><p>A &amp; B<br>next</p><img src="a.png" alt="Fig"><a href="javascript:evil()">bad</a><a href="https://ok.example?a=1&b=2">ok</a><font color=red>plain</font><script>evil()</script><li>loose</li></div>`
+	got := ToXHTML(in)
+	want := `<div><p>A &amp; B<br/>next</p>[Fig]<a>bad</a><a href="https://ok.example?a=1&amp;b=2">ok</a>plain<p>loose</p></div>`
+	if got != want {
+		t.Fatalf("xhtml mismatch:\n got %s\nwant %s", got, want)
+	}
+}
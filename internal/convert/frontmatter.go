@@ -0,0 +1,57 @@
+package convert
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metadata describes the bookmark a converted document came from.
+type Metadata struct {
+	ID          int64
+	URL         string
+	Title       string
+	Description string
+	Tags        []string
+	Progress    float64
+	Starred     bool
+	Time        int64 // saved at, unix seconds
+}
+
+// FrontMatter renders m as a YAML front matter block, including the trailing
+// blank line. Strings are double-quoted so titles with colons stay valid.
+func FrontMatter(m Metadata) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	b.WriteString("id: " + strconv.FormatInt(m.ID, 10) + "\n")
+	if m.Title != "" {
+		b.WriteString("title: " + yamlString(m.Title) + "\n")
+	}
+	if m.URL != "" {
+		b.WriteString("url: " + yamlString(m.URL) + "\n")
+	}
+	if m.Description != "" {
+		b.WriteString("description: " + yamlString(m.Description) + "\n")
+	}
+	if len(m.Tags) == 0 {
+		b.WriteString("tags: []\n")
+	} else {
+		b.WriteString("tags:\n")
+		for _, tag := range m.Tags {
+			b.WriteString("  - " + yamlString(tag) + "\n")
+		}
+	}
+	b.WriteString("progress: " + strconv.FormatFloat(m.Progress, 'f', -1, 64) + "\n")
+	b.WriteString("starred: " + strconv.FormatBool(m.Starred) + "\n")
+	if m.Time > 0 {
+		b.WriteString("saved: " + time.Unix(m.Time, 0).UTC().Format(time.RFC3339) + "\n")
+	}
+	b.WriteString("---\n\n")
+	return b.String()
+}
+
+// yamlString quotes s as a YAML double-quoted scalar. Go's escape sequences
+// are a subset of YAML's, so strconv.Quote output is valid YAML.
+func yamlString(s string) string {
+	return strconv.Quote(s)
+}
@@ -0,0 +1,251 @@
+package convert
+
+import (
+	"html"
+	"strings"
+)
+
+// node is an element or text node of a forgivingly parsed HTML document.
+type node struct {
+	tag      string // empty for text nodes
+	text     string
+	attrs    map[string]string
+	children []*node
+	parent   *node
+}
+
+var voidTags = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true,
+	"img": true, "input": true, "link": true, "meta": true, "source": true,
+	"track": true, "wbr": true,
+}
+
+// skipTags are dropped along with their content.
+var skipTags = map[string]bool{
+	"head": true, "script": true, "style": true, "noscript": true, "template": true,
+	"iframe": true, "svg": true, "object": true, "canvas": true, "form": true,
+	"button": true, "select": true, "textarea": true,
+}
+
+// rawTags hold text that must not be scanned for markup.
+var rawTags = map[string]bool{"script": true, "style": true, "textarea": true}
+
+// parse builds a tree from src. It does not implement the HTML5 algorithm;
+// it tolerates unclosed and mismatched tags, which is enough for the
+// readability output returned by the text endpoint.
+func parse(src string) *node {
+	root := &node{tag: "#root"}
+	cur := root
+	appendText := func(s string) {
+		if s == "" {
+			return
+		}
+		cur.children = append(cur.children, &node{text: html.UnescapeString(s), parent: cur})
+	}
+	i := 0
+	for i < len(src) {
+		lt := strings.IndexByte(src[i:], '<')
+		if lt < 0 {
+			appendText(src[i:])
+			break
+		}
+		appendText(src[i : i+lt])
+		i += lt
+		rest := src[i:]
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			end := strings.Index(rest[4:], "-->")
+			if end < 0 {
+				return root
+			}
+			i += 4 + end + 3
+			continue
+		case strings.HasPrefix(rest, "<!"), strings.HasPrefix(rest, "<?"):
+			end := strings.IndexByte(rest, '>')
+			if end < 0 {
+				return root
+			}
+			i += end + 1
+			continue
+		}
+		end := tagEnd(rest)
+		if end < 0 {
+			appendText(rest)
+			break
+		}
+		raw := rest[1:end]
+		i += end + 1
+		if raw == "" || !(isASCIILetter(raw[0]) || (raw[0] == '/' && len(raw) > 1 && isASCIILetter(raw[1]))) {
+			appendText("<" + raw + ">")
+			continue
+		}
+		if raw[0] == '/' {
+			name := strings.ToLower(strings.TrimSpace(raw[1:]))
+			if sp := strings.IndexAny(name, " \t\r\n"); sp >= 0 {
+				name = name[:sp]
+			}
+			for n := cur; n != root; n = n.parent {
+				if n.tag == name {
+					cur = n.parent
+					break
+				}
+			}
+			continue
+		}
+		name, attrs, selfClosing := parseTag(raw)
+		cur = implicitClose(cur, name)
+		el := &node{tag: name, attrs: attrs, parent: cur}
+		cur.children = append(cur.children, el)
+		if rawTags[name] {
+			closeTag := "</" + name
+			idx := strings.Index(strings.ToLower(src[i:]), closeTag)
+			if idx < 0 {
+				el.children = append(el.children, &node{text: src[i:], parent: el})
+				return root
+			}
+			el.children = append(el.children, &node{text: src[i : i+idx], parent: el})
+			i += idx
+			if gt := strings.IndexByte(src[i:], '>'); gt >= 0 {
+				i += gt + 1
+			} else {
+				i = len(src)
+			}
+			continue
+		}
+		if !selfClosing && !voidTags[name] {
+			cur = el
+		}
+	}
+	return root
+}
+
+// implicitClose pops elements that a new start tag closes implicitly, such as
+// an open <li> when the next <li> starts.
+func implicitClose(cur *node, name string) *node {
+	closes := func(open string) bool {
+		switch name {
+		case "li":
+			return open == "li"
+		case "dt", "dd":
+			return open == "dt" || open == "dd"
+		case "tr":
+			return open == "tr" || open == "td" || open == "th"
+		case "td", "th":
+			return open == "td" || open == "th"
+		case "p", "div", "ul", "ol", "h1", "h2", "h3", "h4", "h5", "h6", "pre", "blockquote", "table", "hr":
+			return open == "p"
+		}
+		return false
+	}
+	for n := cur; n.parent != nil; n = n.parent {
+		if closes(n.tag) {
+			return n.parent
+		}
+		// Do not look past the container that scopes the implicit close.
+		switch n.tag {
+		case "ul", "ol", "dl", "table", "blockquote", "div", "section", "article", "td", "th", "li":
+			return cur
+		}
+	}
+	return cur
+}
+
+// tagEnd finds the '>' closing the tag at the start of s, skipping quoted
+// attribute values.
+func tagEnd(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i
+		}
+	}
+	return -1
+}
+
+func parseTag(raw string) (string, map[string]string, bool) {
+	selfClosing := strings.HasSuffix(raw, "/")
+	if selfClosing {
+		raw = raw[:len(raw)-1]
+	}
+	i := 0
+	for i < len(raw) && !isSpace(raw[i]) {
+		i++
+	}
+	name := strings.ToLower(raw[:i])
+	var attrs map[string]string
+	for i < len(raw) {
+		for i < len(raw) && isSpace(raw[i]) {
+			i++
+		}
+		start := i
+		for i < len(raw) && !isSpace(raw[i]) && raw[i] != '=' {
+			i++
+		}
+		key := strings.ToLower(raw[start:i])
+		if key == "" {
+			i++
+			continue
+		}
+		for i < len(raw) && isSpace(raw[i]) {
+			i++
+		}
+		val := ""
+		if i < len(raw) && raw[i] == '=' {
+			i++
+			for i < len(raw) && isSpace(raw[i]) {
+				i++
+			}
+			if i < len(raw) && (raw[i] == '"' || raw[i] == '\'') {
+				q := raw[i]
+				i++
+				vs := i
+				for i < len(raw) && raw[i] != q {
+					i++
+				}
+				val = raw[vs:i]
+				i++
+			} else {
+				vs := i
+				for i < len(raw) && !isSpace(raw[i]) {
+					i++
+				}
+				val = raw[vs:i]
+			}
+		}
+		if attrs == nil {
+			attrs = map[string]string{}
+		}
+		if _, ok := attrs[key]; !ok {
+			attrs[key] = html.UnescapeString(val)
+		}
+	}
+	return name, attrs, selfClosing
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// textContent returns the concatenated text below n.
+func textContent(n *node) string {
+	if n.tag == "" {
+		return n.text
+	}
+	var b strings.Builder
+	for _, c := range n.children {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
@@ -0,0 +1,102 @@
+package convert
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// xhtmlTags lists the elements kept by ToXHTML with the attributes allowed on
+// each. Everything else is unwrapped (children kept) or, for skipTags, dropped.
+var xhtmlTags = map[string][]string{
+	"p": nil, "div": nil, "section": nil, "article": nil, "aside": nil,
+	"h1": nil, "h2": nil, "h3": nil, "h4": nil, "h5": nil, "h6": nil,
+	"ul": nil, "ol": {"start"}, "li": nil, "dl": nil, "dt": nil, "dd": nil,
+	"blockquote": nil, "pre": nil, "code": nil, "kbd": nil, "samp": nil,
+	"em": nil, "strong": nil, "b": nil, "i": nil, "u": nil, "s": nil, "del": nil, "ins": nil,
+	"sub": nil, "sup": nil, "small": nil, "mark": nil, "cite": nil, "q": nil, "abbr": {"title"},
+	"a": {"href", "title"}, "br": nil, "hr": nil,
+	"figure": nil, "figcaption": nil,
+	"table": nil, "thead": nil, "tbody": nil, "tfoot": nil, "tr": nil,
+	"th": {"colspan", "rowspan"}, "td": {"colspan", "rowspan"}, "caption": nil,
+}
+
+// ToXHTML converts HTML to a sanitized XHTML fragment suitable for an EPUB
+// body: a fixed set of elements, no scripts, styles or event attributes, only
+// http(s) and mailto links, and images replaced by their alt text.
+func ToXHTML(src string) string {
+	var b strings.Builder
+	writeXHTML(&b, parse(src))
+	return strings.TrimSpace(b.String())
+}
+
+func writeXHTML(b *strings.Builder, n *node) {
+	for _, c := range n.children {
+		switch {
+		case c.tag == "":
+			b.WriteString(EscapeXML(c.text))
+		case skipTags[c.tag]:
+		case c.tag == "img":
+			if alt := strings.TrimSpace(c.attrs["alt"]); alt != "" {
+				b.WriteString("[" + EscapeXML(alt) + "]")
+			}
+		case c.tag == "li" && n.tag != "ul" && n.tag != "ol":
+			b.WriteString("<p>")
+			writeXHTML(b, c)
+			b.WriteString("</p>")
+		default:
+			allowed, ok := xhtmlTags[c.tag]
+			if !ok {
+				writeXHTML(b, c)
+				continue
+			}
+			b.WriteString("<" + c.tag)
+			for _, name := range allowed {
+				val, ok := c.attrs[name]
+				if !ok {
+					continue
+				}
+				if name == "href" && !safeHref(val) {
+					continue
+				}
+				b.WriteString(" " + name + "=\"" + EscapeXML(val) + "\"")
+			}
+			if voidTags[c.tag] {
+				b.WriteString("/>")
+				continue
+			}
+			b.WriteString(">")
+			writeXHTML(b, c)
+			b.WriteString("</" + c.tag + ">")
+		}
+	}
+}
+
+func safeHref(href string) bool {
+	lower := strings.ToLower(strings.TrimSpace(href))
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "mailto:")
+}
+
+// EscapeXML escapes text for XML content and attribute values and drops
+// characters that are not allowed in XML 1.0.
+func EscapeXML(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		switch {
+		case r == '&':
+			b.WriteString("&amp;")
+		case r == '<':
+			b.WriteString("&lt;")
+		case r == '>':
+			b.WriteString("&gt;")
+		case r == '"':
+			b.WriteString("&quot;")
+		case r == '\t' || r == '\n' || r == '\r':
+			b.WriteRune(r)
+		case r < 0x20, r == utf8.RuneError, r >= 0xFFFE && r <= 0xFFFF:
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
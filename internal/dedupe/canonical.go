@@ -0,0 +1,130 @@
+package dedupe
+
+import (
+	"net/url"
+	"strings"
+)
+
+// trackingParams are query parameters that only identify where a link was
+// shared, never which page it points at.
+var trackingParams = map[string]bool{
+	"fbclid": true, "gclid": true, "dclid": true, "gbraid": true, "wbraid": true,
+	"msclkid": true, "yclid": true, "igshid": true, "twclid": true, "ttclid": true,
+	"mc_cid": true, "mc_eid": true, "_hsenc": true, "_hsmi": true, "mkt_tok": true,
+	"ref_src": true, "ref_url": true, "oly_anon_id": true, "oly_enc_id": true,
+	"vero_id": true, "cmpid": true, "s_cid": true, "spm": true,
+	// AMP viewer parameters.
+	"amp": true, "amp_js_v": true, "usqp": true, "_gsa": true,
+}
+
+var trackingPrefixes = []string{"utm_", "pk_", "mtm_"}
+
+// Canonical returns the form of rawURL used to recognise duplicates: http
+// and https, "www." and default ports are folded together, tracking
+// parameters and the fragment are dropped, the remaining query is sorted,
+// trailing slashes are trimmed and AMP pages (Google AMP cache URLs,
+// amp. hosts, /amp path segments, .amp.html) are mapped to the page they
+// mirror. Canonical URLs are keys, not links: they are not guaranteed to
+// load. A string that does not parse as an absolute URL is returned trimmed.
+func Canonical(rawURL string) string {
+	raw := strings.TrimSpace(rawURL)
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	for i := 0; i < 3; i++ {
+		inner, ok := unwrapAMPCache(u)
+		if !ok {
+			break
+		}
+		u = inner
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if scheme == "http" {
+		scheme = "https"
+	}
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+	for _, prefix := range []string{"www.", "amp."} {
+		if rest := strings.TrimPrefix(host, prefix); rest != host && strings.Contains(rest, ".") {
+			host = rest
+		}
+	}
+
+	path := u.EscapedPath()
+	path = strings.Replace(path, ".amp.html", ".html", 1)
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	kept := segments[:0]
+	for i, s := range segments {
+		if s == "" || (strings.EqualFold(s, "amp") && (i == 0 || i == len(segments)-1)) {
+			continue
+		}
+		kept = append(kept, s)
+	}
+	path = ""
+	if len(kept) > 0 {
+		path = "/" + strings.Join(kept, "/")
+	}
+
+	q := u.Query()
+	for key := range q {
+		if isTrackingParam(key) || (strings.EqualFold(key, "outputType") && strings.EqualFold(q.Get(key), "amp")) {
+			q.Del(key)
+		}
+	}
+	out := scheme + "://" + host + path
+	if enc := q.Encode(); enc != "" {
+		out += "?" + enc
+	}
+	return out
+}
+
+func isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	if trackingParams[key] {
+		return true
+	}
+	for _, p := range trackingPrefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// unwrapAMPCache returns the publisher URL behind a Google AMP cache or
+// viewer URL: https://example-com.cdn.ampproject.org/c/s/example.com/a and
+// https://www.google.com/amp/s/example.com/a both mirror
+// https://example.com/a.
+func unwrapAMPCache(u *url.URL) (*url.URL, bool) {
+	host := strings.ToLower(u.Hostname())
+	parts := strings.Split(strings.TrimPrefix(u.EscapedPath(), "/"), "/")
+	switch {
+	case strings.HasSuffix(host, ".cdn.ampproject.org"):
+		if len(parts) < 2 || (parts[0] != "c" && parts[0] != "v" && parts[0] != "i") {
+			return nil, false
+		}
+		parts = parts[1:]
+	case (host == "google.com" || strings.HasPrefix(host, "www.google.") || strings.HasPrefix(host, "google.")) && len(parts) > 1 && parts[0] == "amp":
+		parts = parts[1:]
+	default:
+		return nil, false
+	}
+	scheme := "http"
+	if parts[0] == "s" {
+		scheme = "https"
+		parts = parts[1:]
+	}
+	if len(parts) == 0 || parts[0] == "" {
+		return nil, false
+	}
+	inner, err := url.Parse(scheme + "://" + strings.Join(parts, "/"))
+	if err != nil || inner.Host == "" {
+		return nil, false
+	}
+	inner.RawQuery = u.RawQuery
+	return inner, true
+}
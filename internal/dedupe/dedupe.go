@@ -0,0 +1,119 @@
+// Package dedupe finds bookmarks that were saved more than once: the same
+// article under different tracking parameters, schemes, "www." or AMP
+// variants of its URL.
+package dedupe
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+)
+
+// Strategies for choosing the bookmark to keep in a group.
+const (
+	KeepOldest       = "keep-oldest"
+	KeepMostProgress = "keep-most-progress"
+)
+
+// Strategies lists every keep strategy.
+var Strategies = []string{KeepOldest, KeepMostProgress}
+
+// ParseStrategy normalizes an --apply value.
+func ParseStrategy(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, k := range Strategies {
+		if s == k {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("invalid strategy %q (expected %s)", s, strings.Join(Strategies, "|"))
+}
+
+// Group returns the duplicate groups in bookmarks as index lists, in the
+// order each group's first bookmark appears. Bookmarks are duplicates when
+// their URLs have the same Canonical form or they carry the same non-empty
+// hash; the relation is transitive. Groups of one are left out.
+func Group(bookmarks []instapaper.Bookmark) [][]int {
+	parent := make([]int, len(bookmarks))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	union := func(a, b int) {
+		ra, rb := find(a), find(b)
+		if ra == rb {
+			return
+		}
+		if rb < ra {
+			ra, rb = rb, ra
+		}
+		parent[rb] = ra
+	}
+	byURL := map[string]int{}
+	byHash := map[string]int{}
+	for i, b := range bookmarks {
+		if key := Canonical(b.URL); key != "" {
+			if j, ok := byURL[key]; ok {
+				union(i, j)
+			} else {
+				byURL[key] = i
+			}
+		}
+		if b.Hash != "" {
+			if j, ok := byHash[b.Hash]; ok {
+				union(i, j)
+			} else {
+				byHash[b.Hash] = i
+			}
+		}
+	}
+	members := map[int][]int{}
+	var roots []int
+	for i := range bookmarks {
+		r := find(i)
+		if _, ok := members[r]; !ok {
+			roots = append(roots, r)
+		}
+		members[r] = append(members[r], i)
+	}
+	var groups [][]int
+	for _, r := range roots {
+		if len(members[r]) > 1 {
+			groups = append(groups, members[r])
+		}
+	}
+	return groups
+}
+
+// Keep returns the index of the bookmark in group that strategy keeps: the
+// one saved first for keep-oldest, the one read furthest for
+// keep-most-progress. Ties go to the older bookmark, then the lower id.
+func Keep(strategy string, bookmarks []instapaper.Bookmark, group []int) int {
+	best := group[0]
+	for _, i := range group[1:] {
+		b, cur := bookmarks[i], bookmarks[best]
+		if strategy == KeepMostProgress && b.Progress != cur.Progress {
+			if b.Progress > cur.Progress {
+				best = i
+			}
+			continue
+		}
+		if b.Time != cur.Time {
+			if b.Time < cur.Time {
+				best = i
+			}
+			continue
+		}
+		if b.BookmarkID < cur.BookmarkID {
+			best = i
+		}
+	}
+	return best
+}
@@ -0,0 +1,75 @@
+package dedupe
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+)
+
+func TestCanonical(t *testing.T) {
+	same := map[string][]string{
+		"https://example.com/post": {
+			"http://www.example.com/post/",
+			"https://EXAMPLE.com:443/post?utm_source=x&utm_medium=y#comments",
+			"https://example.com/post?fbclid=abc",
+			"https://example.com/post/amp",
+			"https://amp.example.com/post",
+			"https://example-com.cdn.ampproject.org/c/s/example.com/post",
+			"https://www.google.com/amp/s/www.example.com/post/amp/",
+		},
+		"https://example.com/a.html?id=2&page=1": {
+			"https://example.com/a.amp.html?page=1&id=2",
+			"https://example.com/a.html?page=1&id=2&outputType=amp&gclid=z",
+		},
+		"https://example.com": {"http://www.example.com/", "https://example.com#top"},
+	}
+	for want, inputs := range same {
+		for _, in := range inputs {
+			if got := Canonical(in); got != want {
+				t.Errorf("Canonical(%q) = %q, want %q", in, got, want)
+			}
+		}
+	}
+	differ := [][2]string{
+		{"https://example.com/post?id=1", "https://example.com/post?id=2"},
+		{"https://example.com:8080/post", "https://example.com/post"},
+		{"https://amp.dev/about", "https://dev/about"},
+		{"https://blog.example.com/post", "https://example.com/post"},
+	}
+	for _, d := range differ {
+		if Canonical(d[0]) == Canonical(d[1]) {
+			t.Errorf("%q and %q should not be duplicates", d[0], d[1])
+		}
+	}
+	if got := Canonical("  not a url "); got != "not a url" {
+		t.Errorf("Canonical of garbage = %q", got)
+	}
+}
+
+func TestGroupAndKeep(t *testing.T) {
+	bookmarks := []instapaper.Bookmark{
+		{BookmarkID: 1, URL: "https://example.com/a?utm_source=feed", Time: 300, Progress: 0.9},
+		{BookmarkID: 2, URL: "https://other.example/x", Hash: "h1", Time: 100},
+		{BookmarkID: 3, URL: "http://www.example.com/a/", Time: 200},
+		{BookmarkID: 4, URL: "https://unique.example/", Time: 50},
+		{BookmarkID: 5, URL: "https://example.com/a", Time: 200},
+		{BookmarkID: 6, URL: "https://mirror.example/x", Hash: "h1", Time: 400},
+	}
+	groups := Group(bookmarks)
+	if want := [][]int{{0, 2, 4}, {1, 5}}; !reflect.DeepEqual(groups, want) {
+		t.Fatalf("Group = %v, want %v", groups, want)
+	}
+	if got := bookmarks[Keep(KeepOldest, bookmarks, groups[0])].BookmarkID; got != 3 {
+		t.Errorf("keep-oldest kept %d, want 3 (tie on time goes to the lower id)", got)
+	}
+	if got := bookmarks[Keep(KeepMostProgress, bookmarks, groups[0])].BookmarkID; got != 1 {
+		t.Errorf("keep-most-progress kept %d, want 1", got)
+	}
+	if got := bookmarks[Keep(KeepMostProgress, bookmarks, groups[1])].BookmarkID; got != 2 {
+		t.Errorf("keep-most-progress without progress kept %d, want the oldest", got)
+	}
+	if _, err := ParseStrategy("keep-newest"); err == nil {
+		t.Errorf("ParseStrategy accepted an unknown strategy")
+	}
+}
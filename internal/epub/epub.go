@@ -0,0 +1,210 @@
+// Package epub writes minimal, valid EPUB 3 books from XHTML chapters.
+package epub
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/vburojevic/instapaper-cli/internal/convert"
+)
+
+// Chapter is one article. Body must be a well-formed XHTML fragment, such as
+// the output of convert.ToXHTML.
+type Chapter struct {
+	Title string
+	URL   string
+	Body  string
+}
+
+// Book is an EPUB to write. Chapters appear in order after a title page.
+type Book struct {
+	Title      string
+	Language   string
+	Identifier string // defaults to a urn:uuid derived from the chapters
+	Modified   time.Time
+	Chapters   []Chapter
+}
+
+const containerXML = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+const stylesheet = `body { font-family: serif; line-height: 1.5; margin: 0 5%; }
+h1 { font-size: 1.4em; }
+pre { white-space: pre-wrap; font-size: 0.85em; }
+blockquote { margin-left: 1em; font-style: italic; }
+.source { font-size: 0.8em; word-break: break-all; }
+`
+
+// Write writes the book as an EPUB container to w.
+func (b *Book) Write(w io.Writer) error {
+	if len(b.Chapters) == 0 {
+		return errors.New("epub has no chapters")
+	}
+	title := b.Title
+	if title == "" {
+		title = "Instapaper"
+	}
+	lang := b.Language
+	if lang == "" {
+		lang = "en"
+	}
+	id := b.Identifier
+	if id == "" {
+		id = b.defaultIdentifier()
+	}
+	modified := b.Modified
+	if modified.IsZero() {
+		modified = time.Now()
+	}
+
+	zw := zip.NewWriter(w)
+	// The mimetype entry must come first and be stored uncompressed.
+	mw, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mw, "application/epub+zip"); err != nil {
+		return err
+	}
+	files := []struct{ name, body string }{
+		{"META-INF/container.xml", containerXML},
+		{"OEBPS/content.opf", b.packageDocument(title, lang, id, modified)},
+		{"OEBPS/nav.xhtml", b.navDocument(title, lang)},
+		{"OEBPS/style.css", stylesheet},
+		{"OEBPS/title.xhtml", b.titlePage(title, lang)},
+	}
+	for i, ch := range b.Chapters {
+		files = append(files, struct{ name, body string }{"OEBPS/" + chapterFile(i), chapterDocument(ch, lang)})
+	}
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.body); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func (b *Book) defaultIdentifier() string {
+	h := sha1.New()
+	for _, ch := range b.Chapters {
+		fmt.Fprintf(h, "%s\n", ch.URL)
+	}
+	sum := h.Sum(nil)
+	sum[6] = (sum[6] & 0x0f) | 0x50 // version 5
+	sum[8] = (sum[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+func (b *Book) packageDocument(title, lang, id string, modified time.Time) string {
+	var s strings.Builder
+	s.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="` + esc(lang) + `">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">` + esc(id) + `</dc:identifier>
+    <dc:title>` + esc(title) + `</dc:title>
+    <dc:language>` + esc(lang) + `</dc:language>
+    <dc:creator>Instapaper</dc:creator>
+    <meta property="dcterms:modified">` + modified.UTC().Format("2006-01-02T15:04:05Z") + `</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="css" href="style.css" media-type="text/css"/>
+    <item id="title" href="title.xhtml" media-type="application/xhtml+xml"/>
+`)
+	for i := range b.Chapters {
+		fmt.Fprintf(&s, "    <item id=\"ch%d\" href=\"%s\" media-type=\"application/xhtml+xml\"/>\n", i+1, chapterFile(i))
+	}
+	s.WriteString("  </manifest>\n  <spine>\n    <itemref idref=\"title\"/>\n")
+	for i := range b.Chapters {
+		fmt.Fprintf(&s, "    <itemref idref=\"ch%d\"/>\n", i+1)
+	}
+	s.WriteString("  </spine>\n</package>\n")
+	return s.String()
+}
+
+func (b *Book) navDocument(title, lang string) string {
+	var s strings.Builder
+	s.WriteString(xhtmlHead(title, lang, `xmlns:epub="http://www.idpf.org/2007/ops"`))
+	s.WriteString("<nav epub:type=\"toc\" id=\"toc\">\n<h1>Contents</h1>\n<ol>\n<li><a href=\"title.xhtml\">" + esc(title) + "</a></li>\n")
+	for i, ch := range b.Chapters {
+		fmt.Fprintf(&s, "<li><a href=\"%s\">%s</a></li>\n", chapterFile(i), esc(chapterTitle(ch)))
+	}
+	s.WriteString("</ol>\n</nav>\n</body>\n</html>\n")
+	return s.String()
+}
+
+func (b *Book) titlePage(title, lang string) string {
+	var s strings.Builder
+	s.WriteString(xhtmlHead(title, lang, ""))
+	s.WriteString("<h1>" + esc(title) + "</h1>\n<ol>\n")
+	for i, ch := range b.Chapters {
+		fmt.Fprintf(&s, "<li><a href=\"%s\">%s</a>", chapterFile(i), esc(chapterTitle(ch)))
+		if ch.URL != "" {
+			s.WriteString("<br/><span class=\"source\">" + esc(ch.URL) + "</span>")
+		}
+		s.WriteString("</li>\n")
+	}
+	s.WriteString("</ol>\n</body>\n</html>\n")
+	return s.String()
+}
+
+func chapterDocument(ch Chapter, lang string) string {
+	var s strings.Builder
+	title := chapterTitle(ch)
+	s.WriteString(xhtmlHead(title, lang, ""))
+	s.WriteString("<h1>" + esc(title) + "</h1>\n")
+	if ch.URL != "" {
+		s.WriteString("<p class=\"source\">" + esc(ch.URL) + "</p>\n")
+	}
+	s.WriteString(ch.Body)
+	s.WriteString("\n</body>\n</html>\n")
+	return s.String()
+}
+
+func xhtmlHead(title, lang, extraNS string) string {
+	if extraNS != "" {
+		extraNS = " " + extraNS
+	}
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml"` + extraNS + ` xml:lang="` + esc(lang) + `" lang="` + esc(lang) + `">
+<head>
+<meta charset="UTF-8"/>
+<title>` + esc(title) + `</title>
+<link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+`
+}
+
+func chapterFile(i int) string {
+	return fmt.Sprintf("chapter-%03d.xhtml", i+1)
+}
+
+func chapterTitle(ch Chapter) string {
+	if strings.TrimSpace(ch.Title) != "" {
+		return ch.Title
+	}
+	if ch.URL != "" {
+		return ch.URL
+	}
+	return "Untitled"
+}
+
+func esc(s string) string {
+	return convert.EscapeXML(s)
+}
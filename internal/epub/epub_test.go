@@ -0,0 +1,84 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteProducesValidContainer(t *testing.T) {
+	book := &Book{
+		Title:    "Week <1>",
+		Modified: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Chapters: []Chapter{
+			{Title: "First & best", URL: "https://a.example/?x=1&y=2", Body: "<p>Hello</p>"},
+			{URL: "https://b.example", Body: "<p>World</p>"},
+		},
+	}
+	var buf bytes.Buffer
+	if err := book.Write(&buf); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("zip: %v", err)
+	}
+	if zr.File[0].Name != "mimetype" || zr.File[0].Method != zip.Store {
+		t.Fatalf("first entry must be stored mimetype, got %s method=%d", zr.File[0].Name, zr.File[0].Method)
+	}
+	want := []string{"mimetype", "META-INF/container.xml", "OEBPS/content.opf", "OEBPS/nav.xhtml", "OEBPS/style.css", "OEBPS/title.xhtml", "OEBPS/chapter-001.xhtml", "OEBPS/chapter-002.xhtml"}
+	if len(zr.File) != len(want) {
+		t.Fatalf("entries=%d want %d", len(zr.File), len(want))
+	}
+	for i, f := range zr.File {
+		if f.Name != want[i] {
+			t.Fatalf("entry %d=%s want %s", i, f.Name, want[i])
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		body, _ := io.ReadAll(rc)
+		rc.Close()
+		if strings.HasSuffix(f.Name, ".xml") || strings.HasSuffix(f.Name, ".opf") || strings.HasSuffix(f.Name, ".xhtml") {
+			if err := wellFormed(body); err != nil {
+				t.Fatalf("%s not well-formed: %v\n%s", f.Name, err, body)
+			}
+		}
+		switch f.Name {
+		case "OEBPS/content.opf":
+			for _, s := range []string{`<dc:title>Week &lt;1&gt;</dc:title>`, `urn:uuid:`, `2026-01-02T03:04:05Z`, `<itemref idref="ch2"/>`, `properties="nav"`} {
+				if !strings.Contains(string(body), s) {
+					t.Fatalf("content.opf missing %q", s)
+				}
+			}
+		case "OEBPS/title.xhtml":
+			if !strings.Contains(string(body), "https://a.example/?x=1&amp;y=2") {
+				t.Fatalf("title page missing url:\n%s", body)
+			}
+		}
+	}
+}
+
+func TestWriteRequiresChapters(t *testing.T) {
+	if err := (&Book{}).Write(io.Discard); err == nil {
+		t.Fatalf("expected error for empty book")
+	}
+}
+
+func wellFormed(b []byte) error {
+	dec := xml.NewDecoder(bytes.NewReader(b))
+	for {
+		_, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
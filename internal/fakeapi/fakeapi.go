@@ -0,0 +1,568 @@
+// Package fakeapi is an in-memory, stateful stand-in for the Instapaper Full
+// API. It verifies OAuth 1.0a signatures, keeps bookmarks, folders and
+// highlights, implements the list endpoint's have/delete_ids semantics and
+// can inject API errors such as 1040 (rate limited). Tests mount it with
+// httptest.NewServer(fakeapi.New(fakeapi.Options{})); ip dev server serves
+// it on a local port.
+package fakeapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+	"github.com/vburojevic/instapaper-cli/internal/oauth1"
+)
+
+// Default credentials, used for any Options field left empty.
+const (
+	DefaultConsumerKey    = "dev-consumer-key"
+	DefaultConsumerSecret = "dev-consumer-secret"
+	DefaultUsername       = "dev@example.com"
+	DefaultPassword       = "dev"
+	DefaultToken          = "dev-token"
+	DefaultTokenSecret    = "dev-token-secret"
+)
+
+// List limits of the bookmarks/list endpoint.
+const (
+	DefaultListLimit = 25
+	MaxListLimit     = 500
+)
+
+// Options configures a Server.
+type Options struct {
+	ConsumerKey    string
+	ConsumerSecret string
+	// Username and Password are accepted by the xAuth access_token endpoint.
+	Username string
+	Password string
+	// Token and TokenSecret are issued up front, so clients can skip login.
+	Token       string
+	TokenSecret string
+	// Now returns the current time (default time.Now).
+	Now func() time.Time
+	// Logf, when set, receives one line per request.
+	Logf func(format string, args ...any)
+}
+
+// Bookmark is a stored bookmark and the folder it lives in.
+type Bookmark struct {
+	instapaper.Bookmark
+	// Folder is "unread", "archive" or the id of a user folder.
+	Folder string `json:"folder"`
+	// Text is served by get_text; empty text is generated from the title.
+	Text string `json:"-"`
+}
+
+// Server is the fake API. It implements http.Handler.
+type Server struct {
+	opts   Options
+	signer *oauth1.Signer
+	mux    *http.ServeMux
+
+	mu         sync.Mutex
+	tokens     map[string]string
+	bookmarks  map[int64]*Bookmark
+	folders    map[int64]*instapaper.Folder
+	highlights map[int64]*instapaper.Highlight
+	tagIDs     map[string]int64
+	faults     []*Fault
+	nextID     int64
+	requests   int
+}
+
+// New returns an empty server with opts' credentials and one issued token.
+func New(opts Options) *Server {
+	if opts.ConsumerKey == "" {
+		opts.ConsumerKey = DefaultConsumerKey
+	}
+	if opts.ConsumerSecret == "" {
+		opts.ConsumerSecret = DefaultConsumerSecret
+	}
+	if opts.Username == "" {
+		opts.Username = DefaultUsername
+	}
+	if opts.Password == "" {
+		opts.Password = DefaultPassword
+	}
+	if opts.Token == "" {
+		opts.Token = DefaultToken
+	}
+	if opts.TokenSecret == "" {
+		opts.TokenSecret = DefaultTokenSecret
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	s := &Server{
+		opts:   opts,
+		signer: oauth1.NewSigner(opts.ConsumerKey, opts.ConsumerSecret),
+		mux:    http.NewServeMux(),
+	}
+	s.reset()
+	s.routes()
+	return s
+}
+
+// Options returns the effective options, with defaults filled in.
+func (s *Server) Options() Options {
+	return s.opts
+}
+
+func (s *Server) reset() {
+	s.tokens = map[string]string{s.opts.Token: s.opts.TokenSecret}
+	s.bookmarks = map[int64]*Bookmark{}
+	s.folders = map[int64]*instapaper.Folder{}
+	s.highlights = map[int64]*instapaper.Highlight{}
+	s.tagIDs = map[string]int64{}
+	s.faults = nil
+	s.nextID = 1000
+	s.requests = 0
+}
+
+// Reset drops all data, faults and tokens except the pre-issued one.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reset()
+}
+
+// Requests returns how many API requests the server has handled.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *Server) id() int64 {
+	s.nextID++
+	return s.nextID
+}
+
+// Fault makes matching requests fail with an Instapaper error code.
+type Fault struct {
+	Code int `json:"code"`
+	// Path matches requests whose path starts with it; empty matches all.
+	Path string `json:"path,omitempty"`
+	// Times is how many requests fail; 0 fails every matching request.
+	Times int `json:"times,omitempty"`
+	// Status is the HTTP status (default 400, or 500 for 1500 and 1550).
+	Status int `json:"status,omitempty"`
+}
+
+// ParseFault parses "code[:path[:times]]", e.g. "1040:/api/1/bookmarks/list:2".
+func ParseFault(v string) (Fault, error) {
+	parts := strings.SplitN(strings.TrimSpace(v), ":", 3)
+	code, err := strconv.Atoi(parts[0])
+	if err != nil || code <= 0 {
+		return Fault{}, fmt.Errorf("invalid fault %q (expected code[:path[:times]])", v)
+	}
+	f := Fault{Code: code}
+	if len(parts) > 1 {
+		f.Path = parts[1]
+	}
+	if len(parts) > 2 {
+		n, err := strconv.Atoi(parts[2])
+		if err != nil || n < 0 {
+			return Fault{}, fmt.Errorf("invalid fault %q: times must be an integer >= 0", v)
+		}
+		f.Times = n
+	}
+	return f, nil
+}
+
+// InjectFault adds f; faults are checked in the order they were added.
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// takeFault returns the first fault matching path and uses up one of its
+// times.
+func (s *Server) takeFault(path string) *Fault {
+	for i, f := range s.faults {
+		if !strings.HasPrefix(path, f.Path) {
+			continue
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+// apiError is an Instapaper error response.
+type apiError struct {
+	code   int
+	msg    string
+	status int
+}
+
+func (e *apiError) Error() string { return fmt.Sprintf("%d: %s", e.code, e.msg) }
+
+var errorMessages = map[int]string{
+	1040: "Rate-limit exceeded",
+	1041: "Premium account required",
+	1042: "Application is suspended",
+	1240: "Invalid URL specified",
+	1241: "Invalid or missing bookmark_id",
+	1242: "Invalid or missing folder_id",
+	1243: "Invalid or missing progress",
+	1244: "Invalid or missing progress_timestamp",
+	1245: "Private bookmarks require supplied content",
+	1250: "Unexpected error when saving bookmark",
+	1251: "User already has a folder with this title",
+	1252: "Cannot add bookmarks to this folder",
+	1500: "Unexpected service error",
+	1550: "Error generating text version of this URL",
+	1600: "Cannot create highlight with empty text",
+	1601: "Duplicate highlight",
+}
+
+func newAPIError(code int) *apiError {
+	msg := errorMessages[code]
+	if msg == "" {
+		msg = "Error " + strconv.Itoa(code)
+	}
+	return &apiError{code: code, msg: msg}
+}
+
+func writeAPIError(w http.ResponseWriter, e *apiError) {
+	status := e.status
+	if status == 0 {
+		status = http.StatusBadRequest
+		if e.code == 1500 || e.code == 1550 {
+			status = http.StatusInternalServerError
+		}
+	}
+	if e.code == 1040 && w.Header().Get("Retry-After") == "" {
+		w.Header().Set("Retry-After", "1")
+	}
+	writeJSON(w, status, []map[string]any{{"type": "error", "error_code": e.code, "message": e.msg}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// ServeHTTP verifies the request signature, applies injected faults and
+// dispatches to the endpoint. Requests under /_fake/ control the server
+// and are not signed.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	start := s.opts.Now()
+	s.serve(sw, r)
+	if s.opts.Logf != nil {
+		s.opts.Logf("%s %s %d %s", r.Method, r.URL.Path, sw.status, s.opts.Now().Sub(start).Round(time.Microsecond))
+	}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/_fake/") {
+		s.serveControl(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+
+	token, err := s.signer.Verify(http.MethodPost, requestURL(r), r.Header.Get("Authorization"), r.PostForm, func(key string) (string, bool) {
+		secret, ok := s.tokens[key]
+		return secret, ok
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if f := s.takeFault(r.URL.Path); f != nil {
+		e := newAPIError(f.Code)
+		e.status = f.Status
+		writeAPIError(w, e)
+		return
+	}
+	if token == "" && r.URL.Path != "/api/1/oauth/access_token" {
+		http.Error(w, "oauth1: request is not signed with an access token", http.StatusUnauthorized)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.Path
+}
+
+// serveControl handles the unsigned /_fake/ endpoints used by demos and
+// scripts: GET state, POST fault (code, path, times, status) and POST reset.
+func (s *Server) serveControl(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/_fake/state":
+		writeJSON(w, http.StatusOK, s.State())
+	case "/_fake/fault":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		code, err := strconv.Atoi(r.FormValue("code"))
+		if err != nil {
+			http.Error(w, "invalid code", http.StatusBadRequest)
+			return
+		}
+		times, _ := strconv.Atoi(r.FormValue("times"))
+		status, _ := strconv.Atoi(r.FormValue("status"))
+		f := Fault{Code: code, Path: r.FormValue("path"), Times: times, Status: status}
+		s.InjectFault(f)
+		writeJSON(w, http.StatusOK, f)
+	case "/_fake/reset":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.Reset()
+		writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// State is a snapshot of the server's data.
+type State struct {
+	Bookmarks  []Bookmark             `json:"bookmarks"`
+	Folders    []instapaper.Folder    `json:"folders"`
+	Highlights []instapaper.Highlight `json:"highlights"`
+	Faults     []Fault                `json:"faults"`
+	Requests   int                    `json:"requests"`
+}
+
+// State returns a copy of everything the server holds.
+func (s *Server) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := State{
+		Bookmarks:  []Bookmark{},
+		Folders:    s.sortedFolders(),
+		Highlights: []instapaper.Highlight{},
+		Faults:     []Fault{},
+		Requests:   s.requests,
+	}
+	for _, b := range s.sortedBookmarks() {
+		st.Bookmarks = append(st.Bookmarks, *b)
+	}
+	for _, h := range s.sortedHighlights(0) {
+		st.Highlights = append(st.Highlights, *h)
+	}
+	for _, f := range s.faults {
+		st.Faults = append(st.Faults, *f)
+	}
+	return st
+}
+
+// Bookmark returns the stored bookmark with id.
+func (s *Server) Bookmark(id int64) (Bookmark, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.bookmarks[id]
+	if !ok {
+		return Bookmark{}, false
+	}
+	return *b, true
+}
+
+// AddBookmark stores b, filling in id, time, folder and hash when unset,
+// and returns the stored copy.
+func (s *Server) AddBookmark(b Bookmark) Bookmark {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if b.BookmarkID == 0 {
+		b.BookmarkID = instapaper.Int64(s.id())
+	} else if int64(b.BookmarkID) > s.nextID {
+		s.nextID = int64(b.BookmarkID)
+	}
+	if b.Time == 0 {
+		b.Time = instapaper.Int64(s.opts.Now().Unix())
+	}
+	if b.Folder == "" {
+		b.Folder = "unread"
+	}
+	b.Type = "bookmark"
+	for i := range b.Tags {
+		b.Tags[i].ID = instapaper.Int64(s.tagID(b.Tags[i].Name))
+	}
+	s.bookmarks[int64(b.BookmarkID)] = &b
+	s.touch(&b)
+	return b
+}
+
+// AddFolder creates a user folder at the end of the folder order.
+func (s *Server) AddFolder(title string) instapaper.Folder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.addFolder(title)
+}
+
+func (s *Server) addFolder(title string) *instapaper.Folder {
+	pos := 1.0
+	for _, f := range s.folders {
+		if float64(f.Position) >= pos {
+			pos = float64(f.Position) + 1
+		}
+	}
+	f := &instapaper.Folder{Type: "folder", FolderID: instapaper.Int64(s.id()), Title: title, Position: instapaper.Float64(pos)}
+	s.folders[int64(f.FolderID)] = f
+	return f
+}
+
+// AddHighlight stores a highlight on bookmarkID.
+func (s *Server) AddHighlight(bookmarkID int64, text string, position int) instapaper.Highlight {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.addHighlight(bookmarkID, text, position)
+}
+
+func (s *Server) addHighlight(bookmarkID int64, text string, position int) *instapaper.Highlight {
+	h := &instapaper.Highlight{
+		Type:        "highlight",
+		HighlightID: instapaper.Int64(s.id()),
+		BookmarkID:  instapaper.Int64(bookmarkID),
+		Text:        text,
+		Time:        instapaper.Int64(s.opts.Now().Unix()),
+		Position:    instapaper.Int64(position),
+	}
+	s.highlights[int64(h.HighlightID)] = h
+	return h
+}
+
+// Seed adds n sample bookmarks: every fifth is archived, every third
+// starred, and the first few carry a tag and a highlight.
+func (s *Server) Seed(n int) {
+	now := s.opts.Now().Unix()
+	for i := 1; i <= n; i++ {
+		b := Bookmark{
+			Bookmark: instapaper.Bookmark{
+				URL:         fmt.Sprintf("https://example.com/articles/%d", i),
+				Title:       fmt.Sprintf("Example article %d", i),
+				Description: fmt.Sprintf("Sample bookmark number %d.", i),
+				Starred:     instapaper.BoolInt(i%3 == 0),
+				Time:        instapaper.Int64(now - int64(n-i)*3600),
+			},
+		}
+		if i%5 == 0 {
+			b.Folder = "archive"
+		}
+		if i <= 3 {
+			b.Tags = []instapaper.Tag{{Name: "sample"}}
+		}
+		added := s.AddBookmark(b)
+		if i <= 3 {
+			s.AddHighlight(int64(added.BookmarkID), fmt.Sprintf("A highlighted passage from article %d.", i), 0)
+		}
+	}
+}
+
+func (s *Server) tagID(name string) int64 {
+	key := strings.ToLower(name)
+	if id, ok := s.tagIDs[key]; ok {
+		return id
+	}
+	id := s.id()
+	s.tagIDs[key] = id
+	return id
+}
+
+// touch recomputes the change hash after b was modified.
+func (s *Server) touch(b *Bookmark) {
+	b.Hash = ""
+	raw, _ := json.Marshal(b)
+	sum := sha1Hex(raw)
+	b.Hash = sum[:8]
+}
+
+func (s *Server) sortedBookmarks() []*Bookmark {
+	out := make([]*Bookmark, 0, len(s.bookmarks))
+	for _, b := range s.bookmarks {
+		out = append(out, b)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Time != out[j].Time {
+			return out[i].Time > out[j].Time
+		}
+		return out[i].BookmarkID > out[j].BookmarkID
+	})
+	return out
+}
+
+func (s *Server) sortedFolders() []instapaper.Folder {
+	out := make([]instapaper.Folder, 0, len(s.folders))
+	for _, f := range s.folders {
+		out = append(out, *f)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Position != out[j].Position {
+			return out[i].Position < out[j].Position
+		}
+		return out[i].FolderID < out[j].FolderID
+	})
+	return out
+}
+
+// sortedHighlights returns the highlights of bookmarkID, or all of them
+// when bookmarkID is 0, in creation order.
+func (s *Server) sortedHighlights(bookmarkID int64) []*instapaper.Highlight {
+	var out []*instapaper.Highlight
+	for _, h := range s.highlights {
+		if bookmarkID == 0 || int64(h.BookmarkID) == bookmarkID {
+			out = append(out, h)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].HighlightID < out[j].HighlightID })
+	return out
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
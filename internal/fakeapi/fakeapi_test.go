@@ -0,0 +1,241 @@
+package fakeapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+	"github.com/vburojevic/instapaper-cli/internal/oauth1"
+)
+
+func newTestServer(t *testing.T) (*Server, *instapaper.Client) {
+	t.Helper()
+	fake := New(Options{})
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	client, err := instapaper.NewClient(srv.URL, DefaultConsumerKey, DefaultConsumerSecret, &oauth1.Token{Key: DefaultToken, Secret: DefaultTokenSecret}, 2*time.Second)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return fake, client
+}
+
+func apiCode(err error) int {
+	var apiErr *instapaper.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return 0
+}
+
+func TestSignatureVerification(t *testing.T) {
+	fake, client := newTestServer(t)
+	ctx := context.Background()
+	if _, err := client.VerifyCredentials(ctx); err != nil {
+		t.Fatalf("VerifyCredentials: %v", err)
+	}
+
+	client.Token = &oauth1.Token{Key: DefaultToken, Secret: "wrong"}
+	if _, err := client.VerifyCredentials(ctx); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("expected 401 for a bad token secret, got %v", err)
+	}
+
+	client.Token = nil
+	if _, _, err := client.XAuthAccessToken(ctx, DefaultUsername, "nope"); err == nil {
+		t.Fatalf("expected xAuth failure with a wrong password")
+	}
+	key, secret, err := client.XAuthAccessToken(ctx, DefaultUsername, DefaultPassword)
+	if err != nil {
+		t.Fatalf("XAuthAccessToken: %v", err)
+	}
+	client.Token = &oauth1.Token{Key: key, Secret: secret}
+	u, err := client.VerifyCredentials(ctx)
+	if err != nil || u.Username != DefaultUsername {
+		t.Fatalf("VerifyCredentials with issued token: %+v %v", u, err)
+	}
+	if fake.Requests() != 5 {
+		t.Fatalf("requests=%d", fake.Requests())
+	}
+}
+
+func TestBookmarkLifecycle(t *testing.T) {
+	fake, client := newTestServer(t)
+	ctx := context.Background()
+
+	bm, err := client.AddBookmark(ctx, instapaper.AddBookmarkRequest{URL: "https://example.com/a", Title: "A", Tags: []string{"go"}})
+	if err != nil {
+		t.Fatalf("AddBookmark: %v", err)
+	}
+	again, err := client.AddBookmark(ctx, instapaper.AddBookmarkRequest{URL: "https://example.com/a"})
+	if err != nil || again.BookmarkID != bm.BookmarkID || again.Title != "A" {
+		t.Fatalf("re-adding a URL should return the same bookmark: %+v %v", again, err)
+	}
+	if _, err := client.AddBookmark(ctx, instapaper.AddBookmarkRequest{URL: "not a url"}); apiCode(err) != 1240 {
+		t.Fatalf("expected 1240, got %v", err)
+	}
+	id := int64(bm.BookmarkID)
+
+	if b, err := client.Star(ctx, id); err != nil || !bool(b.Starred) {
+		t.Fatalf("Star: %+v %v", b, err)
+	}
+	folder, err := client.AddFolder(ctx, "Work")
+	if err != nil {
+		t.Fatalf("AddFolder: %v", err)
+	}
+	if _, err := client.AddFolder(ctx, "work"); apiCode(err) != 1251 {
+		t.Fatalf("expected duplicate folder error, got %v", err)
+	}
+	if _, err := client.Move(ctx, id, "archive"); apiCode(err) != 1242 {
+		t.Fatalf("expected 1242 moving to archive, got %v", err)
+	}
+	if _, err := client.Move(ctx, id, strconv.FormatInt(int64(folder.FolderID), 10)); err != nil {
+		t.Fatalf("Move: %v", err)
+	}
+	if got, _ := fake.Bookmark(id); got.Folder != strconv.FormatInt(int64(folder.FolderID), 10) {
+		t.Fatalf("folder=%q", got.Folder)
+	}
+	if _, err := client.UpdateReadProgress(ctx, id, 1.5, 10); apiCode(err) != 1243 {
+		t.Fatalf("expected 1243, got %v", err)
+	}
+	if b, err := client.UpdateReadProgress(ctx, id, 0.5, 10); err != nil || b.Progress != 0.5 {
+		t.Fatalf("UpdateReadProgress: %+v %v", b, err)
+	}
+
+	h, err := client.CreateHighlight(ctx, id, "quote", 0)
+	if err != nil {
+		t.Fatalf("CreateHighlight: %v", err)
+	}
+	if _, err := client.CreateHighlight(ctx, id, "quote", 0); apiCode(err) != 1601 {
+		t.Fatalf("expected duplicate highlight error, got %v", err)
+	}
+	if hls, err := client.ListHighlights(ctx, id); err != nil || len(hls) != 1 || hls[0].HighlightID != h.HighlightID {
+		t.Fatalf("ListHighlights: %+v %v", hls, err)
+	}
+	html, err := client.GetTextHTML(ctx, id)
+	if err != nil || !strings.Contains(string(html), "<h1>A</h1>") {
+		t.Fatalf("GetTextHTML: %s %v", html, err)
+	}
+
+	if err := client.DeleteBookmark(ctx, id); err != nil {
+		t.Fatalf("DeleteBookmark: %v", err)
+	}
+	if _, err := client.Archive(ctx, id); apiCode(err) != 1241 {
+		t.Fatalf("expected 1241 after delete, got %v", err)
+	}
+	if st := fake.State(); len(st.Bookmarks) != 0 || len(st.Highlights) != 0 || len(st.Folders) != 1 {
+		t.Fatalf("unexpected state: %+v", st)
+	}
+}
+
+func TestListHaveAndLimit(t *testing.T) {
+	fake, client := newTestServer(t)
+	ctx := context.Background()
+	fake.Seed(10) // 8 unread, 2 archived
+
+	resp, err := client.ListBookmarks(ctx, instapaper.ListBookmarksOptions{Limit: 3})
+	if err != nil {
+		t.Fatalf("ListBookmarks: %v", err)
+	}
+	if len(resp.Bookmarks) != 3 || resp.Bookmarks[0].Title != "Example article 9" {
+		t.Fatalf("expected the 3 newest unread bookmarks, got %+v", resp.Bookmarks)
+	}
+
+	all, err := client.ListBookmarks(ctx, instapaper.ListBookmarksOptions{Limit: 1000})
+	if err != nil || len(all.Bookmarks) != 8 {
+		t.Fatalf("ListBookmarks all: %d %v", len(all.Bookmarks), err)
+	}
+	first, second := all.Bookmarks[0], all.Bookmarks[1]
+	if _, err := client.Archive(ctx, int64(second.BookmarkID)); err != nil {
+		t.Fatalf("Archive: %v", err)
+	}
+	have := []string{
+		strconv.FormatInt(int64(first.BookmarkID), 10) + ":" + first.Hash + ":0.75:" + strconv.FormatInt(time.Now().Unix(), 10),
+		strconv.FormatInt(int64(second.BookmarkID), 10) + ":" + second.Hash,
+	}
+	resp, err = client.ListBookmarks(ctx, instapaper.ListBookmarksOptions{Limit: 500, Have: strings.Join(have, ",")})
+	if err != nil {
+		t.Fatalf("ListBookmarks have: %v", err)
+	}
+	if len(resp.DeleteIDs) != 1 || resp.DeleteIDs[0] != second.BookmarkID {
+		t.Fatalf("delete_ids=%v", resp.DeleteIDs)
+	}
+	// first comes back because the newer client progress changed its hash.
+	if len(resp.Bookmarks) != 7 || resp.Bookmarks[0].BookmarkID != first.BookmarkID || resp.Bookmarks[0].Progress != 0.75 {
+		t.Fatalf("unexpected bookmarks: %+v", resp.Bookmarks)
+	}
+
+	resp, err = client.ListBookmarks(ctx, instapaper.ListBookmarksOptions{Tag: "sample", Highlights: strconv.FormatInt(int64(first.BookmarkID), 10) + "-1"})
+	if err != nil {
+		t.Fatalf("ListBookmarks tag: %v", err)
+	}
+	if len(resp.Bookmarks) != 3 || len(resp.Highlights) != 0 {
+		t.Fatalf("tag list: %d bookmarks, %d highlights", len(resp.Bookmarks), len(resp.Highlights))
+	}
+}
+
+func TestFaultInjection(t *testing.T) {
+	fake, client := newTestServer(t)
+	ctx := context.Background()
+	f, err := ParseFault("1041:/api/1/folders:1")
+	if err != nil {
+		t.Fatalf("ParseFault: %v", err)
+	}
+	fake.InjectFault(f)
+	if _, err := client.ListFolders(ctx); apiCode(err) != 1041 {
+		t.Fatalf("expected injected 1041, got %v", err)
+	}
+	if _, err := client.ListFolders(ctx); err != nil {
+		t.Fatalf("fault should be used up: %v", err)
+	}
+
+	fake.InjectFault(Fault{Code: 1040, Path: "/api/1/bookmarks/list", Times: 1})
+	client.SetRetryPolicy(instapaper.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond})
+	var retries int
+	client.OnRetry = func(instapaper.RetryEvent) { retries++ }
+	start := time.Now()
+	if _, err := client.ListBookmarks(ctx, instapaper.ListBookmarksOptions{}); err != nil {
+		t.Fatalf("ListBookmarks should succeed on retry: %v", err)
+	}
+	if retries != 1 || time.Since(start) < time.Second {
+		t.Fatalf("expected one retry honouring Retry-After, retries=%d", retries)
+	}
+
+	if _, err := ParseFault("x"); err == nil {
+		t.Fatalf("expected ParseFault error")
+	}
+}
+
+func TestControlEndpoints(t *testing.T) {
+	fake := New(Options{})
+	fake.Seed(2)
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	resp, err := http.PostForm(srv.URL+"/_fake/fault", map[string][]string{"code": {"1240"}, "path": {"/api/1/bookmarks/add"}})
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("fault: %v %v", resp, err)
+	}
+	resp.Body.Close()
+	if st := fake.State(); len(st.Faults) != 1 || st.Faults[0].Code != 1240 || len(st.Bookmarks) != 2 {
+		t.Fatalf("state=%+v", st)
+	}
+	resp, err = http.Post(srv.URL+"/_fake/reset", "", nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("reset: %v %v", resp, err)
+	}
+	resp.Body.Close()
+	if st := fake.State(); len(st.Faults) != 0 || len(st.Bookmarks) != 0 {
+		t.Fatalf("state after reset=%+v", st)
+	}
+	resp, err = http.Post(srv.URL+"/api/1/folders/list", "", nil)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("unsigned request: %v %v", resp, err)
+	}
+	resp.Body.Close()
+}
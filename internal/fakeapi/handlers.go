@@ -0,0 +1,489 @@
+package fakeapi
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+)
+
+// apiFunc handles a signed request while the server lock is held and
+// returns the items of the JSON array response.
+type apiFunc func(r *http.Request) ([]any, error)
+
+func (s *Server) routes() {
+	s.mux.HandleFunc("POST /api/1/oauth/access_token", s.accessToken)
+	s.handle("/api/1/account/verify_credentials", s.verifyCredentials)
+	s.mux.HandleFunc("POST /api/1/bookmarks/list", s.listBookmarks)
+	s.handle("/api/1/bookmarks/add", s.addBookmark)
+	s.handle("/api/1/bookmarks/delete", s.deleteBookmark)
+	s.handle("/api/1/bookmarks/update_read_progress", s.updateReadProgress)
+	s.handle("/api/1/bookmarks/star", s.mutate(func(b *Bookmark) { b.Starred = true }))
+	s.handle("/api/1/bookmarks/unstar", s.mutate(func(b *Bookmark) { b.Starred = false }))
+	s.handle("/api/1/bookmarks/archive", s.mutate(func(b *Bookmark) { b.Folder = "archive" }))
+	s.handle("/api/1/bookmarks/unarchive", s.mutate(func(b *Bookmark) { b.Folder = "unread" }))
+	s.handle("/api/1/bookmarks/move", s.moveBookmark)
+	s.mux.HandleFunc("POST /api/1/bookmarks/get_text", s.getText)
+	s.handle("/api/1/folders/list", s.listFolders)
+	s.handle("/api/1/folders/add", s.addFolderHandler)
+	s.handle("/api/1/folders/delete", s.deleteFolder)
+	s.handle("/api/1/folders/set_order", s.setFolderOrder)
+	s.handle("/api/1.1/bookmarks/{id}/highlights", s.listHighlights)
+	s.handle("/api/1.1/bookmarks/{id}/highlight", s.createHighlight)
+	s.handle("/api/1.1/highlights/{id}/delete", s.deleteHighlight)
+}
+
+func (s *Server) handle(path string, fn apiFunc) {
+	s.mux.HandleFunc("POST "+path, func(w http.ResponseWriter, r *http.Request) {
+		items, err := fn(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if items == nil {
+			items = []any{}
+		}
+		writeJSON(w, http.StatusOK, items)
+	})
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	if e, ok := err.(*apiError); ok {
+		writeAPIError(w, e)
+		return
+	}
+	writeAPIError(w, &apiError{code: 1500, msg: err.Error()})
+}
+
+func (s *Server) accessToken(w http.ResponseWriter, r *http.Request) {
+	if r.PostFormValue("x_auth_mode") != "client_auth" ||
+		r.PostFormValue("x_auth_username") != s.opts.Username ||
+		r.PostFormValue("x_auth_password") != s.opts.Password {
+		http.Error(w, "Invalid xAuth credentials.", http.StatusUnauthorized)
+		return
+	}
+	key, secret := randomHex(16), randomHex(16)
+	s.tokens[key] = secret
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(url.Values{"oauth_token": {key}, "oauth_token_secret": {secret}}.Encode()))
+}
+
+func (s *Server) user() map[string]any {
+	return map[string]any{"type": "user", "user_id": 1, "username": s.opts.Username}
+}
+
+func (s *Server) verifyCredentials(*http.Request) ([]any, error) {
+	return []any{s.user()}, nil
+}
+
+// haveEntry is one "id[:hash[:progress:progress_timestamp]]" element of the
+// list endpoint's have parameter.
+type haveEntry struct {
+	id                int64
+	hash              string
+	progress          float64
+	progressTimestamp int64
+}
+
+func parseHave(v string) []haveEntry {
+	var out []haveEntry
+	for _, part := range strings.Split(v, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ":")
+		id, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		e := haveEntry{id: id}
+		if len(fields) > 1 {
+			e.hash = fields[1]
+		}
+		if len(fields) > 3 {
+			e.progress, _ = strconv.ParseFloat(fields[2], 64)
+			e.progressTimestamp, _ = strconv.ParseInt(fields[3], 10, 64)
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// inFolder reports whether b is listed in folder: "unread", "archive",
+// "starred" or a user folder id.
+func inFolder(b *Bookmark, folder string) bool {
+	if folder == "starred" {
+		return bool(b.Starred)
+	}
+	return b.Folder == folder
+}
+
+func hasTag(b *Bookmark, tag string) bool {
+	for _, t := range b.Tags {
+		if strings.EqualFold(t.Name, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// listBookmarks implements bookmarks/list: bookmarks the client does not
+// have (or whose hash changed) newest first up to limit, delete_ids for
+// have entries no longer in the folder, and the highlights of the
+// bookmarks named in highlights. A have entry with a newer
+// progress_timestamp updates the stored progress.
+func (s *Server) listBookmarks(w http.ResponseWriter, r *http.Request) {
+	limit := DefaultListLimit
+	if v := r.PostFormValue("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			writeAPIError(w, &apiError{code: 1500, msg: "Invalid limit"})
+			return
+		}
+		limit = min(max(n, 1), MaxListLimit)
+	}
+	tag := r.PostFormValue("tag")
+	folder := r.PostFormValue("folder_id")
+	if folder == "" {
+		folder = "unread"
+	}
+	if tag == "" && !s.validListFolder(folder) {
+		writeAPIError(w, newAPIError(1242))
+		return
+	}
+	match := func(b *Bookmark) bool {
+		if tag != "" {
+			return hasTag(b, tag)
+		}
+		return inFolder(b, folder)
+	}
+
+	have := map[int64]haveEntry{}
+	deleteIDs := []int64{}
+	for _, e := range parseHave(r.PostFormValue("have")) {
+		have[e.id] = e
+		b, ok := s.bookmarks[e.id]
+		if !ok || !match(b) {
+			deleteIDs = append(deleteIDs, e.id)
+			continue
+		}
+		if e.progressTimestamp > int64(b.ProgressTimestamp) {
+			b.Progress = instapaper.Float64(e.progress)
+			b.ProgressTimestamp = instapaper.Int64(e.progressTimestamp)
+			s.touch(b)
+		}
+	}
+
+	bookmarks := []instapaper.Bookmark{}
+	for _, b := range s.sortedBookmarks() {
+		if len(bookmarks) >= limit {
+			break
+		}
+		if !match(b) {
+			continue
+		}
+		if e, ok := have[int64(b.BookmarkID)]; ok && e.hash == b.Hash {
+			continue
+		}
+		bookmarks = append(bookmarks, b.Bookmark)
+	}
+
+	highlights := []instapaper.Highlight{}
+	for _, part := range strings.FieldsFunc(r.PostFormValue("highlights"), func(r rune) bool { return r == ',' || r == '-' }) {
+		id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil {
+			continue
+		}
+		for _, h := range s.sortedHighlights(id) {
+			highlights = append(highlights, *h)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"user":       s.user(),
+		"bookmarks":  bookmarks,
+		"highlights": highlights,
+		"delete_ids": deleteIDs,
+	})
+}
+
+func (s *Server) validListFolder(folder string) bool {
+	switch folder {
+	case "unread", "archive", "starred":
+		return true
+	}
+	return s.userFolder(folder) != nil
+}
+
+func (s *Server) userFolder(v string) *instapaper.Folder {
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return nil
+	}
+	return s.folders[id]
+}
+
+// addBookmark implements bookmarks/add. Adding a URL that is already saved
+// updates and returns the existing bookmark, like the real service.
+func (s *Server) addBookmark(r *http.Request) ([]any, error) {
+	private := r.PostFormValue("is_private_from_source")
+	content := r.PostFormValue("content")
+	rawURL := strings.TrimSpace(r.PostFormValue("url"))
+	if private != "" {
+		if content == "" {
+			return nil, newAPIError(1245)
+		}
+	} else if u, err := url.Parse(rawURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, newAPIError(1240)
+	}
+	folder := "unread"
+	if v := r.PostFormValue("folder_id"); v != "" {
+		if s.userFolder(v) == nil {
+			return nil, newAPIError(1242)
+		}
+		folder = v
+	}
+	if r.PostFormValue("archived") == "1" {
+		folder = "archive"
+	}
+	var tags []instapaper.Tag
+	if v := r.PostFormValue("tags"); v != "" {
+		if err := json.Unmarshal([]byte(v), &tags); err != nil {
+			return nil, newAPIError(1250)
+		}
+		for i := range tags {
+			tags[i].ID = instapaper.Int64(s.tagID(tags[i].Name))
+		}
+	}
+
+	var b *Bookmark
+	if private == "" {
+		for _, existing := range s.bookmarks {
+			if existing.URL == rawURL {
+				b = existing
+				break
+			}
+		}
+	}
+	if b == nil {
+		b = &Bookmark{Bookmark: instapaper.Bookmark{Type: "bookmark", BookmarkID: instapaper.Int64(s.id()), URL: rawURL, Title: rawURL, PrivateSource: private}}
+		s.bookmarks[int64(b.BookmarkID)] = b
+	}
+	if v := r.PostFormValue("title"); v != "" {
+		b.Title = v
+	}
+	if v := r.PostFormValue("description"); v != "" {
+		b.Description = v
+	}
+	if tags != nil {
+		b.Tags = tags
+	}
+	if content != "" {
+		b.Text = content
+	}
+	b.Folder = folder
+	b.Time = instapaper.Int64(s.opts.Now().Unix())
+	s.touch(b)
+	return []any{b.Bookmark}, nil
+}
+
+func (s *Server) bookmarkParam(r *http.Request) (*Bookmark, error) {
+	id, err := strconv.ParseInt(r.PostFormValue("bookmark_id"), 10, 64)
+	if err != nil {
+		return nil, newAPIError(1241)
+	}
+	b, ok := s.bookmarks[id]
+	if !ok {
+		return nil, newAPIError(1241)
+	}
+	return b, nil
+}
+
+func (s *Server) mutate(change func(*Bookmark)) apiFunc {
+	return func(r *http.Request) ([]any, error) {
+		b, err := s.bookmarkParam(r)
+		if err != nil {
+			return nil, err
+		}
+		change(b)
+		s.touch(b)
+		return []any{b.Bookmark}, nil
+	}
+}
+
+func (s *Server) moveBookmark(r *http.Request) ([]any, error) {
+	b, err := s.bookmarkParam(r)
+	if err != nil {
+		return nil, err
+	}
+	folder := r.PostFormValue("folder_id")
+	if s.userFolder(folder) == nil {
+		return nil, newAPIError(1242)
+	}
+	b.Folder = folder
+	s.touch(b)
+	return []any{b.Bookmark}, nil
+}
+
+func (s *Server) updateReadProgress(r *http.Request) ([]any, error) {
+	b, err := s.bookmarkParam(r)
+	if err != nil {
+		return nil, err
+	}
+	progress, err := strconv.ParseFloat(r.PostFormValue("progress"), 64)
+	if err != nil || progress < 0 || progress > 1 {
+		return nil, newAPIError(1243)
+	}
+	ts, err := strconv.ParseInt(r.PostFormValue("progress_timestamp"), 10, 64)
+	if err != nil || ts <= 0 {
+		return nil, newAPIError(1244)
+	}
+	b.Progress = instapaper.Float64(progress)
+	b.ProgressTimestamp = instapaper.Int64(ts)
+	s.touch(b)
+	return []any{b.Bookmark}, nil
+}
+
+func (s *Server) deleteBookmark(r *http.Request) ([]any, error) {
+	b, err := s.bookmarkParam(r)
+	if err != nil {
+		return nil, err
+	}
+	id := int64(b.BookmarkID)
+	delete(s.bookmarks, id)
+	for _, h := range s.sortedHighlights(id) {
+		delete(s.highlights, int64(h.HighlightID))
+	}
+	return nil, nil
+}
+
+func (s *Server) getText(w http.ResponseWriter, r *http.Request) {
+	b, err := s.bookmarkParam(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	text := b.Text
+	if text == "" {
+		text = "<h1>" + html.EscapeString(b.Title) + "</h1>\n<p>" + html.EscapeString(b.Description) + "</p>\n"
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte("<!DOCTYPE html>\n<html><head><title>" + html.EscapeString(b.Title) + "</title></head><body>\n" + text + "</body></html>\n"))
+}
+
+func (s *Server) listFolders(*http.Request) ([]any, error) {
+	var out []any
+	for _, f := range s.sortedFolders() {
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+func (s *Server) addFolderHandler(r *http.Request) ([]any, error) {
+	title := strings.TrimSpace(r.PostFormValue("title"))
+	if title == "" {
+		return nil, &apiError{code: 1250, msg: "Invalid or missing title"}
+	}
+	for _, f := range s.folders {
+		if strings.EqualFold(f.Title, title) {
+			return nil, newAPIError(1251)
+		}
+	}
+	return []any{*s.addFolder(title)}, nil
+}
+
+// deleteFolder removes a user folder; its bookmarks move to the archive.
+func (s *Server) deleteFolder(r *http.Request) ([]any, error) {
+	v := r.PostFormValue("folder_id")
+	f := s.userFolder(v)
+	if f == nil {
+		return nil, newAPIError(1242)
+	}
+	delete(s.folders, int64(f.FolderID))
+	for _, b := range s.bookmarks {
+		if b.Folder == v {
+			b.Folder = "archive"
+			s.touch(b)
+		}
+	}
+	return nil, nil
+}
+
+func (s *Server) setFolderOrder(r *http.Request) ([]any, error) {
+	positions := map[int64]float64{}
+	for _, part := range strings.Split(r.PostFormValue("order"), ",") {
+		id, pos, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			return nil, newAPIError(1242)
+		}
+		f := s.userFolder(id)
+		p, err := strconv.ParseFloat(pos, 64)
+		if f == nil || err != nil {
+			return nil, newAPIError(1242)
+		}
+		positions[int64(f.FolderID)] = p
+	}
+	for id, p := range positions {
+		s.folders[id].Position = instapaper.Float64(p)
+	}
+	return s.listFolders(r)
+}
+
+func (s *Server) pathBookmark(r *http.Request) (*Bookmark, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return nil, newAPIError(1241)
+	}
+	b, ok := s.bookmarks[id]
+	if !ok {
+		return nil, newAPIError(1241)
+	}
+	return b, nil
+}
+
+func (s *Server) listHighlights(r *http.Request) ([]any, error) {
+	b, err := s.pathBookmark(r)
+	if err != nil {
+		return nil, err
+	}
+	var out []any
+	for _, h := range s.sortedHighlights(int64(b.BookmarkID)) {
+		out = append(out, *h)
+	}
+	return out, nil
+}
+
+func (s *Server) createHighlight(r *http.Request) ([]any, error) {
+	b, err := s.pathBookmark(r)
+	if err != nil {
+		return nil, err
+	}
+	text := r.PostFormValue("text")
+	if strings.TrimSpace(text) == "" {
+		return nil, newAPIError(1600)
+	}
+	id := int64(b.BookmarkID)
+	for _, h := range s.sortedHighlights(id) {
+		if h.Text == text {
+			return nil, newAPIError(1601)
+		}
+	}
+	position, _ := strconv.Atoi(r.PostFormValue("position"))
+	return []any{*s.addHighlight(id, text, position)}, nil
+}
+
+func (s *Server) deleteHighlight(r *http.Request) ([]any, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || s.highlights[id] == nil {
+		return nil, &apiError{code: 1241, msg: "Invalid or missing highlight_id"}
+	}
+	delete(s.highlights, id)
+	return nil, nil
+}
+
+func sha1Hex(b []byte) string {
+	sum := sha1.Sum(b)
+	return hex.EncodeToString(sum[:])
+}
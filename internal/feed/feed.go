@@ -0,0 +1,252 @@
+// Package feed renders a list of links as an Atom 1.0 or JSON Feed 1.1
+// document.
+package feed
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	FormatAtom     = "atom"
+	FormatJSONFeed = "jsonfeed"
+)
+
+// ParseFormat normalizes a feed format name.
+func ParseFormat(s string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "atom", "xml":
+		return FormatAtom, nil
+	case "jsonfeed", "json-feed", "json":
+		return FormatJSONFeed, nil
+	default:
+		return "", fmt.Errorf("invalid feed format %q (expected atom or jsonfeed)", s)
+	}
+}
+
+// ContentType returns the media type served for format.
+func ContentType(format string) string {
+	if format == FormatJSONFeed {
+		return "application/feed+json; charset=utf-8"
+	}
+	return "application/atom+xml; charset=utf-8"
+}
+
+// Item is one feed entry.
+type Item struct {
+	ID          string
+	URL         string
+	Title       string
+	Summary     string
+	ContentHTML string
+	Tags        []string
+	Published   time.Time
+	Updated     time.Time
+}
+
+// Feed is a feed document. ID must be a stable IRI; Updated defaults to the
+// newest item time.
+type Feed struct {
+	ID      string
+	Title   string
+	Author  string
+	HomeURL string
+	FeedURL string
+	Updated time.Time
+	Items   []Item
+}
+
+// Write renders f in format.
+func (f *Feed) Write(w io.Writer, format string) error {
+	if format == FormatJSONFeed {
+		return f.WriteJSONFeed(w)
+	}
+	return f.WriteAtom(w)
+}
+
+func (f *Feed) updated() time.Time {
+	updated := f.Updated
+	for _, it := range f.Items {
+		if t := it.updated(); t.After(updated) {
+			updated = t
+		}
+	}
+	if updated.IsZero() {
+		updated = time.Unix(0, 0)
+	}
+	return updated.UTC()
+}
+
+func (it Item) updated() time.Time {
+	if it.Updated.After(it.Published) {
+		return it.Updated
+	}
+	return it.Published
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      atomText       `xml:"title"`
+	Links      []atomLink     `xml:"link"`
+	Published  string         `xml:"published,omitempty"`
+	Updated    string         `xml:"updated"`
+	Summary    *atomText      `xml:"summary,omitempty"`
+	Content    *atomText      `xml:"content,omitempty"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomFeed struct {
+	XMLName   xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID        string      `xml:"id"`
+	Title     atomText    `xml:"title"`
+	Updated   string      `xml:"updated"`
+	Author    atomPerson  `xml:"author"`
+	Generator string      `xml:"generator"`
+	Links     []atomLink  `xml:"link"`
+	Entries   []atomEntry `xml:"entry"`
+}
+
+// WriteAtom renders f as an Atom 1.0 document. Content is sent as escaped
+// HTML (type="html").
+func (f *Feed) WriteAtom(w io.Writer) error {
+	doc := atomFeed{
+		ID:        f.ID,
+		Title:     atomText{Type: "text", Body: f.Title},
+		Updated:   f.updated().Format(time.RFC3339),
+		Author:    atomPerson{Name: nonEmpty(f.Author, "Instapaper")},
+		Generator: "instapaper-cli",
+	}
+	if f.FeedURL != "" {
+		doc.Links = append(doc.Links, atomLink{Rel: "self", Type: "application/atom+xml", Href: f.FeedURL})
+	}
+	if f.HomeURL != "" {
+		doc.Links = append(doc.Links, atomLink{Rel: "alternate", Type: "text/html", Href: f.HomeURL})
+	}
+	for _, it := range f.Items {
+		entry := atomEntry{
+			ID:      it.ID,
+			Title:   atomText{Type: "text", Body: nonEmpty(it.Title, it.URL)},
+			Updated: it.updated().UTC().Format(time.RFC3339),
+		}
+		if it.URL != "" {
+			entry.Links = []atomLink{{Rel: "alternate", Type: "text/html", Href: it.URL}}
+		}
+		if !it.Published.IsZero() {
+			entry.Published = it.Published.UTC().Format(time.RFC3339)
+		}
+		if it.Summary != "" {
+			entry.Summary = &atomText{Type: "text", Body: it.Summary}
+		}
+		if it.ContentHTML != "" {
+			entry.Content = &atomText{Type: "html", Body: it.ContentHTML}
+		}
+		for _, tag := range it.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type jsonAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonItem struct {
+	ID            string   `json:"id"`
+	URL           string   `json:"url,omitempty"`
+	Title         string   `json:"title,omitempty"`
+	ContentHTML   string   `json:"content_html,omitempty"`
+	ContentText   string   `json:"content_text,omitempty"`
+	Summary       string   `json:"summary,omitempty"`
+	DatePublished string   `json:"date_published,omitempty"`
+	DateModified  string   `json:"date_modified,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+}
+
+type jsonFeed struct {
+	Version     string       `json:"version"`
+	Title       string       `json:"title"`
+	HomePageURL string       `json:"home_page_url,omitempty"`
+	FeedURL     string       `json:"feed_url,omitempty"`
+	Authors     []jsonAuthor `json:"authors,omitempty"`
+	Items       []jsonItem   `json:"items"`
+}
+
+// WriteJSONFeed renders f as a JSON Feed 1.1 document. Items without content
+// fall back to content_text (the summary, or the URL), which the spec requires.
+func (f *Feed) WriteJSONFeed(w io.Writer) error {
+	doc := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       f.Title,
+		HomePageURL: f.HomeURL,
+		FeedURL:     f.FeedURL,
+		Authors:     []jsonAuthor{{Name: nonEmpty(f.Author, "Instapaper")}},
+		Items:       []jsonItem{},
+	}
+	for _, it := range f.Items {
+		item := jsonItem{
+			ID:          it.ID,
+			URL:         it.URL,
+			Title:       it.Title,
+			ContentHTML: it.ContentHTML,
+			Summary:     it.Summary,
+			Tags:        it.Tags,
+		}
+		if item.ContentHTML == "" {
+			item.ContentText = nonEmpty(it.Summary, it.URL)
+		}
+		if !it.Published.IsZero() {
+			item.DatePublished = it.Published.UTC().Format(time.RFC3339)
+		}
+		if it.Updated.After(it.Published) {
+			item.DateModified = it.Updated.UTC().Format(time.RFC3339)
+		}
+		doc.Items = append(doc.Items, item)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+func nonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
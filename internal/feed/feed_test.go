@@ -0,0 +1,89 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sampleFeed() *Feed {
+	return &Feed{
+		ID:      "urn:instapaper-cli:feed:starred",
+		Title:   "Recommended reads",
+		FeedURL: "http://127.0.0.1:8080/",
+		Items: []Item{
+			{
+				ID:          "urn:instapaper:bookmark:1",
+				URL:         "https://example.com/a?x=1&y=2",
+				Title:       "A <b>bold</b> claim",
+				Summary:     "short",
+				ContentHTML: "<p>body &amp; more</p>",
+				Tags:        []string{"go"},
+				Published:   time.Unix(1700000000, 0),
+				Updated:     time.Unix(1700000500, 0),
+			},
+			{ID: "urn:instapaper:bookmark:2", URL: "https://example.com/b", Published: time.Unix(1600000000, 0)},
+		},
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for in, want := range map[string]string{"": FormatAtom, "Atom": FormatAtom, "jsonfeed": FormatJSONFeed, "json": FormatJSONFeed} {
+		if got, err := ParseFormat(in); err != nil || got != want {
+			t.Fatalf("ParseFormat(%q)=%q,%v", in, got, err)
+		}
+	}
+	if _, err := ParseFormat("rss"); err == nil {
+		t.Fatalf("expected error for rss")
+	}
+}
+
+func TestWriteAtom(t *testing.T) {
+	var buf bytes.Buffer
+	if err := sampleFeed().WriteAtom(&buf); err != nil {
+		t.Fatalf("WriteAtom: %v", err)
+	}
+	var doc atomFeed
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("atom is not well-formed: %v\n%s", err, buf.String())
+	}
+	if doc.Updated != "2023-11-14T22:21:40Z" || doc.Author.Name != "Instapaper" || len(doc.Entries) != 2 {
+		t.Fatalf("unexpected feed: %+v", doc)
+	}
+	first := doc.Entries[0]
+	if first.Title.Body != "A <b>bold</b> claim" || first.Content.Type != "html" || first.Content.Body != "<p>body &amp; more</p>" {
+		t.Fatalf("unexpected entry: %+v", first)
+	}
+	if first.Links[0].Href != "https://example.com/a?x=1&y=2" || first.Categories[0].Term != "go" {
+		t.Fatalf("unexpected entry links/categories: %+v", first)
+	}
+	if second := doc.Entries[1]; second.Title.Body != "https://example.com/b" || second.Updated != "2020-09-13T12:26:40Z" {
+		t.Fatalf("unexpected fallback entry: %+v", second)
+	}
+	if !strings.Contains(buf.String(), `<feed xmlns="http://www.w3.org/2005/Atom">`) {
+		t.Fatalf("missing atom namespace:\n%s", buf.String())
+	}
+}
+
+func TestWriteJSONFeed(t *testing.T) {
+	var buf bytes.Buffer
+	if err := sampleFeed().WriteJSONFeed(&buf); err != nil {
+		t.Fatalf("WriteJSONFeed: %v", err)
+	}
+	var doc jsonFeed
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if doc.Version != "https://jsonfeed.org/version/1.1" || len(doc.Items) != 2 {
+		t.Fatalf("unexpected feed: %+v", doc)
+	}
+	if doc.Items[0].ContentHTML == "" || doc.Items[0].DateModified != "2023-11-14T22:21:40Z" {
+		t.Fatalf("unexpected first item: %+v", doc.Items[0])
+	}
+	if doc.Items[1].ContentText != "https://example.com/b" || doc.Items[1].DateModified != "" {
+		t.Fatalf("unexpected second item: %+v", doc.Items[1])
+	}
+}
@@ -0,0 +1,616 @@
+// Package filter implements the --select expression language used to filter
+// bookmarks client-side.
+//
+// An expression combines comparisons with && (or a comma), ||, ! and
+// parentheses:
+//
+//	starred=1, tag~news
+//	(host = "nytimes.com" || host = "ft.com") && progress < 0.5
+//	time > now-7d && !tags
+//	tag in (go, rust) && title =~ "(?i)generics?"
+//
+// Operators are =, !=, ~ (contains), !~, =~ (regular expression), <, <=, >,
+// >= and in (...). A bare field is a presence check (tags, title, ...).
+// Unquoted values run to the next ",", ")", "&&" or "||".
+package filter
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+)
+
+// now is the reference time for relative dates and age; tests replace it.
+var now = time.Now
+
+// Expr is a parsed expression. A nil *Expr matches everything.
+type Expr struct {
+	root node
+}
+
+// Parse parses an expression. An empty expression returns nil, nil.
+func Parse(src string) (*Expr, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, nil
+	}
+	p := &parser{src: src, now: now()}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q", p.src[p.pos:])
+	}
+	return &Expr{root: n}, nil
+}
+
+// Match reports whether b satisfies the expression.
+func (e *Expr) Match(b instapaper.Bookmark) bool {
+	if e == nil {
+		return true
+	}
+	return e.root.match(b)
+}
+
+// Filter returns the bookmarks that match, in order.
+func (e *Expr) Filter(bookmarks []instapaper.Bookmark) []instapaper.Bookmark {
+	if e == nil {
+		return bookmarks
+	}
+	out := make([]instapaper.Bookmark, 0, len(bookmarks))
+	for _, b := range bookmarks {
+		if e.root.match(b) {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+type node interface {
+	match(b instapaper.Bookmark) bool
+}
+
+type andNode struct{ left, right node }
+type orNode struct{ left, right node }
+type notNode struct{ inner node }
+
+func (n andNode) match(b instapaper.Bookmark) bool { return n.left.match(b) && n.right.match(b) }
+func (n orNode) match(b instapaper.Bookmark) bool  { return n.left.match(b) || n.right.match(b) }
+func (n notNode) match(b instapaper.Bookmark) bool { return !n.inner.match(b) }
+
+type kind int
+
+const (
+	kindInt kind = iota
+	kindFloat
+	kindBool
+	kindTime
+	kindAge
+	kindString
+	kindTags
+)
+
+// fields maps every accepted name (including aliases) to its canonical name.
+var fields = map[string]string{
+	"id": "bookmark_id", "bookmark": "bookmark_id", "bookmarkid": "bookmark_id", "bookmark_id": "bookmark_id",
+	"time":        "time",
+	"progress_ts": "progress_timestamp", "progress_timestamp": "progress_timestamp",
+	"progress": "progress",
+	"star":     "starred", "starred": "starred",
+	"age":   "age",
+	"title": "title", "url": "url", "description": "description",
+	"host": "host", "domain": "host",
+	"tag": "tags", "tags": "tags",
+}
+
+var fieldKinds = map[string]kind{
+	"bookmark_id":        kindInt,
+	"time":               kindTime,
+	"progress_timestamp": kindTime,
+	"progress":           kindFloat,
+	"starred":            kindBool,
+	"age":                kindAge,
+	"title":              kindString,
+	"url":                kindString,
+	"description":        kindString,
+	"host":               kindString,
+	"tags":               kindTags,
+}
+
+// compareNode is one field comparison with its value(s) parsed up front.
+type compareNode struct {
+	field string
+	kind  kind
+	op    string
+	nums  []float64 // int, float, bool (0/1), time (unix), age (seconds)
+	strs  []string  // lower-cased
+	re    *regexp.Regexp
+	now   time.Time
+}
+
+// presenceNode is a bare field: non-empty strings and tags, true, non-zero.
+type presenceNode struct {
+	field string
+	now   time.Time
+}
+
+func (n presenceNode) match(b instapaper.Bookmark) bool {
+	switch n.field {
+	case "tags":
+		return len(b.Tags) > 0
+	case "starred":
+		return bool(b.Starred)
+	default:
+		num, str, _ := value(b, n.field, n.now)
+		return num != 0 || str != ""
+	}
+}
+
+func (n compareNode) match(b instapaper.Bookmark) bool {
+	if n.kind == kindTags {
+		return n.matchTags(b.Tags)
+	}
+	num, str, ok := value(b, n.field, n.now)
+	if !ok {
+		return false
+	}
+	if n.kind == kindString {
+		return n.matchString(str)
+	}
+	switch n.op {
+	case "=":
+		return num == n.nums[0]
+	case "!=":
+		return num != n.nums[0]
+	case "<":
+		return num < n.nums[0]
+	case "<=":
+		return num <= n.nums[0]
+	case ">":
+		return num > n.nums[0]
+	case ">=":
+		return num >= n.nums[0]
+	case "in":
+		for _, v := range n.nums {
+			if num == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (n compareNode) matchString(s string) bool {
+	lower := strings.ToLower(s)
+	switch n.op {
+	case "=":
+		if n.field == "host" {
+			return hostMatch(lower, n.strs[0])
+		}
+		return lower == n.strs[0]
+	case "!=":
+		if n.field == "host" {
+			return !hostMatch(lower, n.strs[0])
+		}
+		return lower != n.strs[0]
+	case "~":
+		return strings.Contains(lower, n.strs[0])
+	case "!~":
+		return !strings.Contains(lower, n.strs[0])
+	case "=~":
+		return n.re.MatchString(s)
+	case "in":
+		for _, v := range n.strs {
+			if lower == v || (n.field == "host" && hostMatch(lower, v)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchTags is true when any tag matches; != and !~ are true when no tag
+// matches (so they also hold for untagged bookmarks).
+func (n compareNode) matchTags(tags []instapaper.Tag) bool {
+	positive := n
+	switch n.op {
+	case "!=":
+		positive.op = "="
+	case "!~":
+		positive.op = "~"
+	}
+	found := false
+	for _, t := range tags {
+		if positive.matchString(t.Name) {
+			found = true
+			break
+		}
+	}
+	if positive.op != n.op {
+		return !found
+	}
+	return found
+}
+
+// hostMatch is true for the domain itself and its subdomains.
+func hostMatch(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// value returns the numeric or string value of field for b; ok is false
+// when the field is unset (age of a bookmark without a save time).
+func value(b instapaper.Bookmark, field string, ref time.Time) (float64, string, bool) {
+	switch field {
+	case "bookmark_id":
+		return float64(b.BookmarkID), "", true
+	case "time":
+		return float64(b.Time), "", true
+	case "progress_timestamp":
+		return float64(b.ProgressTimestamp), "", true
+	case "progress":
+		return float64(b.Progress), "", true
+	case "starred":
+		if bool(b.Starred) {
+			return 1, "", true
+		}
+		return 0, "", true
+	case "age":
+		if b.Time <= 0 {
+			return 0, "", false
+		}
+		return ref.Sub(time.Unix(int64(b.Time), 0)).Seconds(), "", true
+	case "title":
+		return 0, b.Title, true
+	case "url":
+		return 0, b.URL, true
+	case "description":
+		return 0, b.Description, true
+	case "host":
+		return 0, Host(b.URL), true
+	}
+	return 0, "", false
+}
+
+// Host returns the lower-cased host of rawURL without a leading "www.".
+func Host(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+type parser struct {
+	src string
+	pos int
+	now time.Time
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid select expression at %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t' || p.src[p.pos] == '\n') {
+		p.pos++
+	}
+}
+
+func (p *parser) consume(tokens ...string) string {
+	p.skipSpace()
+	for _, t := range tokens {
+		if strings.HasPrefix(p.src[p.pos:], t) {
+			p.pos += len(t)
+			return t
+		}
+	}
+	return ""
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.consume("||") != "" {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.consume("&&", ",") != "" {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	p.skipSpace()
+	if strings.HasPrefix(p.src[p.pos:], "!") && !strings.HasPrefix(p.src[p.pos:], "!=") && !strings.HasPrefix(p.src[p.pos:], "!~") {
+		p.pos++
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner}, nil
+	}
+	if p.consume("(") != "" {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.consume(")") == "" {
+			return nil, p.errorf("missing )")
+		}
+		return inner, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.src) && isIdentByte(p.src[p.pos]) {
+		p.pos++
+	}
+	if start == p.pos {
+		if p.pos >= len(p.src) {
+			return nil, p.errorf("expected a field")
+		}
+		return nil, p.errorf("expected a field, found %q", p.src[p.pos:])
+	}
+	name := strings.ToLower(p.src[start:p.pos])
+	field, ok := fields[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown select field: %s", name)
+	}
+	k := fieldKinds[field]
+	op := p.consume("!=", "!~", "=~", "<=", ">=", "=", "~", "<", ">")
+	if op == "" {
+		p.skipSpace()
+		if strings.HasPrefix(strings.ToLower(p.src[p.pos:]), "in") && p.pos+2 <= len(p.src) {
+			rest := strings.TrimLeft(p.src[p.pos+2:], " \t")
+			if strings.HasPrefix(rest, "(") {
+				p.pos += 2
+				op = "in"
+			}
+		}
+	}
+	if op == "" {
+		if p.atTermEnd() {
+			return presenceNode{field: field, now: p.now}, nil
+		}
+		return nil, p.errorf("expected an operator after %s", name)
+	}
+	if !opAllowed(k, op) {
+		return nil, fmt.Errorf("unsupported operator for %s: %s", field, op)
+	}
+	var raw []string
+	if op == "in" {
+		p.consume("(")
+		for {
+			v, err := p.readValue()
+			if err != nil {
+				return nil, err
+			}
+			raw = append(raw, v)
+			if p.consume(",") != "" {
+				continue
+			}
+			if p.consume(")") != "" {
+				break
+			}
+			return nil, p.errorf("expected , or ) in list")
+		}
+	} else {
+		v, err := p.readValue()
+		if err != nil {
+			return nil, err
+		}
+		raw = []string{v}
+	}
+	n := compareNode{field: field, kind: k, op: op, now: p.now}
+	for _, v := range raw {
+		if err := n.addValue(v, p.now); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+func (p *parser) atTermEnd() bool {
+	p.skipSpace()
+	rest := p.src[p.pos:]
+	return rest == "" || strings.HasPrefix(rest, ",") || strings.HasPrefix(rest, ")") || strings.HasPrefix(rest, "&&") || strings.HasPrefix(rest, "||")
+}
+
+// readValue reads a quoted value, or an unquoted one up to the next
+// separator; parentheses inside a value must balance.
+func (p *parser) readValue() (string, error) {
+	p.skipSpace()
+	if p.pos < len(p.src) && (p.src[p.pos] == '"' || p.src[p.pos] == '\'') {
+		quote := p.src[p.pos]
+		var b strings.Builder
+		for i := p.pos + 1; i < len(p.src); i++ {
+			c := p.src[i]
+			if c == '\\' && i+1 < len(p.src) && (p.src[i+1] == quote || p.src[i+1] == '\\') {
+				b.WriteByte(p.src[i+1])
+				i++
+				continue
+			}
+			if c == quote {
+				p.pos = i + 1
+				return b.String(), nil
+			}
+			b.WriteByte(c)
+		}
+		return "", p.errorf("unterminated string")
+	}
+	start := p.pos
+	depth := 0
+	for p.pos < len(p.src) {
+		rest := p.src[p.pos:]
+		if strings.HasPrefix(rest, "&&") || strings.HasPrefix(rest, "||") || rest[0] == ',' {
+			break
+		}
+		if rest[0] == '(' {
+			depth++
+		} else if rest[0] == ')' {
+			if depth == 0 {
+				break
+			}
+			depth--
+		}
+		p.pos++
+	}
+	v := strings.TrimSpace(p.src[start:p.pos])
+	if v == "" {
+		return "", p.errorf("missing value")
+	}
+	return v, nil
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func opAllowed(k kind, op string) bool {
+	switch k {
+	case kindString, kindTags:
+		switch op {
+		case "=", "!=", "~", "!~", "=~", "in":
+			return true
+		}
+	case kindBool:
+		return op == "=" || op == "!="
+	default:
+		switch op {
+		case "=", "!=", "<", "<=", ">", ">=", "in":
+			return true
+		}
+	}
+	return false
+}
+
+func (n *compareNode) addValue(v string, ref time.Time) error {
+	switch n.kind {
+	case kindString, kindTags:
+		if n.op == "=~" {
+			re, err := regexp.Compile(v)
+			if err != nil {
+				return fmt.Errorf("invalid regular expression for %s: %v", n.field, err)
+			}
+			n.re = re
+			return nil
+		}
+		n.strs = append(n.strs, strings.ToLower(v))
+		return nil
+	case kindInt:
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid numeric value for %s: %s", n.field, v)
+		}
+		n.nums = append(n.nums, float64(i))
+	case kindFloat:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid numeric value for %s: %s", n.field, v)
+		}
+		n.nums = append(n.nums, f)
+	case kindBool:
+		switch strings.ToLower(v) {
+		case "1", "true", "yes", "y", "on":
+			n.nums = append(n.nums, 1)
+		case "0", "false", "no", "n", "off":
+			n.nums = append(n.nums, 0)
+		default:
+			return fmt.Errorf("invalid boolean value for %s: %s", n.field, v)
+		}
+	case kindTime:
+		t, err := ParseTime(v, ref)
+		if err != nil {
+			return fmt.Errorf("invalid time for %s: %s (unix, RFC 3339, YYYY-MM-DD or now-7d)", n.field, v)
+		}
+		n.nums = append(n.nums, float64(t.Unix()))
+	case kindAge:
+		d, err := ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration for age: %s (e.g. 30d, 2w, 12h)", v)
+		}
+		n.nums = append(n.nums, d.Seconds())
+	}
+	return nil
+}
+
+// ParseTime parses unix seconds, RFC 3339, a YYYY-MM-DD date (UTC) or a time
+// relative to ref: now, now-7d, now+12h.
+func ParseTime(s string, ref time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	lower := strings.ToLower(s)
+	if strings.HasPrefix(lower, "now") {
+		rest := strings.TrimSpace(lower[3:])
+		if rest == "" {
+			return ref, nil
+		}
+		sign := rest[0]
+		if sign != '-' && sign != '+' {
+			return time.Time{}, fmt.Errorf("invalid relative time: %s", s)
+		}
+		d, err := ParseDuration(strings.TrimSpace(rest[1:]))
+		if err != nil {
+			return time.Time{}, err
+		}
+		if sign == '-' {
+			d = -d
+		}
+		return ref.Add(d), nil
+	}
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(v, 0), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+// ParseDuration parses a Go duration that also accepts days and weeks
+// (30d, 2w, 1.5d).
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if n := len(s); n > 1 && (s[n-1] == 'd' || s[n-1] == 'w') {
+		v, err := strconv.ParseFloat(s[:n-1], 64)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("invalid duration: %s", s)
+		}
+		unit := 24 * time.Hour
+		if s[n-1] == 'w' {
+			unit *= 7
+		}
+		return time.Duration(v * float64(unit)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration: %s", s)
+	}
+	return d, nil
+}
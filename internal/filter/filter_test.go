@@ -0,0 +1,110 @@
+package filter
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+)
+
+func sampleBookmarks() []instapaper.Bookmark {
+	day := int64(24 * 60 * 60)
+	ref := int64(1700000000)
+	return []instapaper.Bookmark{
+		{BookmarkID: 1, URL: "https://www.nytimes.com/a", Title: "Go generics", Progress: 0.2, Time: instapaper.Int64(ref - 2*day), Tags: []instapaper.Tag{{Name: "go"}}},
+		{BookmarkID: 2, URL: "https://cooking.nytimes.com/b", Title: "Soup (winter)", Progress: 0.9, Time: instapaper.Int64(ref - 30*day), Starred: true},
+		{BookmarkID: 3, URL: "https://ft.com/c?x=1&y=2", Title: "Markets", Progress: 0.5, Time: instapaper.Int64(ref - 10*day), Tags: []instapaper.Tag{{Name: "rust"}, {Name: "news"}}},
+		{BookmarkID: 4, URL: "https://notnytimes.com/d", Title: "Other", Description: "long read"},
+	}
+}
+
+func ids(bookmarks []instapaper.Bookmark) string {
+	var parts []string
+	for _, b := range bookmarks {
+		parts = append(parts, string(rune('0'+b.BookmarkID)))
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestFilter(t *testing.T) {
+	now = func() time.Time { return time.Unix(1700000000, 0) }
+	defer func() { now = time.Now }()
+
+	cases := map[string]string{
+		"":                                    "1,2,3,4",
+		"starred=1":                           "2",
+		"starred=1, progress>0.5":             "2",
+		"host=nytimes.com":                    "1,2",
+		"host = nytimes.com || host = ft.com": "1,2,3",
+		"(host=nytimes.com || host=ft.com) && progress < 0.5": "1",
+		"progress >= 0.2 && progress <= 0.5":                  "1,3",
+		"tags":                                                "1,3",
+		"!tags":                                               "2,4",
+		"tag in (go, rust)":                                   "1,3",
+		"tag!=news":                                           "1,2,4",
+		"bookmark_id in (2, 4)":                               "2,4",
+		`title =~ "(?i)^go\b"`:                                "1",
+		"title~soup (winter)":                                 "2",
+		"url~x=1&y=2":                                         "3",
+		"title~o W":                                           "",
+		"time > now-7d":                                       "1",
+		"age>7d && age<20d":                                   "3",
+		"time>=2023-10-01":                                    "1,2,3",
+		"!(starred || progress>0.4)":                          "1,4",
+		`description="long read"`:                             "4",
+		"description":                                         "4",
+	}
+	for expr, want := range cases {
+		e, err := Parse(expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", expr, err)
+		}
+		if got := ids(e.Filter(sampleBookmarks())); got != want {
+			t.Errorf("%q matched %q, want %q", expr, got, want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"age>soon",
+		"title>3",
+		"progress~1",
+		"nope=1",
+		"starred>1",
+		"(starred=1",
+		"title=~(",
+		`title="open`,
+		"time>yesterday",
+		"title=",
+		"starred=1 ||",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q): expected error", expr)
+		}
+	}
+}
+
+func TestParseTimeAndDuration(t *testing.T) {
+	ref := time.Unix(1700000000, 0)
+	for in, want := range map[string]int64{
+		"now":                  1700000000,
+		"now-1d":               1700000000 - 86400,
+		"now+2h":               1700000000 + 7200,
+		"1600000000":           1600000000,
+		"2023-11-14":           1699920000,
+		"2023-11-14T22:13:20Z": 1700000000,
+	} {
+		got, err := ParseTime(in, ref)
+		if err != nil || got.Unix() != want {
+			t.Errorf("ParseTime(%q)=%v,%v want %d", in, got.Unix(), err, want)
+		}
+	}
+	if d, err := ParseDuration("2w"); err != nil || d != 14*24*time.Hour {
+		t.Errorf("ParseDuration(2w)=%v,%v", d, err)
+	}
+	if Host("https://WWW.Example.com:8080/x") != "example.com" {
+		t.Errorf("Host did not normalize")
+	}
+}
@@ -0,0 +1,395 @@
+// Package gateway serves a small read-only JSON API over HTTP on top of a
+// Backend, with optional bearer-token auth and an in-memory response cache.
+//
+//	GET /bookmarks?folder=&tag=&select=&limit=
+//	GET /bookmarks/{id}/text?format=html|markdown|text
+//	GET /folders
+//	GET /highlights?bookmark_id= | ?folder=
+package gateway
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+)
+
+// MaxCacheEntries bounds the response cache; the entries closest to expiry
+// are dropped first.
+const MaxCacheEntries = 1000
+
+// BookmarkQuery holds the query parameters of GET /bookmarks.
+type BookmarkQuery struct {
+	Folder string
+	Tag    string
+	Select string
+	Limit  int
+}
+
+// HighlightQuery holds the query parameters of GET /highlights: one
+// bookmark, or every bookmark in a folder.
+type HighlightQuery struct {
+	BookmarkID int64
+	Folder     string
+}
+
+// Backend answers the API's reads. Errors wrapped with BadRequest are
+// reported as 400; others go through Server.Classify.
+type Backend interface {
+	Bookmarks(ctx context.Context, q BookmarkQuery) ([]instapaper.Bookmark, error)
+	Text(ctx context.Context, bookmarkID int64, format string) ([]byte, error)
+	Folders(ctx context.Context) ([]instapaper.Folder, error)
+	Highlights(ctx context.Context, q HighlightQuery) ([]instapaper.Highlight, error)
+}
+
+type badRequest struct{ err error }
+
+func (e badRequest) Error() string { return e.err.Error() }
+func (e badRequest) Unwrap() error { return e.err }
+
+// BadRequest marks err as the client's fault (HTTP 400).
+func BadRequest(err error) error {
+	if err == nil {
+		return nil
+	}
+	return badRequest{err}
+}
+
+// Server is the HTTP handler.
+type Server struct {
+	Backend Backend
+	// Addr is the listen address. Requests must name it, localhost or a
+	// loopback IP in their Host header, so a web page cannot reach the API
+	// by rebinding its own domain to this machine. When Addr has no host (or
+	// an unspecified one) any IP literal is accepted as well.
+	Addr string
+	// Token, when set, is required as "Authorization: Bearer <token>".
+	Token string
+	// TTL is how long successful responses are cached (0 disables).
+	TTL time.Duration
+	// Classify maps a backend error to an HTTP status and error code; nil
+	// reports every error as 502 upstream_error.
+	Classify func(error) (int, string)
+	// Logf, when set, receives one line per request.
+	Logf func(format string, args ...any)
+
+	once  sync.Once
+	mux   *http.ServeMux
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	contentType string
+	body        []byte
+	expires     time.Time
+}
+
+var textTypes = map[string]string{
+	"html":     "text/html; charset=utf-8",
+	"markdown": "text/markdown; charset=utf-8",
+	"text":     "text/plain; charset=utf-8",
+}
+
+func (s *Server) routes() {
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		s.writeJSON(w, http.StatusOK, map[string]any{"endpoints": []string{
+			"GET /bookmarks?folder=&tag=&select=&limit=",
+			"GET /bookmarks/{id}/text?format=html|markdown|text",
+			"GET /folders",
+			"GET /highlights?bookmark_id=|folder=",
+		}})
+	})
+	s.mux.HandleFunc("GET /bookmarks", s.cached(s.bookmarks))
+	s.mux.HandleFunc("GET /bookmarks/{id}/text", s.cached(s.text))
+	s.mux.HandleFunc("GET /folders", s.cached(s.folders))
+	s.mux.HandleFunc("GET /highlights", s.cached(s.highlights))
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		s.writeError(w, http.StatusNotFound, "not_found", "no such endpoint: "+r.URL.Path)
+	})
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.once.Do(s.routes)
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	defer func() {
+		if s.Logf != nil {
+			s.Logf("%s %s %d cache=%s %s", r.Method, r.URL.RequestURI(), rec.status, rec.Header().Get("X-Cache"), time.Since(start).Round(time.Millisecond))
+		}
+	}()
+	if !s.allowedHost(r.Host) {
+		s.writeError(rec, http.StatusMisdirectedRequest, "invalid_host", "host not allowed: "+r.Host)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		rec.Header().Set("Allow", "GET, HEAD")
+		s.writeError(rec, http.StatusMethodNotAllowed, "method_not_allowed", "this API is read-only")
+		return
+	}
+	if s.Token != "" && !s.authorized(r) {
+		rec.Header().Set("WWW-Authenticate", `Bearer realm="instapaper-cli"`)
+		s.writeError(rec, http.StatusUnauthorized, "unauthorized", "missing or invalid bearer token")
+		return
+	}
+	s.mux.ServeHTTP(rec, r)
+}
+
+func (s *Server) allowedHost(hostport string) bool {
+	return AllowedHost(s.Addr, hostport)
+}
+
+// AllowedHost reports whether a request Host header may reach a server
+// listening on addr: localhost, a loopback IP or addr's own host, plus any IP
+// literal when addr listens on every interface. See Server.Addr.
+func AllowedHost(addr, hostport string) bool {
+	host := stripPort(hostport)
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip != nil && ip.IsLoopback() {
+		return true
+	}
+	if addr == "" {
+		return false
+	}
+	listen := stripPort(addr)
+	if host == listen {
+		return true
+	}
+	if listenIP := net.ParseIP(listen); listen == "" || (listenIP != nil && listenIP.IsUnspecified()) {
+		return ip != nil
+	}
+	return false
+}
+
+// stripPort returns the lower-cased host of a host[:port] value, without
+// IPv6 brackets or a trailing dot.
+func stripPort(hostport string) string {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.TrimPrefix(strings.TrimSuffix(host, "]"), "[")
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	return BearerAuthorized(r, s.Token)
+}
+
+// BearerAuthorized reports whether r carries "Authorization: Bearer <token>".
+func BearerAuthorized(r *http.Request, token string) bool {
+	auth := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(auth[len(prefix):])), []byte(token)) == 1
+}
+
+// result is a successful response body and its content type.
+type result struct {
+	contentType string
+	body        []byte
+}
+
+// cached serves h through the cache, keyed by path and normalised query.
+func (s *Server) cached(h func(*http.Request) (result, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Path + "?" + r.URL.Query().Encode()
+		if e, ok := s.lookup(key); ok {
+			w.Header().Set("X-Cache", "hit")
+			s.write(w, e.contentType, e.body)
+			return
+		}
+		res, err := h(r)
+		if err != nil {
+			status, code := http.StatusBadGateway, "upstream_error"
+			var bad badRequest
+			if errors.As(err, &bad) {
+				status, code = http.StatusBadRequest, "invalid_request"
+			} else if s.Classify != nil {
+				status, code = s.Classify(err)
+			}
+			s.writeError(w, status, code, err.Error())
+			return
+		}
+		s.store(key, res)
+		w.Header().Set("X-Cache", "miss")
+		s.write(w, res.contentType, res.body)
+	}
+}
+
+func (s *Server) lookup(key string) (cacheEntry, bool) {
+	if s.TTL <= 0 {
+		return cacheEntry{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.cache[key]
+	if !ok || time.Now().After(e.expires) {
+		return cacheEntry{}, false
+	}
+	return e, true
+}
+
+func (s *Server) store(key string, res result) {
+	if s.TTL <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.cache == nil {
+		s.cache = map[string]cacheEntry{}
+	}
+	for k, e := range s.cache {
+		if now.After(e.expires) {
+			delete(s.cache, k)
+		}
+	}
+	for len(s.cache) >= MaxCacheEntries {
+		oldest := ""
+		for k, e := range s.cache {
+			if oldest == "" || e.expires.Before(s.cache[oldest].expires) {
+				oldest = k
+			}
+		}
+		delete(s.cache, oldest)
+	}
+	s.cache[key] = cacheEntry{contentType: res.contentType, body: res.body, expires: now.Add(s.TTL)}
+}
+
+func (s *Server) bookmarks(r *http.Request) (result, error) {
+	q := r.URL.Query()
+	bq := BookmarkQuery{Folder: q.Get("folder"), Tag: q.Get("tag"), Select: q.Get("select"), Limit: 25}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 500 {
+			return result{}, BadRequest(errors.New("limit must be 0..500"))
+		}
+		bq.Limit = n
+	}
+	if bq.Folder == "" {
+		bq.Folder = "unread"
+	}
+	bookmarks, err := s.Backend.Bookmarks(r.Context(), bq)
+	if err != nil {
+		return result{}, err
+	}
+	if bookmarks == nil {
+		bookmarks = []instapaper.Bookmark{}
+	}
+	return jsonResult(bookmarks)
+}
+
+func (s *Server) text(r *http.Request) (result, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return result{}, BadRequest(errors.New("invalid bookmark id"))
+	}
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = "html"
+	}
+	contentType, ok := textTypes[format]
+	if !ok {
+		return result{}, BadRequest(errors.New("format must be html, markdown or text"))
+	}
+	body, err := s.Backend.Text(r.Context(), id, format)
+	if err != nil {
+		return result{}, err
+	}
+	return result{contentType: contentType, body: body}, nil
+}
+
+func (s *Server) folders(r *http.Request) (result, error) {
+	folders, err := s.Backend.Folders(r.Context())
+	if err != nil {
+		return result{}, err
+	}
+	if folders == nil {
+		folders = []instapaper.Folder{}
+	}
+	return jsonResult(folders)
+}
+
+func (s *Server) highlights(r *http.Request) (result, error) {
+	q := r.URL.Query()
+	hq := HighlightQuery{Folder: q.Get("folder")}
+	if v := q.Get("bookmark_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			return result{}, BadRequest(errors.New("invalid bookmark_id"))
+		}
+		if hq.Folder != "" {
+			return result{}, BadRequest(errors.New("use only one of bookmark_id or folder"))
+		}
+		hq.BookmarkID = id
+	} else if hq.Folder == "" {
+		hq.Folder = "unread"
+	}
+	highlights, err := s.Backend.Highlights(r.Context(), hq)
+	if err != nil {
+		return result{}, err
+	}
+	if highlights == nil {
+		highlights = []instapaper.Highlight{}
+	}
+	return jsonResult(highlights)
+}
+
+func jsonResult(v any) (result, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return result{}, err
+	}
+	return result{contentType: "application/json", body: append(b, '\n')}, nil
+}
+
+// write sends a successful response. Article HTML is untrusted, so every
+// body is sandboxed and its content type is not sniffed: a browser opening
+// /bookmarks/{id}/text runs no scripts with the gateway's origin.
+func (s *Server) write(w http.ResponseWriter, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if s.TTL > 0 {
+		w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(s.TTL.Seconds())))
+	} else {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	_, _ = w.Write(body)
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, v any) {
+	b, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(append(b, '\n'))
+}
+
+func (s *Server) writeError(w http.ResponseWriter, status int, code, msg string) {
+	s.writeJSON(w, status, map[string]any{"error": map[string]any{"code": code, "message": msg}})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,168 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+)
+
+type fakeBackend struct {
+	calls int
+	last  BookmarkQuery
+}
+
+func (f *fakeBackend) Bookmarks(_ context.Context, q BookmarkQuery) ([]instapaper.Bookmark, error) {
+	f.calls++
+	f.last = q
+	if q.Select == "bad" {
+		return nil, BadRequest(errors.New("bad select"))
+	}
+	return []instapaper.Bookmark{{BookmarkID: 1, Title: "One"}}, nil
+}
+
+func (f *fakeBackend) Text(_ context.Context, id int64, format string) ([]byte, error) {
+	f.calls++
+	return []byte(format + " body"), nil
+}
+
+func (f *fakeBackend) Folders(context.Context) ([]instapaper.Folder, error) {
+	f.calls++
+	return nil, errors.New("upstream down")
+}
+
+func (f *fakeBackend) Highlights(context.Context, HighlightQuery) ([]instapaper.Highlight, error) {
+	f.calls++
+	return nil, nil
+}
+
+func get(t *testing.T, url, token string) (*http.Response, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestServerCacheAndErrors(t *testing.T) {
+	backend := &fakeBackend{}
+	srv := httptest.NewServer(&Server{Backend: backend, TTL: time.Minute})
+	defer srv.Close()
+
+	resp, body := get(t, srv.URL+"/bookmarks?tag=go&limit=5", "")
+	if resp.StatusCode != 200 || resp.Header.Get("X-Cache") != "miss" || !strings.Contains(body, `"One"`) {
+		t.Fatalf("first GET: %d %q %s", resp.StatusCode, resp.Header.Get("X-Cache"), body)
+	}
+	if backend.last != (BookmarkQuery{Folder: "unread", Tag: "go", Limit: 5}) {
+		t.Fatalf("query: %+v", backend.last)
+	}
+	// Same query in another order is the same cache key.
+	resp, _ = get(t, srv.URL+"/bookmarks?limit=5&tag=go", "")
+	if resp.Header.Get("X-Cache") != "hit" || backend.calls != 1 {
+		t.Fatalf("expected cache hit, got %q after %d calls", resp.Header.Get("X-Cache"), backend.calls)
+	}
+
+	resp, body = get(t, srv.URL+"/bookmarks/7/text?format=markdown", "")
+	if resp.StatusCode != 200 || body != "markdown body" || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/markdown") {
+		t.Fatalf("text: %d %q %s", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+	resp, _ = get(t, srv.URL+"/bookmarks/7/text", "")
+	if resp.Header.Get("Content-Security-Policy") != "sandbox" || resp.Header.Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatalf("html text should be sandboxed: %v", resp.Header)
+	}
+
+	cases := []struct {
+		path   string
+		status int
+		code   string
+	}{
+		{"/bookmarks?select=bad", 400, "invalid_request"},
+		{"/bookmarks?limit=x", 400, "invalid_request"},
+		{"/bookmarks/abc/text", 400, "invalid_request"},
+		{"/bookmarks/1/text?format=pdf", 400, "invalid_request"},
+		{"/highlights?bookmark_id=1&folder=unread", 400, "invalid_request"},
+		{"/folders", 502, "upstream_error"},
+		{"/nope", 404, "not_found"},
+	}
+	for _, c := range cases {
+		resp, body := get(t, srv.URL+c.path, "")
+		if resp.StatusCode != c.status || !strings.Contains(body, `"code":"`+c.code+`"`) {
+			t.Errorf("%s: %d %s", c.path, resp.StatusCode, body)
+		}
+	}
+	// Errors are not cached.
+	calls := backend.calls
+	get(t, srv.URL+"/folders", "")
+	if backend.calls != calls+1 {
+		t.Fatalf("error response was cached")
+	}
+
+	post, err := http.Post(srv.URL+"/bookmarks", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post.Body.Close()
+	if post.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("POST: %d", post.StatusCode)
+	}
+}
+
+func TestServerBearerToken(t *testing.T) {
+	srv := httptest.NewServer(&Server{Backend: &fakeBackend{}, Token: "s3cret"})
+	defer srv.Close()
+
+	for _, token := range []string{"", "wrong"} {
+		resp, body := get(t, srv.URL+"/bookmarks", token)
+		if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" || !strings.Contains(body, "unauthorized") {
+			t.Fatalf("token %q: %d %s", token, resp.StatusCode, body)
+		}
+	}
+	resp, _ := get(t, srv.URL+"/bookmarks", "s3cret")
+	if resp.StatusCode != 200 || resp.Header.Get("Cache-Control") != "no-store" {
+		t.Fatalf("authorized GET: %d %q", resp.StatusCode, resp.Header.Get("Cache-Control"))
+	}
+}
+
+func TestServerHostCheck(t *testing.T) {
+	cases := []struct {
+		addr, host string
+		ok         bool
+	}{
+		{"127.0.0.1:8080", "127.0.0.1:8080", true},
+		{"127.0.0.1:8080", "localhost:8080", true},
+		{"127.0.0.1:8080", "[::1]:8080", true},
+		{"127.0.0.1:8080", "rebind.example:8080", false},
+		{"127.0.0.1:8080", "192.168.1.5:8080", false},
+		{"nas.lan:8080", "NAS.lan:8080", true},
+		{"nas.lan:8080", "other.lan:8080", false},
+		{":8080", "192.168.1.5:8080", true},
+		{"0.0.0.0:8080", "192.168.1.5:8080", true},
+		{"0.0.0.0:8080", "rebind.example:8080", false},
+	}
+	for _, c := range cases {
+		srv := &Server{Backend: &fakeBackend{}, Addr: c.addr}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = c.host
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		if ok := rec.Code == http.StatusOK; ok != c.ok {
+			t.Fatalf("addr %s host %s: status %d %s", c.addr, c.host, rec.Code, rec.Body.String())
+		}
+		if !c.ok && !strings.Contains(rec.Body.String(), "invalid_host") {
+			t.Fatalf("addr %s host %s: %s", c.addr, c.host, rec.Body.String())
+		}
+	}
+}
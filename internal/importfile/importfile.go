@@ -0,0 +1,334 @@
+// Package importfile parses bookmark exports from browsers, Pocket and feed
+// readers (Netscape bookmark HTML, Pocket HTML and OPML).
+package importfile
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Item is one bookmark read from an export file.
+type Item struct {
+	URL         string
+	Title       string
+	Description string
+	Tags        []string
+	Folder      string
+	Archive     bool
+	Time        int64 // added at, unix seconds; 0 when unknown
+}
+
+// rootFolders are browser container folders that carry no meaning on import.
+var rootFolders = map[string]bool{
+	"bookmarks":         true,
+	"bookmarks bar":     true,
+	"bookmarks toolbar": true,
+	"bookmarks menu":    true,
+	"other bookmarks":   true,
+	"mobile bookmarks":  true,
+	"favorites":         true,
+	"favorites bar":     true,
+	"favourites bar":    true,
+}
+
+// newDecoder returns a lenient decoder that accepts the tag soup browsers and
+// Pocket produce: unclosed elements, unquoted attributes and HTML entities.
+func newDecoder(r io.Reader) *xml.Decoder {
+	dec := xml.NewDecoder(r)
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+	return dec
+}
+
+// ParseNetscape reads a Netscape bookmark file as exported by Chrome, Firefox,
+// Safari and most bookmarking services. The innermost folder (H3) becomes the
+// item folder; TAGS and ADD_DATE attributes map to tags and time.
+func ParseNetscape(r io.Reader) ([]Item, error) {
+	dec := newDecoder(r)
+	var items []Item
+	var stack []string // folder per open DL
+	pendingFolder := ""
+	var text *strings.Builder
+	var capture string // "h3", "a" or "dd"
+	var current *Item
+	flush := func() {
+		if text == nil {
+			return
+		}
+		value := strings.TrimSpace(text.String())
+		switch capture {
+		case "h3":
+			pendingFolder = value
+		case "a":
+			if current != nil {
+				current.Title = value
+			}
+		case "dd":
+			if n := len(items); n > 0 && items[n-1].Description == "" {
+				items[n-1].Description = value
+			}
+		}
+		text = nil
+		capture = ""
+	}
+	for {
+		tok, err := nextToken(dec)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse netscape bookmarks: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := strings.ToLower(t.Name.Local)
+			switch name {
+			case "h3", "a", "dd":
+				flush()
+				capture = name
+				text = &strings.Builder{}
+				if name == "a" {
+					current = &Item{
+						URL:    attr(t, "href"),
+						Tags:   splitList(attr(t, "tags")),
+						Folder: currentFolder(stack),
+						Time:   parseUnix(attr(t, "add_date")),
+					}
+				}
+			case "dl":
+				flush()
+				stack = append(stack, pendingFolder)
+				pendingFolder = ""
+			case "dt":
+				flush()
+			}
+		case xml.EndElement:
+			name := strings.ToLower(t.Name.Local)
+			switch name {
+			case "h3", "dd":
+				if capture == name {
+					flush()
+				}
+			case "a":
+				if capture == "a" {
+					flush()
+				}
+				if current != nil && isWebURL(current.URL) {
+					items = append(items, *current)
+				}
+				current = nil
+			case "dl":
+				flush()
+				if len(stack) > 0 {
+					stack = stack[:len(stack)-1]
+				}
+			}
+		case xml.CharData:
+			if text != nil {
+				text.Write(t)
+			}
+		}
+	}
+	return oldestFirst(items), nil
+}
+
+// ParsePocket reads Pocket's HTML export: H1 sections ("Unread", "Read
+// Archive") containing links with time_added and tags attributes. Items in the
+// archive section are marked Archive.
+func ParsePocket(r io.Reader) ([]Item, error) {
+	dec := newDecoder(r)
+	var items []Item
+	archive := false
+	var text *strings.Builder
+	var current *Item
+	inH1 := false
+	for {
+		tok, err := nextToken(dec)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse pocket export: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch strings.ToLower(t.Name.Local) {
+			case "h1":
+				inH1 = true
+				text = &strings.Builder{}
+			case "a":
+				current = &Item{
+					URL:  attr(t, "href"),
+					Tags: splitList(attr(t, "tags")),
+					Time: parseUnix(attr(t, "time_added")),
+				}
+				text = &strings.Builder{}
+			}
+		case xml.EndElement:
+			switch strings.ToLower(t.Name.Local) {
+			case "h1":
+				if inH1 && text != nil {
+					section := strings.ToLower(text.String())
+					archive = strings.Contains(section, "archive") || (strings.Contains(section, "read") && !strings.Contains(section, "unread"))
+				}
+				inH1 = false
+				text = nil
+			case "a":
+				if current != nil && isWebURL(current.URL) {
+					if text != nil {
+						current.Title = strings.TrimSpace(text.String())
+					}
+					current.Archive = archive
+					items = append(items, *current)
+				}
+				current = nil
+				text = nil
+			}
+		case xml.CharData:
+			if text != nil {
+				text.Write(t)
+			}
+		}
+	}
+	return oldestFirst(items), nil
+}
+
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr"`
+	URL      string        `xml:"url,attr"`
+	HTMLURL  string        `xml:"htmlUrl,attr"`
+	XMLURL   string        `xml:"xmlUrl,attr"`
+	Category string        `xml:"category,attr"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+type opmlDocument struct {
+	Body struct {
+		Outlines []opmlOutline `xml:"outline"`
+	} `xml:"body"`
+}
+
+// ParseOPML reads an OPML outline. Outlines with a url (or htmlUrl/xmlUrl)
+// become items; parent outlines without one become the item folder, and the
+// category attribute maps to tags.
+func ParseOPML(r io.Reader) ([]Item, error) {
+	dec := newDecoder(r)
+	var doc opmlDocument
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parse opml: %w", err)
+	}
+	var items []Item
+	var walk func(outlines []opmlOutline, folder string)
+	walk = func(outlines []opmlOutline, folder string) {
+		for _, o := range outlines {
+			title := strings.TrimSpace(o.Title)
+			if title == "" {
+				title = strings.TrimSpace(o.Text)
+			}
+			link := firstNonEmpty(o.URL, o.HTMLURL, o.XMLURL)
+			if isWebURL(link) {
+				items = append(items, Item{
+					URL:    strings.TrimSpace(link),
+					Title:  title,
+					Tags:   splitList(strings.ReplaceAll(o.Category, "/", ",")),
+					Folder: folder,
+				})
+			}
+			if len(o.Outlines) > 0 {
+				child := folder
+				if link == "" && title != "" {
+					child = title
+				}
+				walk(o.Outlines, child)
+			}
+		}
+	}
+	walk(doc.Body.Outlines, "")
+	return items, nil
+}
+
+// nextToken is dec.Token, except that running out of input with elements
+// still open (normal for HTML exports) is reported as io.EOF.
+func nextToken(dec *xml.Decoder) (xml.Token, error) {
+	tok, err := dec.Token()
+	var syntaxErr *xml.SyntaxError
+	if errors.As(err, &syntaxErr) && syntaxErr.Msg == "unexpected EOF" {
+		return nil, io.EOF
+	}
+	return tok, err
+}
+
+func attr(t xml.StartElement, name string) string {
+	for _, a := range t.Attr {
+		if strings.EqualFold(a.Name.Local, name) {
+			return strings.TrimSpace(a.Value)
+		}
+	}
+	return ""
+}
+
+func currentFolder(stack []string) string {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i] != "" && !rootFolders[strings.ToLower(stack[i])] {
+			return stack[i]
+		}
+	}
+	return ""
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func parseUnix(s string) int64 {
+	v, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || v < 0 {
+		return 0
+	}
+	// Some exporters write microseconds or milliseconds.
+	for v > 1e11 {
+		v /= 1000
+	}
+	return v
+}
+
+func isWebURL(s string) bool {
+	lower := strings.ToLower(strings.TrimSpace(s))
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// oldestFirst orders items by time so that, once imported, the most recently
+// saved item ends up on top. Files with missing times keep their order.
+func oldestFirst(items []Item) []Item {
+	for _, it := range items {
+		if it.Time == 0 {
+			return items
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Time < items[j].Time
+	})
+	return items
+}
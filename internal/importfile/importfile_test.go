@@ -0,0 +1,91 @@
+package importfile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const netscapeSample = `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<!-- This is an automatically generated file. -->
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+    <DT><H3 ADD_DATE="1600000000" PERSONAL_TOOLBAR_FOLDER="true">Bookmarks bar</H3>
+    <DL><p>
+        <DT><A HREF="https://b.example/" ADD_DATE="1700000200" TAGS="go,news">B &amp; co</A>
+        <DD>Second item
+        <DT><H3>Reading</H3>
+        <DL><p>
+            <DT><A HREF="https://a.example/" ADD_DATE="1700000100">A</A>
+            <DT><A HREF="javascript:void(0)" ADD_DATE="1700000300">Bookmarklet</A>
+        </DL><p>
+    </DL><p>
+    <DT><A HREF="https://c.example/?a=1&b=2" ADD_DATE=1700000300000000>C & D</A>
+</DL><p>
+`
+
+func TestParseNetscape(t *testing.T) {
+	items, err := ParseNetscape(strings.NewReader(netscapeSample))
+	if err != nil {
+		t.Fatalf("ParseNetscape: %v", err)
+	}
+	want := []Item{
+		{URL: "https://a.example/", Title: "A", Folder: "Reading", Time: 1700000100},
+		{URL: "https://b.example/", Title: "B & co", Description: "Second item", Tags: []string{"go", "news"}, Time: 1700000200},
+		{URL: "https://c.example/?a=1&b=2", Title: "C & D", Time: 1700000300},
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Fatalf("items:\n got %+v\nwant %+v", items, want)
+	}
+}
+
+func TestParsePocket(t *testing.T) {
+	src := `<!DOCTYPE html>
+<html><head><meta http-equiv="Content-Type" content="text/html; charset=UTF-8"><title>Pocket Export</title></head>
+<body>
+<h1>Unread</h1>
+<ul>
+<li><a href="https://new.example" time_added="1700000500" tags="later,go">New</a></li>
+</ul>
+<h1>Read Archive</h1>
+<ul>
+<li><a href="https://old.example" time_added="1600000000" tags="">Old</a></li>
+</ul>
+</body></html>`
+	items, err := ParsePocket(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("ParsePocket: %v", err)
+	}
+	want := []Item{
+		{URL: "https://old.example", Title: "Old", Archive: true, Time: 1600000000},
+		{URL: "https://new.example", Title: "New", Tags: []string{"later", "go"}, Time: 1700000500},
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Fatalf("items:\n got %+v\nwant %+v", items, want)
+	}
+}
+
+func TestParseOPML(t *testing.T) {
+	src := `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="2.0"><head><title>Links</title></head><body>
+<outline text="Tech">
+  <outline text="Go blog" type="rss" xmlUrl="https://go.dev/blog/feed.atom" htmlUrl="https://go.dev/blog" category="go,/lang"/>
+  <outline text="Link" type="link" url="https://link.example"/>
+</outline>
+<outline text="Top" url="https://top.example"/>
+</body></opml>`
+	items, err := ParseOPML(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("ParseOPML: %v", err)
+	}
+	want := []Item{
+		{URL: "https://go.dev/blog", Title: "Go blog", Folder: "Tech", Tags: []string{"go", "lang"}},
+		{URL: "https://link.example", Title: "Link", Folder: "Tech"},
+		{URL: "https://top.example", Title: "Top"},
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Fatalf("items:\n got %+v\nwant %+v", items, want)
+	}
+}
@@ -0,0 +1,339 @@
+package instapaper
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Redacted replaces secrets in recorded cassettes.
+const Redacted = "REDACTED"
+
+// redactedFormKeys are request parameters that never reach a cassette.
+var redactedFormKeys = []string{"x_auth_username", "x_auth_password"}
+
+// redactedBodyKeys are query-string response fields (xAuth tokens) that
+// never reach a cassette.
+var redactedBodyKeys = []string{"oauth_token", "oauth_token_secret"}
+
+// recordedHeaders are the headers kept in a cassette.
+var recordedHeaders = []string{"Accept", "Content-Type", "Retry-After"}
+
+// Interaction is one recorded request and its response or transport error.
+type Interaction struct {
+	Request    CassetteRequest   `json:"request"`
+	Response   *CassetteResponse `json:"response,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	DurationMS int64             `json:"duration_ms"`
+}
+
+type CassetteRequest struct {
+	Method string              `json:"method"`
+	URL    string              `json:"url"`
+	Header map[string]string   `json:"header,omitempty"`
+	Form   map[string][]string `json:"form,omitempty"`
+}
+
+type CassetteResponse struct {
+	Status     int               `json:"status"`
+	Header     map[string]string `json:"header,omitempty"`
+	Body       string            `json:"body,omitempty"`
+	BodyBase64 string            `json:"body_base64,omitempty"`
+}
+
+// Recorder appends interactions to a cassette file, one JSON object per
+// line, as they happen. Several clients may share one Recorder.
+type Recorder struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewRecorder creates (or truncates) the cassette file at path.
+func NewRecorder(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return &Recorder{path: path}, nil
+}
+
+func (r *Recorder) write(it Interaction) error {
+	b, err := json.Marshal(it)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Cassette holds recorded interactions for replay. Each interaction is
+// served once, in recorded order among requests that match it.
+type Cassette struct {
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// LoadCassette reads a cassette written by a Recorder.
+func LoadCassette(path string) (*Cassette, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c := &Cassette{}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var it Interaction
+		if err := json.Unmarshal(sc.Bytes(), &it); err != nil {
+			return nil, fmt.Errorf("cassette %s line %d: %w", path, line, err)
+		}
+		c.interactions = append(c.interactions, it)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	c.used = make([]bool, len(c.interactions))
+	return c, nil
+}
+
+// Remaining returns how many interactions have not been replayed.
+func (c *Cassette) Remaining() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, u := range c.used {
+		if !u {
+			n++
+		}
+	}
+	return n
+}
+
+// take returns the first unused interaction recorded for req.
+func (c *Cassette) take(req CassetteRequest) (Interaction, bool) {
+	key := matchKey(req)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, it := range c.interactions {
+		if !c.used[i] && matchKey(it.Request) == key {
+			c.used[i] = true
+			return it, true
+		}
+	}
+	return Interaction{}, false
+}
+
+// matchKey identifies a request by method, path and form, so a cassette
+// replays against any API base.
+func matchKey(req CassetteRequest) string {
+	path := req.URL
+	if u, err := url.Parse(req.URL); err == nil {
+		path = u.Path
+	}
+	return req.Method + " " + path + "?" + url.Values(req.Form).Encode()
+}
+
+// EnableRecording saves every request/response pair to r, with the
+// Authorization header, xAuth credentials and issued tokens redacted. Call it
+// before EnableDebug so debug output still covers every request.
+func (c *Client) EnableRecording(r *Recorder) {
+	if c == nil || r == nil {
+		return
+	}
+	base := c.HTTP.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	c.HTTP.Transport = &recordTransport{base: base, rec: r}
+}
+
+// EnableReplay answers requests from cas instead of the network. A request
+// with no recorded counterpart fails.
+func (c *Client) EnableReplay(cas *Cassette) {
+	if c == nil || cas == nil {
+		return
+	}
+	c.HTTP.Transport = &replayTransport{cas: cas}
+}
+
+type recordTransport struct {
+	base http.RoundTripper
+	rec  *Recorder
+}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	creq, err := cassetteRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	it := Interaction{Request: creq, DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		it.Error = err.Error()
+		if werr := t.rec.write(it); werr != nil {
+			return nil, fmt.Errorf("%w (cassette: %v)", err, werr)
+		}
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	cresp := &CassetteResponse{Status: resp.StatusCode, Header: pickHeaders(resp.Header)}
+	body = redactBody(body)
+	if utf8.Valid(body) {
+		cresp.Body = string(body)
+	} else {
+		cresp.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+	it.Response = cresp
+	if err := t.rec.write(it); err != nil {
+		return nil, fmt.Errorf("cassette: %w", err)
+	}
+	return resp, nil
+}
+
+type replayTransport struct {
+	cas *Cassette
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		defer req.Body.Close()
+	}
+	creq, err := cassetteRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	it, ok := t.cas.take(creq)
+	if !ok {
+		return nil, fmt.Errorf("cassette: no recorded response for %s %s", req.Method, req.URL.Path)
+	}
+	if it.Response == nil {
+		return nil, fmt.Errorf("cassette: recorded error: %s", it.Error)
+	}
+	body := []byte(it.Response.Body)
+	if it.Response.BodyBase64 != "" {
+		if body, err = base64.StdEncoding.DecodeString(it.Response.BodyBase64); err != nil {
+			return nil, fmt.Errorf("cassette: %w", err)
+		}
+	}
+	header := http.Header{}
+	for k, v := range it.Response.Header {
+		header.Set(k, v)
+	}
+	return &http.Response{
+		StatusCode:    it.Response.Status,
+		Status:        fmt.Sprintf("%d %s", it.Response.Status, http.StatusText(it.Response.Status)),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// cassetteRequest captures req's method, URL, headers and form body without
+// consuming the body, redacting secrets.
+func cassetteRequest(req *http.Request) (CassetteRequest, error) {
+	creq := CassetteRequest{Method: req.Method, URL: req.URL.Redacted(), Header: pickHeaders(req.Header)}
+	if req.Header.Get("Authorization") != "" {
+		if creq.Header == nil {
+			creq.Header = map[string]string{}
+		}
+		creq.Header["Authorization"] = Redacted
+	}
+	if req.Body == nil || !strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		return creq, nil
+	}
+	var body []byte
+	var err error
+	if req.GetBody != nil {
+		var rc io.ReadCloser
+		if rc, err = req.GetBody(); err == nil {
+			body, err = io.ReadAll(rc)
+			rc.Close()
+		}
+	} else {
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if err != nil {
+		return creq, err
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil || len(form) == 0 {
+		return creq, nil
+	}
+	for _, k := range redactedFormKeys {
+		if _, ok := form[k]; ok {
+			form.Set(k, Redacted)
+		}
+	}
+	creq.Form = form
+	return creq, nil
+}
+
+func pickHeaders(h http.Header) map[string]string {
+	var out map[string]string
+	for _, k := range recordedHeaders {
+		if v := h.Get(k); v != "" {
+			if out == nil {
+				out = map[string]string{}
+			}
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// redactBody blanks xAuth tokens in a query-string response body.
+func redactBody(body []byte) []byte {
+	trim := bytes.TrimSpace(body)
+	if !bytes.Contains(trim, []byte("oauth_token")) || bytes.HasPrefix(trim, []byte("[")) || bytes.HasPrefix(trim, []byte("{")) {
+		return body
+	}
+	vals, err := url.ParseQuery(string(trim))
+	if err != nil {
+		return body
+	}
+	for _, k := range redactedBodyKeys {
+		if _, ok := vals[k]; ok {
+			vals.Set(k, Redacted)
+		}
+	}
+	return []byte(vals.Encode())
+}
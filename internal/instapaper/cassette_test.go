@@ -0,0 +1,88 @@
+package instapaper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vburojevic/instapaper-cli/internal/oauth1"
+)
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	var progress []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/1/oauth/access_token":
+			writeString(t, w, "oauth_token=tok-secret-key&oauth_token_secret=very-secret")
+		case "/api/1/bookmarks/update_read_progress":
+			progress = append(progress, r.FormValue("progress"))
+			w.Header().Set("Content-Type", "application/json")
+			writeString(t, w, `[{"type":"bookmark","bookmark_id":7,"progress":`+r.FormValue("progress")+`}]`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "run.cassette")
+	rec, err := NewRecorder(path)
+	if err != nil {
+		t.Fatalf("NewRecorder: %v", err)
+	}
+	ctx := context.Background()
+	client := newTestClient(t, srv.URL, nil)
+	client.EnableRecording(rec)
+	if _, _, err := client.XAuthAccessToken(ctx, "me@example.com", "hunter2"); err != nil {
+		t.Fatalf("XAuthAccessToken: %v", err)
+	}
+	client.Token = &oauth1.Token{Key: "tok", Secret: "sec"}
+	for _, p := range []float64{0.25, 0.5, 0.25} {
+		if _, err := client.UpdateReadProgress(ctx, 7, p, 100); err != nil {
+			t.Fatalf("UpdateReadProgress: %v", err)
+		}
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read cassette: %v", err)
+	}
+	for _, secret := range []string{"hunter2", "me%40example.com", "me@example.com", "very-secret", "tok-secret-key", "oauth_signature"} {
+		if strings.Contains(string(raw), secret) {
+			t.Fatalf("cassette leaks %q:\n%s", secret, raw)
+		}
+	}
+	if n := strings.Count(string(raw), "\n"); n != 4 {
+		t.Fatalf("expected 4 interactions, got %d", n)
+	}
+
+	cas, err := LoadCassette(path)
+	if err != nil {
+		t.Fatalf("LoadCassette: %v", err)
+	}
+	replay := newTestClient(t, "http://127.0.0.1:1", &oauth1.Token{Key: "other", Secret: "other"})
+	replay.EnableReplay(cas)
+	tok, _, err := replay.XAuthAccessToken(ctx, "someone-else", "pw")
+	if err != nil || tok != Redacted {
+		t.Fatalf("replayed XAuthAccessToken: %q %v", tok, err)
+	}
+	// Identical requests are answered in recorded order.
+	for _, p := range []float64{0.25, 0.25, 0.5} {
+		bm, err := replay.UpdateReadProgress(ctx, 7, p, 100)
+		if err != nil || float64(bm.Progress) != p {
+			t.Fatalf("replayed UpdateReadProgress(%v): %+v %v", p, bm, err)
+		}
+	}
+	if cas.Remaining() != 0 {
+		t.Fatalf("remaining=%d", cas.Remaining())
+	}
+	if _, err := replay.UpdateReadProgress(ctx, 7, 0.25, 100); err == nil || !strings.Contains(err.Error(), "no recorded response") {
+		t.Fatalf("expected a miss once the cassette is used up, got %v", err)
+	}
+	if len(progress) != 3 {
+		t.Fatalf("replay reached the server: %v", progress)
+	}
+}
@@ -23,6 +23,11 @@ type Client struct {
 	UserAgent string
 	RetryCount   int
 	RetryBackoff time.Duration
+	Limiter      *RateLimiter
+	// Retry overrides RetryCount/RetryBackoff when set (see SetRetryPolicy).
+	Retry   *RetryPolicy
+	// OnRetry, when set, is called before every retry sleep.
+	OnRetry func(RetryEvent)
 }
 
 func NewClient(baseURL, consumerKey, consumerSecret string, token *oauth1.Token, timeout time.Duration) (*Client, error) {
@@ -55,6 +60,10 @@ func (c *Client) SetRetry(count int, backoff time.Duration) {
 	}
 	c.RetryCount = count
 	c.RetryBackoff = backoff
+	if c.Retry != nil {
+		c.Retry.MaxAttempts = count + 1
+		c.Retry.BaseDelay = backoff
+	}
 }
 
 type APIError struct {
@@ -78,33 +87,31 @@ func (e *APIError) Error() string {
 // postForm signs and posts an application/x-www-form-urlencoded request.
 // It returns status code, headers, and raw response body.
 func (c *Client) postForm(ctx context.Context, path string, form url.Values, accept string) (int, http.Header, []byte, error) {
-	attempts := c.RetryCount + 1
-	if attempts < 1 {
-		attempts = 1
-	}
-	backoff := c.RetryBackoff
-	if backoff <= 0 {
-		backoff = 500 * time.Millisecond
-	}
-	var lastStatus int
-	var lastHeaders http.Header
-	var lastBody []byte
-	var lastErr error
-	for i := 0; i < attempts; i++ {
-		status, headers, body, err := c.postFormOnce(ctx, path, form, accept)
-		lastStatus, lastHeaders, lastBody, lastErr = status, headers, body, err
-		if err == nil && !shouldRetry(status, body) {
-			return status, headers, body, nil
+	policy := c.retryPolicy()
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		if err := c.Limiter.Wait(ctx); err != nil {
+			return 0, nil, nil, err
 		}
+		status, headers, body, err := c.postFormOnce(ctx, path, form, accept)
 		if ctx.Err() != nil {
 			return status, headers, body, ctx.Err()
 		}
-		if i < attempts-1 {
-			time.Sleep(backoff * time.Duration(1<<i))
-			continue
+		class := policy.classify(ctx, status, body, err)
+		if class == "" || attempt >= policy.MaxAttempts {
+			return status, headers, body, err
+		}
+		delay, fromHeader, ok := policy.delay(attempt, headers, time.Now())
+		if !ok || (policy.MaxElapsed > 0 && time.Since(start)+delay > policy.MaxElapsed) {
+			return status, headers, body, err
+		}
+		if c.OnRetry != nil {
+			c.OnRetry(RetryEvent{Path: path, Attempt: attempt, Class: class, Status: status, Err: err, Delay: delay, RetryAfter: fromHeader})
+		}
+		if err := sleepContext(ctx, delay); err != nil {
+			return status, headers, body, err
 		}
 	}
-	return lastStatus, lastHeaders, lastBody, lastErr
 }
 
 func (c *Client) postFormOnce(ctx context.Context, path string, form url.Values, accept string) (int, http.Header, []byte, error) {
@@ -141,16 +148,6 @@ func (c *Client) postFormOnce(ctx context.Context, path string, form url.Values,
 	return resp.StatusCode, resp.Header, b, nil
 }
 
-func shouldRetry(status int, body []byte) bool {
-	if status == 429 || status >= 500 {
-		return true
-	}
-	if apiErr := parseAPIError(body); apiErr != nil {
-		return apiErr.Code == 1040
-	}
-	return false
-}
-
 func parseAPIError(body []byte) *APIError {
 	// Typical Instapaper errors are returned as a JSON array whose first element has {"type":"error", ...}
 	trim := bytes.TrimSpace(body)
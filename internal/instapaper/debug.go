@@ -61,6 +61,29 @@ func (c *Client) enableDebug(w io.Writer, json bool) {
 		base = http.DefaultTransport
 	}
 	c.HTTP.Transport = &debugTransport{base: base, w: w, json: json}
+	c.OnRetry = func(ev RetryEvent) { writeRetryEvent(w, json, ev) }
+}
+
+func writeRetryEvent(w io.Writer, asJSON bool, ev RetryEvent) {
+	if asJSON {
+		payload := map[string]any{
+			"type":        "retry",
+			"path":        ev.Path,
+			"attempt":     ev.Attempt,
+			"class":       ev.Class,
+			"delay_ms":    ev.Delay.Milliseconds(),
+			"retry_after": ev.RetryAfter,
+		}
+		if ev.Status != 0 {
+			payload["status"] = ev.Status
+		}
+		if ev.Err != nil {
+			payload["error"] = ev.Err.Error()
+		}
+		_ = writeJSONLine(w, payload)
+		return
+	}
+	fmt.Fprintf(w, "debug: retry %s attempt=%d class=%s status=%d delay=%s\n", ev.Path, ev.Attempt, ev.Class, ev.Status, ev.Delay)
 }
 
 func writeJSONLine(w io.Writer, payload map[string]any) error {
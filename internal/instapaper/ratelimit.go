@@ -0,0 +1,108 @@
+package instapaper
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket shared by every request of a Client, so
+// concurrent workers together stay under the configured rate.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// NewRateLimiter allows perSecond requests per second on average and bursts
+// of up to burst requests (at least 1).
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{rate: perSecond, burst: float64(burst), tokens: float64(burst), now: time.Now}
+}
+
+// Wait blocks until a request may be sent or ctx is done. A nil limiter
+// never waits.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil || l.rate <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	// Reserve a token now; a negative balance is the queue ahead of us.
+	l.tokens--
+	wait := time.Duration(0)
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// SetRateLimit limits the client to perSecond requests per second (0
+// disables limiting).
+func (c *Client) SetRateLimit(perSecond float64, burst int) {
+	if c == nil {
+		return
+	}
+	if perSecond <= 0 {
+		c.Limiter = nil
+		return
+	}
+	c.Limiter = NewRateLimiter(perSecond, burst)
+}
+
+// ParseRate parses a request rate such as "5/s", "300/m", "1000/h" or a bare
+// number of requests per second.
+func ParseRate(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	num, unit, hasUnit := strings.Cut(s, "/")
+	v, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid rate %q (expected e.g. 5/s, 300/m)", s)
+	}
+	if !hasUnit {
+		return v, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(unit)) {
+	case "s", "sec", "second":
+		return v, nil
+	case "m", "min", "minute":
+		return v / 60, nil
+	case "h", "hour":
+		return v / 3600, nil
+	default:
+		return 0, fmt.Errorf("invalid rate %q (expected e.g. 5/s, 300/m)", s)
+	}
+}
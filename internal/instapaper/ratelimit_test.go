@@ -0,0 +1,52 @@
+package instapaper
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	for in, want := range map[string]float64{"": 0, "5/s": 5, "5": 5, "300/m": 5, "3600/h": 1, "0.5/sec": 0.5} {
+		got, err := ParseRate(in)
+		if err != nil || got != want {
+			t.Fatalf("ParseRate(%q)=%v,%v want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"fast", "5/d", "-1/s"} {
+		if _, err := ParseRate(in); err == nil {
+			t.Fatalf("ParseRate(%q): expected error", in)
+		}
+	}
+}
+
+func TestRateLimiterSpacesRequests(t *testing.T) {
+	l := NewRateLimiter(200, 1)
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatalf("Wait: %v", err)
+		}
+	}
+	// The first request uses the burst token, the other five wait 5ms each.
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("requests not limited: %v", elapsed)
+	}
+	var nilLimiter *RateLimiter
+	if err := nilLimiter.Wait(context.Background()); err != nil {
+		t.Fatalf("nil limiter: %v", err)
+	}
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	l := NewRateLimiter(0.1, 1)
+	_ = l.Wait(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err == nil {
+		t.Fatalf("expected context error")
+	}
+	if l.tokens < -0.01 {
+		t.Fatalf("cancelled wait kept its reservation: %v", l.tokens)
+	}
+}
@@ -0,0 +1,233 @@
+package instapaper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retry classes name the failures a RetryPolicy may retry.
+const (
+	RetryRateLimit = "rate_limit" // HTTP 429 and API error 1040
+	RetryServer    = "server"     // HTTP 5xx
+	RetryNetwork   = "network"    // transport errors: timeouts, resets, DNS
+)
+
+// RetryClasses lists every retry class.
+var RetryClasses = []string{RetryRateLimit, RetryServer, RetryNetwork}
+
+// RetryPolicy controls how failed requests are retried: jittered exponential
+// backoff between attempts, Retry-After headers honoured up to MaxDelay, and
+// sleeps that end early when the request context is cancelled.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	MaxAttempts int
+	// MaxElapsed stops retrying once the next attempt would start more than
+	// this long after the first (0 = no limit).
+	MaxElapsed time.Duration
+	// BaseDelay doubles after every attempt up to MaxDelay. A Retry-After
+	// header asking for longer than MaxDelay ends the retries.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Jitter randomly shortens each delay by up to this fraction (0..1).
+	Jitter float64
+	// On lists the retry classes to retry; nil retries all of them.
+	On []string
+}
+
+// DefaultRetryPolicy makes a single attempt; raise MaxAttempts to retry.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 1,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    30 * time.Second,
+		Jitter:      0.2,
+	}
+}
+
+// RetryEvent describes a retry about to happen, for debug logging.
+type RetryEvent struct {
+	Path       string
+	Attempt    int // the attempt that failed, starting at 1
+	Class      string
+	Status     int
+	Err        error
+	Delay      time.Duration
+	RetryAfter bool // Delay came from a Retry-After header
+}
+
+// ParseRetryClasses parses a comma-separated list of retry classes. "all"
+// selects every class and "none" disables retries.
+func ParseRetryClasses(s string) ([]string, error) {
+	var out []string
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		switch part {
+		case "":
+			continue
+		case "all":
+			return append([]string{}, RetryClasses...), nil
+		case "none":
+			return []string{}, nil
+		case RetryRateLimit, RetryServer, RetryNetwork:
+			if !seen[part] {
+				seen[part] = true
+				out = append(out, part)
+			}
+		default:
+			return nil, fmt.Errorf("invalid retry class %q (expected %s, all or none)", part, strings.Join(RetryClasses, ", "))
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// SetRetryPolicy replaces the client's retry policy.
+func (c *Client) SetRetryPolicy(p RetryPolicy) {
+	if c == nil {
+		return
+	}
+	if p.MaxAttempts < 1 {
+		p.MaxAttempts = 1
+	}
+	c.Retry = &p
+	c.RetryCount = p.MaxAttempts - 1
+	c.RetryBackoff = p.BaseDelay
+}
+
+// retryPolicy returns the policy in effect: Retry when set, otherwise the
+// defaults with RetryCount and RetryBackoff applied.
+func (c *Client) retryPolicy() RetryPolicy {
+	if c.Retry != nil {
+		return *c.Retry
+	}
+	p := DefaultRetryPolicy()
+	if c.RetryCount > 0 {
+		p.MaxAttempts = c.RetryCount + 1
+	}
+	if c.RetryBackoff > 0 {
+		p.BaseDelay = c.RetryBackoff
+	}
+	return p
+}
+
+// classify returns the retry class of a failed attempt, or "" when the
+// outcome must not be retried (success, client errors, cancellation).
+func (p RetryPolicy) classify(ctx context.Context, status int, body []byte, err error) string {
+	class := ""
+	switch {
+	case err != nil:
+		if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+			return ""
+		}
+		class = RetryNetwork
+	case status == http.StatusTooManyRequests:
+		class = RetryRateLimit
+	case status >= 500:
+		class = RetryServer
+	default:
+		if apiErr := parseAPIError(body); apiErr != nil && apiErr.Code == 1040 {
+			class = RetryRateLimit
+		}
+	}
+	if class == "" || !p.Allows(class) {
+		return ""
+	}
+	return class
+}
+
+// Allows reports whether failures of the given retry class are retried.
+func (p RetryPolicy) Allows(class string) bool {
+	if p.On == nil {
+		return true
+	}
+	for _, c := range p.On {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// Delay returns how long to wait after the given failed attempt (1-based)
+// of a request sent outside the client, such as a webhook delivery. ok is
+// false when a Retry-After header asks for longer than MaxDelay and the
+// request should not be retried.
+func (p RetryPolicy) Delay(attempt int, headers http.Header) (d time.Duration, ok bool) {
+	d, _, ok = p.delay(attempt, headers, time.Now())
+	return d, ok
+}
+
+// delay returns how long to wait after the given failed attempt (1-based)
+// and whether that came from a Retry-After header, which wins over the
+// computed backoff. ok is false when the header asks for more than MaxDelay.
+func (p RetryPolicy) delay(attempt int, headers http.Header, now time.Time) (d time.Duration, fromHeader, ok bool) {
+	if d, ok := parseRetryAfter(headers.Get("Retry-After"), now); ok {
+		if p.MaxDelay > 0 && d > p.MaxDelay {
+			return p.MaxDelay, true, false
+		}
+		return d, true, true
+	}
+	d = p.BaseDelay
+	if d <= 0 {
+		d = 500 * time.Millisecond
+	}
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		j := p.Jitter
+		if j > 1 {
+			j = 1
+		}
+		d -= time.Duration(float64(d) * j * rand.Float64())
+	}
+	return d, false, true
+}
+
+// parseRetryAfter reads a Retry-After value in seconds or as an HTTP date.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := t.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// sleepContext waits for d or until ctx is done, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,172 @@
+package instapaper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vburojevic/instapaper-cli/internal/oauth1"
+)
+
+func TestParseRetryClasses(t *testing.T) {
+	got, err := ParseRetryClasses("server, rate_limit,server")
+	if err != nil {
+		t.Fatalf("ParseRetryClasses: %v", err)
+	}
+	if len(got) != 2 || got[0] != RetryRateLimit || got[1] != RetryServer {
+		t.Fatalf("classes=%v", got)
+	}
+	if got, _ := ParseRetryClasses("all"); len(got) != len(RetryClasses) {
+		t.Fatalf("all=%v", got)
+	}
+	if got, _ := ParseRetryClasses("none"); got == nil || len(got) != 0 {
+		t.Fatalf("none=%v", got)
+	}
+	if _, err := ParseRetryClasses("client"); err == nil {
+		t.Fatalf("expected error for unknown class")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if d, ok := parseRetryAfter("7", now); !ok || d != 7*time.Second {
+		t.Fatalf("seconds: %v %v", d, ok)
+	}
+	date := now.Add(90 * time.Second).Format(http.TimeFormat)
+	if d, ok := parseRetryAfter(date, now); !ok || d != 90*time.Second {
+		t.Fatalf("date: %v %v", d, ok)
+	}
+	if _, ok := parseRetryAfter("soon", now); ok {
+		t.Fatalf("expected invalid value to be ignored")
+	}
+}
+
+func TestRetryDelayBackoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if d, fromHeader, ok := p.delay(i+1, http.Header{}, time.Now()); d != w || fromHeader || !ok {
+			t.Fatalf("attempt %d: delay=%v want %v", i+1, d, w)
+		}
+	}
+	p.Jitter = 0.5
+	for i := 0; i < 50; i++ {
+		if d, _, _ := p.delay(2, http.Header{}, time.Now()); d < time.Second || d > 2*time.Second {
+			t.Fatalf("jittered delay out of range: %v", d)
+		}
+	}
+	h := http.Header{}
+	h.Set("Retry-After", "3")
+	if d, fromHeader, ok := p.delay(1, h, time.Now()); d != 3*time.Second || !fromHeader || !ok {
+		t.Fatalf("Retry-After: %v %v %v", d, fromHeader, ok)
+	}
+	h.Set("Retry-After", "3600")
+	if d, _, ok := p.delay(1, h, time.Now()); d != 5*time.Second || ok {
+		t.Fatalf("Retry-After above MaxDelay: %v %v", d, ok)
+	}
+}
+
+func TestPostFormRetriesWithEvents(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		writeString(t, w, `[{"type":"user","user_id":1,"username":"u"}]`)
+	}))
+	defer srv.Close()
+
+	client := newTestClient(t, srv.URL, &oauth1.Token{Key: "tok", Secret: "sec"})
+	client.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	var events []RetryEvent
+	client.OnRetry = func(ev RetryEvent) { events = append(events, ev) }
+	if _, err := client.VerifyCredentials(context.Background()); err != nil {
+		t.Fatalf("VerifyCredentials: %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("calls=%d", calls)
+	}
+	if len(events) != 1 || events[0].Class != RetryServer || events[0].Status != 503 || !events[0].RetryAfter || events[0].Attempt != 1 {
+		t.Fatalf("events=%+v", events)
+	}
+}
+
+func TestPostFormRetryClassFilter(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	client := newTestClient(t, srv.URL, &oauth1.Token{Key: "tok", Secret: "sec"})
+	client.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, On: []string{RetryServer}})
+	if _, err := client.VerifyCredentials(context.Background()); err == nil {
+		t.Fatalf("expected error")
+	}
+	if calls != 1 {
+		t.Fatalf("429 retried with on=server: calls=%d", calls)
+	}
+}
+
+func TestPostFormLongRetryAfterIsNotRetried(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	client := newTestClient(t, srv.URL, &oauth1.Token{Key: "tok", Secret: "sec"})
+	client.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Second})
+	if _, err := client.VerifyCredentials(context.Background()); err == nil {
+		t.Fatalf("expected error")
+	}
+	if calls != 1 {
+		t.Fatalf("Retry-After above MaxDelay retried: calls=%d", calls)
+	}
+}
+
+func TestPostFormRetryStopsOnCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	client := newTestClient(t, srv.URL, &oauth1.Token{Key: "tok", Secret: "sec"})
+	client.SetRetryPolicy(RetryPolicy{MaxAttempts: 5, BaseDelay: time.Minute})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.VerifyCredentials(ctx)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("retry sleep ignored cancellation")
+	}
+}
+
+func TestPostFormRetryMaxElapsed(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	client := newTestClient(t, srv.URL, &oauth1.Token{Key: "tok", Secret: "sec"})
+	client.SetRetryPolicy(RetryPolicy{MaxAttempts: 10, BaseDelay: time.Hour, MaxElapsed: time.Second})
+	if _, err := client.VerifyCredentials(context.Background()); err == nil {
+		t.Fatalf("expected error")
+	}
+	if calls != 1 {
+		t.Fatalf("calls=%d", calls)
+	}
+}
@@ -151,6 +151,15 @@ type Tag struct {
 	Name string `json:"name"`
 }
 
+// TagNames returns the names of tags in order.
+func TagNames(tags []Tag) []string {
+	names := make([]string, 0, len(tags))
+	for _, t := range tags {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
 type Bookmark struct {
 	Type              string  `json:"type"`
 	BookmarkID        Int64   `json:"bookmark_id"`
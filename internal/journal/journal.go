@@ -0,0 +1,401 @@
+// Package journal records the outcome of every item of a bulk job in an
+// append-only NDJSON file, so an interrupted job can be resumed with only the
+// items that have not succeeded yet.
+//
+// The first line describes the job and carries its input items; every later
+// line is an event: "item" (one outcome), "resume" or "done".
+package journal
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ext is the file extension of journals created under a jobs directory.
+const Ext = ".jsonl"
+
+// Header is the first line of a journal.
+type Header struct {
+	Event   string   `json:"event"` // always "job"
+	ID      string   `json:"id"`
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+	Profile string   `json:"profile,omitempty"`
+	// Key names the progress data field that identifies an item
+	// ("bookmark_id", "url"). Object items are matched on the same field;
+	// scalar items (bookmark ids) are the key themselves.
+	Key     string            `json:"key,omitempty"`
+	Items   []json.RawMessage `json:"items"`
+	Created int64             `json:"created"`
+}
+
+// Event is a line after the header.
+type Event struct {
+	Event  string         `json:"event"`
+	Status string         `json:"status,omitempty"`
+	Error  string         `json:"error,omitempty"`
+	Data   map[string]any `json:"data,omitempty"`
+	Time   int64          `json:"time"`
+	// Set on "done" events.
+	Succeeded   int  `json:"succeeded,omitempty"`
+	Failed      int  `json:"failed,omitempty"`
+	Interrupted bool `json:"interrupted,omitempty"`
+}
+
+// Journal appends events to a job file. It is safe for concurrent use; a nil
+// Journal discards everything.
+type Journal struct {
+	mu   sync.Mutex
+	f    *os.File
+	w    *bufio.Writer
+	Path string
+}
+
+var now = time.Now
+
+// NewID returns a sortable, unique job id such as 20240102-150405-a1b2c3.
+func NewID() string {
+	var b [3]byte
+	_, _ = rand.Read(b[:])
+	return now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b[:])
+}
+
+// Create writes a new journal at path with h as its header. Items are
+// marshalled with encoding/json.
+func Create(path string, h Header, items any) (*Journal, error) {
+	raw, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &h.Items); err != nil {
+		return nil, fmt.Errorf("journal items must be a list: %w", err)
+	}
+	h.Event = "job"
+	if h.Created == 0 {
+		h.Created = now().Unix()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{f: f, w: bufio.NewWriter(f), Path: path}
+	if err := j.write(h); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return j, j.Flush()
+}
+
+// Append reopens an existing journal to continue it and records a "resume"
+// event.
+func Append(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{f: f, w: bufio.NewWriter(f), Path: path}
+	if !endsWithNewline(path) {
+		// Terminate a line cut short by a crash so it stays one bad line.
+		_ = j.w.WriteByte('\n')
+	}
+	if err := j.write(Event{Event: "resume", Time: now().Unix()}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return j, j.Flush()
+}
+
+func endsWithNewline(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return true
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil || st.Size() == 0 {
+		return true
+	}
+	var b [1]byte
+	if _, err := f.ReadAt(b[:], st.Size()-1); err != nil {
+		return true
+	}
+	return b[0] == '\n'
+}
+
+// Record logs the outcome of one item. data is the item's progress data and
+// must contain the job's key field. The line is synced to disk before Record
+// returns.
+func (j *Journal) Record(data map[string]any, itemErr error) error {
+	if j == nil {
+		return nil
+	}
+	ev := Event{Event: "item", Status: "ok", Data: data, Time: now().Unix()}
+	if itemErr != nil {
+		ev.Status = "error"
+		ev.Error = itemErr.Error()
+	}
+	return j.write(ev)
+}
+
+// Done logs the end of a run and closes the journal.
+func (j *Journal) Done(succeeded, failed int, interrupted bool) error {
+	if j == nil {
+		return nil
+	}
+	err := j.write(Event{Event: "done", Succeeded: succeeded, Failed: failed, Interrupted: interrupted, Time: now().Unix()})
+	if cerr := j.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Flush writes buffered events to disk.
+func (j *Journal) Flush() error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.w.Flush()
+}
+
+// Close flushes and closes the file.
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	err := j.w.Flush()
+	if cerr := j.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (j *Journal) write(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	b = append(b, '\n')
+	if _, err := j.w.Write(b); err != nil {
+		return err
+	}
+	// Every line reaches the disk before the caller moves on, so a crash or
+	// power loss never forgets an item that was reported as done.
+	if err := j.w.Flush(); err != nil {
+		return err
+	}
+	return j.f.Sync()
+}
+
+// Job is a journal read back from disk.
+type Job struct {
+	Header
+	Path string `json:"path"`
+	// Runs counts the start plus every resume.
+	Runs        int   `json:"runs"`
+	Succeeded   int   `json:"succeeded"`
+	Failed      int   `json:"failed"`
+	Remaining   int   `json:"remaining"`
+	Finished    bool  `json:"finished"`
+	Interrupted bool  `json:"interrupted"`
+	Updated     int64 `json:"updated"`
+	// LastErrors holds the latest error of each item that has not succeeded.
+	LastErrors map[string]string `json:"last_errors,omitempty"`
+
+	remaining []json.RawMessage
+}
+
+// Load reads a journal. A truncated last line (the process died while
+// writing it) is ignored.
+func Load(path string) (*Job, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 256*1024*1024)
+	if !sc.Scan() {
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s: empty journal", path)
+	}
+	job := &Job{Path: path, LastErrors: map[string]string{}}
+	if err := json.Unmarshal(sc.Bytes(), &job.Header); err != nil || job.Event != "job" {
+		return nil, fmt.Errorf("%s: not a job journal", path)
+	}
+	job.Runs = 1
+	job.Updated = job.Created
+	succeeded := map[string]int{}
+	for sc.Scan() {
+		var ev Event
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			continue
+		}
+		job.Updated = ev.Time
+		switch ev.Event {
+		case "item":
+			key := keyString(ev.Data[job.Key])
+			if ev.Status == "ok" {
+				succeeded[key]++
+				delete(job.LastErrors, key)
+			} else {
+				job.LastErrors[key] = ev.Error
+			}
+		case "resume":
+			job.Runs++
+			job.Finished = false
+		case "done":
+			job.Finished = true
+			job.Interrupted = ev.Interrupted
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	// An item is done once a success with its key has been recorded. Equal
+	// keys (the same URL imported twice) are matched one success each.
+	pending := map[string]bool{}
+	for _, raw := range job.Items {
+		key, err := job.itemKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if succeeded[key] > 0 {
+			succeeded[key]--
+			job.Succeeded++
+			continue
+		}
+		job.remaining = append(job.remaining, raw)
+		pending[key] = true
+		if _, ok := job.LastErrors[key]; ok {
+			job.Failed++
+		}
+	}
+	job.Remaining = len(job.remaining)
+	for key := range job.LastErrors {
+		if !pending[key] {
+			delete(job.LastErrors, key)
+		}
+	}
+	return job, nil
+}
+
+// Complete reports whether every item has succeeded.
+func (j *Job) Complete() bool { return j.Remaining == 0 }
+
+// RemainingItems decodes the items that have not succeeded into dst, which
+// must be a pointer to a slice.
+func (j *Job) RemainingItems(dst any) error {
+	raw, err := json.Marshal(j.remaining)
+	if err != nil {
+		return err
+	}
+	if j.remaining == nil {
+		raw = []byte("[]")
+	}
+	return json.Unmarshal(raw, dst)
+}
+
+func (j *Job) itemKey(raw json.RawMessage) (string, error) {
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return "", err
+	}
+	if m, ok := v.(map[string]any); ok {
+		return keyString(m[j.Key]), nil
+	}
+	return keyString(v), nil
+}
+
+// keyString normalises a decoded JSON value so that 42, 42.0 and "42" from
+// different writers compare equal.
+func keyString(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return fmt.Sprintf("%.0f", t)
+	case string:
+		return t
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+// List loads every journal in dir, newest first. Unreadable files are
+// skipped.
+func List(dir string) ([]*Job, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var jobs []*Job
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), Ext) {
+			continue
+		}
+		job, err := Load(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	sort.SliceStable(jobs, func(a, b int) bool {
+		if jobs[a].Created != jobs[b].Created {
+			return jobs[a].Created > jobs[b].Created
+		}
+		return jobs[a].ID > jobs[b].ID
+	})
+	return jobs, nil
+}
+
+// Find resolves a job by id or unique id prefix in dir, or by file path.
+func Find(dir, ref string) (*Job, error) {
+	if strings.ContainsAny(ref, `/\`) || strings.HasSuffix(ref, Ext) {
+		return Load(ref)
+	}
+	jobs, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+	var match *Job
+	for _, job := range jobs {
+		if job.ID == ref {
+			return job, nil
+		}
+		if strings.HasPrefix(job.ID, ref) {
+			if match != nil {
+				return nil, fmt.Errorf("job id %q is ambiguous", ref)
+			}
+			match = job
+		}
+	}
+	if match == nil {
+		return nil, fmt.Errorf("job not found: %s", ref)
+	}
+	return match, nil
+}
@@ -0,0 +1,118 @@
+package journal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type item struct {
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+}
+
+func TestJournalRemainingItems(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "job1"+Ext)
+	items := []item{{URL: "https://a"}, {URL: "https://b"}, {URL: "https://a", Title: "again"}, {URL: "https://c"}}
+	j, err := Create(path, Header{ID: "job1", Command: "import", Key: "url"}, items)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	_ = j.Record(map[string]any{"url": "https://a", "bookmark_id": 1}, nil)
+	_ = j.Record(map[string]any{"url": "https://b"}, errors.New("boom"))
+	if err := j.Done(1, 1, true); err != nil {
+		t.Fatalf("Done: %v", err)
+	}
+	// A crash mid-write leaves a partial line behind.
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	_, _ = f.WriteString(`{"event":"item","sta`)
+	f.Close()
+
+	job, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if job.Succeeded != 1 || job.Failed != 1 || job.Remaining != 3 || !job.Interrupted || job.Complete() {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+	if job.LastErrors["https://b"] != "boom" {
+		t.Fatalf("unexpected errors: %v", job.LastErrors)
+	}
+	var rest []item
+	if err := job.RemainingItems(&rest); err != nil {
+		t.Fatalf("RemainingItems: %v", err)
+	}
+	if len(rest) != 3 || rest[0].URL != "https://b" || rest[1].Title != "again" || rest[2].URL != "https://c" {
+		t.Fatalf("unexpected remaining: %+v", rest)
+	}
+
+	j, err = Append(path)
+	if err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	for _, u := range []string{"https://b", "https://a", "https://c"} {
+		_ = j.Record(map[string]any{"url": u}, nil)
+	}
+	if err := j.Done(3, 0, false); err != nil {
+		t.Fatalf("Done: %v", err)
+	}
+	job, err = Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !job.Complete() || job.Runs != 2 || len(job.LastErrors) != 0 {
+		t.Fatalf("expected complete job: %+v", job)
+	}
+}
+
+func TestJournalScalarItemsAndFind(t *testing.T) {
+	dir := t.TempDir()
+	for _, id := range []string{"20240101-000000-aaaaaa", "20240102-000000-bbbbbb"} {
+		j, err := Create(filepath.Join(dir, id+Ext), Header{ID: id, Command: "archive", Key: "bookmark_id"}, []int64{10, 20})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		_ = j.Record(map[string]any{"bookmark_id": int64(20)}, nil)
+		j.Close()
+	}
+	if _, err := Find(dir, "2024"); err == nil {
+		t.Fatalf("expected ambiguous prefix error")
+	}
+	job, err := Find(dir, "20240102")
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	var ids []int64
+	if err := job.RemainingItems(&ids); err != nil || len(ids) != 1 || ids[0] != 10 {
+		t.Fatalf("unexpected remaining ids %v (%v)", ids, err)
+	}
+	jobs, err := List(dir)
+	if err != nil || len(jobs) != 2 {
+		t.Fatalf("List: %d jobs (%v)", len(jobs), err)
+	}
+	if _, err := Find(dir, "nope"); err == nil {
+		t.Fatalf("expected not found")
+	}
+}
+
+func TestJournalRecordIsDurable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "job1"+Ext)
+	j, err := Create(path, Header{ID: "job1", Command: "archive", Key: "bookmark_id"}, []int64{10, 20})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	defer j.Close()
+	if err := j.Record(map[string]any{"bookmark_id": int64(10)}, nil); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	// Read back without closing, as after a crash.
+	job, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if job.Succeeded != 1 || job.Remaining != 1 {
+		t.Fatalf("record not on disk: %+v", job)
+	}
+}
@@ -0,0 +1,272 @@
+// Package mcp implements the tool-serving side of the Model Context Protocol:
+// JSON-RPC 2.0 messages, one per line, over a reader and writer (stdio).
+//
+// Only what a tool server needs is supported: initialize, ping, tools/list
+// and tools/call. Notifications are accepted and ignored.
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ProtocolVersions are the MCP revisions this server speaks, newest first.
+var ProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// JSON-RPC error codes.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Tool is a callable tool. Handler receives the raw "arguments" object and
+// returns a JSON object for structuredContent; an error is reported to the
+// client as a tool result with isError set, not as a protocol error.
+type Tool struct {
+	Name         string
+	Title        string
+	Description  string
+	InputSchema  map[string]any
+	OutputSchema map[string]any
+	Annotations  *Annotations
+	Handler      func(ctx context.Context, args json.RawMessage) (any, error)
+}
+
+// Annotations are the behaviour hints MCP clients show or act on.
+type Annotations struct {
+	ReadOnly    bool `json:"readOnlyHint"`
+	Destructive bool `json:"destructiveHint"`
+	Idempotent  bool `json:"idempotentHint"`
+	OpenWorld   bool `json:"openWorldHint"`
+}
+
+// Server dispatches requests to its tools.
+type Server struct {
+	Name         string
+	Version      string
+	Instructions string
+	// Logf, when set, receives one line per handled request.
+	Logf func(format string, args ...any)
+
+	tools []Tool
+	index map[string]int
+}
+
+// AddTool registers t, replacing a tool with the same name.
+func (s *Server) AddTool(t Tool) {
+	if s.index == nil {
+		s.index = map[string]int{}
+	}
+	if i, ok := s.index[t.Name]; ok {
+		s.tools[i] = t
+		return
+	}
+	s.index[t.Name] = len(s.tools)
+	s.tools = append(s.tools, t)
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string { return e.Message }
+
+// Serve reads requests from r until EOF or ctx is done, writing responses to
+// w. Requests are handled in order.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	lines := make(chan []byte)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		for sc.Scan() {
+			line := append([]byte(nil), sc.Bytes()...)
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+		errc <- sc.Err()
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case line, ok := <-lines:
+			if !ok {
+				return <-errc
+			}
+			if len(line) == 0 {
+				continue
+			}
+			if resp := s.handle(ctx, line); resp != nil {
+				if err := s.write(w, resp); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func (s *Server) write(w io.Writer, resp *response) error {
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// handle returns the response to one message, or nil for a notification.
+func (s *Server) handle(ctx context.Context, line []byte) *response {
+	var req request
+	if err := json.Unmarshal(line, &req); err != nil {
+		return &response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: CodeParseError, Message: "parse error: " + err.Error()}}
+	}
+	if len(req.ID) == 0 {
+		s.logf("notification %s", req.Method)
+		return nil
+	}
+	resp := &response{JSONRPC: "2.0", ID: req.ID}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		resp.Error = &rpcError{Code: CodeInvalidRequest, Message: "invalid request"}
+		return resp
+	}
+	result, err := s.dispatch(ctx, req)
+	if err != nil {
+		var rerr *rpcError
+		if !errors.As(err, &rerr) {
+			rerr = &rpcError{Code: CodeInternalError, Message: err.Error()}
+		}
+		resp.Error = rerr
+		s.logf("%s: error %d %s", req.Method, rerr.Code, rerr.Message)
+		return resp
+	}
+	resp.Result = result
+	return resp
+}
+
+func (s *Server) dispatch(ctx context.Context, req request) (any, error) {
+	switch req.Method {
+	case "initialize":
+		var p struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		if len(req.Params) > 0 {
+			if err := json.Unmarshal(req.Params, &p); err != nil {
+				return nil, &rpcError{Code: CodeInvalidParams, Message: err.Error()}
+			}
+		}
+		version := ProtocolVersions[0]
+		for _, v := range ProtocolVersions {
+			if v == p.ProtocolVersion {
+				version = v
+			}
+		}
+		s.logf("initialize: protocol %s", version)
+		result := map[string]any{
+			"protocolVersion": version,
+			"capabilities":    map[string]any{"tools": map[string]any{"listChanged": false}},
+			"serverInfo":      map[string]any{"name": s.Name, "version": s.Version},
+		}
+		if s.Instructions != "" {
+			result["instructions"] = s.Instructions
+		}
+		return result, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		tools := make([]map[string]any, 0, len(s.tools))
+		for _, t := range s.tools {
+			tools = append(tools, describe(t))
+		}
+		return map[string]any{"tools": tools}, nil
+	case "tools/call":
+		var p struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			return nil, &rpcError{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		i, ok := s.index[p.Name]
+		if !ok {
+			return nil, &rpcError{Code: CodeInvalidParams, Message: fmt.Sprintf("unknown tool: %s", p.Name)}
+		}
+		if len(p.Arguments) == 0 || string(p.Arguments) == "null" {
+			p.Arguments = json.RawMessage("{}")
+		}
+		s.logf("tools/call %s", p.Name)
+		return callResult(s.tools[i].Handler(ctx, p.Arguments)), nil
+	default:
+		return nil, &rpcError{Code: CodeMethodNotFound, Message: fmt.Sprintf("method not found: %s", req.Method)}
+	}
+}
+
+func describe(t Tool) map[string]any {
+	d := map[string]any{
+		"name":        t.Name,
+		"description": t.Description,
+		"inputSchema": t.InputSchema,
+	}
+	if t.Title != "" {
+		d["title"] = t.Title
+	}
+	if t.OutputSchema != nil {
+		d["outputSchema"] = t.OutputSchema
+	}
+	if t.Annotations != nil {
+		d["annotations"] = t.Annotations
+	}
+	return d
+}
+
+// callResult wraps a handler's value as structured content plus its JSON
+// text, or an error as an isError result.
+func callResult(v any, err error) map[string]any {
+	if err != nil {
+		return map[string]any{
+			"content": []map[string]any{{"type": "text", "text": err.Error()}},
+			"isError": true,
+		}
+	}
+	b, merr := json.Marshal(v)
+	if merr != nil {
+		return callResult(nil, merr)
+	}
+	return map[string]any{
+		"content":           []map[string]any{{"type": "text", "text": string(b)}},
+		"structuredContent": v,
+		"isError":           false,
+	}
+}
+
+func (s *Server) logf(format string, args ...any) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
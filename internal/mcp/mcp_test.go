@@ -0,0 +1,85 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func serve(t *testing.T, s *Server, lines ...string) []map[string]any {
+	t.Helper()
+	var out bytes.Buffer
+	if err := s.Serve(context.Background(), strings.NewReader(strings.Join(lines, "\n")+"\n"), &out); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	var resps []map[string]any
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var m map[string]any
+		if err := dec.Decode(&m); err != nil {
+			t.Fatalf("decode response: %v\n%s", err, out.String())
+		}
+		resps = append(resps, m)
+	}
+	return resps
+}
+
+func TestServer(t *testing.T) {
+	s := &Server{Name: "test", Version: "1.0"}
+	s.AddTool(Tool{
+		Name:        "echo",
+		Description: "Echo a message",
+		InputSchema: map[string]any{"type": "object", "properties": map[string]any{"msg": map[string]any{"type": "string"}}},
+		Annotations: &Annotations{ReadOnly: true},
+		Handler: func(ctx context.Context, args json.RawMessage) (any, error) {
+			var a struct{ Msg string }
+			if err := json.Unmarshal(args, &a); err != nil {
+				return nil, err
+			}
+			if a.Msg == "" {
+				return nil, errors.New("msg is required")
+			}
+			return map[string]any{"msg": a.Msg}, nil
+		},
+	})
+
+	resps := serve(t, s,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"t","version":"0"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"echo","arguments":{"msg":"hi"}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"echo","arguments":{}}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"nope"}}`,
+		`{"jsonrpc":"2.0","id":"six","method":"resources/list"}`,
+		`not json`,
+	)
+	if len(resps) != 7 {
+		t.Fatalf("expected 7 responses (notification unanswered), got %d: %v", len(resps), resps)
+	}
+	init := resps[0]["result"].(map[string]any)
+	if init["protocolVersion"] != "2024-11-05" || init["serverInfo"].(map[string]any)["name"] != "test" {
+		t.Fatalf("initialize: %v", init)
+	}
+	tools := resps[1]["result"].(map[string]any)["tools"].([]any)
+	if len(tools) != 1 || tools[0].(map[string]any)["name"] != "echo" || tools[0].(map[string]any)["annotations"].(map[string]any)["readOnlyHint"] != true {
+		t.Fatalf("tools/list: %v", tools)
+	}
+	call := resps[2]["result"].(map[string]any)
+	if call["isError"] != false || call["structuredContent"].(map[string]any)["msg"] != "hi" {
+		t.Fatalf("tools/call: %v", call)
+	}
+	if failed := resps[3]["result"].(map[string]any); failed["isError"] != true {
+		t.Fatalf("tool error should be an isError result: %v", failed)
+	}
+	for i, code := range map[int]float64{4: CodeInvalidParams, 5: CodeMethodNotFound, 6: CodeParseError} {
+		if e, ok := resps[i]["error"].(map[string]any); !ok || e["code"] != code {
+			t.Fatalf("response %d: expected error %v, got %v", i, code, resps[i])
+		}
+	}
+	if resps[5]["id"] != "six" {
+		t.Fatalf("id not echoed: %v", resps[5])
+	}
+}
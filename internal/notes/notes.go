@@ -0,0 +1,140 @@
+// Package notes renders bookmark highlights for note-taking tools: Markdown,
+// Obsidian notes and Readwise CSV imports.
+package notes
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vburojevic/instapaper-cli/internal/convert"
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+)
+
+// Article is a bookmark and its highlights.
+type Article struct {
+	Bookmark   instapaper.Bookmark
+	Highlights []instapaper.Highlight
+}
+
+// NewArticle returns an Article with highlights in reading order.
+func NewArticle(b instapaper.Bookmark, highlights []instapaper.Highlight) Article {
+	hls := append([]instapaper.Highlight(nil), highlights...)
+	sort.SliceStable(hls, func(i, j int) bool {
+		if hls[i].Position != hls[j].Position {
+			return hls[i].Position < hls[j].Position
+		}
+		return hls[i].HighlightID < hls[j].HighlightID
+	})
+	return Article{Bookmark: b, Highlights: hls}
+}
+
+// Filename returns the file name of an article: its bookmark id. The title
+// is only in the note itself, so a title changed on the service side keeps
+// updating the same file.
+func Filename(a Article, ext string) string {
+	return strconv.FormatInt(int64(a.Bookmark.BookmarkID), 10) + ext
+}
+
+// Markdown renders one article as a standalone Markdown document.
+func Markdown(a Article) string {
+	var b strings.Builder
+	writeArticle(&b, a, "#", false)
+	return b.String()
+}
+
+// MarkdownDigest renders several articles as sections of one document.
+func MarkdownDigest(articles []Article) string {
+	var b strings.Builder
+	b.WriteString("# Instapaper highlights\n")
+	for _, a := range articles {
+		b.WriteString("\n")
+		writeArticle(&b, a, "##", false)
+	}
+	return b.String()
+}
+
+// Obsidian renders one article as an Obsidian note: YAML front matter with the
+// bookmark metadata and one block reference (^hl-<id>) per highlight.
+func Obsidian(a Article) string {
+	bm := a.Bookmark
+	var b strings.Builder
+	b.WriteString(convert.FrontMatter(convert.Metadata{
+		ID:          int64(bm.BookmarkID),
+		URL:         bm.URL,
+		Title:       bm.Title,
+		Description: bm.Description,
+		Tags:        instapaper.TagNames(bm.Tags),
+		Progress:    float64(bm.Progress),
+		Starred:     bool(bm.Starred),
+		Time:        int64(bm.Time),
+	}))
+	writeArticle(&b, a, "#", true)
+	return b.String()
+}
+
+func writeArticle(b *strings.Builder, a Article, heading string, blockRefs bool) {
+	title := strings.TrimSpace(a.Bookmark.Title)
+	if title == "" {
+		title = a.Bookmark.URL
+	}
+	b.WriteString(heading + " " + title + "\n\n")
+	if a.Bookmark.URL != "" {
+		b.WriteString("<" + a.Bookmark.URL + ">\n\n")
+	}
+	for _, h := range a.Highlights {
+		b.WriteString(quote(h.Text))
+		if blockRefs {
+			fmt.Fprintf(b, " ^hl-%d", int64(h.HighlightID))
+		}
+		b.WriteString("\n\n")
+		if note := strings.TrimSpace(h.Note); note != "" {
+			b.WriteString("**Note:** " + note + "\n\n")
+		}
+	}
+}
+
+func quote(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("> "+line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ReadwiseHeader is the column layout of Readwise's generic CSV import.
+var ReadwiseHeader = []string{"Highlight", "Title", "Author", "URL", "Note", "Location", "Date"}
+
+// WriteReadwiseCSV writes one row per highlight in Readwise's CSV import format.
+func WriteReadwiseCSV(w io.Writer, articles []Article) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(ReadwiseHeader); err != nil {
+		return err
+	}
+	for _, a := range articles {
+		for _, h := range a.Highlights {
+			date := ""
+			if h.Time > 0 {
+				date = time.Unix(int64(h.Time), 0).UTC().Format("2006-01-02 15:04:05")
+			}
+			row := []string{
+				h.Text,
+				a.Bookmark.Title,
+				"",
+				a.Bookmark.URL,
+				h.Note,
+				strconv.FormatInt(int64(h.Position), 10),
+				date,
+			}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,64 @@
+package notes
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+)
+
+func sampleArticle() Article {
+	return NewArticle(
+		instapaper.Bookmark{BookmarkID: 42, Title: "Go: Generics, Explained!", URL: "https://go.dev/blog/intro-generics", Tags: []instapaper.Tag{{Name: "golang"}}, Time: 1700000000},
+		[]instapaper.Highlight{
+			{HighlightID: 2, BookmarkID: 42, Text: "second", Position: 5, Time: 1700000100, Note: "remember"},
+			{HighlightID: 1, BookmarkID: 42, Text: "first\nline two", Position: 1, Time: 1700000050},
+		},
+	)
+}
+
+func TestFilenameIsStable(t *testing.T) {
+	a := sampleArticle()
+	if got := Filename(a, ".md"); got != "42.md" {
+		t.Fatalf("Filename=%q", got)
+	}
+	a.Bookmark.Title = "Renamed"
+	if got := Filename(a, ".md"); got != "42.md" {
+		t.Fatalf("Filename after rename=%q", got)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	got := Markdown(sampleArticle())
+	want := "# Go: Generics, Explained!\n\n<https://go.dev/blog/intro-generics>\n\n> first\n> line two\n\n> second\n\n**Note:** remember\n\n"
+	if got != want {
+		t.Fatalf("Markdown mismatch:\n%q", got)
+	}
+	digest := MarkdownDigest([]Article{sampleArticle()})
+	if !strings.HasPrefix(digest, "# Instapaper highlights\n\n## Go: Generics") {
+		t.Fatalf("digest mismatch:\n%s", digest)
+	}
+}
+
+func TestObsidian(t *testing.T) {
+	got := Obsidian(sampleArticle())
+	for _, want := range []string{"---\nid: 42\n", "tags:\n  - \"golang\"\n", "> first\n> line two ^hl-1\n", "> second ^hl-2\n"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("Obsidian missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestWriteReadwiseCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteReadwiseCSV(&buf, []Article{sampleArticle()}); err != nil {
+		t.Fatalf("WriteReadwiseCSV: %v", err)
+	}
+	want := "Highlight,Title,Author,URL,Note,Location,Date\n" +
+		"\"first\nline two\",\"Go: Generics, Explained!\",,https://go.dev/blog/intro-generics,,1,2023-11-14 22:14:10\n" +
+		"second,\"Go: Generics, Explained!\",,https://go.dev/blog/intro-generics,remember,5,2023-11-14 22:15:00\n"
+	if buf.String() != want {
+		t.Fatalf("csv mismatch:\n%s", buf.String())
+	}
+}
@@ -63,20 +63,14 @@ func (s *Signer) AuthorizationHeader(method, rawURL string, bodyParams url.Value
 		oauthParams["oauth_token"] = token.Key
 	}
 
-	normalizedURL, err := normalizeURL(rawURL)
+	tokenSecret := ""
+	if token != nil {
+		tokenSecret = token.Secret
+	}
+	sig, err := s.signature(method, rawURL, oauthParams, bodyParams, tokenSecret)
 	if err != nil {
 		return "", err
 	}
-
-	paramString := normalizeParams(oauthParams, bodyParams)
-	baseString := strings.ToUpper(method) + "&" + oauthEscape(normalizedURL) + "&" + oauthEscape(paramString)
-
-	signingKey := oauthEscape(s.ConsumerSecret) + "&"
-	if token != nil {
-		signingKey += oauthEscape(token.Secret)
-	}
-
-	sig := signHMACSHA1(signingKey, baseString)
 	oauthParams["oauth_signature"] = sig
 
 	// Deterministic header ordering for easier debugging.
@@ -94,6 +88,85 @@ func (s *Signer) AuthorizationHeader(method, rawURL string, bodyParams url.Value
 	return "OAuth " + strings.Join(parts, ", "), nil
 }
 
+// signature computes the HMAC-SHA1 signature over the request and the
+// oauth_* parameters (excluding oauth_signature itself).
+func (s *Signer) signature(method, rawURL string, oauthParams map[string]string, bodyParams url.Values, tokenSecret string) (string, error) {
+	normalizedURL, err := normalizeURL(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	paramString := normalizeParams(oauthParams, bodyParams)
+	baseString := strings.ToUpper(method) + "&" + oauthEscape(normalizedURL) + "&" + oauthEscape(paramString)
+
+	signingKey := oauthEscape(s.ConsumerSecret) + "&" + oauthEscape(tokenSecret)
+	return signHMACSHA1(signingKey, baseString), nil
+}
+
+// ErrInvalidSignature is returned by Verify when a request is not signed
+// with the expected consumer and token secrets.
+var ErrInvalidSignature = errors.New("oauth1: invalid signature")
+
+// Verify checks the Authorization header of a signed request, the server-side
+// counterpart of AuthorizationHeader. tokenSecret maps an oauth_token to its
+// secret and reports whether the token is known. It returns the token key, or
+// "" for requests signed without a token (xAuth).
+func (s *Signer) Verify(method, rawURL, header string, bodyParams url.Values, tokenSecret func(key string) (string, bool)) (string, error) {
+	params, err := ParseAuthorizationHeader(header)
+	if err != nil {
+		return "", err
+	}
+	if params["oauth_consumer_key"] != s.ConsumerKey {
+		return "", errors.New("oauth1: unknown consumer key")
+	}
+	if m := params["oauth_signature_method"]; m != "HMAC-SHA1" {
+		return "", fmt.Errorf("oauth1: unsupported signature method %q", m)
+	}
+	got := params["oauth_signature"]
+	delete(params, "oauth_signature")
+	key := params["oauth_token"]
+	secret := ""
+	if key != "" {
+		var ok bool
+		if secret, ok = tokenSecret(key); !ok {
+			return "", errors.New("oauth1: unknown token")
+		}
+	}
+	want, err := s.signature(method, rawURL, params, bodyParams, secret)
+	if err != nil {
+		return "", err
+	}
+	if !hmac.Equal([]byte(got), []byte(want)) {
+		return "", ErrInvalidSignature
+	}
+	return key, nil
+}
+
+// ParseAuthorizationHeader decodes the oauth_* parameters of an
+// "OAuth k="v", ..." header.
+func ParseAuthorizationHeader(header string) (map[string]string, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(header), "OAuth ")
+	if !ok {
+		return nil, errors.New("oauth1: missing OAuth authorization header")
+	}
+	params := map[string]string{}
+	for _, part := range strings.Split(rest, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("oauth1: malformed header parameter %q", part)
+		}
+		v, err := url.PathUnescape(strings.Trim(v, `"`))
+		if err != nil {
+			return nil, fmt.Errorf("oauth1: malformed header parameter %q", part)
+		}
+		if k == "realm" {
+			continue
+		}
+		params[k] = v
+	}
+	return params, nil
+}
+
 type pair struct {
 	k string
 	v string
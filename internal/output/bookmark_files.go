@@ -0,0 +1,205 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+)
+
+// BookmarkGroup is a folder of bookmarks for the file exports below.
+type BookmarkGroup struct {
+	Folder    string
+	Bookmarks []instapaper.Bookmark
+}
+
+// csvDefaultFields is the column order used when no --fields are given. It
+// matches the columns ip import --input-format csv reads back.
+var csvDefaultFields = []string{"bookmark_id", "url", "title", "description", "tags", "folder", "starred", "progress", "progress_timestamp", "time"}
+
+// IsFileFormat reports whether format is one of the bookmark file formats.
+func IsFileFormat(format string) bool {
+	switch strings.ToLower(format) {
+	case "csv", "netscape", "opml":
+		return true
+	default:
+		return false
+	}
+}
+
+// WriteBookmarkFile writes groups as csv, netscape or opml.
+func WriteBookmarkFile(w io.Writer, format string, groups []BookmarkGroup, fieldsCSV string) error {
+	switch strings.ToLower(format) {
+	case "csv":
+		return WriteBookmarksCSV(w, groups, fieldsCSV)
+	case "netscape":
+		return WriteNetscape(w, groups)
+	case "opml":
+		return WriteOPML(w, "Instapaper bookmarks", groups)
+	default:
+		return fmt.Errorf("unsupported file format: %s", format)
+	}
+}
+
+// WriteBookmarksCSV writes a header row followed by one row per bookmark.
+// fieldsCSV selects and orders the columns; "folder" is accepted in addition
+// to the bookmark fields.
+func WriteBookmarksCSV(w io.Writer, groups []BookmarkGroup, fieldsCSV string) error {
+	fields := csvDefaultFields
+	if strings.TrimSpace(fieldsCSV) != "" {
+		fields = nil
+		for _, f := range strings.Split(fieldsCSV, ",") {
+			f = strings.ToLower(strings.TrimSpace(f))
+			if f == "folder" {
+				fields = append(fields, f)
+				continue
+			}
+			parsed, err := parseFields(f)
+			if err != nil {
+				return err
+			}
+			fields = append(fields, parsed...)
+		}
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(fields); err != nil {
+		return err
+	}
+	for _, g := range groups {
+		for _, b := range g.Bookmarks {
+			m := bookmarkToMap(b)
+			row := make([]string, len(fields))
+			for i, f := range fields {
+				if f == "folder" {
+					row[i] = g.Folder
+					continue
+				}
+				row[i] = csvValue(m[f])
+			}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvValue(v any) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case int64:
+		return strconv.FormatInt(t, 10)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	case []instapaper.Tag:
+		return strings.Join(instapaper.TagNames(t), ",")
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+// WriteNetscape writes a Netscape bookmark file (the format browsers import
+// and export) with one H3 folder per group. ADD_DATE carries the bookmark
+// time and TAGS its tags.
+func WriteNetscape(w io.Writer, groups []BookmarkGroup) error {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE NETSCAPE-Bookmark-file-1>\n")
+	b.WriteString("<!-- This is an automatically generated file.\n     It will be read and overwritten.\n     DO NOT EDIT! -->\n")
+	b.WriteString("<META HTTP-EQUIV=\"Content-Type\" CONTENT=\"text/html; charset=UTF-8\">\n")
+	b.WriteString("<TITLE>Bookmarks</TITLE>\n<H1>Bookmarks</H1>\n<DL><p>\n")
+	for _, g := range groups {
+		fmt.Fprintf(&b, "    <DT><H3>%s</H3>\n    <DL><p>\n", html.EscapeString(oneLine(g.Folder)))
+		for _, bm := range g.Bookmarks {
+			title := oneLine(bm.Title)
+			if title == "" {
+				title = bm.URL
+			}
+			fmt.Fprintf(&b, "        <DT><A HREF=\"%s\"", html.EscapeString(bm.URL))
+			if bm.Time > 0 {
+				fmt.Fprintf(&b, " ADD_DATE=\"%d\"", int64(bm.Time))
+			}
+			if len(bm.Tags) > 0 {
+				fmt.Fprintf(&b, " TAGS=\"%s\"", html.EscapeString(strings.Join(instapaper.TagNames(bm.Tags), ",")))
+			}
+			fmt.Fprintf(&b, ">%s</A>\n", html.EscapeString(title))
+			if desc := oneLine(bm.Description); desc != "" {
+				fmt.Fprintf(&b, "        <DD>%s\n", html.EscapeString(desc))
+			}
+		}
+		b.WriteString("    </DL><p>\n")
+	}
+	b.WriteString("</DL><p>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type opmlOutline struct {
+	XMLName  xml.Name      `xml:"outline"`
+	Type     string        `xml:"type,attr,omitempty"`
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	URL      string        `xml:"url,attr,omitempty"`
+	Created  string        `xml:"created,attr,omitempty"`
+	Category string        `xml:"category,attr,omitempty"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    struct {
+		Title string `xml:"title"`
+	} `xml:"head"`
+	Body struct {
+		Outlines []opmlOutline `xml:"outline"`
+	} `xml:"body"`
+}
+
+// WriteOPML writes an OPML 2.0 outline with one parent outline per group and
+// a type="link" outline per bookmark. Tags become the category attribute.
+func WriteOPML(w io.Writer, title string, groups []BookmarkGroup) error {
+	doc := opmlDocument{Version: "2.0"}
+	doc.Head.Title = title
+	for _, g := range groups {
+		folder := opmlOutline{Text: oneLine(g.Folder), Title: oneLine(g.Folder)}
+		for _, bm := range g.Bookmarks {
+			text := oneLine(bm.Title)
+			if text == "" {
+				text = bm.URL
+			}
+			item := opmlOutline{
+				Type:     "link",
+				Text:     text,
+				URL:      bm.URL,
+				Category: strings.Join(instapaper.TagNames(bm.Tags), ","),
+			}
+			if bm.Time > 0 {
+				item.Created = time.Unix(int64(bm.Time), 0).UTC().Format(time.RFC1123Z)
+			}
+			folder.Outlines = append(folder.Outlines, item)
+		}
+		doc.Body.Outlines = append(doc.Body.Outlines, folder)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
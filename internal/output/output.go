@@ -70,6 +70,62 @@ func PrintBookmarks(w io.Writer, format string, bookmarks []instapaper.Bookmark)
 	return tw.Flush()
 }
 
+// bookmarkGroupJSON is the json/ndjson shape of one group.
+type bookmarkGroupJSON struct {
+	Group     string                `json:"group"`
+	Count     int                   `json:"count"`
+	Bookmarks []instapaper.Bookmark `json:"bookmarks"`
+}
+
+// PrintBookmarkGroups prints grouped bookmarks: one object per group in
+// json/ndjson, the group key as an extra first column in plain, and one
+// titled table per group otherwise.
+func PrintBookmarkGroups(w io.Writer, format string, groups []BookmarkGroup) error {
+	switch {
+	case strings.EqualFold(format, "json") || isNDJSON(format):
+		records := make([]bookmarkGroupJSON, 0, len(groups))
+		for _, g := range groups {
+			bookmarks := g.Bookmarks
+			if bookmarks == nil {
+				bookmarks = []instapaper.Bookmark{}
+			}
+			records = append(records, bookmarkGroupJSON{Group: g.Folder, Count: len(g.Bookmarks), Bookmarks: bookmarks})
+		}
+		if !isNDJSON(format) {
+			return WriteJSON(w, records)
+		}
+		for _, rec := range records {
+			if err := WriteJSONLine(w, rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	case strings.EqualFold(format, "plain"):
+		for _, g := range groups {
+			var buf strings.Builder
+			if err := PrintBookmarks(&buf, format, g.Bookmarks); err != nil {
+				return err
+			}
+			for _, line := range strings.SplitAfter(buf.String(), "\n") {
+				if line != "" {
+					fmt.Fprintf(w, "%s\t%s", oneLine(g.Folder), line)
+				}
+			}
+		}
+		return nil
+	}
+	for i, g := range groups {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s (%d)\n", oneLine(g.Folder), len(g.Bookmarks))
+		if err := PrintBookmarks(w, format, g.Bookmarks); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func PrintBookmarksWithFields(w io.Writer, format string, bookmarks []instapaper.Bookmark, fieldsCSV string) error {
 	fields, err := parseFields(fieldsCSV)
 	if err != nil {
@@ -2,8 +2,10 @@ package output
 
 import (
 	"bytes"
+	"encoding/xml"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/vburojevic/instapaper-cli/internal/instapaper"
@@ -170,3 +172,158 @@ func TestPrintPlainOutputs(t *testing.T) {
 		t.Fatalf("plain highlights mismatch\n--- got ---\n%s\n--- want ---\n%s", got, want)
 	}
 }
+
+func sampleGroups() []BookmarkGroup {
+	return []BookmarkGroup{{
+		Folder: "Read & Review",
+		Bookmarks: []instapaper.Bookmark{{
+			BookmarkID:  7,
+			URL:         "https://example.com/a?x=1&y=2",
+			Title:       "A \"quoted\" title",
+			Description: "first line\nsecond",
+			Time:        1700000000,
+			Starred:     instapaper.BoolInt(true),
+			Tags:        []instapaper.Tag{{Name: "go"}, {Name: "cli"}},
+		}},
+	}}
+}
+
+func TestWriteBookmarksCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteBookmarksCSV(&buf, sampleGroups(), ""); err != nil {
+		t.Fatalf("WriteBookmarksCSV: %v", err)
+	}
+	want := "bookmark_id,url,title,description,tags,folder,starred,progress,progress_timestamp,time\n" +
+		"7,https://example.com/a?x=1&y=2,\"A \"\"quoted\"\" title\",\"first line\nsecond\",\"go,cli\",Read & Review,true,0,0,1700000000\n"
+	if buf.String() != want {
+		t.Fatalf("csv mismatch:\n%s", buf.String())
+	}
+	buf.Reset()
+	if err := WriteBookmarksCSV(&buf, sampleGroups(), "url, folder"); err != nil {
+		t.Fatalf("WriteBookmarksCSV fields: %v", err)
+	}
+	if got := buf.String(); got != "url,folder\nhttps://example.com/a?x=1&y=2,Read & Review\n" {
+		t.Fatalf("csv fields mismatch:\n%s", got)
+	}
+	if err := WriteBookmarksCSV(&buf, sampleGroups(), "nope"); err == nil {
+		t.Fatalf("expected unknown field error")
+	}
+}
+
+func TestWriteNetscape(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteNetscape(&buf, sampleGroups()); err != nil {
+		t.Fatalf("WriteNetscape: %v", err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		"<!DOCTYPE NETSCAPE-Bookmark-file-1>",
+		"<DT><H3>Read &amp; Review</H3>",
+		`<DT><A HREF="https://example.com/a?x=1&amp;y=2" ADD_DATE="1700000000" TAGS="go,cli">A &#34;quoted&#34; title</A>`,
+		"<DD>first line second",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("netscape missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestWriteOPML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteOPML(&buf, "Bookmarks", sampleGroups()); err != nil {
+		t.Fatalf("WriteOPML: %v", err)
+	}
+	var doc opmlDocument
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("opml is not well-formed: %v\n%s", err, buf.String())
+	}
+	if len(doc.Body.Outlines) != 1 || doc.Body.Outlines[0].Text != "Read & Review" {
+		t.Fatalf("unexpected folders: %+v", doc.Body.Outlines)
+	}
+	item := doc.Body.Outlines[0].Outlines[0]
+	if item.Type != "link" || item.URL != "https://example.com/a?x=1&y=2" || item.Category != "go,cli" || item.Created != "Tue, 14 Nov 2023 22:13:20 +0000" {
+		t.Fatalf("unexpected item: %+v", item)
+	}
+}
+
+func TestTemplateBookmarks(t *testing.T) {
+	tmpl, err := ParseTemplate(`{{define "header"}}# Reading list ({{len .}}){{end}}- [{{mdescape .Title}}]({{.URL}}) {{domain .URL}} {{.Time | date "2006-01-02"}} {{.Tags | tags | join ", "}} {{.Folder}}`)
+	if err != nil {
+		t.Fatalf("ParseTemplate: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Bookmarks(&buf, sampleGroups()); err != nil {
+		t.Fatalf("Bookmarks: %v", err)
+	}
+	want := "# Reading list (1)\n- [A \"quoted\" title](https://example.com/a?x=1&y=2) example.com 2023-11-14 go, cli Read & Review\n"
+	if buf.String() != want {
+		t.Fatalf("template mismatch:\n%q\nwant\n%q", buf.String(), want)
+	}
+
+	tmpl, err = ParseTemplate("ip archive {{.BookmarkID}} # {{truncate 8 .Title | shquote}}\n")
+	if err != nil {
+		t.Fatalf("ParseTemplate: %v", err)
+	}
+	buf.Reset()
+	groups := []BookmarkGroup{{Bookmarks: []instapaper.Bookmark{{BookmarkID: 3, Title: "it's a long title"}}}}
+	if err := tmpl.Bookmarks(&buf, groups); err != nil {
+		t.Fatalf("Bookmarks: %v", err)
+	}
+	if got := buf.String(); got != "ip archive 3 # 'it'\\''s ...'\n" {
+		t.Fatalf("shell template mismatch: %q", got)
+	}
+	if _, err := ParseTemplate("{{.Title"); err == nil {
+		t.Fatalf("expected parse error")
+	}
+}
+
+func TestTemplateFoldersAndHighlights(t *testing.T) {
+	tmpl, err := ParseTemplate("{{.FolderID}}={{upper .Title}}")
+	if err != nil {
+		t.Fatalf("ParseTemplate: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Folders(&buf, []instapaper.Folder{{FolderID: 2, Title: "Work"}, {FolderID: 3, Title: "Play"}}); err != nil {
+		t.Fatalf("Folders: %v", err)
+	}
+	if got := buf.String(); got != "2=WORK\n3=PLAY\n" {
+		t.Fatalf("folders template mismatch: %q", got)
+	}
+
+	tmpl, err = ParseTemplate(`> {{oneline .Text}} ({{.Time | date "rfc3339"}}){{define "footer"}}{{json .}}{{end}}`)
+	if err != nil {
+		t.Fatalf("ParseTemplate: %v", err)
+	}
+	buf.Reset()
+	hls := []instapaper.Highlight{{Type: "highlight", HighlightID: 4, BookmarkID: 1, Text: "a\nb", Time: 1700000000}}
+	if err := tmpl.Highlights(&buf, hls); err != nil {
+		t.Fatalf("Highlights: %v", err)
+	}
+	want := "> a b (2023-11-14T22:13:20Z)\n" + `[{"type":"highlight","highlight_id":4,"bookmark_id":1,"text":"a\nb","time":1700000000,"position":0}]` + "\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("highlights template mismatch:\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestPrintBookmarkGroups(t *testing.T) {
+	groups := []BookmarkGroup{
+		{Folder: "go.dev", Bookmarks: []instapaper.Bookmark{{BookmarkID: 1, Title: "A", URL: "https://go.dev/a"}}},
+		{Folder: "(none)"},
+	}
+	var buf bytes.Buffer
+	if err := PrintBookmarkGroups(&buf, "plain", groups); err != nil {
+		t.Fatalf("PrintBookmarkGroups plain: %v", err)
+	}
+	if got := buf.String(); got != "go.dev\t1\t0\t0.0000\tA\thttps://go.dev/a\n" {
+		t.Fatalf("plain groups mismatch: %q", got)
+	}
+	buf.Reset()
+	if err := PrintBookmarkGroups(&buf, "ndjson", groups); err != nil {
+		t.Fatalf("PrintBookmarkGroups ndjson: %v", err)
+	}
+	want := `{"group":"go.dev","count":1,"bookmarks":[{"type":"","bookmark_id":1,"url":"https://go.dev/a","title":"A"}]}` + "\n" +
+		`{"group":"(none)","count":0,"bookmarks":[]}` + "\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("ndjson groups mismatch:\n%s", got)
+	}
+}
@@ -0,0 +1,204 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/vburojevic/instapaper-cli/internal/convert"
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+)
+
+// Template renders bookmarks, folders or highlights through a Go
+// text/template, executed once per item with the item as dot. A newline is
+// added after each item unless the template already ends with one. Optional
+// "header" and "footer" templates run once around the items, with the whole
+// item slice as dot.
+type Template struct {
+	tmpl *template.Template
+}
+
+// TemplateBookmark is the dot of a bookmark template: every Bookmark field
+// plus the folder the bookmark was exported from (empty for plain listings).
+type TemplateBookmark struct {
+	instapaper.Bookmark
+	Folder string
+}
+
+// ParseTemplate parses text with the template helper functions available.
+func ParseTemplate(text string) (*Template, error) {
+	tmpl, err := template.New("output").Funcs(TemplateFuncs()).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{tmpl: tmpl}, nil
+}
+
+// TemplateFuncs returns the helper functions available to output templates.
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"date":     templateDate,
+		"truncate": templateTruncate,
+		"domain":   templateDomain,
+		"tags":     instapaper.TagNames,
+		"join":     templateJoin,
+		"mdescape": convert.EscapeMarkdown,
+		"shquote":  shellQuote,
+		"json":     templateJSON,
+		"oneline":  oneLine,
+		"lower":    strings.ToLower,
+		"upper":    strings.ToUpper,
+	}
+}
+
+// Bookmarks renders each bookmark of each group.
+func (t *Template) Bookmarks(w io.Writer, groups []BookmarkGroup) error {
+	items := []TemplateBookmark{}
+	for _, g := range groups {
+		for _, b := range g.Bookmarks {
+			items = append(items, TemplateBookmark{Bookmark: b, Folder: g.Folder})
+		}
+	}
+	return executeItems(w, t.tmpl, items)
+}
+
+// Folders renders each folder.
+func (t *Template) Folders(w io.Writer, folders []instapaper.Folder) error {
+	if folders == nil {
+		folders = []instapaper.Folder{}
+	}
+	return executeItems(w, t.tmpl, folders)
+}
+
+// Highlights renders each highlight.
+func (t *Template) Highlights(w io.Writer, highlights []instapaper.Highlight) error {
+	if highlights == nil {
+		highlights = []instapaper.Highlight{}
+	}
+	return executeItems(w, t.tmpl, highlights)
+}
+
+func executeItems[T any](w io.Writer, tmpl *template.Template, items []T) error {
+	if err := executeNamed(w, tmpl, "header", items); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, item := range items {
+		buf.Reset()
+		if err := tmpl.Execute(&buf, item); err != nil {
+			return err
+		}
+		if buf.Len() > 0 && buf.Bytes()[buf.Len()-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return executeNamed(w, tmpl, "footer", items)
+}
+
+// executeNamed runs the named associated template, if defined, with a
+// trailing newline like the per-item output.
+func executeNamed(w io.Writer, tmpl *template.Template, name string, data any) error {
+	if tmpl.Lookup(name) == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		return err
+	}
+	if buf.Len() > 0 && buf.Bytes()[buf.Len()-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// templateDate formats a unix timestamp in UTC with a Go time layout;
+// "rfc3339" is accepted as a shorthand. Zero timestamps render empty.
+func templateDate(layout string, v any) (string, error) {
+	var sec int64
+	switch t := v.(type) {
+	case instapaper.Int64:
+		sec = int64(t)
+	case int64:
+		sec = t
+	case int:
+		sec = int64(t)
+	case float64:
+		sec = int64(t)
+	case time.Time:
+		if t.IsZero() {
+			return "", nil
+		}
+		sec = t.Unix()
+	default:
+		return "", fmt.Errorf("date: unsupported value %T", v)
+	}
+	if sec == 0 {
+		return "", nil
+	}
+	if strings.EqualFold(layout, "rfc3339") {
+		layout = time.RFC3339
+	}
+	return time.Unix(sec, 0).UTC().Format(layout), nil
+}
+
+// templateTruncate shortens s to at most n characters on one line, ending
+// in "..." when cut.
+func templateTruncate(n int, s string) string {
+	s = oneLine(s)
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	if n <= 3 {
+		return string(r[:n])
+	}
+	return string(r[:n-3]) + "..."
+}
+
+// templateDomain returns the host of a URL without a leading "www.".
+func templateDomain(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// templateJoin joins strings or tags with sep.
+func templateJoin(sep string, v any) (string, error) {
+	switch t := v.(type) {
+	case []string:
+		return strings.Join(t, sep), nil
+	case []instapaper.Tag:
+		return strings.Join(instapaper.TagNames(t), sep), nil
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("join: unsupported value %T", v)
+	}
+}
+
+// shellQuote quotes s as a single POSIX shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func templateJSON(v any) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
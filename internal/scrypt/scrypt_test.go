@@ -0,0 +1,43 @@
+package scrypt
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// Test vectors from RFC 7914, sections 11 and 12.
+func TestKeyRFC7914(t *testing.T) {
+	cases := []struct {
+		password, salt string
+		n, r, p        int
+		want           string
+	}{
+		{"", "", 16, 1, 1, "77d6576238657b203b19ca42c18a0497f16b4844e3074ae8dfdffa3fede21442fcd0069ded0948f8326a753a0fc81f17e8d3e0fb2e0d3628cf35e20c38d18906"},
+		{"password", "NaCl", 1024, 8, 16, "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640"},
+	}
+	for _, c := range cases {
+		got, err := Key([]byte(c.password), []byte(c.salt), c.n, c.r, c.p, 64)
+		if err != nil {
+			t.Fatalf("Key(%q): %v", c.password, err)
+		}
+		if hex.EncodeToString(got) != c.want {
+			t.Fatalf("Key(%q, N=%d) = %x", c.password, c.n, got)
+		}
+	}
+}
+
+func TestPBKDF2RFC7914(t *testing.T) {
+	got := PBKDF2([]byte("passwd"), []byte("salt"), 1, 64)
+	want := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"
+	if hex.EncodeToString(got) != want {
+		t.Fatalf("PBKDF2 = %x", got)
+	}
+}
+
+func TestKeyRejectsBadParams(t *testing.T) {
+	for _, n := range []int{0, 1, 3, 1000} {
+		if _, err := Key([]byte("p"), []byte("s"), n, 8, 1, 32); err == nil {
+			t.Fatalf("expected error for N=%d", n)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Package search implements a small on-disk inverted index over bookmark
+// metadata and cached article text, with a boolean query language.
+package search
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+const indexVersion = 1
+
+// Fields that can be scoped in queries (title:, url:, tag:, ...).
+const (
+	FieldTitle       = "title"
+	FieldURL         = "url"
+	FieldTag         = "tag"
+	FieldDescription = "description"
+	FieldBody        = "body"
+)
+
+var allFields = []string{FieldTitle, FieldURL, FieldTag, FieldDescription, FieldBody}
+
+// fieldWeights boosts matches in short, descriptive fields over body text.
+var fieldWeights = map[string]float64{
+	FieldTitle:       3,
+	FieldTag:         2,
+	FieldURL:         1.5,
+	FieldDescription: 1.5,
+	FieldBody:        1,
+}
+
+// Document is the searchable content of one bookmark.
+type Document struct {
+	ID          int64
+	Title       string
+	URL         string
+	Description string
+	Tags        []string
+	Body        string
+}
+
+// Source describes a document that may be (re)indexed. Signature changes
+// whenever the content changes; Load is only called for changed documents.
+type Source struct {
+	ID        int64
+	Signature string
+	Load      func() (Document, error)
+}
+
+type Posting struct {
+	Doc       int64
+	Positions []int
+}
+
+type docInfo struct {
+	Signature string
+	Lengths   map[string]int
+}
+
+// Index is an inverted index: field -> term -> postings.
+type Index struct {
+	Version int
+	Docs    map[int64]*docInfo
+	Terms   map[string]map[string][]Posting
+}
+
+// UpdateStats reports what Update changed.
+type UpdateStats struct {
+	Added   int `json:"added"`
+	Updated int `json:"updated"`
+	Removed int `json:"removed"`
+}
+
+func New() *Index {
+	idx := &Index{
+		Version: indexVersion,
+		Docs:    map[int64]*docInfo{},
+		Terms:   map[string]map[string][]Posting{},
+	}
+	for _, f := range allFields {
+		idx.Terms[f] = map[string][]Posting{}
+	}
+	return idx
+}
+
+// Load reads an index from path. A missing or outdated index is returned empty.
+func Load(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return New(), nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	idx := &Index{}
+	if err := gob.NewDecoder(f).Decode(idx); err != nil {
+		return nil, fmt.Errorf("parse search index %s: %w", path, err)
+	}
+	if idx.Version != indexVersion {
+		return New(), nil
+	}
+	if idx.Docs == nil {
+		idx.Docs = map[int64]*docInfo{}
+	}
+	if idx.Terms == nil {
+		idx.Terms = map[string]map[string][]Posting{}
+	}
+	for _, field := range allFields {
+		if idx.Terms[field] == nil {
+			idx.Terms[field] = map[string][]Posting{}
+		}
+	}
+	return idx, nil
+}
+
+func (idx *Index) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(f).Encode(idx); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(path)
+		if err2 := os.Rename(tmp, path); err2 != nil {
+			_ = os.Remove(tmp)
+			return err2
+		}
+	}
+	return nil
+}
+
+// Len returns the number of indexed documents.
+func (idx *Index) Len() int { return len(idx.Docs) }
+
+// Update brings the index in line with sources: new and changed documents are
+// (re)indexed and documents no longer present are removed.
+func (idx *Index) Update(sources []Source) (UpdateStats, error) {
+	var stats UpdateStats
+	seen := make(map[int64]bool, len(sources))
+	var stale []int64
+	var changed []Source
+	for _, src := range sources {
+		seen[src.ID] = true
+		info, ok := idx.Docs[src.ID]
+		if ok && info.Signature == src.Signature {
+			continue
+		}
+		if ok {
+			stats.Updated++
+			stale = append(stale, src.ID)
+		} else {
+			stats.Added++
+		}
+		changed = append(changed, src)
+	}
+	for id := range idx.Docs {
+		if !seen[id] {
+			stale = append(stale, id)
+			stats.Removed++
+		}
+	}
+	idx.remove(stale)
+	for _, src := range changed {
+		doc, err := src.Load()
+		if err != nil {
+			return stats, err
+		}
+		doc.ID = src.ID
+		idx.add(doc, src.Signature)
+	}
+	return stats, nil
+}
+
+func (idx *Index) add(doc Document, signature string) {
+	info := &docInfo{Signature: signature, Lengths: map[string]int{}}
+	fields := map[string][]string{
+		FieldTitle:       Tokenize(doc.Title),
+		FieldURL:         Tokenize(doc.URL),
+		FieldTag:         Tokenize(strings.Join(doc.Tags, " ")),
+		FieldDescription: Tokenize(doc.Description),
+		FieldBody:        Tokenize(doc.Body),
+	}
+	for field, tokens := range fields {
+		info.Lengths[field] = len(tokens)
+		positions := map[string][]int{}
+		for pos, tok := range tokens {
+			positions[tok] = append(positions[tok], pos)
+		}
+		terms := idx.Terms[field]
+		for term, pos := range positions {
+			terms[term] = append(terms[term], Posting{Doc: doc.ID, Positions: pos})
+		}
+	}
+	idx.Docs[doc.ID] = info
+}
+
+func (idx *Index) remove(ids []int64) {
+	if len(ids) == 0 {
+		return
+	}
+	drop := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		if _, ok := idx.Docs[id]; ok {
+			drop[id] = true
+			delete(idx.Docs, id)
+		}
+	}
+	if len(drop) == 0 {
+		return
+	}
+	for _, terms := range idx.Terms {
+		for term, postings := range terms {
+			kept := postings[:0]
+			for _, p := range postings {
+				if !drop[p.Doc] {
+					kept = append(kept, p)
+				}
+			}
+			if len(kept) == 0 {
+				delete(terms, term)
+				continue
+			}
+			terms[term] = kept
+		}
+	}
+}
+
+// Tokenize lowercases s and splits it into runs of letters and digits.
+func Tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,438 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Query is a parsed search expression.
+//
+// Syntax:
+//
+//	go generics          both terms (implicit AND)
+//	"type parameters"    phrase
+//	go OR rust           either term
+//	go AND NOT rust      exclusion (also: go -rust)
+//	(go OR rust) tag:news
+//	title:generics url:"go.dev" tag:golang
+//	gener*               prefix match
+type Query struct {
+	root node
+}
+
+// Result is a matching document and its relevance score.
+type Result struct {
+	ID    int64
+	Score float64
+}
+
+type node interface {
+	eval(idx *Index) map[int64]float64
+}
+
+type andNode struct{ left, right node }
+type orNode struct{ left, right node }
+type notNode struct{ child node }
+
+type termNode struct {
+	field  string // empty = all fields
+	tokens []string
+	prefix bool
+}
+
+// Parse parses a query expression.
+func Parse(expr string) (*Query, error) {
+	toks, err := lexQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(toks) == 0 {
+		return nil, fmt.Errorf("empty search query")
+	}
+	p := &parser{toks: toks}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("unexpected %q in search query", p.toks[p.pos].text)
+	}
+	return &Query{root: root}, nil
+}
+
+// Search evaluates q against idx and returns results ordered by score.
+func (idx *Index) Search(q *Query) []Result {
+	scores := q.root.eval(idx)
+	out := make([]Result, 0, len(scores))
+	for id, score := range scores {
+		out = append(out, Result{ID: id, Score: score})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].ID > out[j].ID
+	})
+	return out
+}
+
+func (n andNode) eval(idx *Index) map[int64]float64 {
+	// NOT on either side narrows the other side instead of matching everything.
+	if nn, ok := n.right.(notNode); ok {
+		return subtract(n.left.eval(idx), nn.child.eval(idx))
+	}
+	if nn, ok := n.left.(notNode); ok {
+		return subtract(n.right.eval(idx), nn.child.eval(idx))
+	}
+	left := n.left.eval(idx)
+	right := n.right.eval(idx)
+	out := map[int64]float64{}
+	for id, s := range left {
+		if r, ok := right[id]; ok {
+			out[id] = s + r
+		}
+	}
+	return out
+}
+
+func (n orNode) eval(idx *Index) map[int64]float64 {
+	out := n.left.eval(idx)
+	for id, s := range n.right.eval(idx) {
+		out[id] += s
+	}
+	return out
+}
+
+func (n notNode) eval(idx *Index) map[int64]float64 {
+	all := make(map[int64]float64, len(idx.Docs))
+	for id := range idx.Docs {
+		all[id] = 0
+	}
+	return subtract(all, n.child.eval(idx))
+}
+
+func subtract(from, remove map[int64]float64) map[int64]float64 {
+	for id := range remove {
+		delete(from, id)
+	}
+	return from
+}
+
+func (n termNode) eval(idx *Index) map[int64]float64 {
+	fields := allFields
+	if n.field != "" {
+		fields = []string{n.field}
+	}
+	out := map[int64]float64{}
+	for _, field := range fields {
+		for id, s := range n.evalField(idx, field) {
+			out[id] += s * fieldWeights[field]
+		}
+	}
+	return out
+}
+
+// evalField scores a term or phrase in one field with BM25.
+func (n termNode) evalField(idx *Index, field string) map[int64]float64 {
+	terms := idx.Terms[field]
+	if len(n.tokens) == 1 {
+		if n.prefix {
+			out := map[int64]float64{}
+			for term, postings := range terms {
+				if strings.HasPrefix(term, n.tokens[0]) {
+					for id, s := range idx.bm25(field, postings, nil) {
+						out[id] += s
+					}
+				}
+			}
+			return out
+		}
+		return idx.bm25(field, terms[n.tokens[0]], nil)
+	}
+	// Phrase: count positions where every token follows the previous one.
+	lists := make([]map[int64][]int, len(n.tokens))
+	for i, tok := range n.tokens {
+		lists[i] = map[int64][]int{}
+		for _, p := range terms[tok] {
+			lists[i][p.Doc] = p.Positions
+		}
+	}
+	freqs := map[int64]int{}
+	for doc, starts := range lists[0] {
+		count := 0
+		for _, start := range starts {
+			ok := true
+			for i := 1; i < len(n.tokens); i++ {
+				if !containsInt(lists[i][doc], start+i) {
+					ok = false
+					break
+				}
+			}
+			if ok {
+				count++
+			}
+		}
+		if count > 0 {
+			freqs[doc] = count
+		}
+	}
+	if len(freqs) == 0 {
+		return nil
+	}
+	postings := make([]Posting, 0, len(freqs))
+	for doc := range freqs {
+		postings = append(postings, Posting{Doc: doc})
+	}
+	return idx.bm25(field, postings, freqs)
+}
+
+// bm25 scores postings for one term; freqs overrides per-document term
+// frequency (used for phrases).
+func (idx *Index) bm25(field string, postings []Posting, freqs map[int64]int) map[int64]float64 {
+	const k1, b = 1.2, 0.75
+	n := float64(len(idx.Docs))
+	df := float64(len(postings))
+	if df == 0 || n == 0 {
+		return nil
+	}
+	idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+	total := 0
+	for _, info := range idx.Docs {
+		total += info.Lengths[field]
+	}
+	avg := float64(total) / n
+	if avg == 0 {
+		avg = 1
+	}
+	out := make(map[int64]float64, len(postings))
+	for _, p := range postings {
+		tf := float64(len(p.Positions))
+		if freqs != nil {
+			tf = float64(freqs[p.Doc])
+		}
+		dl := 0.0
+		if info, ok := idx.Docs[p.Doc]; ok {
+			dl = float64(info.Lengths[field])
+		}
+		out[p.Doc] = idf * (tf * (k1 + 1)) / (tf + k1*(1-b+b*dl/avg))
+	}
+	return out
+}
+
+func containsInt(list []int, v int) bool {
+	i := sort.SearchInts(list, v)
+	return i < len(list) && list[i] == v
+}
+
+// --- lexer/parser ---
+
+type queryTokKind int
+
+const (
+	tokTerm queryTokKind = iota
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type queryTok struct {
+	kind   queryTokKind
+	text   string
+	field  string
+	phrase bool
+}
+
+func lexQuery(s string) ([]queryTok, error) {
+	var toks []queryTok
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			toks = append(toks, queryTok{kind: tokLParen, text: "("})
+			i++
+		case c == ')':
+			toks = append(toks, queryTok{kind: tokRParen, text: ")"})
+			i++
+		case c == '-' && i+1 < len(s) && s[i+1] != ' ':
+			toks = append(toks, queryTok{kind: tokNot, text: "-"})
+			i++
+		default:
+			field := ""
+			// Field prefix like title: or url:
+			j := i
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || s[j] == '_') {
+				j++
+			}
+			if j < len(s) && s[j] == ':' && j > i {
+				name, err := normalizeField(s[i:j])
+				if err != nil {
+					return nil, err
+				}
+				field = name
+				i = j + 1
+			}
+			if i < len(s) && s[i] == '"' {
+				end := strings.IndexByte(s[i+1:], '"')
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated phrase in search query")
+				}
+				toks = append(toks, queryTok{kind: tokTerm, text: s[i+1 : i+1+end], field: field, phrase: true})
+				i += end + 2
+				continue
+			}
+			j = i
+			for j < len(s) && !strings.ContainsRune(" \t\r\n()\"", rune(s[j])) {
+				j++
+			}
+			word := s[i:j]
+			i = j
+			if word == "" {
+				if field != "" {
+					return nil, fmt.Errorf("missing value for %s: in search query", field)
+				}
+				continue
+			}
+			if field == "" {
+				switch word {
+				case "AND", "&&":
+					toks = append(toks, queryTok{kind: tokAnd, text: word})
+					continue
+				case "OR", "||":
+					toks = append(toks, queryTok{kind: tokOr, text: word})
+					continue
+				case "NOT", "!":
+					toks = append(toks, queryTok{kind: tokNot, text: word})
+					continue
+				}
+			}
+			toks = append(toks, queryTok{kind: tokTerm, text: word, field: field})
+		}
+	}
+	return toks, nil
+}
+
+func normalizeField(name string) (string, error) {
+	switch strings.ToLower(name) {
+	case "title":
+		return FieldTitle, nil
+	case "url", "site", "domain":
+		return FieldURL, nil
+	case "tag", "tags":
+		return FieldTag, nil
+	case "description", "desc":
+		return FieldDescription, nil
+	case "body", "text":
+		return FieldBody, nil
+	default:
+		return "", fmt.Errorf("unknown search field: %s", name)
+	}
+}
+
+type parser struct {
+	toks []queryTok
+	pos  int
+}
+
+func (p *parser) peek() (queryTok, bool) {
+	if p.pos >= len(p.toks) {
+		return queryTok{}, false
+	}
+	return p.toks[p.pos], true
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind != tokOr {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left: left, right: right}
+	}
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind == tokOr || t.kind == tokRParen {
+			return left, nil
+		}
+		if t.kind == tokAnd {
+			p.pos++
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of search query")
+	}
+	switch t.kind {
+	case tokNot:
+		p.pos++
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{child: child}, nil
+	case tokLParen:
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := p.peek(); !ok || t.kind != tokRParen {
+			return nil, fmt.Errorf("missing ) in search query")
+		}
+		p.pos++
+		return inner, nil
+	case tokTerm:
+		p.pos++
+		return newTermNode(t)
+	default:
+		return nil, fmt.Errorf("unexpected %q in search query", t.text)
+	}
+}
+
+func newTermNode(t queryTok) (node, error) {
+	text := t.text
+	prefix := false
+	if !t.phrase && strings.HasSuffix(text, "*") {
+		prefix = true
+		text = strings.TrimRight(text, "*")
+	}
+	tokens := Tokenize(text)
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("search term %q has no searchable characters", t.text)
+	}
+	if len(tokens) > 1 {
+		prefix = false
+	}
+	return termNode{field: t.field, tokens: tokens, prefix: prefix}, nil
+}
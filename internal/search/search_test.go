@@ -0,0 +1,137 @@
+package search
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func testIndex(t *testing.T) *Index {
+	t.Helper()
+	docs := []Document{
+		{ID: 1, Title: "Go generics explained", URL: "https://go.dev/blog/intro-generics", Tags: []string{"golang"}, Body: "Type parameters arrive in Go 1.18."},
+		{ID: 2, Title: "Rust ownership", URL: "https://doc.rust-lang.org/book", Tags: []string{"rust"}, Body: "Borrowing and lifetimes. Generics are also covered."},
+		{ID: 3, Title: "Cooking pasta", URL: "https://example.com/pasta", Body: "Boil water with salt."},
+	}
+	var sources []Source
+	for _, d := range docs {
+		d := d
+		sources = append(sources, Source{ID: d.ID, Signature: "v1", Load: func() (Document, error) { return d, nil }})
+	}
+	idx := New()
+	stats, err := idx.Update(sources)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if stats.Added != 3 {
+		t.Fatalf("added=%d want 3", stats.Added)
+	}
+	return idx
+}
+
+func searchIDs(t *testing.T, idx *Index, expr string) []int64 {
+	t.Helper()
+	q, err := Parse(expr)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", expr, err)
+	}
+	var ids []int64
+	for _, r := range idx.Search(q) {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func TestSearchQueries(t *testing.T) {
+	idx := testIndex(t)
+	cases := []struct {
+		expr string
+		want []int64
+	}{
+		{"generics", []int64{1, 2}},
+		{`"type parameters"`, []int64{1}},
+		{`"parameters type"`, nil},
+		{"generics AND rust", []int64{2}},
+		{"generics -rust", []int64{1}},
+		{"generics NOT rust", []int64{1}},
+		{"pasta OR ownership", []int64{3, 2}},
+		{"title:generics", []int64{1}},
+		{"url:go.dev", []int64{1}},
+		{"tag:rust", []int64{2}},
+		{"(pasta OR rust) salt", []int64{3}},
+		{"gener*", []int64{1, 2}},
+	}
+	for _, tc := range cases {
+		// Ranking is covered separately; compare as sets.
+		got := searchIDs(t, idx, tc.expr)
+		if !sameSet(got, tc.want) {
+			t.Fatalf("%q: got %v want %v", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestSearchRanksTitleAboveBody(t *testing.T) {
+	idx := testIndex(t)
+	got := searchIDs(t, idx, "generics")
+	if len(got) != 2 || got[0] != 1 {
+		t.Fatalf("got %v, want title match first", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{"", "(go", `"open`, "nope:go", "go OR"} {
+		if _, err := Parse(expr); err == nil {
+			t.Fatalf("Parse(%q): expected error", expr)
+		}
+	}
+}
+
+func TestUpdateAndSaveRoundTrip(t *testing.T) {
+	idx := testIndex(t)
+	// Drop doc 3, change doc 2.
+	stats, err := idx.Update([]Source{
+		{ID: 1, Signature: "v1"},
+		{ID: 2, Signature: "v2", Load: func() (Document, error) { return Document{Title: "Zig comptime"}, nil }},
+	})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if stats.Updated != 1 || stats.Removed != 1 || stats.Added != 0 {
+		t.Fatalf("stats=%+v", stats)
+	}
+	path := filepath.Join(t.TempDir(), "index.gob")
+	if err := idx.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if loaded.Len() != 2 {
+		t.Fatalf("len=%d want 2", loaded.Len())
+	}
+	if got := searchIDs(t, loaded, "rust OR pasta"); len(got) != 0 {
+		t.Fatalf("stale postings: %v", got)
+	}
+	if got := searchIDs(t, loaded, "comptime"); !sameSet(got, []int64{2}) {
+		t.Fatalf("comptime: %v", got)
+	}
+}
+
+func sameSet(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	m := map[int64]int{}
+	for _, v := range a {
+		m[v]++
+	}
+	for _, v := range b {
+		m[v]--
+	}
+	for _, n := range m {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,420 @@
+// Package store keeps a local, on-disk mirror of an Instapaper account so that
+// read-only commands can run without hitting the API.
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+)
+
+const (
+	dataName      = "store.json"
+	textDirName   = "text"
+	schemaVersion = 1
+)
+
+// Entry is a bookmark plus the local bookkeeping needed to sync it.
+type Entry struct {
+	Bookmark instapaper.Bookmark `json:"bookmark"`
+	// Folder is "unread", "archive", or a user folder id. An empty folder marks
+	// an entry that was removed from its folder and has not reappeared yet.
+	Folder string `json:"folder"`
+	// TextHash is the bookmark hash at the time the text view was cached.
+	TextHash string `json:"text_hash,omitempty"`
+}
+
+type Store struct {
+	Version    int                               `json:"version"`
+	SyncedAt   int64                             `json:"synced_at,omitempty"`
+	User       instapaper.User                   `json:"user"`
+	Folders    []instapaper.Folder               `json:"folders,omitempty"`
+	Bookmarks  map[string]*Entry                 `json:"bookmarks"`
+	Highlights map[string][]instapaper.Highlight `json:"highlights,omitempty"`
+
+	dir string
+}
+
+// ApplyResult counts the changes made by a single Apply call.
+type ApplyResult struct {
+	Added   int `json:"added"`
+	Updated int `json:"updated"`
+	Removed int `json:"removed"`
+}
+
+// Open loads the store in dir. A missing store is returned empty.
+func Open(dir string) (*Store, error) {
+	if dir == "" {
+		return nil, errors.New("store dir is empty")
+	}
+	s := &Store{
+		Version:    schemaVersion,
+		Bookmarks:  map[string]*Entry{},
+		Highlights: map[string][]instapaper.Highlight{},
+		dir:        dir,
+	}
+	path := filepath.Join(dir, dataName)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, err
+	}
+	if len(b) == 0 {
+		return s, nil
+	}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("parse store %s: %w", path, err)
+	}
+	if s.Version > schemaVersion {
+		return nil, fmt.Errorf("store %s has unsupported version %d", path, s.Version)
+	}
+	s.Version = schemaVersion
+	if s.Bookmarks == nil {
+		s.Bookmarks = map[string]*Entry{}
+	}
+	if s.Highlights == nil {
+		s.Highlights = map[string][]instapaper.Highlight{}
+	}
+	return s, nil
+}
+
+func (s *Store) Dir() string { return s.dir }
+
+// Empty reports whether the store has never been synced.
+func (s *Store) Empty() bool {
+	return s.SyncedAt == 0 && len(s.Bookmarks) == 0
+}
+
+func (s *Store) Save() error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	path := filepath.Join(s.dir, dataName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	// Windows can't replace existing files via rename.
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(path)
+		if err2 := os.Rename(tmp, path); err2 != nil {
+			_ = os.Remove(tmp)
+			return err2
+		}
+	}
+	return nil
+}
+
+// Apply merges one folder's list response into the store. Bookmarks are
+// upserted into folder; delete ids only detach entries that still belong to
+// folder, because a moved bookmark may already have been seen elsewhere.
+func (s *Store) Apply(folder string, bookmarks []instapaper.Bookmark, deleteIDs []instapaper.Int64) ApplyResult {
+	var res ApplyResult
+	for _, b := range bookmarks {
+		key := idKey(int64(b.BookmarkID))
+		if e, ok := s.Bookmarks[key]; ok {
+			e.Bookmark = b
+			e.Folder = folder
+			res.Updated++
+			continue
+		}
+		s.Bookmarks[key] = &Entry{Bookmark: b, Folder: folder}
+		res.Added++
+	}
+	for _, id := range deleteIDs {
+		e, ok := s.Bookmarks[idKey(int64(id))]
+		if !ok || e.Folder != folder {
+			continue
+		}
+		e.Folder = ""
+		res.Removed++
+	}
+	return res
+}
+
+// Prune drops detached entries along with their highlights and cached text.
+// It returns the number of bookmarks removed.
+func (s *Store) Prune() (int, error) {
+	removed := 0
+	for key, e := range s.Bookmarks {
+		if e.Folder != "" {
+			continue
+		}
+		delete(s.Bookmarks, key)
+		delete(s.Highlights, key)
+		if err := os.Remove(s.textPath(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, err
+		}
+		removed++
+	}
+	for key := range s.Highlights {
+		if _, ok := s.Bookmarks[key]; !ok {
+			delete(s.Highlights, key)
+		}
+	}
+	return removed, nil
+}
+
+// Retain detaches entries whose folder is not in folders, e.g. after a user
+// folder was deleted upstream.
+func (s *Store) Retain(folders []string) {
+	keep := make(map[string]bool, len(folders))
+	for _, f := range folders {
+		keep[f] = true
+	}
+	for _, e := range s.Bookmarks {
+		if e.Folder != "" && !keep[e.Folder] {
+			e.Folder = ""
+		}
+	}
+}
+
+// HaveEntries returns the bookmarks currently stored for folder, suitable for
+// building the list endpoint's have parameter.
+func (s *Store) HaveEntries(folder string) []instapaper.Bookmark {
+	out := []instapaper.Bookmark{}
+	for _, e := range s.Bookmarks {
+		if e.Folder == folder {
+			out = append(out, e.Bookmark)
+		}
+	}
+	return out
+}
+
+// Entry returns the stored entry for a bookmark id.
+func (s *Store) Entry(id int64) (*Entry, bool) {
+	e, ok := s.Bookmarks[idKey(id)]
+	if !ok || e.Folder == "" {
+		return nil, false
+	}
+	return e, true
+}
+
+// Entries returns all attached entries, newest first.
+func (s *Store) Entries() []*Entry {
+	out := make([]*Entry, 0, len(s.Bookmarks))
+	for _, e := range s.Bookmarks {
+		if e.Folder != "" {
+			out = append(out, e)
+		}
+	}
+	sortEntries(out)
+	return out
+}
+
+// BookmarksInFolder returns the bookmarks in folder ("unread", "archive", "starred",
+// or a user folder id), newest first.
+func (s *Store) BookmarksInFolder(folder string) []instapaper.Bookmark {
+	out := []instapaper.Bookmark{}
+	for _, e := range s.Entries() {
+		if folder == "starred" {
+			if bool(e.Bookmark.Starred) {
+				out = append(out, e.Bookmark)
+			}
+			continue
+		}
+		if e.Folder == folder {
+			out = append(out, e.Bookmark)
+		}
+	}
+	return out
+}
+
+// BookmarksByTag returns the bookmarks carrying tag across all folders, newest first.
+func (s *Store) BookmarksByTag(tag string) []instapaper.Bookmark {
+	out := []instapaper.Bookmark{}
+	for _, e := range s.Entries() {
+		for _, t := range e.Bookmark.Tags {
+			if strings.EqualFold(t.Name, tag) {
+				out = append(out, e.Bookmark)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// ResolveFolder maps a folder name, id or user folder title to a stored folder key.
+func (s *Store) ResolveFolder(folder string) (string, error) {
+	if folder == "" {
+		return "unread", nil
+	}
+	lower := strings.ToLower(folder)
+	if lower == "unread" || lower == "starred" || lower == "archive" {
+		return lower, nil
+	}
+	if _, err := strconv.ParseInt(folder, 10, 64); err == nil {
+		return folder, nil
+	}
+	for _, f := range s.Folders {
+		if strings.EqualFold(f.Title, folder) {
+			return idKey(int64(f.FolderID)), nil
+		}
+	}
+	return "", fmt.Errorf("folder not found in local store: %s", folder)
+}
+
+// FolderTitle returns a display title for a stored folder key.
+func (s *Store) FolderTitle(folder string) string {
+	switch folder {
+	case "unread":
+		return "Unread"
+	case "archive":
+		return "Archive"
+	case "starred":
+		return "Starred"
+	}
+	for _, f := range s.Folders {
+		if idKey(int64(f.FolderID)) == folder {
+			return f.Title
+		}
+	}
+	return folder
+}
+
+// MergeHighlights upserts highlights by id and returns how many were new.
+func (s *Store) MergeHighlights(highlights []instapaper.Highlight) int {
+	added := 0
+	for _, h := range highlights {
+		key := idKey(int64(h.BookmarkID))
+		existing := s.Highlights[key]
+		replaced := false
+		for i := range existing {
+			if existing[i].HighlightID == h.HighlightID {
+				existing[i] = h
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			s.Highlights[key] = append(existing, h)
+			added++
+		}
+	}
+	return added
+}
+
+// ClearHighlights drops the stored highlights for the bookmarks in folder.
+func (s *Store) ClearHighlights(folder string) {
+	for key, e := range s.Bookmarks {
+		if e.Folder == folder {
+			delete(s.Highlights, key)
+		}
+	}
+}
+
+// Detach marks every entry in folder as removed, so a full resync can
+// re-attach only what the API still returns.
+func (s *Store) Detach(folder string) {
+	for _, e := range s.Bookmarks {
+		if e.Folder == folder {
+			e.Folder = ""
+		}
+	}
+}
+
+func (s *Store) HighlightsFor(bookmarkID int64) []instapaper.Highlight {
+	out := append([]instapaper.Highlight{}, s.Highlights[idKey(bookmarkID)]...)
+	sortHighlights(out)
+	return out
+}
+
+// AllHighlights returns every stored highlight ordered by bookmark and position.
+func (s *Store) AllHighlights() []instapaper.Highlight {
+	out := []instapaper.Highlight{}
+	for _, hls := range s.Highlights {
+		out = append(out, hls...)
+	}
+	sortHighlights(out)
+	return out
+}
+
+func sortHighlights(out []instapaper.Highlight) {
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].BookmarkID != out[j].BookmarkID {
+			return out[i].BookmarkID < out[j].BookmarkID
+		}
+		if out[i].Position != out[j].Position {
+			return out[i].Position < out[j].Position
+		}
+		return out[i].HighlightID < out[j].HighlightID
+	})
+}
+
+// NeedsText reports whether the cached text for a bookmark is missing or stale.
+func (s *Store) NeedsText(bookmarkID int64) bool {
+	e, ok := s.Entry(bookmarkID)
+	if !ok {
+		return false
+	}
+	if !s.HasText(bookmarkID) {
+		return true
+	}
+	return e.Bookmark.Hash != "" && e.TextHash != e.Bookmark.Hash
+}
+
+// WriteText caches the text view HTML for a bookmark.
+func (s *Store) WriteText(bookmarkID int64, html []byte) error {
+	e, ok := s.Entry(bookmarkID)
+	if !ok {
+		return fmt.Errorf("bookmark %d not in local store", bookmarkID)
+	}
+	if err := os.MkdirAll(filepath.Join(s.dir, textDirName), 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.textPath(idKey(bookmarkID)), html, 0o600); err != nil {
+		return err
+	}
+	e.TextHash = e.Bookmark.Hash
+	return nil
+}
+
+// ReadText returns the cached text view HTML for a bookmark.
+func (s *Store) ReadText(bookmarkID int64) ([]byte, error) {
+	b, err := os.ReadFile(s.textPath(idKey(bookmarkID)))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("text for bookmark %d not in local store; run: ip sync --text", bookmarkID)
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// HasText reports whether text is cached for a bookmark, stale or not.
+func (s *Store) HasText(bookmarkID int64) bool {
+	_, err := os.Stat(s.textPath(idKey(bookmarkID)))
+	return err == nil
+}
+
+func (s *Store) textPath(key string) string {
+	return filepath.Join(s.dir, textDirName, key+".html")
+}
+
+func sortEntries(entries []*Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].Bookmark, entries[j].Bookmark
+		if a.Time != b.Time {
+			return a.Time > b.Time
+		}
+		return a.BookmarkID > b.BookmarkID
+	})
+}
+
+func idKey(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
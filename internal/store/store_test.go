@@ -0,0 +1,86 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+)
+
+func TestApplyMoveBetweenFolders(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	s.Apply("unread", []instapaper.Bookmark{{BookmarkID: 1, Hash: "a"}, {BookmarkID: 2, Hash: "b"}}, nil)
+
+	// Bookmark 1 moved to archive and archive is synced first.
+	s.Apply("archive", []instapaper.Bookmark{{BookmarkID: 1, Hash: "a"}}, nil)
+	res := s.Apply("unread", nil, []instapaper.Int64{1, 2})
+	if res.Removed != 1 {
+		t.Fatalf("removed=%d want 1", res.Removed)
+	}
+	removed, err := s.Prune()
+	if err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	if removed != 1 {
+		t.Fatalf("pruned=%d want 1", removed)
+	}
+	e, ok := s.Entry(1)
+	if !ok || e.Folder != "archive" {
+		t.Fatalf("entry 1=%+v ok=%t", e, ok)
+	}
+	if _, ok := s.Entry(2); ok {
+		t.Fatalf("entry 2 should be pruned")
+	}
+}
+
+func TestSaveRoundTripAndText(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	s.SyncedAt = 1700000000
+	s.Folders = []instapaper.Folder{{FolderID: 7, Title: "Work"}}
+	s.Apply("7", []instapaper.Bookmark{{BookmarkID: 3, Hash: "h1", Starred: true, Tags: []instapaper.Tag{{Name: "go"}}}}, nil)
+	s.MergeHighlights([]instapaper.Highlight{{HighlightID: 9, BookmarkID: 3, Text: "quote"}})
+	if !s.NeedsText(3) {
+		t.Fatalf("expected text to be needed")
+	}
+	if err := s.WriteText(3, []byte("<p>hi</p>")); err != nil {
+		t.Fatalf("WriteText: %v", err)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	loaded, err := Open(dir)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	folder, err := loaded.ResolveFolder("work")
+	if err != nil || folder != "7" {
+		t.Fatalf("ResolveFolder=%q err=%v", folder, err)
+	}
+	if got := loaded.BookmarksInFolder("starred"); len(got) != 1 {
+		t.Fatalf("starred=%+v", got)
+	}
+	if got := loaded.BookmarksByTag("GO"); len(got) != 1 {
+		t.Fatalf("tagged=%+v", got)
+	}
+	if got := loaded.HighlightsFor(3); len(got) != 1 || got[0].Text != "quote" {
+		t.Fatalf("highlights=%+v", got)
+	}
+	if loaded.NeedsText(3) {
+		t.Fatalf("text should be fresh")
+	}
+	loaded.Apply("7", []instapaper.Bookmark{{BookmarkID: 3, Hash: "h2"}}, nil)
+	if !loaded.NeedsText(3) {
+		t.Fatalf("text should be stale after hash change")
+	}
+	b, err := loaded.ReadText(3)
+	if err != nil || string(b) != "<p>hi</p>" {
+		t.Fatalf("ReadText=%q err=%v", b, err)
+	}
+}
@@ -0,0 +1,205 @@
+// Package undo keeps an append-only log of bookmark mutations and the state
+// each bookmark had before, so they can be reverted later.
+package undo
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// MaxOps is the number of operations kept in the log; older ones are dropped
+// when a new one is appended.
+const MaxOps = 500
+
+// State is the part of a bookmark a mutation changed. Only the fields the
+// mutation touched are set.
+type State struct {
+	// Folder is "unread", "archive" or a user folder id.
+	Folder            string   `json:"folder,omitempty"`
+	Starred           *bool    `json:"starred,omitempty"`
+	Progress          *float64 `json:"progress,omitempty"`
+	ProgressTimestamp *int64   `json:"progress_timestamp,omitempty"`
+}
+
+// Empty reports whether no field is known.
+func (s State) Empty() bool {
+	return s.Folder == "" && s.Starred == nil && s.Progress == nil
+}
+
+// Change is one bookmark touched by an operation.
+type Change struct {
+	BookmarkID int64 `json:"bookmark_id"`
+	Before     State `json:"before"`
+	After      State `json:"after"`
+}
+
+// Op is one invocation of a mutating command.
+type Op struct {
+	ID       string   `json:"id"`
+	Time     int64    `json:"time"`
+	Command  string   `json:"command"`
+	Profile  string   `json:"profile,omitempty"`
+	Changes  []Change `json:"changes"`
+	UndoneAt int64    `json:"undone_at,omitempty"`
+}
+
+// Undone reports whether the operation has been reverted.
+func (o Op) Undone() bool { return o.UndoneAt != 0 }
+
+// record is a log line: an operation, or a marker that one was undone.
+type record struct {
+	Type string `json:"type"` // "op" or "undo"
+	Op   *Op    `json:"op,omitempty"`
+	Undo string `json:"undo,omitempty"`
+	Time int64  `json:"time,omitempty"`
+}
+
+// Log is the operation log at a path.
+type Log struct {
+	path string
+}
+
+var now = time.Now
+
+// Open returns the log stored at path. The file is created on first append.
+func Open(path string) *Log {
+	return &Log{path: path}
+}
+
+// NewID returns a short, sortable operation id.
+func NewID() string {
+	var b [2]byte
+	_, _ = rand.Read(b[:])
+	return now().UTC().Format("20060102150405") + hex.EncodeToString(b[:])
+}
+
+// Append records op, filling in its id and time when unset.
+func (l *Log) Append(op *Op) error {
+	if op.ID == "" {
+		op.ID = NewID()
+	}
+	if op.Time == 0 {
+		op.Time = now().Unix()
+	}
+	ops, err := l.Ops()
+	if err != nil {
+		return err
+	}
+	if len(ops) >= MaxOps {
+		return l.rewrite(append(ops[len(ops)-MaxOps+1:], *op))
+	}
+	return l.append(record{Type: "op", Op: op})
+}
+
+// MarkUndone records that the operation with id was reverted.
+func (l *Log) MarkUndone(id string) error {
+	return l.append(record{Type: "undo", Undo: id, Time: now().Unix()})
+}
+
+// Ops returns every operation, oldest first, with UndoneAt resolved.
+// Malformed lines are skipped.
+func (l *Log) Ops() ([]Op, error) {
+	f, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var ops []Op
+	index := map[string]int{}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for sc.Scan() {
+		var rec record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			continue
+		}
+		switch {
+		case rec.Type == "op" && rec.Op != nil:
+			index[rec.Op.ID] = len(ops)
+			ops = append(ops, *rec.Op)
+		case rec.Type == "undo":
+			if i, ok := index[rec.Undo]; ok {
+				ops[i].UndoneAt = rec.Time
+			}
+		}
+	}
+	return ops, sc.Err()
+}
+
+// Find returns the operation with id.
+func (l *Log) Find(id string) (Op, error) {
+	ops, err := l.Ops()
+	if err != nil {
+		return Op{}, err
+	}
+	for _, op := range ops {
+		if op.ID == id {
+			return op, nil
+		}
+	}
+	return Op{}, fmt.Errorf("operation not found: %s", id)
+}
+
+func (l *Log) append(rec record) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// rewrite replaces the log with ops, keeping their undo state.
+func (l *Log) rewrite(ops []Op) error {
+	var buf []byte
+	for i := range ops {
+		op := ops[i]
+		undoneAt := op.UndoneAt
+		op.UndoneAt = 0
+		lines := []record{{Type: "op", Op: &op}}
+		if undoneAt != 0 {
+			lines = append(lines, record{Type: "undo", Undo: op.ID, Time: undoneAt})
+		}
+		for _, rec := range lines {
+			b, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			buf = append(append(buf, b...), '\n')
+		}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), ".undo-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), l.path)
+}
@@ -0,0 +1,49 @@
+package undo
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestLogAppendUndoAndTrim(t *testing.T) {
+	log := Open(filepath.Join(t.TempDir(), "undo.jsonl"))
+	ops, err := log.Ops()
+	if err != nil || len(ops) != 0 {
+		t.Fatalf("empty log: %v %v", ops, err)
+	}
+	starred := false
+	first := &Op{Command: "star", Changes: []Change{{BookmarkID: 1, Before: State{Starred: &starred}}}}
+	if err := log.Append(first); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if first.ID == "" || first.Time == 0 {
+		t.Fatalf("id/time not set: %+v", first)
+	}
+	if err := log.MarkUndone(first.ID); err != nil {
+		t.Fatalf("MarkUndone: %v", err)
+	}
+	op, err := log.Find(first.ID)
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	if !op.Undone() || op.Changes[0].Before.Starred == nil || *op.Changes[0].Before.Starred {
+		t.Fatalf("unexpected op: %+v", op)
+	}
+
+	for i := 0; i < MaxOps; i++ {
+		if err := log.Append(&Op{ID: fmt.Sprintf("op%d", i), Command: "archive", Changes: []Change{{BookmarkID: int64(i), Before: State{Folder: "unread"}}}}); err != nil {
+			t.Fatalf("Append %d: %v", i, err)
+		}
+	}
+	ops, err = log.Ops()
+	if err != nil {
+		t.Fatalf("Ops: %v", err)
+	}
+	if len(ops) != MaxOps || ops[0].ID != "op0" || ops[len(ops)-1].ID != fmt.Sprintf("op%d", MaxOps-1) {
+		t.Fatalf("log not trimmed: %d ops, first %s", len(ops), ops[0].ID)
+	}
+	if _, err := log.Find(first.ID); err == nil {
+		t.Fatalf("oldest op should have been dropped")
+	}
+}
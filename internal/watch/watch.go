@@ -0,0 +1,98 @@
+// Package watch turns successive incremental list results into change
+// events. Each folder poll is compared with what the caller knew about the
+// folder before it (the list cursor's have map); a bookmark leaving one
+// watched folder and arriving in another during the same poll is a move.
+package watch
+
+import (
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+)
+
+// Event kinds.
+const (
+	Added           = "added"
+	Deleted         = "deleted"
+	ProgressChanged = "progress_changed"
+	StarredChanged  = "starred_changed"
+	Moved           = "moved"
+)
+
+// Kinds lists every event kind.
+var Kinds = []string{Added, Deleted, Moved, ProgressChanged, StarredChanged}
+
+// Entry is the last known state of a bookmark in a folder.
+type Entry struct {
+	Progress          float64
+	ProgressTimestamp int64
+	Starred           bool
+}
+
+// Poll is the result of listing one folder with a have parameter built from
+// Known: the bookmarks that are new or changed, and the known ids that are
+// no longer in the folder.
+type Poll struct {
+	Folder    string
+	Known     map[int64]Entry
+	Bookmarks []instapaper.Bookmark
+	DeleteIDs []int64
+}
+
+// Event is one change. From and To carry the old and new value for
+// progress_changed and starred_changed, and the source and destination
+// folder for moved (Folder is then the destination).
+type Event struct {
+	Event      string               `json:"event"`
+	Time       int64                `json:"time"`
+	Folder     string               `json:"folder"`
+	BookmarkID int64                `json:"bookmark_id"`
+	From       any                  `json:"from,omitempty"`
+	To         any                  `json:"to,omitempty"`
+	Bookmark   *instapaper.Bookmark `json:"bookmark,omitempty"`
+}
+
+// Diff returns the events for one round of polls, stamped with at, in poll
+// order. A bookmark deleted from one poll's folder and added to another's
+// is reported once, as moved, where it was added.
+func Diff(at int64, polls []Poll) []Event {
+	deletedFrom := map[int64]string{}
+	for _, p := range polls {
+		for _, id := range p.DeleteIDs {
+			if _, ok := deletedFrom[id]; !ok {
+				deletedFrom[id] = p.Folder
+			}
+		}
+	}
+	moved := map[int64]bool{}
+	var events []Event
+	for _, p := range polls {
+		for i := range p.Bookmarks {
+			b := &p.Bookmarks[i]
+			id := int64(b.BookmarkID)
+			prev, known := p.Known[id]
+			if !known {
+				if from, ok := deletedFrom[id]; ok && from != p.Folder && !moved[id] {
+					moved[id] = true
+					events = append(events, Event{Event: Moved, Time: at, Folder: p.Folder, BookmarkID: id, From: from, To: p.Folder, Bookmark: b})
+					continue
+				}
+				events = append(events, Event{Event: Added, Time: at, Folder: p.Folder, BookmarkID: id, Bookmark: b})
+				continue
+			}
+			if float64(b.Progress) != prev.Progress {
+				events = append(events, Event{Event: ProgressChanged, Time: at, Folder: p.Folder, BookmarkID: id, From: prev.Progress, To: float64(b.Progress), Bookmark: b})
+			}
+			if bool(b.Starred) != prev.Starred {
+				events = append(events, Event{Event: StarredChanged, Time: at, Folder: p.Folder, BookmarkID: id, From: prev.Starred, To: bool(b.Starred), Bookmark: b})
+			}
+		}
+	}
+	for _, p := range polls {
+		for _, id := range p.DeleteIDs {
+			if moved[id] && deletedFrom[id] == p.Folder {
+				continue
+			}
+			events = append(events, Event{Event: Deleted, Time: at, Folder: p.Folder, BookmarkID: id})
+		}
+	}
+	return events
+}
@@ -0,0 +1,67 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+)
+
+func TestDiff(t *testing.T) {
+	polls := []Poll{
+		{
+			Folder: "unread",
+			Known: map[int64]Entry{
+				1: {Progress: 0.1},
+				2: {},
+				3: {},
+				4: {},
+			},
+			Bookmarks: []instapaper.Bookmark{
+				{BookmarkID: 1, Progress: 0.6, Starred: true},
+				{BookmarkID: 5, Title: "new"},
+			},
+			DeleteIDs: []int64{2, 3},
+		},
+		{
+			Folder:    "archive",
+			Known:     map[int64]Entry{},
+			Bookmarks: []instapaper.Bookmark{{BookmarkID: 3}},
+		},
+	}
+	events := Diff(100, polls)
+	want := []struct {
+		event  string
+		folder string
+		id     int64
+	}{
+		{ProgressChanged, "unread", 1},
+		{StarredChanged, "unread", 1},
+		{Added, "unread", 5},
+		{Moved, "archive", 3},
+		{Deleted, "unread", 2},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events: %+v", len(events), events)
+	}
+	for i, w := range want {
+		e := events[i]
+		if e.Event != w.event || e.Folder != w.folder || e.BookmarkID != w.id || e.Time != 100 {
+			t.Fatalf("event %d: got %+v want %+v", i, e, w)
+		}
+	}
+	if events[0].From != 0.1 || events[0].To != 0.6 {
+		t.Fatalf("progress from/to: %+v", events[0])
+	}
+	if events[1].From != false || events[1].To != true {
+		t.Fatalf("starred from/to: %+v", events[1])
+	}
+	if events[3].From != "unread" || events[3].To != "archive" || events[3].Bookmark == nil {
+		t.Fatalf("moved: %+v", events[3])
+	}
+	if events[4].Bookmark != nil {
+		t.Fatalf("deleted events carry no bookmark: %+v", events[4])
+	}
+	if got := Diff(100, []Poll{{Folder: "unread", Known: map[int64]Entry{1: {Progress: 0.5}}, Bookmarks: []instapaper.Bookmark{{BookmarkID: 1, Progress: 0.5, Title: "renamed"}}}}); len(got) != 0 {
+		t.Fatalf("unwatched field changes should not emit events: %+v", got)
+	}
+}
@@ -0,0 +1,159 @@
+// Package webhook posts JSON payloads to HTTP endpoints, optionally signed
+// with HMAC-SHA256, retrying transient failures under an
+// instapaper.RetryPolicy.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+)
+
+// Request headers set on every delivery.
+const (
+	EventHeader     = "X-Instapaper-Event"
+	DeliveryHeader  = "X-Instapaper-Delivery"
+	SignatureHeader = "X-Instapaper-Signature"
+)
+
+// Sign returns the signature header value for body: "sha256=" followed by
+// the hex HMAC-SHA256 of body keyed with secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is a valid Sign value for body.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// Target is one endpoint.
+type Target struct {
+	URL     string
+	Secret  string
+	Headers map[string]string
+}
+
+// Delivery is one payload for a target.
+type Delivery struct {
+	ID    string
+	Event string
+	Body  []byte
+}
+
+// Result describes how a delivery went.
+type Result struct {
+	Attempts int `json:"attempts"`
+	Status   int `json:"status,omitempty"`
+}
+
+// Sender delivers payloads.
+type Sender struct {
+	Client    *http.Client
+	Retry     instapaper.RetryPolicy
+	UserAgent string
+	// Sleep waits between attempts; nil waits on a timer that stops early
+	// when ctx is done.
+	Sleep func(ctx context.Context, d time.Duration) error
+}
+
+// Send posts d to t. Network errors, 429 and 5xx responses are retried as
+// the policy allows; any other non-2xx response fails at once.
+func (s *Sender) Send(ctx context.Context, t Target, d Delivery) (Result, error) {
+	var res Result
+	start := time.Now()
+	for {
+		res.Attempts++
+		status, headers, err := s.post(ctx, t, d)
+		res.Status = status
+		if err == nil && status >= 200 && status < 300 {
+			return res, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("HTTP %d", status)
+		}
+		class := retryClass(ctx, status, err)
+		if class == "" || !s.Retry.Allows(class) || res.Attempts >= s.Retry.MaxAttempts {
+			return res, err
+		}
+		delay, ok := s.Retry.Delay(res.Attempts, headers)
+		if !ok || (s.Retry.MaxElapsed > 0 && time.Since(start)+delay > s.Retry.MaxElapsed) {
+			return res, err
+		}
+		if serr := s.sleep(ctx, delay); serr != nil {
+			return res, err
+		}
+	}
+}
+
+func (s *Sender) post(ctx context.Context, t Target, d Delivery) (int, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(d.Body))
+	if err != nil {
+		return 0, nil, err
+	}
+	for k, v := range t.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.UserAgent != "" {
+		req.Header.Set("User-Agent", s.UserAgent)
+	}
+	req.Header.Set(EventHeader, d.Event)
+	req.Header.Set(DeliveryHeader, d.ID)
+	if t.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(t.Secret, d.Body))
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	return resp.StatusCode, resp.Header, nil
+}
+
+// retryClass maps a failed attempt to an instapaper retry class, or "" when
+// it must not be retried.
+func retryClass(ctx context.Context, status int, err error) string {
+	switch {
+	case status == 0 && err != nil:
+		if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+			return ""
+		}
+		return instapaper.RetryNetwork
+	case status == http.StatusTooManyRequests:
+		return instapaper.RetryRateLimit
+	case status >= 500:
+		return instapaper.RetryServer
+	}
+	return ""
+}
+
+func (s *Sender) sleep(ctx context.Context, d time.Duration) error {
+	if s.Sleep != nil {
+		return s.Sleep(ctx, d)
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,65 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vburojevic/instapaper-cli/internal/instapaper"
+)
+
+func noSleep(context.Context, time.Duration) error { return nil }
+
+func TestSendSignsAndRetries(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !Verify("s3cret", body, r.Header.Get(SignatureHeader)) {
+			t.Errorf("bad signature %q", r.Header.Get(SignatureHeader))
+		}
+		if r.Header.Get(EventHeader) != "added" || r.Header.Get(DeliveryHeader) != "d1" || r.Header.Get("X-Team") != "reading" {
+			t.Errorf("headers: %v", r.Header)
+		}
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	s := &Sender{Retry: instapaper.RetryPolicy{MaxAttempts: 3}, Sleep: noSleep}
+	target := Target{URL: srv.URL, Secret: "s3cret", Headers: map[string]string{"X-Team": "reading"}}
+	res, err := s.Send(context.Background(), target, Delivery{ID: "d1", Event: "added", Body: []byte(`{"event":"added"}`)})
+	if err != nil || res.Attempts != 3 || res.Status != http.StatusNoContent {
+		t.Fatalf("Send: res=%+v err=%v", res, err)
+	}
+
+	calls.Store(0)
+	s.Retry.MaxAttempts = 2
+	res, err = s.Send(context.Background(), target, Delivery{ID: "d1", Event: "added", Body: []byte(`{}`)})
+	if err == nil || res.Attempts != 2 || res.Status != http.StatusServiceUnavailable {
+		t.Fatalf("expected failure after 2 attempts: res=%+v err=%v", res, err)
+	}
+}
+
+func TestSendClientErrorIsNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	s := &Sender{Retry: instapaper.RetryPolicy{MaxAttempts: 5}, Sleep: noSleep}
+	res, err := s.Send(context.Background(), Target{URL: srv.URL}, Delivery{ID: "d", Event: "deleted", Body: []byte(`{}`)})
+	if err == nil || res.Attempts != 1 || calls.Load() != 1 {
+		t.Fatalf("400 should fail once: res=%+v err=%v calls=%d", res, err, calls.Load())
+	}
+	if Verify("k", []byte("a"), Sign("k", []byte("b"))) {
+		t.Fatalf("Verify accepted a signature for another body")
+	}
+}